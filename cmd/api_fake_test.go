@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+)
+
+// fakeAPI 内存中的飞书后端，用于测试批量和wiki下载的编排逻辑
+type fakeAPI struct {
+	mu          sync.Mutex
+	docs        map[string]string // docx token -> title
+	revisions   map[string]int64
+	attachments map[string][]*lark.DocxBlockFile // docx token -> file blocks
+	images      map[string][]string              // docx token -> image tokens
+	covers      map[string]string                // docx token -> cover image token
+	boards      map[string][]core.Board          // docx token -> board blocks
+	failBoards  map[string]bool                  // board token -> image download fails
+	failCovers  map[string]bool
+	links       map[string][]string          // docx token -> urls linked from its text
+	driveFiles  map[string]string            // uploaded file token -> content
+	sheets      map[string]*core.Spreadsheet // sheet or bitable token -> content
+	failDocs    map[string]bool
+	wikiName    string
+	spaces      []*lark.GetWikiSpaceListRespItem
+	wikiNodes   map[string][]*core.WikiNode // parent node token ("" for root) -> children
+	folderNames map[string]string
+	folders     map[string][]*lark.GetDriveFileListRespFile
+	members     []core.WikiSpaceMember
+	collabs     map[string][]*lark.GetDriveMemberPermissionListRespMember // obj token -> collaborators
+	public      map[string]*lark.GetDrivePublicPermissionRespPermissionPublic
+	userNames   map[string]string // open id -> name, nil when the contact scope is missing
+	calls       map[string]int
+}
+
+var _ core.API = (*fakeAPI)(nil)
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{
+		docs:        make(map[string]string),
+		revisions:   make(map[string]int64),
+		attachments: make(map[string][]*lark.DocxBlockFile),
+		images:      make(map[string][]string),
+		covers:      make(map[string]string),
+		boards:      make(map[string][]core.Board),
+		failBoards:  make(map[string]bool),
+		failCovers:  make(map[string]bool),
+		links:       make(map[string][]string),
+		driveFiles:  make(map[string]string),
+		sheets:      make(map[string]*core.Spreadsheet),
+		failDocs:    make(map[string]bool),
+		wikiNodes:   make(map[string][]*core.WikiNode),
+		folderNames: make(map[string]string),
+		folders:     make(map[string][]*lark.GetDriveFileListRespFile),
+		collabs:     make(map[string][]*lark.GetDriveMemberPermissionListRespMember),
+		public:      make(map[string]*lark.GetDrivePublicPermissionRespPermissionPublic),
+		calls:       make(map[string]int),
+	}
+}
+
+// newFakeWiki 名为 "Space" 的知识空间，节点由 addNode 和 addDoc 逐层添加
+func newFakeWiki() *fakeAPI {
+	f := newFakeAPI()
+	f.wikiName = "Space"
+	return f
+}
+
+// addNode 在父节点parent（根为空）下添加节点，同时设置父节点的 HasChild，
+// docx 节点登记文档标题。返回的节点可以继续设置其他字段
+func (f *fakeAPI) addNode(parent, nodeToken, objType, objToken, title string) *core.WikiNode {
+	node := &core.WikiNode{GetWikiNodeListRespItem: lark.GetWikiNodeListRespItem{
+		NodeToken: nodeToken, ObjToken: objToken, ObjType: objType, Title: title,
+	}}
+	for _, nodes := range f.wikiNodes {
+		for _, n := range nodes {
+			if parent != "" && n.NodeToken == parent {
+				n.HasChild = true
+			}
+		}
+	}
+	f.wikiNodes[parent] = append(f.wikiNodes[parent], node)
+	if objType == "docx" {
+		f.docs[objToken] = title
+	}
+	return node
+}
+
+// addDoc 添加标题为name的docx节点，节点和文档token分别为 wik 和 doc 加上name
+func (f *fakeAPI) addDoc(parent, name string) *core.WikiNode {
+	return f.addNode(parent, "wik"+name, "docx", "doc"+name, name)
+}
+
+func (f *fakeAPI) called(method string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[method]++
+}
+
+func (f *fakeAPI) callCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+func (f *fakeAPI) GetDocxDocument(ctx context.Context, docToken string) (*lark.DocxDocument, error) {
+	f.called("GetDocxDocument")
+	title, ok := f.docs[docToken]
+	if !ok {
+		return nil, lark.NewError("Drive", "GetDocxDocument", 1770002, "not found")
+	}
+	if f.failDocs[docToken] {
+		return nil, fmt.Errorf("document %s failed", docToken)
+	}
+	return &lark.DocxDocument{DocumentID: docToken, RevisionID: f.revisions[docToken], Title: title}, nil
+}
+
+func (f *fakeAPI) GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error) {
+	f.called("GetDocxContent")
+	title, ok := f.docs[docToken]
+	if !ok || f.failDocs[docToken] {
+		return nil, nil, fmt.Errorf("document %s not found", docToken)
+	}
+	textBlockID := docToken + "_text"
+	elements := []*lark.DocxTextElement{
+		{TextRun: &lark.DocxTextElementTextRun{Content: "content of " + title}},
+	}
+	for _, url := range f.links[docToken] {
+		elements = append(elements, &lark.DocxTextElement{TextRun: &lark.DocxTextElementTextRun{
+			Content:          " link",
+			TextElementStyle: &lark.DocxTextElementStyle{Link: &lark.DocxTextElementStyleLink{URL: url}},
+		}})
+	}
+	children := []string{textBlockID}
+	var fileBlocks []*lark.DocxBlock
+	for _, file := range f.attachments[docToken] {
+		viewID := file.Token + "_view"
+		children = append(children, viewID)
+		fileBlocks = append(fileBlocks,
+			&lark.DocxBlock{BlockID: viewID, BlockType: lark.DocxBlockTypeView, ParentID: docToken,
+				Children: []string{file.Token + "_file"}, View: &lark.DocxBlockView{}},
+			&lark.DocxBlock{BlockID: file.Token + "_file", BlockType: lark.DocxBlockTypeFile, ParentID: viewID,
+				File: file},
+		)
+	}
+	for i, imgToken := range f.images[docToken] {
+		imageID := fmt.Sprintf("%s_image%d", docToken, i)
+		children = append(children, imageID)
+		fileBlocks = append(fileBlocks, &lark.DocxBlock{BlockID: imageID, BlockType: lark.DocxBlockTypeImage,
+			ParentID: docToken, Image: &lark.DocxBlockImage{Token: imgToken, Width: 10, Height: 10}})
+	}
+	for i := range f.boards[docToken] {
+		boardID := fmt.Sprintf("%s_board%d", docToken, i)
+		children = append(children, boardID)
+		fileBlocks = append(fileBlocks, &lark.DocxBlock{BlockID: boardID, BlockType: core.DocxBlockTypeBoard,
+			ParentID: docToken})
+	}
+	return &lark.DocxDocument{DocumentID: docToken, RevisionID: f.revisions[docToken], Title: title}, append([]*lark.DocxBlock{
+		{
+			BlockID:   docToken,
+			BlockType: lark.DocxBlockTypePage,
+			Children:  children,
+			Page: &lark.DocxBlockText{Elements: []*lark.DocxTextElement{
+				{TextRun: &lark.DocxTextElementTextRun{Content: title}},
+			}},
+		},
+		{
+			BlockID:   textBlockID,
+			BlockType: lark.DocxBlockTypeText,
+			ParentID:  docToken,
+			Text:      &lark.DocxBlockText{Elements: elements},
+		},
+	}, fileBlocks...), nil
+}
+
+func (f *fakeAPI) GetDocxCover(ctx context.Context, docToken string) (string, error) {
+	f.called("GetDocxCover")
+	if f.failCovers[docToken] {
+		return "", fmt.Errorf("cover of %s not found", docToken)
+	}
+	return f.covers[docToken], nil
+}
+
+func (f *fakeAPI) GetDocxListSequences(ctx context.Context, documentID string) (map[string]string, error) {
+	f.called("GetDocxListSequences")
+	return nil, nil
+}
+
+func (f *fakeAPI) GetDocxBoards(ctx context.Context, documentID string) (map[string]core.Board, error) {
+	f.called("GetDocxBoards")
+	boards := make(map[string]core.Board)
+	for i, board := range f.boards[documentID] {
+		boards[fmt.Sprintf("%s_board%d", documentID, i)] = board
+	}
+	return boards, nil
+}
+
+func (f *fakeAPI) GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWikiNodeRespNode, error) {
+	f.called("GetWikiNodeInfo")
+	for _, nodes := range f.wikiNodes {
+		for _, n := range nodes {
+			if n.NodeToken == token {
+				return &lark.GetWikiNodeRespNode{
+					SpaceID:   n.SpaceID,
+					NodeToken: n.NodeToken,
+					ObjToken:  n.ObjToken,
+					ObjType:   n.ObjType,
+					Title:     n.Title,
+					HasChild:  n.HasChild,
+				}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("wiki node %s not found", token)
+}
+
+func (f *fakeAPI) GetWikiNodeByObj(ctx context.Context, objToken, objType string) (*lark.GetWikiNodeRespNode, error) {
+	f.called("GetWikiNodeByObj")
+	for _, nodes := range f.wikiNodes {
+		for _, n := range nodes {
+			if n.ObjToken == objToken && n.ObjType == objType {
+				return &lark.GetWikiNodeRespNode{SpaceID: n.SpaceID, NodeToken: n.NodeToken,
+					ObjToken: n.ObjToken, ObjType: n.ObjType, Title: n.Title}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no wiki node hosts %s %s", objType, objToken)
+}
+
+func (f *fakeAPI) GetWikiName(ctx context.Context, spaceID string) (string, error) {
+	f.called("GetWikiName")
+	return f.wikiName, nil
+}
+
+func (f *fakeAPI) GetWikiNodeList(ctx context.Context, spaceID string, parentNodeToken *string) ([]*core.WikiNode, error) {
+	f.called("GetWikiNodeList")
+	parent := ""
+	if parentNodeToken != nil {
+		parent = *parentNodeToken
+	}
+	return f.wikiNodes[parent], nil
+}
+
+func (f *fakeAPI) GetWikiSpace(ctx context.Context, spaceID string) (*lark.GetWikiSpaceRespSpace, error) {
+	f.called("GetWikiSpace")
+	return &lark.GetWikiSpaceRespSpace{SpaceID: spaceID, Name: f.wikiName}, nil
+}
+
+func (f *fakeAPI) GetWikiSpaceList(ctx context.Context) ([]*lark.GetWikiSpaceListRespItem, error) {
+	f.called("GetWikiSpaceList")
+	return f.spaces, nil
+}
+
+func (f *fakeAPI) GetWikiSpaceMembers(ctx context.Context, spaceID string) ([]core.WikiSpaceMember, error) {
+	f.called("GetWikiSpaceMembers")
+	return f.members, nil
+}
+
+func (f *fakeAPI) GetDriveFolderFileList(ctx context.Context, pageToken *string, folderToken *string) ([]*lark.GetDriveFileListRespFile, error) {
+	f.called("GetDriveFolderFileList")
+	return f.folders[*folderToken], nil
+}
+
+func (f *fakeAPI) GetDriveFolderName(ctx context.Context, folderToken string) (string, error) {
+	f.called("GetDriveFolderName")
+	return f.folderNames[folderToken], nil
+}
+
+func (f *fakeAPI) GetDocCollaborators(ctx context.Context, token, objType string) ([]*lark.GetDriveMemberPermissionListRespMember, error) {
+	f.called("GetDocCollaborators")
+	return f.collabs[token], nil
+}
+
+func (f *fakeAPI) GetDocPublicPermission(ctx context.Context, token, objType string) (*lark.GetDrivePublicPermissionRespPermissionPublic, error) {
+	f.called("GetDocPublicPermission")
+	return f.public[token], nil
+}
+
+func (f *fakeAPI) DownloadImage(ctx context.Context, imgToken, outDir string) (string, error) {
+	f.called("DownloadImage")
+	filename := filepath.Join(outDir, imgToken+".png")
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return imgToken, err
+	}
+	return filename, os.WriteFile(filename, []byte(imgToken), 0o644)
+}
+
+func (f *fakeAPI) DownloadBoardImage(ctx context.Context, boardToken, dir string) (string, error) {
+	f.called("DownloadBoardImage")
+	if f.failBoards[boardToken] {
+		return boardToken, fmt.Errorf("board %s not found", boardToken)
+	}
+	filename := filepath.Join(dir, boardToken+".png")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return boardToken, err
+	}
+	return filename, os.WriteFile(filename, []byte(boardToken), 0o644)
+}
+
+func (f *fakeAPI) DownloadAttachment(ctx context.Context, fileToken, dir string, namer core.AttachmentNamer) (string, error) {
+	f.called("DownloadAttachment")
+	name := fileToken
+	for _, files := range f.attachments {
+		for _, file := range files {
+			if file.Token == fileToken {
+				name = file.Name
+			}
+		}
+	}
+	if namer != nil {
+		name = namer(name, fileToken)
+	} else {
+		name = core.AttachmentName(name, fileToken, 0)
+	}
+	filename := filepath.Join(dir, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fileToken, err
+	}
+	return filename, os.WriteFile(filename, []byte(fileToken), 0o644)
+}
+
+func (f *fakeAPI) DownloadDriveFile(ctx context.Context, fileToken, path string, maxBytes int64) (int64, error) {
+	f.called("DownloadDriveFile")
+	content, ok := f.driveFiles[fileToken]
+	if !ok {
+		return 0, fmt.Errorf("file %s not found", fileToken)
+	}
+	if maxBytes > 0 && int64(len(content)) > maxBytes {
+		return int64(len(content)), core.ErrFileTooLarge
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	return int64(len(content)), os.WriteFile(path, []byte(content), 0o644)
+}
+
+func (f *fakeAPI) DownloadImageRaw(ctx context.Context, imgToken, imgDir string) (string, []byte, error) {
+	f.called("DownloadImageRaw")
+	return filepath.Join(imgDir, imgToken+".png"), []byte(imgToken), nil
+}
+
+func (f *fakeAPI) GetSheetContent(ctx context.Context, sheetToken string) (*core.Spreadsheet, error) {
+	f.called("GetSheetContent")
+	if sheet, ok := f.sheets[sheetToken]; ok {
+		return sheet, nil
+	}
+	return nil, fmt.Errorf("sheet %s not found", sheetToken)
+}
+
+func (f *fakeAPI) GetBitableRecords(ctx context.Context, appToken string) (*core.Spreadsheet, error) {
+	f.called("GetBitableRecords")
+	if sheet, ok := f.sheets[appToken]; ok {
+		return sheet, nil
+	}
+	return nil, fmt.Errorf("bitable %s not found", appToken)
+}
+
+func (f *fakeAPI) GetUserName(ctx context.Context, openID string) (string, error) {
+	f.called("GetUserName")
+	if f.userNames == nil {
+		return "", lark.NewError("Contact", "GetUser", 99991672, "access denied, contact scope required")
+	}
+	return f.userNames[openID], nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadBoards(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	drawio := `<mxfile><diagram name="flow"></diagram></mxfile>`
+	api := newFakeAPI()
+	api.docs = map[string]string{"docA": "A"}
+	api.boards["docA"] = []core.Board{
+		{Token: "brdFlow", DrawIO: drawio},
+		{Token: "brdSketch"},
+		{Token: "brdBroken"},
+	}
+	api.failBoards["brdBroken"] = true
+
+	url := "https://domain.feishu.cn/docx/docA"
+	doc, err := fetchDocument(context.Background(), api, url, &dlOpts)
+	if !assert.NoError(t, err) || !assert.NoError(t, writeDocument(context.Background(), api, doc, &dlOpts)) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "A.md"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	md := string(data)
+
+	// 画板导出为图片，带有 draw.io 源数据时另存 .drawio 文件并在注释中注明
+	imageDir := filepath.Join(outputDir, "static")
+	assert.Contains(t, md, "static/brdFlow.png)")
+	assert.Contains(t, md, "<!-- editable draw.io source: "+filepath.Join(imageDir, "brdFlow.drawio")+" -->")
+	assert.Contains(t, md, "static/brdSketch.png)")
+	saved, err := os.ReadFile(filepath.Join(imageDir, "brdFlow.drawio"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, drawio, string(saved))
+	}
+	_, err = os.Stat(filepath.Join(imageDir, "brdSketch.drawio"))
+	assert.True(t, os.IsNotExist(err))
+
+	// 下载失败的画板只告警，不留下指向token的图片
+	assert.NotContains(t, md, "brdBroken")
+
+	// 下载结果中记录哪些画板带有可编辑的源文件
+	result := documentResult(url, doc, nil, &dlOpts)
+	assert.Equal(t, []BoardExport{
+		{Token: "brdFlow", Image: filepath.Join(imageDir, "brdFlow.png"), DrawIO: filepath.Join(imageDir, "brdFlow.drawio")},
+		{Token: "brdSketch", Image: filepath.Join(imageDir, "brdSketch.png")},
+	}, result.Boards)
+
+	// 没有画板的文档不请求画板数据
+	api.docs["docB"] = "B"
+	assert.NoError(t, downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/docB", &dlOpts))
+	assert.Equal(t, 1, api.callCount("GetDocxBoards"))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/pkg/errors"
+)
+
+// handleCacheCommand 查看或清空本地缓存
+func handleCacheCommand(action string) error {
+	configPath, err := core.GetConfigFilePath()
+	if err != nil {
+		return err
+	}
+	config, err := core.ReadConfigFromFile(configPath)
+	if err != nil {
+		return err
+	}
+	cache, err := config.Cache.Open()
+	if err != nil {
+		return err
+	}
+	if cache == nil {
+		return errors.New("cache is disabled, set cache.dir in the config file to enable it")
+	}
+
+	switch action {
+	case "stats":
+		stats, err := cache.Stats()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Cache directory:", stats.Dir)
+		fmt.Println("Documents:      ", stats.DocxEntries)
+		fmt.Println("Media files:    ", stats.MediaEntries)
+		fmt.Printf("Total size:      %.2f MB\n", float64(stats.Size)/(1<<20))
+	case "clear":
+		if err := cache.Clear(); err != nil {
+			return err
+		}
+		fmt.Println("Cleared the cache in", cache.Dir())
+	default:
+		return errors.Errorf("unknown cache action %q, expect \"stats\" or \"clear\"", action)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// changesFileName 存在上一次的清单时，在输出目录生成的变更记录
+const changesFileName = "CHANGES.md"
+
+// ManifestChange 两次清单之间一个文档的变化
+type ManifestChange struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+	// 移动的同时内容也有修改
+	ContentChanged bool `json:"content_changed,omitempty"`
+}
+
+// ManifestDiff 按类型分组的变化，修改以内容哈希为准，只增加版本号不算修改
+type ManifestDiff struct {
+	Added   []ManifestChange `json:"added"`
+	Changed []ManifestChange `json:"changed"`
+	Moved   []ManifestChange `json:"moved"`
+	Removed []ManifestChange `json:"removed"`
+}
+
+func (d *ManifestDiff) Empty() bool {
+	return len(d.Added)+len(d.Changed)+len(d.Moved)+len(d.Removed) == 0
+}
+
+func changeOf(entry *ManifestEntry) ManifestChange {
+	return ManifestChange{Title: entry.Title, URL: entry.URL, Path: entry.Path}
+}
+
+func diffManifests(old, new *Manifest) *ManifestDiff {
+	diff := &ManifestDiff{
+		Added:   []ManifestChange{},
+		Changed: []ManifestChange{},
+		Moved:   []ManifestChange{},
+		Removed: []ManifestChange{},
+	}
+	var current []*ManifestEntry
+	for _, entry := range new.Documents {
+		current = append(current, entry)
+	}
+	for _, entry := range sortedEntries(current) {
+		prev, ok := old.Documents[entry.Token]
+		change := changeOf(entry)
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, change)
+		case prev.Path != entry.Path:
+			change.OldPath = prev.Path
+			change.ContentChanged = prev.ContentHash != entry.ContentHash
+			diff.Moved = append(diff.Moved, change)
+		case prev.ContentHash != entry.ContentHash:
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	var removed []*ManifestEntry
+	for token, entry := range old.Documents {
+		if _, ok := new.Documents[token]; !ok {
+			removed = append(removed, entry)
+		}
+	}
+	for _, entry := range sortedEntries(removed) {
+		diff.Removed = append(diff.Removed, changeOf(entry))
+	}
+	return diff
+}
+
+// localLink 使用尖括号包裹本地路径，兼容包含空格的文件名
+func localLink(title, path string) string {
+	return fmt.Sprintf("[%s](<%s>)", title, path)
+}
+
+// renderChanges 渲染分组的变更记录，本地文件链接相对于清单所在目录
+func renderChanges(diff *ManifestDiff, generatedAt time.Time) string {
+	sb := new(strings.Builder)
+	sb.WriteString("# 变更记录\n\n")
+	sb.WriteString(fmt.Sprintf("> 生成时间: %s\n\n", dlConfig.Output.FormatTime(generatedAt)))
+	if diff.Empty() {
+		sb.WriteString("本次同步没有文档变化。\n")
+		return sb.String()
+	}
+	section := func(name string, changes []ManifestChange, render func(c ManifestChange) string) {
+		if len(changes) == 0 {
+			return
+		}
+		sb.WriteString(fmt.Sprintf("## %s (%d)\n\n", name, len(changes)))
+		for _, c := range changes {
+			sb.WriteString("- " + render(c) + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	section("新增", diff.Added, func(c ManifestChange) string {
+		return fmt.Sprintf("%s · [原文](%s)", localLink(c.Title, c.Path), c.URL)
+	})
+	section("修改", diff.Changed, func(c ManifestChange) string {
+		return fmt.Sprintf("%s · [原文](%s)", localLink(c.Title, c.Path), c.URL)
+	})
+	section("移动", diff.Moved, func(c ManifestChange) string {
+		line := fmt.Sprintf("%s ← `%s` · [原文](%s)", localLink(c.Title, c.Path), c.OldPath, c.URL)
+		if c.ContentChanged {
+			line += "（内容已修改）"
+		}
+		return line
+	})
+	section("删除", diff.Removed, func(c ManifestChange) string {
+		return fmt.Sprintf("%s `%s` · [原文](%s)", c.Title, c.Path, c.URL)
+	})
+	return sb.String()
+}
+
+// handleChangesCommand 比较两个清单文件并输出变更记录
+func handleChangesCommand(oldPath, newPath string, asJSON bool) error {
+	old, err := readManifest(oldPath)
+	if err != nil {
+		return err
+	}
+	new, err := readManifest(newPath)
+	if err != nil {
+		return err
+	}
+	diff := diffManifests(old, new)
+	if asJSON {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Print(renderChanges(diff, new.GeneratedAt))
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffManifests(t *testing.T) {
+	entry := func(token, path, hash string, revision int64) *ManifestEntry {
+		return &ManifestEntry{Token: token, Title: token, URL: "https://domain.feishu.cn/wiki/" + token,
+			Path: path, ContentHash: hash, RevisionID: revision}
+	}
+	old := &Manifest{Documents: map[string]*ManifestEntry{
+		"same":    entry("same", "a/same.md", "h1", 1),
+		"noop":    entry("noop", "a/noop.md", "h2", 1),
+		"edited":  entry("edited", "a/edited.md", "h3", 1),
+		"moved":   entry("moved", "a/moved.md", "h4", 1),
+		"removed": entry("removed", "a/removed.md", "h5", 1),
+	}}
+	new := &Manifest{Documents: map[string]*ManifestEntry{
+		"same":   entry("same", "a/same.md", "h1", 1),
+		"noop":   entry("noop", "a/noop.md", "h2", 2),
+		"edited": entry("edited", "a/edited.md", "h3x", 2),
+		"moved":  entry("moved", "b/moved.md", "h4", 1),
+		"added":  entry("added", "b/added.md", "h6", 1),
+	}}
+
+	diff := diffManifests(old, new)
+	// 只增加版本号而内容不变的文档不算修改
+	assert.Equal(t, []ManifestChange{changeOf(new.Documents["added"])}, diff.Added)
+	assert.Equal(t, []ManifestChange{changeOf(new.Documents["edited"])}, diff.Changed)
+	if assert.Len(t, diff.Moved, 1) {
+		assert.Equal(t, "a/moved.md", diff.Moved[0].OldPath)
+		assert.False(t, diff.Moved[0].ContentChanged)
+	}
+	assert.Equal(t, []ManifestChange{changeOf(old.Documents["removed"])}, diff.Removed)
+
+	md := renderChanges(diff, new.GeneratedAt)
+	assert.Contains(t, md, "## 新增 (1)\n\n- [added](<b/added.md>) · [原文](https://domain.feishu.cn/wiki/added)")
+	assert.Contains(t, md, "- [moved](<b/moved.md>) ← `a/moved.md`")
+	assert.Contains(t, md, "## 删除 (1)")
+	assert.NotContains(t, md, "noop")
+}
+
+func TestDownloadWikiWritesChanges(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addDoc("", "B")
+	run := func() {
+		runManifest = newManifestRecorder(outputDir)
+		report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+		if assert.NoError(t, err) {
+			assert.NoError(t, runManifest.write(report))
+		}
+	}
+
+	// 首次下载只生成清单
+	run()
+	manifest, err := readManifest(filepath.Join(outputDir, manifestFileName))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Space/A.md", manifest.Documents["docA"].Path)
+	}
+	_, err = os.Stat(filepath.Join(outputDir, changesFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	// 下载失败的文档沿用上一次的记录，不会被报告为删除
+	api.failDocs["docB"] = true
+	api.addDoc("", "C")
+	run()
+	data, err := os.ReadFile(filepath.Join(outputDir, changesFileName))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "## 新增 (1)")
+		assert.Contains(t, string(data), "[C](<Space/C.md>)")
+		assert.NotContains(t, string(data), "删除")
+	}
+}
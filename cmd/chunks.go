@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// ChunkRecord 分块导出时JSONL文件中的一行，供RAG等流水线直接导入
+type ChunkRecord struct {
+	Title       string   `json:"title"`
+	DocumentID  string   `json:"document_id"`
+	Index       int      `json:"index"`
+	HeadingPath []string `json:"heading_path"`
+	Text        string   `json:"text"`
+	URL         string   `json:"url"`
+	Tokens      int      `json:"tokens"`
+}
+
+// chunkCollector 汇总所有文档的分块写入同一个文件，为nil时每个文档单独输出
+type chunkCollector struct {
+	mu      sync.Mutex
+	records []ChunkRecord
+}
+
+var runChunks *chunkCollector
+
+const combinedChunksFile = "chunks.jsonl"
+
+func validateChunkOpts(opts *DownloadOpts) error {
+	if opts.chunkMaxTokens <= 0 {
+		return errors.Errorf("--chunk-max-tokens must be positive, got %d", opts.chunkMaxTokens)
+	}
+	if opts.chunkCharsPerToken <= 0 {
+		return errors.Errorf("--chunk-chars-per-token must be positive, got %g", opts.chunkCharsPerToken)
+	}
+	return nil
+}
+
+// blockAnchorURL 在文档链接后附加块id，打开时定位到分块开始的位置
+func blockAnchorURL(url, blockID string) string {
+	if i := strings.Index(url, "#"); i >= 0 {
+		url = url[:i]
+	}
+	if blockID == "" {
+		return url
+	}
+	return url + "#" + blockID
+}
+
+func marshalChunkRecords(records []ChunkRecord) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// downloadDocumentChunks 按标题切分文档并写入JSONL，不下载图片
+func downloadDocumentChunks(url string, source DocumentSource, docx *lark.DocxDocument, blocks []*lark.DocxBlock, opts *DownloadOpts) error {
+	docToken := source.ObjToken
+	parser := core.NewTextParser(opts.textKeepLinks)
+	chunks := parser.ParseDocxChunks(docx, blocks, core.ChunkOptions{
+		MaxTokens:     opts.chunkMaxTokens,
+		CharsPerToken: opts.chunkCharsPerToken,
+	})
+	records := make([]ChunkRecord, 0, len(chunks))
+	for i, chunk := range chunks {
+		records = append(records, ChunkRecord{
+			Title:       docx.Title,
+			DocumentID:  docx.DocumentID,
+			Index:       i,
+			HeadingPath: chunk.HeadingPath,
+			Text:        chunk.Text,
+			URL:         blockAnchorURL(url, chunk.BlockID),
+			Tokens:      chunk.Tokens,
+		})
+	}
+
+	if err := prepareOutputDir(url, docToken, docx, blocks, opts); err != nil {
+		return err
+	}
+
+	data, err := marshalChunkRecords(records)
+	if err != nil {
+		return err
+	}
+	if runChunks != nil {
+		runManifest.record(docx, docToken, url, source, filepath.Join(opts.outputDir, combinedChunksFile), opts.tags, data)
+		runChunks.mu.Lock()
+		runChunks.records = append(runChunks.records, records...)
+		runChunks.mu.Unlock()
+		logf("Collected %d chunks of %s\n", len(records), docx.Title)
+		return nil
+	}
+
+	baseName := documentBaseName(opts, docx.Title, docToken)
+	outputPath := filepath.Join(opts.outputDir, baseName+".jsonl")
+	if err := runDedup.writeFile(outputPath, dlConfig.Output.NormalizeText(data)); err != nil {
+		return err
+	}
+	runFiles.Add(outputPath)
+	runManifest.record(docx, docToken, url, source, outputPath, opts.tags, data)
+	logf("Downloaded %d chunks to %s\n", len(records), outputPath)
+	return nil
+}
+
+// write 将汇总的分块按文档和序号排序后写入输出目录，保证多次运行结果稳定
+func (c *chunkCollector) write(outputDir string) error {
+	if c == nil {
+		return nil
+	}
+	sort.SliceStable(c.records, func(i, j int) bool {
+		if c.records[i].DocumentID != c.records[j].DocumentID {
+			return c.records[i].DocumentID < c.records[j].DocumentID
+		}
+		return c.records[i].Index < c.records[j].Index
+	})
+	data, err := marshalChunkRecords(c.records)
+	if err != nil {
+		return err
+	}
+	outputPath := filepath.Join(outputDir, combinedChunksFile)
+	if err := runDedup.writeFile(outputPath, dlConfig.Output.NormalizeText(data)); err != nil {
+		return err
+	}
+	runFiles.Add(outputPath)
+	fmt.Printf("Wrote %d chunks to %s\n", len(c.records), outputPath)
+	return nil
+}
@@ -48,3 +48,22 @@ func handleConfigCommand() error {
 	}
 	return nil
 }
+
+// readCredentialConfig 读取配置文件，缺少凭证时返回提示如何配置的错误
+func readCredentialConfig() (*core.Config, error) {
+	configPath, err := core.GetConfigFilePath()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return nil, credentialsError(configPath)
+	}
+	config, err := core.ReadConfigFromFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if config.Feishu.AppId == "" || config.Feishu.AppSecret == "" {
+		return nil, credentialsError(configPath)
+	}
+	return config, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadCover(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeAPI()
+	api.docs = map[string]string{"docA": "A", "docB": "B", "docC": "C"}
+	api.images["docA"] = []string{"imgA"}
+	api.covers["docA"] = "imgCover"
+	api.failCovers["docC"] = true
+	download := func(dir, token string) string {
+		t.Helper()
+		dlOpts.outputDir = dir
+		err := downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/"+token, &dlOpts)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		data, err := os.ReadFile(filepath.Join(dir, api.docs[token]+".md"))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return string(data)
+	}
+	plainB := download(filepath.Join(outputDir, "plain"), "docB")
+	plainC := download(filepath.Join(outputDir, "plain"), "docC")
+
+	dlConfig.Output.Cover = "image"
+	dir := filepath.Join(outputDir, "cover")
+
+	// 封面作为第一张图片，与正文图片一样下载到图片目录
+	md := download(dir, "docA")
+	cover := strings.Index(md, "static/imgCover.png)")
+	if assert.GreaterOrEqual(t, cover, 0, md) {
+		assert.Less(t, cover, strings.Index(md, "content of A"))
+		assert.Less(t, cover, strings.Index(md, "static/imgA.png)"))
+	}
+	assertFileExists(t, filepath.Join(dir, "static", "imgCover.png"))
+
+	// 没有封面的文档不受影响
+	assert.Equal(t, plainB, download(dir, "docB"))
+
+	// 获取封面失败只告警，文档照常下载
+	assert.Equal(t, plainC, download(dir, "docC"))
+	assert.Equal(t, 3, api.callCount("GetDocxCover"))
+
+	// front_matter 模式下封面链接写入 front matter，正文中不再插入
+	dlConfig.Output.Cover = "front_matter"
+	dlConfig.Output.FrontMatter = true
+	dir = filepath.Join(outputDir, "front")
+	md = download(dir, "docA")
+	assert.Regexp(t, `(?m)^cover: ".*static/imgCover.png"$`, md)
+	assert.Equal(t, 1, strings.Count(md, "imgCover.png"))
+	assertFileExists(t, filepath.Join(dir, "static", "imgCover.png"))
+	assert.NotContains(t, download(dir, "docB"), "cover:")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+// DedupLink 记录与参考快照共享存储的文件，清理快照时据此判断文件是否仍被引用
+type DedupLink struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+	Method string `json:"method"` // "hardlink" or "reflink"
+	Bytes  int64  `json:"bytes"`
+}
+
+// deduper 将与参考快照内容相同的文件替换为链接，为nil时不做去重
+type deduper struct {
+	mu         sync.Mutex
+	refDir     string
+	outDir     string
+	links      []DedupLink
+	bytesSaved int64
+}
+
+var runDedup *deduper
+
+func newDeduper(refDir, outDir string) (*deduper, error) {
+	info, err := os.Stat(refDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "--dedup-against")
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("--dedup-against: %s is not a directory", refDir)
+	}
+	absRef, err := filepath.Abs(refDir)
+	if err != nil {
+		return nil, err
+	}
+	absOut, err := filepath.Abs(outDir)
+	if err != nil {
+		return nil, err
+	}
+	return &deduper{refDir: absRef, outDir: absOut}, nil
+}
+
+// refPath 返回输出文件在参考快照中对应的路径
+func (d *deduper) refPath(path string) (string, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(d.outDir, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.Join(d.refDir, rel), true
+}
+
+func (d *deduper) link(ref, path string, size int64) bool {
+	method, err := utils.LinkFile(ref, path)
+	if err != nil {
+		warnf("Warning: failed to link %s to %s: %v\n", path, ref, err)
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.links = append(d.links, DedupLink{Path: path, Target: ref, Method: method, Bytes: size})
+	d.bytesSaved += size
+	return true
+}
+
+// writeFile 内容与参考快照相同时直接链接，否则原子写入
+func (d *deduper) writeFile(path string, data []byte) error {
+	if d != nil {
+		ref, ok := d.refPath(path)
+		if ok && utils.SameContent(ref, data) && d.link(ref, path, int64(len(data))) {
+			return nil
+		}
+	}
+	return runSyncer.WriteFile(path, data, 0o644)
+}
+
+// dedupFile 对已写入的文件（如下载的图片）做去重
+func (d *deduper) dedupFile(path string) {
+	if d == nil {
+		return
+	}
+	ref, ok := d.refPath(path)
+	if !ok || !utils.SameFiles(ref, path) {
+		return
+	}
+	if info, err := os.Stat(path); err == nil {
+		d.link(ref, path, info.Size())
+	}
+}
+
+// fillReport 将去重结果写入下载报告
+func (d *deduper) fillReport(report *BatchDownloadReport) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	report.DedupBytesSaved = d.bytesSaved
+	report.DedupLinks = append([]DedupLink(nil), d.links...)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+type DiffOpts struct {
+	against string // 作为基准的 Markdown 文件或转储文件，为空时在镜像的清单中查找
+	dir     string // 本地镜像的根目录
+	output  string // 差异文件路径，默认为当前目录下的 <标题>.diff.md
+	style   string
+}
+
+var diffOpts = DiffOpts{}
+
+// diffImageLink 基准 Markdown 中图片链接的目标
+var diffImageLink = regexp.MustCompile(`(!\[[^\]]*\]\()(<?)([^)\s>]+)`)
+
+// handleDiffCommand 比较文档的当前内容与本地导出或转储，将逐词的差异写入单独的文件
+func handleDiffCommand(url string) error {
+	config, err := readCredentialConfig()
+	if err != nil {
+		return err
+	}
+	dlConfig = *config
+	if err := dlConfig.Output.Validate(); err != nil {
+		return err
+	}
+	if err := validateDiffStyle(diffOpts.style); err != nil {
+		return err
+	}
+	httpClient, err := core.NewHTTPClient(dlConfig.HTTP)
+	if err != nil {
+		return err
+	}
+	clientOpts := append(dlConfig.Feishu.ClientOptions(), core.WithHTTPClient(httpClient))
+	client := core.NewClient(dlConfig.Feishu.AppId, dlConfig.Feishu.AppSecret, clientOpts...)
+	return diffDocument(context.Background(), client, url)
+}
+
+func validateDiffStyle(style string) error {
+	switch style {
+	case core.DiffStyleHTML, core.DiffStyleCritic:
+		return nil
+	}
+	return errors.Errorf("invalid --style %q, expect \"html\" or \"critic\"", style)
+}
+
+// renderForDiff 按导出时的配置渲染文档，图片保留token，不含 front matter
+func renderForDiff(dump *docxDump) (string, error) {
+	parser := core.NewParser(dlConfig.Output)
+	markdown := parser.ParseDocxContent(dump.Document, dump.Blocks)
+	_, body, err := dlConfig.Output.FormatDocument(core.DocumentMeta{
+		Title:    dump.Document.Title,
+		URL:      dump.URL,
+		Token:    dump.Document.DocumentID,
+		Revision: dump.Document.RevisionID,
+	}, markdown)
+	if err != nil {
+		return "", err
+	}
+	return parser.RestoreGalleries(parser.RestoreCodeFenceAttrs(body)), nil
+}
+
+func diffDocument(ctx context.Context, client core.API, url string) error {
+	doc, err := fetchDocument(ctx, client, url, &DownloadOpts{outputDir: diffOpts.dir})
+	if err != nil {
+		return err
+	}
+	if doc.docx == nil {
+		return errors.Errorf("%s is not a document, only documents can be compared", url)
+	}
+	current, err := renderForDiff(&docxDump{URL: url, Document: doc.docx, Blocks: doc.blocks})
+	if err != nil {
+		return err
+	}
+
+	outputPath := diffOpts.output
+	if outputPath == "" {
+		outputPath = utils.SanitizeFileName(doc.docx.Title) + ".diff.md"
+	}
+	baseline, err := diffBaseline(doc, url, filepath.Dir(outputPath))
+	if err != nil {
+		return err
+	}
+
+	result, stats := core.InlineDiff(baseline, current, core.DiffOptions{
+		Style:    diffOpts.style,
+		ImageKey: imageKeyOf(filepath.Join(diffOpts.dir, dlConfig.Output.ImageDir)),
+	})
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, dlConfig.Output.NormalizeText([]byte(result)), 0o644); err != nil {
+		return err
+	}
+	if !stats.Changed() {
+		fmt.Printf("No changes in %s, wrote it to %s\n", doc.docx.Title, outputPath)
+		return nil
+	}
+	fmt.Printf("Wrote the changes of %s to %s: %d words inserted, %d words deleted, %d images replaced\n",
+		doc.docx.Title, outputPath, stats.Insertions, stats.Deletions, stats.ReplacedImages)
+	return nil
+}
+
+// diffBaseline 读取作为基准的内容：转储按当前配置渲染；Markdown 去掉 front matter，
+// 其中的本地图片链接改为相对差异文件所在的目录
+func diffBaseline(doc *fetchedDocument, url, outputDir string) (string, error) {
+	against := diffOpts.against
+	if strings.HasSuffix(against, ".json") || strings.HasSuffix(against, ".json.gz") {
+		dump, err := readDump(against)
+		if err != nil {
+			return "", err
+		}
+		if dump.URL == "" {
+			dump.URL = url
+		}
+		return renderForDiff(dump)
+	}
+	if against == "" {
+		var err error
+		if against, err = exportedPath(doc); err != nil {
+			return "", err
+		}
+	}
+	data, err := os.ReadFile(against)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the baseline")
+	}
+	markdown := string(utils.NormalizeText(data, utils.NewlineLF, false))
+	markdown = core.StripFrontMatter(markdown)
+	baseDir := filepath.Dir(against)
+	return diffImageLink.ReplaceAllStringFunc(markdown, func(link string) string {
+		m := diffImageLink.FindStringSubmatch(link)
+		target := m[3]
+		if strings.Contains(target, "://") || filepath.IsAbs(target) {
+			return link
+		}
+		return m[1] + m[2] + relativeLink(outputDir, filepath.Join(baseDir, filepath.FromSlash(target)))
+	}), nil
+}
+
+// exportedPath 在镜像的清单中查找文档导出的文件，没有清单时按文件名规则推断
+func exportedPath(doc *fetchedDocument) (string, error) {
+	manifest, err := readManifest(filepath.Join(diffOpts.dir, manifestFileName))
+	if err == nil {
+		entry, ok := manifest.Documents[doc.docToken]
+		if !ok {
+			return "", errors.Errorf("%s is not in the manifest of %s, specify the baseline with --against",
+				doc.docx.Title, diffOpts.dir)
+		}
+		return filepath.Join(diffOpts.dir, entry.Path), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	opts := &DownloadOpts{outputDir: diffOpts.dir}
+	outputPath := filepath.Join(diffOpts.dir, documentBaseName(opts, doc.docx.Title, doc.docToken)+".md")
+	if _, err := os.Stat(outputPath); err != nil {
+		return "", errors.Errorf("no export of %s found in %s, specify the baseline with --against",
+			doc.docx.Title, diffOpts.dir)
+	}
+	return outputPath, nil
+}
+
+// imageKeyOf 按token识别图片；按内容哈希命名的图片通过图片目录中的记录找回token
+func imageKeyOf(imageDir string) func(src string) string {
+	tokens := make(map[string]string)
+	for token, name := range newImageStore(imageDir).names {
+		tokens[name] = token
+	}
+	return func(src string) string {
+		if token, ok := tokens[path.Base(src)]; ok {
+			return token
+		}
+		return core.ImageFileKey(src)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffDocument(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	api.images["docA"] = []string{"imgA", "imgB"}
+	api.addDoc("", "A")
+	runManifest = newManifestRecorder(outputDir)
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) || !assert.NoError(t, runManifest.write(report)) {
+		return
+	}
+	runManifest = nil
+
+	diffDir := t.TempDir()
+	diffOpts = DiffOpts{dir: outputDir, output: filepath.Join(diffDir, "A.diff.md"), style: core.DiffStyleHTML}
+	t.Cleanup(func() { diffOpts = DiffOpts{} })
+	url := "https://domain.feishu.cn/wiki/wikA"
+
+	// 内容不变时没有标记，图片链接指向镜像中的文件
+	if !assert.NoError(t, diffDocument(context.Background(), api, url)) {
+		return
+	}
+	data, err := os.ReadFile(diffOpts.output)
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(data), "<ins>")
+		assert.Contains(t, string(data), filepath.Join("Space", "static", "imgA.png")+")")
+	}
+
+	// 文字和图片的改动分别标记，镜像中的文件不变
+	exported, _ := os.ReadFile(filepath.Join(outputDir, "Space", "A.md"))
+	api.docs["docA"] = "B"
+	api.images["docA"] = []string{"imgA", "imgC"}
+	if !assert.NoError(t, diffDocument(context.Background(), api, url)) {
+		return
+	}
+	data, err = os.ReadFile(diffOpts.output)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "# <del>A</del> <ins>B</ins>")
+		assert.Contains(t, string(data), `<ins class="image-replaced">![](imgC)</ins>`)
+	}
+	unchanged, _ := os.ReadFile(filepath.Join(outputDir, "Space", "A.md"))
+	assert.Equal(t, exported, unchanged)
+}
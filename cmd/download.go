@@ -4,16 +4,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/88250/lute"
 	"github.com/Wsine/feishu2md/core"
 	"github.com/Wsine/feishu2md/utils"
 	"github.com/chyroc/lark"
 	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
 )
 
 type DownloadOpts struct {
@@ -21,349 +21,662 @@ type DownloadOpts struct {
 	dump                 bool
 	batch                bool
 	wiki                 bool
-	wikiOutline          bool // 新增：是否只下载wiki目录结构
-	wikiOutlineWithLinks bool // 新增：生成wiki目录时是否包含文章链接
+	spaceName            string // 按名称指定知识空间，代替空间链接
+	wikiOutline          bool   // 新增：是否只下载wiki目录结构
+	wikiOutlineWithLinks bool   // 新增：生成wiki目录时是否包含文章链接
+	outlineDepth         int
+	outlineFormat        string // 目录结构的格式：md 或 json
+	outlineNoIcons       bool   // 目录结构中不添加节点类型的emoji标识
+	gitCommit            bool
+	gitPush              bool
+	gitMessage           string
+	gitAllowDirty        bool
+	gitMaxFailures       int
+	dedupAgainst         string
+	dumpDir              string
+	dumpGzip             bool
+	withPermissions      bool
+	forceEmpty           bool
+	emptyExitCode        int
+	excludeDrafts        string
+	includeHidden        bool   // 导出对知识空间访客隐藏的节点
+	format               string // 输出格式：md、text 或 chunks
+	textKeepLinks        bool
+	chunkMaxTokens       int
+	chunkCharsPerToken   float64
+	chunksCombined       bool
+	maxPathBytes         int
+	sync                 bool     // 跳过版本号与上一次清单相同的文档
+	prune                bool     // 同步时删除远端已删除文档的本地文件
+	tags                 []string // 文档所在的上级目录标题，批量和wiki下载时用作标签
+	rewriteLinks         bool     // 将指向本次已下载文档的链接改写为本地相对路径
+	names                *fileNamer
+	sinks                []string        // 附加的输出目标，追加在配置文件的 output.sinks 之后
+	fromFile             string          // 每行一个文档链接的文件，"-" 表示标准输入
+	maxConcurrency       int             // 同时下载的文档数，0表示默认值
+	contentConcurrency   int             // 同时读取内容的文档数，0表示由 maxConcurrency 推导
+	imageConcurrency     int             // 同时下载图片并写入的文档数，0表示由 maxConcurrency 推导
+	retryReport          string          // 重新下载该报告中失败的文档
+	types                string          // 批量和wiki下载的节点类型，逗号分隔的 docx、file、sheet 和 bitable
+	statusAddr           string          // 运行期间提供状态接口的地址，如 127.0.0.1:8090
+	pinResolutions       bool            // 复用清单中记录的链接解析结果，只查询新出现的链接
+	reResolve            bool            // 忽略 --pin-resolutions，重新查询全部链接
+	dryRun               bool            // 只遍历，不读取文档内容也不写入文件
+	estimate             bool            // 空跑时估算接口调用数和耗时
+	objType              string          // 遍历时已知的对象类型，空跑时用于估算
+	frontMatter          bool            // 本次运行是否为文档添加 front matter
+	frontMatterSet       bool            // 是否通过 --front-matter 覆盖了 output.front_matter
+	outputDirSet         bool            // 是否通过 -o 指定了输出目录
+	fromProject          bool            // 下载项目配置中的 sources
+	noProjectConfig      bool            // 不读取项目配置
+	sources              []string        // 项目配置中的多个链接，与 --from-file 的列表相同
+	setFlags             map[string]bool // 命令行中指定的选项，优先于项目配置
+	strictFormat         bool            // lute 格式化失败时报错，而不是写入未格式化的内容
+	legacyMap            string          // 文档token到旧版导出工具文件路径的映射文件，.csv 或 .json
+}
+
+// forDir 复制用户指定的下载选项并改为输出到dir，批量模式下每个文档共用同一套设置
+func (opts DownloadOpts) forDir(dir string) DownloadOpts {
+	opts.outputDir = dir
+	opts.batch = false
+	opts.wiki = false
+	return opts
 }
 
 // DownloadResult 下载结果记录
 type DownloadResult struct {
-	URL      string    `json:"url"`
-	Filename string    `json:"filename"`
-	Status   string    `json:"status"` // "success" or "error"
-	Error    string    `json:"error,omitempty"`
-	Time     time.Time `json:"time"`
+	URL       string `json:"url"`
+	OutputDir string `json:"output_dir,omitempty"` // 文档所在的目录，wiki下载时随节点层级变化
+	Filename  string `json:"filename"`
+	Status    string `json:"status"` // "success", "skipped" or "error"
+	Error     string `json:"error,omitempty"`
+	Retries   int    `json:"retries,omitempty"` // 触发频率限制后重试的次数
+	Bytes     int64  `json:"bytes,omitempty"`   // 上传文件的字节数，文档为0
+	Type      string `json:"type,omitempty"`    // --dry-run 时遍历得到的对象类型
+	// 写入时的告警：output.html.accessibility 修正过或无法修正的问题，以及格式化失败
+	Warnings []string `json:"warnings,omitempty"`
+	// overrides.yaml 中对该文档应用的规则及结果
+	Overrides []AppliedOverride `json:"overrides,omitempty"`
+	// 转换为 Markdown 时完整支持、降级和丢弃的块数及得分
+	Quality *core.ConversionQuality `json:"quality,omitempty"`
+	// 导出的画板，drawio 不为空的画板带有可编辑的源文件
+	Boards []BoardExport `json:"boards,omitempty"`
+	Time   time.Time     `json:"time"`
+	// 知识库中的文档同时记录节点链接和文档链接，以及所在的知识空间
+	DocumentSource
 }
 
 // BatchDownloadReport 批量下载报告
 type BatchDownloadReport struct {
+	Version       string           `json:"version"`
+	CompatVersion string           `json:"compat_version"`
+	Build         BuildInfo        `json:"build"` // 生成报告的程序的提交、构建时间和平台
+	OutputDir     string           `json:"output_dir"`
 	TotalFiles    int              `json:"total_files"`
 	SuccessCount  int              `json:"success_count"`
+	SkippedCount  int              `json:"skipped_count"`
+	PlannedCount  int              `json:"planned_count,omitempty"`
 	ErrorCount    int              `json:"error_count"`
 	Results       []DownloadResult `json:"results"`
 	StartTime     time.Time        `json:"start_time"`
 	EndTime       time.Time        `json:"end_time"`
 	Duration      string           `json:"duration"`
+	// 按标题前缀排除的草稿节点数，不计入 total_files
+	ExcludedDrafts int `json:"excluded_drafts"`
+	// 对知识空间访客隐藏而未导出的节点数，接口返回可见性且未指定 --include-hidden 时才有
+	ExcludedHidden int `json:"excluded_hidden,omitempty"`
+	// 与参考快照去重的结果，仅在指定 --dedup-against 时输出
+	DedupBytesSaved int64       `json:"dedup_bytes_saved,omitempty"`
+	DedupLinks      []DedupLink `json:"dedup_links,omitempty"`
+	// 超出路径长度预算而被截断的目录和文件名
+	PathTruncations []PathTruncation `json:"path_truncations,omitempty"`
+	// 遍历时因循环引用或超过 download.max_depth 而跳过的节点
+	SkippedNodes []SkippedNode `json:"skipped_nodes,omitempty"`
+	// --legacy-map 中本次没有匹配到任何文档的旧路径
+	LegacyUnmatched []LegacyPath `json:"legacy_unmatched,omitempty"`
+	// 上一次清单中有、本次远端已不存在的文档
+	Removed []RemovedDocument `json:"removed,omitempty"`
+	// 指定 --rewrite-links 时每个文件改写为本地相对路径的链接数
+	RewrittenLinks map[string]int `json:"rewritten_links,omitempty"`
+	// --from-file 列表中的文件夹和知识空间各自的根目录
+	Roots []RootDir `json:"roots,omitempty"`
+	// --pin-resolutions 时复用清单记录、未查询接口的解析数
+	PinnedResolutions int `json:"pinned_resolutions,omitempty"`
+	// 重新解析的结果与清单记录不同的链接，通常是文档被移动
+	ResolutionChanges []ResolutionChange `json:"resolution_changes,omitempty"`
+	// 每个接口方法的调用次数、失败次数和耗时
+	APICalls []core.MethodMetrics `json:"api_calls,omitempty"`
+	// --dry-run --estimate 的估算结果
+	Estimate *RunEstimate `json:"estimate,omitempty"`
 }
 
 var dlOpts = DownloadOpts{}
+
+// maxConcurrency 同时下载的文档数上限
+const maxConcurrency = 10
+
+// errNoDocuments 批量或wiki模式下没有找到任何待下载的文档
+var errNoDocuments = errors.New("no documents found matching the criteria")
 var dlConfig core.Config
 
+// runSyncer 按 output.fsync 刷盘导出的文件，为nil时与之前一样交给操作系统
+var runSyncer *utils.Syncer
+
 // downloadDocumentWithResult 下载文档并返回结果记录
-func downloadDocumentWithResult(ctx context.Context, client *core.Client, url string, opts *DownloadOpts) DownloadResult {
+func downloadDocumentWithResult(ctx context.Context, client core.API, url string, opts *DownloadOpts) DownloadResult {
+	doc, err := fetchDocument(ctx, client, url, opts)
+	if err == nil {
+		err = writeDocument(ctx, client, doc, opts)
+	}
+	return documentResult(url, doc, err, opts)
+}
+
+// documentResult 生成下载结果记录，文件名与实际写入的一致
+func documentResult(url string, doc *fetchedDocument, err error, opts *DownloadOpts) DownloadResult {
 	result := DownloadResult{
-		URL:    url,
-		Time:   time.Now(),
-		Status: "error",
+		URL:       url,
+		OutputDir: opts.outputDir,
+		Time:      dlConfig.Output.Now(),
+		Status:    "error",
+	}
+	if doc != nil {
+		result.Bytes = doc.size
+		result.Warnings = doc.warnings
+		result.DocumentSource = doc.source
+		result.Overrides = doc.overrides
+		result.Quality = doc.quality
+		result.Boards = doc.boards
+	}
+	if errors.Is(err, errOverrideSkipped) {
+		result.Status = "skipped"
+		result.Overrides = []AppliedOverride{{Directive: overrideSkip, Status: "applied"}}
+		return result
+	}
+	if err != nil && !errors.Is(err, errSkipped) {
+		result.Error = err.Error()
+		result.Retries = core.Retries(err)
+		logf("Error downloading %s: %v\n", url, err)
+		return result
+	}
+	result.Status = "success"
+	if err != nil {
+		result.Status = "skipped"
 	}
+	result.Filename = outputFileName(doc, opts)
+	return result
+}
 
-	err := downloadDocument(ctx, client, url, opts)
+// outputFileName 文档写入的文件名，表格按csv导出多个工作表时为第一个文件
+func outputFileName(doc *fetchedDocument, opts *DownloadOpts) string {
+	if doc.isFile() {
+		return fileNodeName(opts, doc.title, doc.docToken)
+	}
+	if doc.isSheet() {
+		return sheetFileNames(opts, doc)[0]
+	}
+	return documentBaseName(opts, doc.docx.Title, doc.docToken) + opts.fileExt()
+}
+
+func downloadDocument(ctx context.Context, client core.API, url string, opts *DownloadOpts) error {
+	doc, err := fetchDocument(ctx, client, url, opts)
 	if err != nil {
-		result.Error = err.Error()
-		fmt.Printf("Error downloading %s: %v\n", url, err)
+		return err
+	}
+	return writeDocument(ctx, client, doc, opts)
+}
+
+// downloadSingle 下载单个文档，失败时直接返回错误，跳过的文档与批量下载一样记入报告
+func downloadSingle(ctx context.Context, client core.API, url string) (*BatchDownloadReport, error) {
+	report := newBatchDownloadReport()
+	runProgress.add()
+	runProgress.begin("content-1", url)
+	// --legacy-map 可能改变文档的输出目录，不影响报告所在的输出根目录
+	opts := dlOpts
+	doc, err := fetchDocument(ctx, client, url, &opts)
+	if err == nil {
+		err = writeDocument(ctx, client, doc, &opts)
+	}
+	if errors.Is(err, errOverrideSkipped) {
+		fmt.Printf("Skipped %s, which is marked skip in %s\n", url, overridesFileName)
+	}
+	runProgress.idle("content-1")
+	if err != nil && !errors.Is(err, errOverrideSkipped) && !errors.Is(err, errSkipped) {
+		runProgress.finish("error")
+		runProgress.end()
+		return nil, err
+	}
+	result := documentResult(url, doc, err, &opts)
+	runProgress.finish(result.Status)
+	runProgress.end()
+
+	report.TotalFiles = 1
+	if result.Status == "success" {
+		report.SuccessCount = 1
 	} else {
-		result.Status = "success"
-		// 尝试从URL中提取文档token来构建文件名
-		if docType, docToken, urlErr := utils.ValidateDocumentURL(url); urlErr == nil {
-			if docType == "wiki" {
-				// 对于wiki页面，需要获取实际的文档信息
-				if node, nodeErr := client.GetWikiNodeInfo(ctx, docToken); nodeErr == nil {
-					docToken = node.ObjToken
-				}
-			}
-			// 构建文件名 - 使用文档标题作为文件名
-			if docx, _, titleErr := client.GetDocxContent(ctx, docToken); titleErr == nil {
-				sanitizedTitle := utils.SanitizeFileName(docx.Title)
-				result.Filename = fmt.Sprintf("%s.md", sanitizedTitle)
-			} else {
-				result.Filename = fmt.Sprintf("%s.md", docToken)
-			}
-		}
+		report.SkippedCount = 1
 	}
+	report.Results = append(report.Results, result)
+	report.EndTime = dlConfig.Output.Now()
+	report.Duration = report.EndTime.Sub(report.StartTime).String()
+	return report, nil
+}
 
-	return result
+// fetchedDocument 已读取内容、等待下载图片和写入的文档，已读取的表格，或等待下载的上传文件
+type fetchedDocument struct {
+	url       string
+	docToken  string
+	source    DocumentSource // 文档的节点链接和文档链接
+	docx      *lark.DocxDocument
+	blocks    []*lark.DocxBlock
+	objType   string // 上传的文件为 "file"，表格为 "sheet" 或 "bitable"，都没有docx和blocks
+	title     string // 上传文件的节点标题（包含扩展名）或表格的标题
+	size      int64  // 上传文件写入的字节数
+	sheet     *core.Spreadsheet
+	warnings  []string                // 写入时的告警，记录在下载结果中
+	overrides []AppliedOverride       // 写入后应用的 overrides.yaml 规则
+	quality   *core.ConversionQuality // 转换为 Markdown 的质量，其他格式为nil
+	boards    []BoardExport           // 导出为图片的画板
 }
 
-func downloadDocument(ctx context.Context, client *core.Client, url string, opts *DownloadOpts) error {
+// isFile 是否为知识库中上传的文件
+func (doc *fetchedDocument) isFile() bool {
+	return doc.objType == fileNodeType
+}
+
+// isSheet 是否为电子表格或多维表格
+func (doc *fetchedDocument) isSheet() bool {
+	return isSheetType(doc.objType)
+}
+
+// fetchDocument 解析链接并读取文档内容，同步时未变化的文档只读取文档信息并返回errSkipped
+func fetchDocument(ctx context.Context, client core.API, url string, opts *DownloadOpts) (*fetchedDocument, error) {
 	// Validate the url to download
 	docType, docToken, err := utils.ValidateDocumentURL(url)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	fmt.Println("Captured document token:", docToken)
+	logf("Captured document token: %s\n", docToken)
+	urlToken := docToken
 
 	// for a wiki page, we need to renew docType and docToken first
+	var node *Resolution
 	if docType == "wiki" {
-		node, err := client.GetWikiNodeInfo(ctx, docToken)
+		node, err = runResolutions.wikiNode(ctx, client, docToken)
 		if err != nil {
-			return fmt.Errorf("GetWikiNodeInfo err: %v for %v", err, url)
+			return nil, fmt.Errorf("GetWikiNodeInfo err: %v for %v", err, url)
+		}
+		docType = node.Type
+		docToken = node.Token
+		if runOverrides.skipped(docToken) {
+			return nil, errOverrideSkipped
+		}
+		runLegacyMap.redirect(opts, docToken, urlToken)
+		// 上传的文件没有内容可读取，在写入阶段直接下载
+		if docType == fileNodeType {
+			if err := checkFileNode(node.Title); err != nil {
+				return nil, err
+			}
+			return &fetchedDocument{url: url, docToken: docToken, objType: fileNodeType, title: node.Title,
+				source: newDocumentSource(url, fileNodeType, docToken, node)}, nil
 		}
-		docType = node.ObjType
-		docToken = node.ObjToken
 	}
 	if docType == "docs" {
-		return errors.Errorf(
+		return nil, errors.Errorf(
 			`Feishu Docs is no longer supported. ` +
 				`Please refer to the Readme/Release for v1_support.`)
 	}
+	if runOverrides.skipped(docToken) {
+		return nil, errOverrideSkipped
+	}
+	runLegacyMap.redirect(opts, docToken, urlToken)
+	docType = sheetObjType(docType)
+	if node == nil {
+		node = lookupWikiNode(ctx, client, docType, docToken, opts)
+	}
+	source := newDocumentSource(url, docType, docToken, node)
+	if isSheetType(docType) {
+		return fetchSheet(ctx, client, url, source, docType, docToken)
+	}
+
+	// 同步模式下先比较版本号，未变化的文档不再读取内容
+	if runManifest.syncing() {
+		docx, err := client.GetDocxDocument(ctx, docToken)
+		if err != nil {
+			return nil, err
+		}
+		baseName := documentBaseName(opts, docx.Title, docToken)
+		if runManifest.unchanged(docToken, docx.RevisionID, filepath.Join(opts.outputDir, baseName+opts.fileExt())) {
+			runManifest.keep(docx, docToken, url, source, opts.tags)
+			if opts.fileExt() == ".md" {
+				runLinks.add(filepath.Join(opts.outputDir, baseName+".md"), false, source.tokens()...)
+			}
+			logf("Skipped unchanged document %s\n", url)
+			return &fetchedDocument{url: url, docToken: docToken, docx: docx, source: source}, errSkipped
+		}
+	}
 
 	// Process the download
 	docx, blocks, err := client.GetDocxContent(ctx, docToken)
 	if err != nil {
+		return nil, err
+	}
+	return &fetchedDocument{url: url, docToken: docToken, docx: docx, blocks: blocks, source: source}, nil
+}
+
+// writeDocument 写入文档，之后应用 overrides.yaml 中的补丁等规则
+func writeDocument(ctx context.Context, client core.API, doc *fetchedDocument, opts *DownloadOpts) error {
+	if err := writeDocumentContent(ctx, client, doc, opts); err != nil {
 		return err
 	}
+	doc.overrides = runOverrides.apply(doc.docToken, filepath.Join(opts.outputDir, outputFileName(doc, opts)))
+	return nil
+}
+
+// writeDocumentContent 下载文档中的图片和附件，转换后写入输出目录
+func writeDocumentContent(ctx context.Context, client core.API, doc *fetchedDocument, opts *DownloadOpts) error {
+	if doc.isFile() {
+		return writeFileNode(ctx, client, doc, opts)
+	}
+	if doc.isSheet() {
+		return writeSheet(ctx, doc, opts)
+	}
+	url, docToken, docx, blocks := doc.url, doc.docToken, doc.docx, doc.blocks
+
+	switch opts.format {
+	case formatText:
+		return downloadDocumentText(url, doc.source, docx, blocks, opts)
+	case formatChunks:
+		return downloadDocumentChunks(url, doc.source, docx, blocks, opts)
+	}
 
 	parser := core.NewParser(dlConfig.Output)
+	if dlConfig.Output.ListStartFromBlock {
+		parser.SetListSequences(listSequences(ctx, client, docx))
+	}
+	parser.SetBoards(docxBoards(ctx, client, docx, blocks))
 	markdown := parser.ParseDocxContent(docx, blocks)
+	quality := parser.Quality()
+	doc.quality = &quality
+	doc.warnings = parser.Warnings
+	for _, warning := range parser.Warnings {
+		warnf("Warning: %s: %s\n", docx.Title, warning)
+	}
 
 	if !dlConfig.Output.SkipImgDownload {
 		for _, imgToken := range parser.ImgTokens {
-			localLink, err := client.DownloadImage(
-				ctx, imgToken, filepath.Join(opts.outputDir, dlConfig.Output.ImageDir),
+			imgPath, localLink, err := downloadImage(ctx, client, imgToken, opts)
+			if err != nil {
+				return err
+			}
+			var width, height int64
+			if parser.NeedsImageSize(imgToken) {
+				width, height, _ = utils.ImageFileSize(imgPath)
+			}
+			markdown = parser.ResolveImage(markdown, imgToken, localLink, width, height)
+		}
+	}
+
+	// 附件以原文件名加token后缀命名，以相对文档的链接引用
+	if !dlConfig.Output.SkipFileDownload {
+		fileDir := filepath.Join(opts.outputDir, dlConfig.Output.FileDir)
+		for _, fileToken := range parser.FileTokens {
+			filePath, err := client.DownloadAttachment(
+				ctx, fileToken, fileDir, runPathBudget.attachmentNamer(fileDir),
 			)
 			if err != nil {
 				return err
 			}
-			markdown = strings.Replace(markdown, imgToken, localLink, 1)
+			runDedup.dedupFile(filePath)
+			runFiles.Add(filePath)
+			markdown = parser.ResolveFile(markdown, fileToken, relativeLink(opts.outputDir, filePath))
 		}
 	}
 
-	// 在markdown开头添加原文档链接
-	markdownWithLink := fmt.Sprintf("# %s\n\n> 原文档链接: [%s](%s)\n\n%s", docx.Title, docx.Title, url, markdown)
+	// 画板下载为图片，失败时只告警并去掉该画板；带有 draw.io 源数据时在图片后
+	// 以html注释注明可编辑的文件
+	if !dlConfig.Output.SkipImgDownload {
+		for _, board := range parser.Boards {
+			link, export, err := downloadBoard(ctx, client, board, opts)
+			if err != nil {
+				warnf("Warning: failed to download board %s of %s: %v\n", board.Token, docx.Title, err)
+				markdown = parser.ResolveBoard(markdown, board.Token, "", "")
+				continue
+			}
+			drawIOLink := ""
+			if export.DrawIO != "" {
+				drawIOLink = strings.TrimSuffix(link, filepath.Ext(link)) + ".drawio"
+			}
+			markdown = parser.ResolveBoard(markdown, board.Token, link, drawIOLink)
+			doc.boards = append(doc.boards, export)
+		}
+	}
+
+	// 封面作为文档的第一张图片，或写入 front matter 的 cover 字段，
+	// 获取失败只告警不影响文档下载
+	var coverLink string
+	switch dlConfig.Output.Cover {
+	case "image":
+		if coverPath, cover := downloadCover(ctx, client, docToken, opts); cover != "" {
+			var width, height int64
+			if dlConfig.Output.ImageDimensions != "" && coverPath != "" {
+				width, height, _ = utils.ImageFileSize(coverPath)
+			}
+			markdown = fmt.Sprintf("%s\n\n%s", parser.RenderImage(cover, width, height), markdown)
+		}
+	case "front_matter":
+		if dlConfig.Output.FrontMatter {
+			_, coverLink = downloadCover(ctx, client, docToken, opts)
+		}
+	}
 
-	// Format the markdown document
-	engine := lute.New(func(l *lute.Lute) {
-		l.RenderOptions.AutoSpace = true
-	})
-	result := engine.FormatStr("md", markdownWithLink)
+	// 按照兼容版本添加标题和原文档链接（或 front matter）并格式化
+	frontMatter, body, err := dlConfig.Output.FormatDocument(core.DocumentMeta{
+		Title:        docx.Title,
+		URL:          url,
+		Token:        docToken,
+		Revision:     docx.RevisionID,
+		DownloadedAt: dlConfig.Output.Now(),
+		Cover:        coverLink,
+	}, markdown)
+	if err := formatFallback(doc, docx.Title, err, opts); err != nil {
+		return err
+	}
+	body = parser.RestoreGalleries(parser.RestoreCodeFenceAttrs(body))
+	result := frontMatter + body
 
-	// Handle the output directory and name
+	if err := prepareOutputDir(url, docToken, docx, blocks, opts); err != nil {
+		return err
+	}
+
+	// Write to markdown file - 使用文档标题作为文件名
+	baseName := documentBaseName(opts, docx.Title, docToken)
+	outputPath := filepath.Join(opts.outputDir, baseName+".md")
+	err = writeMarkdown(ctx, PostProcessDocument{
+		Path:     outputPath,
+		Title:    docx.Title,
+		URL:      url,
+		Token:    docToken,
+		Revision: docx.RevisionID,
+		Tags:     opts.tags,
+	}, []byte(result))
+	if err != nil {
+		return err
+	}
+	runFiles.Add(outputPath)
+	// 清单的哈希不含 front matter，其中的下载时间每次都不同
+	runManifest.record(docx, docToken, url, doc.source, outputPath, opts.tags, []byte(body))
+	runLinks.add(outputPath, true, doc.source.tokens()...)
+	logf("Downloaded markdown file to %s\n", outputPath)
+
+	return nil
+}
+
+// prepareOutputDir 创建输出目录，并按需保存接口返回的原始json
+func prepareOutputDir(url, docToken string, docx *lark.DocxDocument, blocks []*lark.DocxBlock, opts *DownloadOpts) error {
 	if _, err := os.Stat(opts.outputDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(opts.outputDir, 0o755); err != nil {
 			return err
 		}
 	}
 
-	if dlOpts.dump {
-		jsonName := fmt.Sprintf("%s.json", docToken)
-		outputPath := filepath.Join(opts.outputDir, jsonName)
-		data := struct {
-			Document *lark.DocxDocument `json:"document"`
-			Blocks   []*lark.DocxBlock  `json:"blocks"`
-		}{
+	if opts.dump {
+		outputPath, err := writeDump(opts, docToken, &docxDump{
+			URL:      url,
 			Document: docx,
 			Blocks:   blocks,
-		}
-		pdata := utils.PrettyPrint(data)
-
-		if err = os.WriteFile(outputPath, []byte(pdata), 0o644); err != nil {
+		})
+		if err != nil {
 			return err
 		}
-		fmt.Printf("Dumped json response to %s\n", outputPath)
+		runFiles.Add(outputPath)
+		logf("Dumped json response to %s\n", outputPath)
 	}
+	return nil
+}
 
-	// Write to markdown file - 使用文档标题作为文件名
-	sanitizedTitle := utils.SanitizeFileName(docx.Title)
-	mdName := fmt.Sprintf("%s.md", sanitizedTitle)
-	outputPath := filepath.Join(opts.outputDir, mdName)
-	if err = os.WriteFile(outputPath, []byte(result), 0o644); err != nil {
-		return err
+// listSequences 读取有序列表的起始编号，失败时只告警，文档照常从1编号
+func listSequences(ctx context.Context, client core.API, docx *lark.DocxDocument) map[string]string {
+	sequences, err := client.GetDocxListSequences(ctx, docx.DocumentID)
+	if err != nil {
+		warnf("Warning: failed to get the list numbers of %s: %v\n", docx.Title, err)
+		return nil
 	}
-	fmt.Printf("Downloaded markdown file to %s\n", outputPath)
+	return sequences
+}
 
-	return nil
+// downloadCover 下载文档封面并返回图片路径和链接，无封面或失败时链接为空，
+// 跳过图片下载时链接为封面的token
+func downloadCover(ctx context.Context, client core.API, docToken string, opts *DownloadOpts) (path, link string) {
+	coverToken, err := client.GetDocxCover(ctx, docToken)
+	if err != nil {
+		warnf("Warning: failed to get the cover of %s: %v\n", docToken, err)
+		return "", ""
+	}
+	if coverToken == "" || dlConfig.Output.SkipImgDownload {
+		return "", coverToken
+	}
+	path, link, err = downloadImage(ctx, client, coverToken, opts)
+	if err != nil {
+		warnf("Warning: failed to download the cover of %s: %v\n", docToken, err)
+		return "", ""
+	}
+	return path, link
 }
 
-func downloadDocuments(ctx context.Context, client *core.Client, url string) error {
+func downloadDocuments(ctx context.Context, client core.API, url string) (*BatchDownloadReport, error) {
 	// Validate the url to download
 	folderToken, err := utils.ValidateFolderURL(url)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	fmt.Println("Captured folder token:", folderToken)
 
 	// 初始化批量下载报告
-	report := &BatchDownloadReport{
-		StartTime: time.Now(),
-		Results:   make([]DownloadResult, 0),
-	}
+	report := newBatchDownloadReport()
 
-	// 使用带缓冲的 channel，避免死锁
-	// 缓冲区大小设置为1000，足以处理大多数批量下载场景
-	resultChan := make(chan DownloadResult, 1000)
-	wg := sync.WaitGroup{}
+	// 遍历到的文档提交到下载流水线，读取内容与下载图片并发进行
+	pipeline := newDownloadPipeline(ctx, client)
 
-	// Recursively go through the folder and download the documents
-	var processFolder func(ctx context.Context, folderPath, folderToken string) error
-	processFolder = func(ctx context.Context, folderPath, folderToken string) error {
-		files, err := client.GetDriveFolderFileList(ctx, nil, &folderToken)
-		if err != nil {
-			return err
-		}
-		opts := DownloadOpts{outputDir: folderPath, dump: dlOpts.dump, batch: false}
-		for _, file := range files {
-			if file.Type == "folder" {
-				_folderPath := filepath.Join(folderPath, file.Name)
-				if err := processFolder(ctx, _folderPath, file.Token); err != nil {
-					return err
-				}
-			} else if file.Type == "docx" {
-				// concurrently download the document
-				report.TotalFiles++
-				wg.Add(1)
-				go func(_url string) {
-					defer wg.Done()
-					result := downloadDocumentWithResult(ctx, client, _url, &opts)
-					resultChan <- result
-				}(file.URL)
-			}
-		}
-		return nil
-	}
-	if err := processFolder(ctx, dlOpts.outputDir, folderToken); err != nil {
-		return err
-	}
-
-	// 等待所有下载完成并收集结果
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	// 收集所有下载结果
-	for result := range resultChan {
-		report.Results = append(report.Results, result)
-		if result.Status == "success" {
-			report.SuccessCount++
-		} else {
-			report.ErrorCount++
-		}
+	// 同一文件夹下标题相同的文档按遍历顺序去重命名
+	walker := newFolderWalker(client, pipeline, report, newFileNamer())
+	err = walker.walk(ctx, dlOpts.outputDir, folderToken, nil, 0)
+	// 遍历出错时也要等待已提交的文档处理完
+	results := pipeline.wait()
+	if err != nil {
+		return nil, err
 	}
-
-	// 完成报告
-	report.EndTime = time.Now()
-	report.Duration = report.EndTime.Sub(report.StartTime).String()
-
-	// 生成并保存下载报告
-	if err := generateDownloadReport(report, dlOpts.outputDir); err != nil {
-		fmt.Printf("Warning: Failed to generate download report: %v\n", err)
+	if report.TotalFiles == 0 && !dlOpts.forceEmpty {
+		return report, errNoDocuments
 	}
 
-	// 打印下载摘要
-	printDownloadSummary(report)
-
-	return nil
+	finishBatchReport(report, results)
+	return report, nil
 }
 
-func downloadWiki(ctx context.Context, client *core.Client, url string) error {
+func downloadWiki(ctx context.Context, client core.API, url string) (*BatchDownloadReport, error) {
 	prefixURL, spaceID, err := utils.ValidateWikiURL(url)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	wikiName, err := client.GetWikiName(ctx, spaceID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if wikiName == "" {
-		return fmt.Errorf("failed to GetWikiName")
-	}
-	
-	// 使用wiki名称创建根文件夹
-	folderPath := filepath.Join(dlOpts.outputDir, utils.SanitizeFileName(wikiName))
-	if err := os.MkdirAll(folderPath, 0o755); err != nil {
-		return err
+		return nil, fmt.Errorf("failed to GetWikiName")
 	}
 
 	// 初始化批量下载报告
-	report := &BatchDownloadReport{
-		StartTime: time.Now(),
-		Results:   make([]DownloadResult, 0),
-	}
-
-	// 使用带缓冲的 channel，避免死锁
-	// 缓冲区大小设置为1000，足以处理大多数批量下载场景
-	resultChan := make(chan DownloadResult, 1000)
-
-	var maxConcurrency = 10 // Set the maximum concurrency level
-	wg := sync.WaitGroup{}
-	semaphore := make(chan struct{}, maxConcurrency) // Create a semaphore with the maximum concurrency level
-
-	var downloadWikiNode func(ctx context.Context,
-		client *core.Client,
-		spaceID string,
-		parentPath string,
-		parentNodeToken *string) error
-
-	downloadWikiNode = func(ctx context.Context,
-		client *core.Client,
-		spaceID string,
-		folderPath string,
-		parentNodeToken *string) error {
-		nodes, err := client.GetWikiNodeList(ctx, spaceID, parentNodeToken)
-		if err != nil {
-			return err
-		}
-		for _, n := range nodes {
-			// 创建当前节点的文件夹路径，使用节点标题
-			currentPath := folderPath
-			
-			// 如果是有子文档的wiki节点，创建以标题命名的文件夹
-			if n.HasChild {
-				currentPath = filepath.Join(folderPath, utils.SanitizeFileName(n.Title))
-				// 确保文件夹存在
-				if err := os.MkdirAll(currentPath, 0o755); err != nil {
-					return err
-				}
-				
-				// 递归处理子节点
-				if err := downloadWikiNode(ctx, client,
-					spaceID, currentPath, &n.NodeToken); err != nil {
-					return err
-				}
-			}
-			
-			// 如果是文档，下载它
-			if n.ObjType == "docx" {
-				opts := DownloadOpts{outputDir: folderPath, dump: dlOpts.dump, batch: false}
-				report.TotalFiles++
-				wg.Add(1)
-				semaphore <- struct{}{}
-				go func(_url string) {
-					defer func() {
-						wg.Done()
-						<-semaphore
-					}()
-					result := downloadDocumentWithResult(ctx, client, _url, &opts)
-					resultChan <- result
-				}(prefixURL + "/wiki/" + n.NodeToken)
-			}
+	report := newBatchDownloadReport()
+
+	// 遍历到的文档提交到下载流水线，读取内容与下载图片并发进行
+	pipeline := newDownloadPipeline(ctx, client)
+
+	// 同一节点下标题相同的文档按遍历顺序去重命名
+	walker := newWikiWalker(client, pipeline, report, newFileNamer(), prefixURL, spaceID)
+
+	// 使用wiki名称作为根文件夹，在下载文档时按需创建
+	folderPath, err := walker.rootDir(ctx, dlOpts.outputDir, wikiName)
+	if err != nil {
+		pipeline.wait()
+		return nil, err
+	}
+	err = walker.walk(ctx, folderPath, nil, nil, 0)
+	// 遍历出错时也要等待已提交的文档处理完
+	results := pipeline.wait()
+	if err != nil {
+		return nil, err
+	}
+	if report.TotalFiles == 0 && !dlOpts.forceEmpty {
+		return report, errNoDocuments
+	}
+	if !dlOpts.dryRun {
+		if err := os.MkdirAll(folderPath, 0o755); err != nil {
+			return nil, err
 		}
-		return nil
 	}
 
-	if err = downloadWikiNode(ctx, client, spaceID, folderPath, nil); err != nil {
-		return err
+	// 导出权限快照，只写入元数据不影响文档输出
+	if dlOpts.withPermissions {
+		if err := writeSpacePermissions(ctx, client, spaceID, wikiName, folderPath, walker.permNodes); err != nil {
+			fmt.Printf("Warning: Failed to write the permission snapshot: %v\n", err)
+		}
 	}
 
-	// 等待所有下载完成并收集结果
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+	finishBatchReport(report, results)
+	return report, nil
+}
 
-	// 收集所有下载结果
-	for result := range resultChan {
+// finishBatchReport 按遍历顺序收集下载结果并完成报告：改写文档链接，补充清单、去重等记录，
+// 保存报告文件并打印摘要
+func finishBatchReport(report *BatchDownloadReport, results []DownloadResult) {
+	for _, result := range results {
 		report.Results = append(report.Results, result)
-		if result.Status == "success" {
+		switch result.Status {
+		case "success":
 			report.SuccessCount++
-		} else {
+		case "skipped":
+			report.SkippedCount++
+		case statusPlanned:
+			report.PlannedCount++
+		default:
 			report.ErrorCount++
 		}
 	}
 
 	// 完成报告
-	report.EndTime = time.Now()
+	report.EndTime = dlConfig.Output.Now()
 	report.Duration = report.EndTime.Sub(report.StartTime).String()
+	if err := runLinks.rewrite(report, dlOpts.outputDir); err != nil {
+		fmt.Printf("Warning: Failed to rewrite document links: %v\n", err)
+	}
+	runDedup.fillReport(report)
+	runPathBudget.fillReport(report)
+	runManifest.fillReport(report)
+	runResolutions.fillReport(report)
+	runLegacyMap.fillReport(report)
+	fillRunMetrics(report)
 
 	// 生成并保存下载报告
 	if err := generateDownloadReport(report, dlOpts.outputDir); err != nil {
@@ -372,17 +685,36 @@ func downloadWiki(ctx context.Context, client *core.Client, url string) error {
 
 	// 打印下载摘要
 	printDownloadSummary(report)
+}
 
-	return nil
+// newBatchDownloadReport 初始化批量下载报告，记录程序版本、构建信息和输出兼容版本
+func newBatchDownloadReport() *BatchDownloadReport {
+	compatVersion, _, _ := dlConfig.Output.ResolveCompatVersion()
+	build := currentBuildInfo()
+	return &BatchDownloadReport{
+		Version:       build.Version,
+		CompatVersion: compatVersion,
+		Build:         build,
+		OutputDir:     dlOpts.outputDir,
+		StartTime:     dlConfig.Output.Now(),
+		Results:       make([]DownloadResult, 0),
+	}
 }
 
 // generateDownloadReport 生成下载报告文件
 func generateDownloadReport(report *BatchDownloadReport, outputDir string) error {
-	reportPath := filepath.Join(outputDir, fmt.Sprintf("report_%s.json", 
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return err
+	}
+	reportPath := filepath.Join(outputDir, fmt.Sprintf("report_%s.json",
 		report.StartTime.Format("20060102_150405")))
-	
+
 	reportData := utils.PrettyPrint(report)
-	return os.WriteFile(reportPath, []byte(reportData), 0o644)
+	if err := utils.WriteFileDurable(reportPath, dlConfig.Output.NormalizeText([]byte(reportData)), 0o644); err != nil {
+		return err
+	}
+	runFiles.Add(reportPath)
+	return nil
 }
 
 // printDownloadSummary 打印下载摘要
@@ -391,10 +723,59 @@ func printDownloadSummary(report *BatchDownloadReport) {
 	fmt.Println("批量下载完成摘要")
 	fmt.Println(strings.Repeat("=", 50))
 	fmt.Printf("总文件数: %d\n", report.TotalFiles)
+	if report.PlannedCount > 0 {
+		fmt.Printf("计划下载: %d\n", report.PlannedCount)
+	}
 	fmt.Printf("成功下载: %d\n", report.SuccessCount)
+	if report.SkippedCount > 0 {
+		fmt.Printf("跳过未变化: %d\n", report.SkippedCount)
+	}
 	fmt.Printf("下载失败: %d\n", report.ErrorCount)
 	fmt.Printf("下载耗时: %s\n", report.Duration)
-	
+	if report.ExcludedDrafts > 0 {
+		fmt.Printf("排除草稿: %d\n", report.ExcludedDrafts)
+	}
+	if report.ExcludedHidden > 0 {
+		fmt.Printf("排除隐藏节点: %d\n", report.ExcludedHidden)
+	}
+	if applied, failed := countOverrides(report); applied+failed > 0 {
+		fmt.Printf("覆盖规则: 应用 %d，失败 %d，详见报告中的 overrides\n", applied, failed)
+	}
+	if n := countWarnedDocuments(report); n > 0 {
+		fmt.Printf("有告警的文档: %d，详见报告中的 warnings\n", n)
+	}
+	printQualityReview(report)
+	if len(report.PathTruncations) > 0 {
+		fmt.Printf("截断路径: %d 个名称超出路径长度预算，原标题见报告中的 path_truncations\n",
+			len(report.PathTruncations))
+	}
+	if len(report.SkippedNodes) > 0 {
+		fmt.Printf("跳过节点: %d 个节点循环引用或层级过深，详见报告中的 skipped_nodes\n", len(report.SkippedNodes))
+	}
+	if len(report.LegacyUnmatched) > 0 {
+		fmt.Printf("旧路径映射: %d 条没有匹配到文档，详见报告中的 legacy_unmatched\n", len(report.LegacyUnmatched))
+	}
+	if len(report.Removed) > 0 {
+		pruned := 0
+		for _, doc := range report.Removed {
+			if doc.Pruned {
+				pruned++
+			}
+		}
+		fmt.Printf("远端已删除: %d 个文档，清理本地文件 %d 个，详见报告中的 removed\n", len(report.Removed), pruned)
+	}
+	if len(report.RewrittenLinks) > 0 {
+		total := 0
+		for _, count := range report.RewrittenLinks {
+			total += count
+		}
+		fmt.Printf("改写链接: %d 个文件中的 %d 个链接指向本地文档\n", len(report.RewrittenLinks), total)
+	}
+	if len(report.DedupLinks) > 0 {
+		fmt.Printf("去重链接: %d 个文件，节省 %d 字节\n",
+			len(report.DedupLinks), report.DedupBytesSaved)
+	}
+
 	if report.ErrorCount > 0 {
 		fmt.Println("\n失败的文件:")
 		for _, result := range report.Results {
@@ -403,11 +784,13 @@ func printDownloadSummary(report *BatchDownloadReport) {
 			}
 		}
 	}
-	
+
 	if report.SuccessCount > 0 {
 		fmt.Println("\n成功下载的文件:")
 		for _, result := range report.Results {
-			if result.Status == "success" {
+			if result.Status == "success" && result.Bytes > 0 {
+				fmt.Printf("  - %s -> %s %s (%d bytes)\n", result.URL, fileIcon, result.Filename, result.Bytes)
+			} else if result.Status == "success" {
 				fmt.Printf("  - %s -> %s\n", result.URL, result.Filename)
 			}
 		}
@@ -421,30 +804,386 @@ func handleDownloadCommand(url string) error {
 	if err != nil {
 		return err
 	}
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return credentialsError(configPath)
+	}
 	config, err := core.ReadConfigFromFile(configPath)
 	if err != nil {
 		return err
 	}
+	if config.Feishu.AppId == "" || config.Feishu.AppSecret == "" {
+		return credentialsError(configPath)
+	}
 	dlConfig = *config
+	// 项目配置在全局配置之上、命令行选项之下
+	if url, err = loadProjectConfig(url); err != nil {
+		return err
+	}
+	if err := dlConfig.Feishu.Validate(); err != nil {
+		return err
+	}
+	if err := dlConfig.Output.Validate(); err != nil {
+		return err
+	}
+	if err := dlConfig.Download.Validate(); err != nil {
+		return err
+	}
+	if err := dlConfig.Sheet.Validate(); err != nil {
+		return err
+	}
+	if err := dlConfig.Estimate.Validate(); err != nil {
+		return err
+	}
+	if dlOpts.maxConcurrency == 0 {
+		dlOpts.maxConcurrency = dlConfig.Download.Concurrency
+	}
+	if dlConfig.Output.HTML.Accessibility && dlConfig.Output.HTML.Lang == "" {
+		warnf("Warning: output.html.lang is not set, the documents are exported without a language\n")
+	}
+	if dlOpts.frontMatterSet {
+		dlConfig.Output.FrontMatter = dlOpts.frontMatter
+	}
+	if dlConfig.Output.Cover == "front_matter" && !dlConfig.Output.FrontMatter {
+		warnf("Warning: output.cover is front_matter but the front matter is disabled, covers are not exported\n")
+	}
+	if runSyncer, err = utils.NewSyncer(dlConfig.Output.Fsync); err != nil {
+		return err
+	}
+	sinks, err := parseSinks(append(append([]string{}, dlConfig.Output.Sinks...), dlOpts.sinks...))
+	if err != nil {
+		return err
+	}
+	if err := validateFormat(dlOpts.format); err != nil {
+		return err
+	}
+	if err := validateSyncOpts(&dlOpts); err != nil {
+		return err
+	}
+	if err := validateRewriteLinks(&dlOpts); err != nil {
+		return err
+	}
+	if err := validateFromFile(&dlOpts, url); err != nil {
+		return err
+	}
+	if err := validateConcurrency(&dlOpts); err != nil {
+		return err
+	}
+	if err := validateRetry(&dlOpts, url); err != nil {
+		return err
+	}
+	if err := validateTypes(&dlOpts); err != nil {
+		return err
+	}
+	if err := validateStatusAddr(&dlOpts); err != nil {
+		return err
+	}
+	if err := validateOutlineFormat(dlOpts.outlineFormat); err != nil {
+		return err
+	}
+	if err := validateDryRun(&dlOpts); err != nil {
+		return err
+	}
+	if dlOpts.retryReport != "" {
+		dlOpts.outputDir = retryRootDir(&dlOpts)
+	}
+	if dlOpts.format == formatChunks {
+		if err := validateChunkOpts(&dlOpts); err != nil {
+			return err
+		}
+		if dlOpts.chunksCombined {
+			runChunks = &chunkCollector{}
+		}
+	}
+
+	// 在启动时加载证书配置，避免运行中途才报错
+	httpClient, err := core.NewHTTPClient(dlConfig.HTTP)
+	if err != nil {
+		return err
+	}
 
 	// Instantiate the client
-	client := core.NewClient(
+	// 按配置限制请求频率，触发频率限制的请求自动退避重试
+	clientOpts := append(dlConfig.Feishu.ClientOptions(), dlConfig.Sheet.ClientOptions()...)
+	clientOpts = append(clientOpts, core.WithHTTPClient(httpClient), core.WithSyncer(runSyncer))
+	var api core.API = core.NewClient(
 		dlConfig.Feishu.AppId, dlConfig.Feishu.AppSecret,
+		clientOpts...,
 	)
-	ctx := context.Background()
+	// 统计实际发出的请求，缓存命中的调用不计入，报告中的 api_calls 可与估算结果对照
+	runMetrics = core.NewMetrics()
+	api = core.WithMiddleware(api, runMetrics.Middleware())
+	// 配置了本地缓存时，未变化的文档和图片直接从缓存读取
+	cache, err := dlConfig.Cache.Open()
+	if err != nil {
+		return err
+	}
+	if cache != nil {
+		api = core.NewDiskCachedAPI(api, cache)
+	}
+	// 批量下载时同一wiki节点会被多次查询，缓存节点信息避免重复请求
+	client := core.NewCachedAPI(api)
+	// 中断时不再开始新的请求，已提交的文档记为失败后照常生成报告
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// 状态接口的 /cancel 与中断相同
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 输出根目录中的 overrides.yaml 在开始下载前读取，规则有误时不开始下载
+	if runOverrides, err = loadOverrides(dlOpts.outputDir); err != nil {
+		return err
+	}
+	// 旧路径同样相对输出根目录，映射有误时不开始下载
+	if runLegacyMap, err = loadLegacyMap(dlOpts.legacyMap, dlOpts.outputDir); err != nil {
+		return err
+	}
+
+	// 需要查询接口的链接解析都记录在清单中，--pin-resolutions 时复用上一次的结果
+	runResolutions = newResolutionRecorder(dlOpts.outputDir, dlOpts.pinResolutions && !dlOpts.reResolve)
+
+	// 与 --wiki 或 --batch 一起使用时先下载文档，再生成链接指向本地文件的目录结构
+	outlineAfterDownload := dlOpts.wikiOutline && (dlOpts.wiki || dlOpts.batch)
+
+	// 按名称指定知识空间时，参数为可选的站点地址，解析出空间链接后按wiki模式下载
+	if dlOpts.spaceName != "" {
+		if dlOpts.batch {
+			return errors.New("--space-name can not be used with --batch")
+		}
+		if url, err = resolveSpaceURL(ctx, client, dlOpts.spaceName, url); err != nil {
+			return err
+		}
+		if _, _, err := utils.ValidateWikiURL(url); err != nil {
+			return errors.Errorf("invalid site url, expect one like https://example.feishu.cn")
+		}
+		dlOpts.wiki = true
+	}
+
+	// 如果启用了wikiOutline选项，只生成wiki或文件夹的目录结构
+	if dlOpts.wikiOutline && !outlineAfterDownload {
+		return generateOutline(ctx, client, url, nil)
+	}
+
+	if dlOpts.gitCommit {
+		if err := checkGitWorkTree(dlOpts.outputDir); err != nil {
+			return err
+		}
+	}
+
+	// 路径长度预算在遍历时分配，超长的标题在创建目录前就被截断
+	if dlOpts.maxPathBytes >= 0 {
+		runPathBudget = newPathBudget(dlOpts.maxPathBytes, dlConfig.Output.ImageDir)
+	}
+
+	if dlOpts.dedupAgainst != "" {
+		if runDedup, err = newDeduper(dlOpts.dedupAgainst, dlOpts.outputDir); err != nil {
+			return err
+		}
+	}
+
+	// 按内容哈希命名的图片存放在输出根目录，所有文档共用
+	if dlConfig.Output.UseHashImageNames && !dlConfig.Output.SkipImgDownload && !dlOpts.dryRun {
+		runImages = newImageStore(filepath.Join(dlOpts.outputDir, dlConfig.Output.ImageDir))
+	}
+
+	if !dlOpts.dryRun {
+		if runPostProcess, err = newPostProcessor(dlConfig.Output.PostProcess); err != nil {
+			return err
+		}
+	}
+
+	var urls []string
+	if dlOpts.fromFile != "" {
+		if urls, err = openURLList(dlOpts.fromFile); err != nil {
+			return err
+		}
+	} else if len(dlOpts.sources) > 0 {
+		urls = dlOpts.sources
+	}
+
+	// 批量和wiki下载（包括列表中有文件夹或知识空间时）、重试以及固定解析结果时记录清单，与上一次的清单比较生成变更记录，
+	// 同步时据此跳过未变化的文档。空跑时不记录，否则未遍历的文档会被当作已删除
+	if (dlOpts.batch || dlOpts.wiki || hasListRoots(urls) || dlOpts.pinResolutions || dlOpts.retryReport != "") && !dlOpts.dryRun {
+		runManifest = newManifestRecorder(dlOpts.outputDir)
+		runManifest.sync = dlOpts.sync
+		runManifest.prune = dlOpts.prune
+		runManifest.partial = dlOpts.retryReport != ""
+	}
+	// 链接在全部文档写入后统一改写，此时才知道每个文档的本地路径
+	if dlOpts.rewriteLinks && !dlOpts.dryRun {
+		runLinks = newLinkIndex()
+	}
+
+	// 多个文档时以单行进度代替逐条输出，状态接口读取同一份进度
+	if dlOpts.retryReport != "" || dlOpts.hasURLList() || dlOpts.batch || dlOpts.wiki || dlOpts.statusAddr != "" {
+		runProgress = newProgressLine()
+	}
+	if dlOpts.statusAddr != "" {
+		stopStatus, err := startStatusServer(dlOpts.statusAddr,
+			statusHandler(ctx, cancel, runProgress, dlConfig.Download.StatusToken))
+		if err != nil {
+			return err
+		}
+		defer stopStatus()
+	}
+
+	var report *BatchDownloadReport
+	if dlOpts.retryReport != "" {
+		report, err = retryDownloads(ctx, client, dlOpts.retryReport)
+	} else if dlOpts.hasURLList() {
+		report, err = downloadURLList(ctx, client, urls)
+	} else if dlOpts.batch {
+		report, err = downloadDocuments(ctx, client, url)
+	} else if dlOpts.wiki {
+		report, err = downloadWiki(ctx, client, url)
+	} else if dlOpts.dryRun {
+		report = newBatchDownloadReport()
+		report.TotalFiles = 1
+		report.PlannedCount = 1
+		report.Results = append(report.Results, plannedResult(url, &dlOpts))
+		report.EndTime = dlConfig.Output.Now()
+		report.Duration = report.EndTime.Sub(report.StartTime).String()
+		fillRunMetrics(report)
+		err = generateDownloadReport(report, dlOpts.outputDir)
+	} else {
+		report, err = downloadSingle(ctx, client, url)
+	}
+	if errors.Is(err, errNoDocuments) {
+		return handleNoDocuments(report)
+	}
+	if err != nil {
+		return err
+	}
+	// 空跑只生成报告，不写入任何文档、清单和附加输出
+	if dlOpts.dryRun {
+		if report.Estimate != nil {
+			printEstimate(report.Estimate)
+		}
+		return nil
+	}
+	if err := runChunks.write(dlOpts.outputDir); err != nil {
+		return err
+	}
+	if err := runImages.write(); err != nil {
+		return err
+	}
+	// 清单记录的文档必须先落盘
+	if err := runSyncer.Flush(); err != nil {
+		return err
+	}
+	if err := runManifest.write(report); err != nil {
+		return err
+	}
+	if outlineAfterDownload {
+		if err := generateOutline(ctx, client, url, localOutlinePaths(report)); err != nil {
+			return err
+		}
+	}
+	// 处理命令在提交和附加输出之前执行，它们包含命令修改后的文件
+	if err := runPostProcess.run(ctx, dlOpts.outputDir, report); err != nil {
+		return err
+	}
 
-	// 如果启用了wikiOutline选项，只生成wiki目录结构
-	if dlOpts.wikiOutline {
-		return generateWikiOutline(ctx, client, url)
+	if dlOpts.gitCommit {
+		if err := publishGitCommit(report, dlOpts.outputDir); err != nil {
+			return err
+		}
+	}
+	// 附加输出目标在输出目录完整写入后执行，失败不影响输出目录
+	if err := runSinks(sinks, dlOpts.outputDir, report); err != nil {
+		return err
 	}
+	if dlOpts.retryReport != "" {
+		return retryExitError(report)
+	}
+	return nil
+}
 
-	if dlOpts.batch {
-		return downloadDocuments(ctx, client, url)
+// credentialsError 配置文件或其中的应用凭证缺失时提示如何配置
+func credentialsError(configPath string) error {
+	return errors.Errorf(
+		"app id and app secret are missing in %s, create an app on "+
+			"https://open.feishu.cn/app and run `feishu2md config --appId <id> --appSecret <secret>`",
+		configPath)
+}
+
+// formatFallback lute 格式化文档失败（panic）时改为写入未格式化的内容，并在结果中记录
+// format_failed 告警；--strict-format 时以及其他错误原样返回
+func formatFallback(doc *fetchedDocument, title string, err error, opts *DownloadOpts) error {
+	var formatErr *core.FormatError
+	if !errors.As(err, &formatErr) || opts.strictFormat {
+		return err
 	}
+	warning := fmt.Sprintf("format_failed: %v", formatErr.Panic)
+	doc.warnings = append(doc.warnings, warning)
+	warnf("Warning: %s: %s, writing the unformatted markdown\n", title, warning)
+	return nil
+}
 
-	if dlOpts.wiki {
-		return downloadWiki(ctx, client, url)
+// countOverrides 统计应用成功和失败的覆盖规则
+func countOverrides(report *BatchDownloadReport) (applied, failed int) {
+	for _, result := range report.Results {
+		for _, override := range result.Overrides {
+			if override.Status == "failed" {
+				failed++
+			} else {
+				applied++
+			}
+		}
 	}
+	return applied, failed
+}
 
-	return downloadDocument(ctx, client, url, &dlOpts)
+// countWarnedDocuments 有告警的文档数
+func countWarnedDocuments(report *BatchDownloadReport) int {
+	n := 0
+	for _, result := range report.Results {
+		if len(result.Warnings) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// handleNoDocuments 没有找到文档时不生成报告和目录，以单独的退出码提醒流水线
+func handleNoDocuments(report *BatchDownloadReport) error {
+	msg := "No documents found matching the criteria, "
+	if report != nil && report.ExcludedDrafts > 0 {
+		msg += fmt.Sprintf("%d drafts were excluded by --exclude-drafts %q, which is the likely cause ",
+			report.ExcludedDrafts, dlOpts.excludeDrafts)
+	} else if report != nil && report.ExcludedHidden > 0 {
+		msg += fmt.Sprintf("%d nodes hidden from space visitors were excluded, "+
+			"which is the likely cause (add --include-hidden to export them) ", report.ExcludedHidden)
+	} else {
+		msg += "check that the url is correct and the app can access the documents "
+	}
+	msg += "(use --force-empty to write an empty report anyway)"
+	if dlOpts.emptyExitCode == 0 {
+		fmt.Println(msg)
+		return nil
+	}
+	return cli.Exit(msg, dlOpts.emptyExitCode)
+}
+
+// isExcludedHidden 接口标明对访客隐藏的节点默认不导出，指定 --include-hidden 时导出
+func isExcludedHidden(n *core.WikiNode) bool {
+	return n.Hidden != nil && *n.Hidden && !dlOpts.includeHidden
+}
+
+// isExcludedDraft 标题以 --exclude-drafts 指定的前缀开头时视为草稿
+func isExcludedDraft(title string) bool {
+	return dlOpts.excludeDrafts != "" &&
+		strings.HasPrefix(strings.TrimSpace(title), dlOpts.excludeDrafts)
+}
+
+// relativeLink 返回相对文档所在目录的链接，位于文档目录内时以 ./ 开头
+func relativeLink(docDir, path string) string {
+	rel, err := filepath.Rel(docDir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasPrefix(rel, "../") {
+		return rel
+	}
+	return "./" + rel
 }
@@ -0,0 +1,721 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDownloadTest(t *testing.T) string {
+	t.Helper()
+	outputDir := t.TempDir()
+	dlConfig = *core.NewConfig("", "")
+	dlOpts = DownloadOpts{outputDir: outputDir}
+	t.Cleanup(func() {
+		dlOpts = DownloadOpts{}
+		dlConfig = core.Config{}
+		runManifest = nil
+		runLinks = nil
+		runImages = nil
+		runPostProcess = nil
+		runResolutions = nil
+		runOverrides = nil
+		runLegacyMap = nil
+	})
+	return outputDir
+}
+
+func assertFileExists(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected file %s: %v", path, err)
+	}
+}
+
+func TestDownloadWiki(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	api.failDocs["docD"] = true
+	api.addDoc("", "A")
+	api.addNode("", "wikB", "mindnote", "bmnB", "B")
+	api.addDoc("", "C")
+	api.addDoc("", "D")
+	api.addDoc("wikA", "A1")
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 4, report.TotalFiles)
+	assert.Equal(t, 3, report.SuccessCount)
+	assert.Equal(t, 1, report.ErrorCount)
+
+	// 有子节点的文档与子节点目录并列存放
+	assertFileExists(t, filepath.Join(outputDir, "Space", "A.md"))
+	assertFileExists(t, filepath.Join(outputDir, "Space", "A", "A1.md"))
+	assertFileExists(t, filepath.Join(outputDir, "Space", "C.md"))
+	data, err := os.ReadFile(filepath.Join(outputDir, "Space", "A", "A1.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "content of A1")
+		assert.Contains(t, string(data), "https://domain.feishu.cn/wiki/wikA1")
+	}
+}
+
+func TestDownloadWikiHashImageNames(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlConfig.Output.UseHashImageNames = true
+	imageDir := filepath.Join(outputDir, dlConfig.Output.ImageDir)
+	runImages = newImageStore(imageDir)
+	api := newFakeWiki()
+	api.images["docA"] = []string{"imgShared"}
+	api.images["docA1"] = []string{"imgShared", "imgOther"}
+	api.images["docA2"] = []string{"imgShared"}
+	api.addDoc("", "A")
+	api.addDoc("wikA", "A1")
+	api.addDoc("wikA", "A2")
+	url := "https://domain.feishu.cn/wiki/settings/123"
+
+	_, err := downloadWiki(context.Background(), api, url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// 共用的图片只下载一次，以内容哈希命名
+	assert.Equal(t, 2, api.callCount("DownloadImageRaw"))
+	assert.Equal(t, 0, api.callCount("DownloadImage"))
+	sum := sha256.Sum256([]byte("imgShared"))
+	shared := hex.EncodeToString(sum[:])[:imageHashLen] + ".png"
+	assertFileExists(t, filepath.Join(imageDir, shared))
+
+	// 链接相对各自文档所在的目录
+	data, err := os.ReadFile(filepath.Join(outputDir, "Space", "A.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "](../static/"+shared+")")
+	}
+	data, err = os.ReadFile(filepath.Join(outputDir, "Space", "A", "A1.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "](../../static/"+shared+")")
+	}
+	assert.NoError(t, runImages.write())
+	assertFileExists(t, filepath.Join(imageDir, imageIndexFileName))
+
+	// 再次运行时已下载的图片不再请求
+	runImages = newImageStore(imageDir)
+	_, err = downloadWiki(context.Background(), api, url)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, api.callCount("DownloadImageRaw"))
+}
+
+func TestDownloadWikiFileNodes(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlConfig.Output.FileNodeExtensions = []string{"pdf", "PPTX"}
+	runManifest = newManifestRecorder(outputDir)
+	api := newFakeWiki()
+	api.driveFiles = map[string]string{"boxS": "slides", "boxZ": "archive"}
+	api.addDoc("", "A")
+	api.addNode("", "wikZ", "file", "boxZ", "backup.zip")
+	api.addNode("wikA", "wikS", "file", "boxS", "slides.pptx")
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// zip不在 output.file_node_extensions 中，不计入总数
+	assert.Equal(t, 2, report.TotalFiles)
+	assert.Equal(t, 2, report.SuccessCount)
+	if assert.Len(t, report.Results, 2) {
+		// 子节点先于上级文档提交
+		assert.Equal(t, "slides.pptx", report.Results[0].Filename)
+		assert.Equal(t, int64(len("slides")), report.Results[0].Bytes)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Space", "A", "slides.pptx"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "slides", string(data))
+	}
+	_, err = os.Stat(filepath.Join(outputDir, "Space", "backup.zip"))
+	assert.True(t, os.IsNotExist(err))
+
+	if assert.NoError(t, runManifest.write(report)) {
+		tags, err := os.ReadFile(filepath.Join(outputDir, tagsFileName))
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(tags), fileIcon+" [slides.pptx](<Space/A/slides.pptx>)")
+		}
+	}
+
+	// --types docx 跳过上传的文件
+	dlOpts.types = docxType
+	api.calls["DownloadDriveFile"] = 0
+	report, err = downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, report.TotalFiles)
+		assert.Equal(t, 0, api.callCount("DownloadDriveFile"))
+	}
+}
+
+func TestDownloadDocuments(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeAPI()
+	api.docs = map[string]string{"doc1": "Doc1", "doc2": "Doc2"}
+	api.folders["fld"] = []*lark.GetDriveFileListRespFile{
+		{Token: "doc1", Name: "Doc1", Type: "docx", URL: "https://domain.feishu.cn/docx/doc1"},
+		{Token: "sub", Name: "Sub", Type: "folder"},
+		{Token: "bmn", Name: "Mind", Type: "mindnote", URL: "https://domain.feishu.cn/mindnotes/bmn"},
+	}
+	api.folders["sub"] = []*lark.GetDriveFileListRespFile{
+		{Token: "doc2", Name: "Doc2", Type: "docx", URL: "https://domain.feishu.cn/docx/doc2"},
+	}
+
+	report, err := downloadDocuments(context.Background(), api, "https://domain.feishu.cn/drive/folder/fld")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, report.TotalFiles)
+	assert.Equal(t, 2, report.SuccessCount)
+	assertFileExists(t, filepath.Join(outputDir, "Doc1.md"))
+	assertFileExists(t, filepath.Join(outputDir, "Sub", "Doc2.md"))
+}
+
+// tableRow 返回markdown中第一个单元格为first的表格行，单元格去掉首尾空格，转义的 \| 不分隔单元格
+func tableRow(md, first string) []string {
+	for _, line := range strings.Split(md, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 2 || line[0] != '|' || line[len(line)-1] != '|' {
+			continue
+		}
+		var cells []string
+		var cell strings.Builder
+		row := line[1 : len(line)-1]
+		for i := 0; i < len(row); i++ {
+			switch {
+			case row[i] == '\\' && i+1 < len(row) && row[i+1] == '|':
+				cell.WriteString(`\|`)
+				i++
+			case row[i] == '|':
+				cells = append(cells, strings.TrimSpace(cell.String()))
+				cell.Reset()
+			default:
+				cell.WriteByte(row[i])
+			}
+		}
+		cells = append(cells, strings.TrimSpace(cell.String()))
+		if cells[0] == first {
+			return cells
+		}
+	}
+	return nil
+}
+
+func TestDownloadSheets(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	runManifest = newManifestRecorder(outputDir)
+	api := newFakeAPI()
+	api.sheets["sht"] = &core.Spreadsheet{Title: "Budget", Tabs: []*core.SheetTab{
+		{Title: "2024", Rows: [][]string{{"Item", "Cost"}, {"a|b", "1.5"}}},
+	}}
+	api.sheets["bas"] = &core.Spreadsheet{Title: "Tasks", Tabs: []*core.SheetTab{
+		{Title: "Open", Rows: [][]string{{"Name", "Owner"}, {"Write, review", "Ann"}}},
+		{Title: "Done", Rows: [][]string{{"Name"}}},
+	}}
+	api.folders["fld"] = []*lark.GetDriveFileListRespFile{
+		{Token: "sht", Name: "Budget", Type: "sheet", URL: "https://domain.feishu.cn/sheets/sht"},
+		{Token: "bas", Name: "Tasks", Type: "bitable", URL: "https://domain.feishu.cn/base/bas"},
+	}
+
+	report, err := downloadDocuments(context.Background(), api, "https://domain.feishu.cn/drive/folder/fld")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, report.SuccessCount)
+	if assert.Len(t, report.Results, 2) {
+		assert.Equal(t, "Budget.md", report.Results[0].Filename)
+		assert.Equal(t, "Tasks.md", report.Results[1].Filename)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Budget.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "## 2024")
+		// lute 会按列宽补齐空格，按单元格比较
+		assert.Equal(t, []string{`a\|b`, "1.5"}, tableRow(string(data), `a\|b`))
+	}
+	assert.Equal(t, bitableType, runManifest.manifest.Documents["bas"].Type)
+
+	// csv 格式每个工作表一个文件，只有一个工作表时不追加名称
+	dlConfig.Output.SheetFormat = core.SheetFormatCSV
+	report, err = downloadDocuments(context.Background(), api, "https://domain.feishu.cn/drive/folder/fld")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Budget.csv", report.Results[0].Filename)
+	data, err = os.ReadFile(filepath.Join(outputDir, "Tasks.Open.csv"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Name,Owner\n\"Write, review\",Ann\n", string(data))
+	}
+	assertFileExists(t, filepath.Join(outputDir, "Tasks.Done.csv"))
+
+	// 单个表格链接
+	dlOpts.outputDir = filepath.Join(outputDir, "single")
+	assert.NoError(t, downloadDocument(context.Background(), api, "https://domain.feishu.cn/sheets/sht", &dlOpts))
+	assertFileExists(t, filepath.Join(outputDir, "single", "Budget.csv"))
+
+	// --types docx 跳过表格
+	dlOpts.types = docxType
+	_, err = downloadDocuments(context.Background(), api, "https://domain.feishu.cn/drive/folder/fld")
+	assert.ErrorIs(t, err, errNoDocuments)
+}
+
+func TestDownloadWikiDumpDir(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dumpDir := filepath.Join(t.TempDir(), "dumps")
+	dlOpts.dump = true
+	dlOpts.dumpDir = dumpDir
+	api := newFakeWiki()
+	api.addDoc("", "A")
+
+	_, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// 批量模式下转储文件按用户设置集中存放，不混入Markdown目录
+	assertFileExists(t, filepath.Join(dumpDir, "docA.json"))
+	_, err = os.Stat(filepath.Join(outputDir, "Space", "docA.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadNoDocuments(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(api *fakeAPI)
+		run   func(ctx context.Context, api core.API) (*BatchDownloadReport, error)
+	}{
+		{
+			name:  "empty wiki",
+			setup: func(api *fakeAPI) { api.wikiName = "Space" },
+			run: func(ctx context.Context, api core.API) (*BatchDownloadReport, error) {
+				return downloadWiki(ctx, api, "https://domain.feishu.cn/wiki/settings/123")
+			},
+		},
+		{
+			name:  "empty folder",
+			setup: func(api *fakeAPI) {},
+			run: func(ctx context.Context, api core.API) (*BatchDownloadReport, error) {
+				return downloadDocuments(ctx, api, "https://domain.feishu.cn/drive/folder/fld")
+			},
+		},
+		{
+			// 有子节点的wiki节点全部被 --types 过滤时，也不创建以标题命名的目录
+			name: "filtered wiki",
+			setup: func(api *fakeAPI) {
+				dlOpts.types = sheetType
+				api.wikiName = "Space"
+				api.addDoc("", "A")
+				api.addDoc("wikA", "A1")
+				api.addNode("wikA1", "wikA2", "mindnote", "bmnA2", "A2")
+			},
+			run: func(ctx context.Context, api core.API) (*BatchDownloadReport, error) {
+				return downloadWiki(ctx, api, "https://domain.feishu.cn/wiki/settings/123")
+			},
+		},
+		{
+			// 文件夹中只有不支持的类型时，视为全部被过滤
+			name: "nothing matched",
+			setup: func(api *fakeAPI) {
+				api.folders["fld"] = []*lark.GetDriveFileListRespFile{
+					{Token: "bmn", Name: "Mind", Type: "mindnote", URL: "https://domain.feishu.cn/mindnotes/bmn"},
+				}
+			},
+			run: func(ctx context.Context, api core.API) (*BatchDownloadReport, error) {
+				return downloadDocuments(ctx, api, "https://domain.feishu.cn/drive/folder/fld")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := filepath.Join(setupDownloadTest(t), "out")
+			dlOpts.outputDir = outputDir
+			api := newFakeAPI()
+			tt.setup(api)
+
+			_, err := tt.run(context.Background(), api)
+			assert.ErrorIs(t, err, errNoDocuments)
+			_, statErr := os.Stat(outputDir)
+			assert.True(t, os.IsNotExist(statErr), "output directory should not be created")
+
+			// --force-empty 时照常生成报告
+			dlOpts.forceEmpty = true
+			report, err := tt.run(context.Background(), api)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, report.TotalFiles)
+			matches, _ := filepath.Glob(filepath.Join(outputDir, "report_*.json"))
+			assert.Len(t, matches, 1)
+			_, statErr = os.Stat(filepath.Join(outputDir, "Space", "A"))
+			assert.True(t, os.IsNotExist(statErr), "no directory for filtered nodes")
+		})
+	}
+}
+
+func TestHandleNoDocumentsExitCode(t *testing.T) {
+	setupDownloadTest(t)
+	dlOpts.emptyExitCode = 3
+	err := handleNoDocuments(nil)
+	if exitErr, ok := err.(interface{ ExitCode() int }); assert.True(t, ok) {
+		assert.Equal(t, 3, exitErr.ExitCode())
+	}
+
+	dlOpts.emptyExitCode = 0
+	assert.NoError(t, handleNoDocuments(nil))
+}
+
+func TestDownloadWikiExcludeDrafts(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.excludeDrafts = "[草稿]"
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addNode("", "wikB", "docx", "docB", "[草稿] B")
+	api.addDoc("wikB", "B1")
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, report.TotalFiles)
+	assert.Equal(t, 1, report.ExcludedDrafts)
+	assertFileExists(t, filepath.Join(outputDir, "Space", "A.md"))
+	_, err = os.Stat(filepath.Join(outputDir, "Space", "[草稿] B"))
+	assert.True(t, os.IsNotExist(err), "draft subtree should be skipped")
+
+	// 全部被排除时提示草稿过滤是可能的原因
+	api.wikiNodes[""] = api.wikiNodes[""][1:]
+	report, err = downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	assert.ErrorIs(t, err, errNoDocuments)
+	dlOpts.emptyExitCode = 3
+	if err := handleNoDocuments(report); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "--exclude-drafts")
+	}
+}
+
+func TestDownloadWikiIncludeHidden(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.excludeDrafts = "[草稿]"
+	hidden := true
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addDoc("", "B").Hidden = &hidden
+	api.addDoc("wikB", "B1")
+	// 隐藏的草稿计为隐藏节点
+	api.addNode("", "wikC", "docx", "docC", "[草稿] C").Hidden = &hidden
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, report.TotalFiles)
+	assert.Equal(t, 2, report.ExcludedHidden)
+	assert.Equal(t, 0, report.ExcludedDrafts)
+	_, err = os.Stat(filepath.Join(outputDir, "Space", "B"))
+	assert.True(t, os.IsNotExist(err), "hidden subtree should be skipped")
+
+	dlOpts.includeHidden = true
+	report, err = downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 3, report.TotalFiles)
+	assert.Equal(t, 0, report.ExcludedHidden)
+	assert.Equal(t, 1, report.ExcludedDrafts)
+	assertFileExists(t, filepath.Join(outputDir, "Space", "B", "B1.md"))
+}
+
+func TestDownloadDocumentText(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.format = formatText
+	api := newFakeAPI()
+	api.docs = map[string]string{"doc1": "Doc1"}
+
+	err := downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/doc1", &dlOpts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Doc1.txt"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Doc1\n\ncontent of Doc1\n", string(data))
+	}
+	meta, err := os.ReadFile(filepath.Join(outputDir, "Doc1.meta.json"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(meta), `"url": "https://domain.feishu.cn/docx/doc1"`)
+		assert.Contains(t, string(meta), `"text_file": "Doc1.txt"`)
+	}
+	_, err = os.Stat(filepath.Join(outputDir, "Doc1.md"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Error(t, validateFormat("html"))
+}
+
+func TestDownloadDocumentFrontMatter(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlConfig.Output.FrontMatter = true
+	api := newFakeAPI()
+	api.docs = map[string]string{"doc1": "Doc1"}
+
+	err := downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/doc1", &dlOpts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Doc1.md"))
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(string(data), "---\ntitle: \"Doc1\"\nsource: \"https://domain.feishu.cn/docx/doc1\"\ntoken: \"doc1\"\n"))
+		assert.Contains(t, string(data), "downloaded_at: ")
+		assert.NotContains(t, string(data), "原文档链接")
+	}
+}
+
+func TestDownloadDocumentAccessibility(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlConfig.Output.HTML.Accessibility = true
+	api := newFakeAPI()
+	api.docs = map[string]string{"doc1": "Doc1"}
+	api.images["doc1"] = []string{"img1"}
+
+	// 修正的问题记录在下载结果中
+	result := downloadDocumentWithResult(context.Background(), api, "https://domain.feishu.cn/docx/doc1", &dlOpts)
+	assert.Equal(t, "success", result.Status)
+	assert.Equal(t, []string{`1 images have no caption, their alt text is "image"`}, result.Warnings)
+	data, err := os.ReadFile(filepath.Join(outputDir, "Doc1.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "![image](")
+	}
+}
+
+func TestFormatFallback(t *testing.T) {
+	setupDownloadTest(t)
+	formatErr := &core.FormatError{Panic: "index out of range"}
+
+	// 格式化失败时写入未格式化的内容并记录告警
+	doc := &fetchedDocument{}
+	assert.NoError(t, formatFallback(doc, "A", formatErr, &dlOpts))
+	assert.Equal(t, []string{"format_failed: index out of range"}, doc.warnings)
+
+	// --strict-format 和其他错误原样返回
+	doc = &fetchedDocument{}
+	dlOpts.strictFormat = true
+	assert.Equal(t, formatErr, formatFallback(doc, "A", formatErr, &dlOpts))
+	assert.Empty(t, doc.warnings)
+	dlOpts.strictFormat = false
+	assert.Error(t, formatFallback(doc, "A", fmt.Errorf("unknown output.compat_version"), &dlOpts))
+	assert.NoError(t, formatFallback(doc, "A", nil, &dlOpts))
+}
+
+func TestDownloadDocumentPostProcess(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeAPI()
+	api.docs = map[string]string{"doc1": "Doc1"}
+	url := "https://domain.feishu.cn/docx/doc1"
+	var err error
+	// 文件路径是最后一个参数，sh -c 中为 $0
+	runPostProcess, err = newPostProcessor(core.PostProcessConfig{
+		FileCommand: []string{"sh", "-c", `cat > "$0.json" && echo banner >> "$0" && echo processed`},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, downloadDocument(context.Background(), api, url, &dlOpts)) {
+		return
+	}
+	outputPath := filepath.Join(outputDir, "Doc1.md")
+	data, err := os.ReadFile(outputPath)
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasSuffix(string(data), "banner\n"))
+	}
+	data, err = os.ReadFile(outputPath + ".json")
+	if assert.NoError(t, err) {
+		var doc PostProcessDocument
+		assert.NoError(t, json.Unmarshal(data, &doc))
+		assert.Equal(t, PostProcessDocument{Path: outputPath, Title: "Doc1", URL: url, Token: "doc1"}, doc)
+	}
+
+	// 默认失败只告警，on_failure 为 fail 时文档下载失败
+	runPostProcess, _ = newPostProcessor(core.PostProcessConfig{FileCommand: []string{"false"}})
+	assert.NoError(t, downloadDocument(context.Background(), api, url, &dlOpts))
+	runPostProcess, _ = newPostProcessor(core.PostProcessConfig{FileCommand: []string{"false"}, OnFailure: core.PostProcessFail})
+	assert.Error(t, downloadDocument(context.Background(), api, url, &dlOpts))
+	runPostProcess, _ = newPostProcessor(core.PostProcessConfig{
+		FileCommand: []string{"sh", "-c", "sleep 5"}, Timeout: "10ms", OnFailure: core.PostProcessFail,
+	})
+	err = downloadDocument(context.Background(), api, url, &dlOpts)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "timed out")
+	}
+}
+
+func TestDownloadDocumentAttachments(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeAPI()
+	api.docs = map[string]string{"doc1": "Doc1"}
+	api.attachments["doc1"] = []*lark.DocxBlockFile{
+		{Token: "boxReport", Name: "report.pdf"},
+		{Token: "boxNotes", Name: "meeting notes.zip"},
+	}
+
+	err := downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/doc1", &dlOpts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Doc1.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "[report.pdf](./files/report~Report.pdf)")
+		assert.Contains(t, string(data), "[meeting notes.zip](./files/meeting%20notes~xNotes.zip)")
+	}
+	assertFileExists(t, filepath.Join(outputDir, "files", "report~Report.pdf"))
+	assertFileExists(t, filepath.Join(outputDir, "files", "meeting notes~xNotes.zip"))
+
+	// 附件名同样受路径长度预算限制，截断后保留token后缀和扩展名
+	fileDir := filepath.Join(outputDir, "files")
+	runPathBudget = newPathBudget(len(fileDir)+1+20, "img")
+	defer func() { runPathBudget = nil }()
+	assert.NoError(t, downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/doc1", &dlOpts))
+	assertFileExists(t, filepath.Join(fileDir, "report~Report.pdf"))
+	assertFileExists(t, filepath.Join(fileDir, "meeting n~xNotes.zip"))
+	report := newBatchDownloadReport()
+	runPathBudget.fillReport(report)
+	assert.Contains(t, report.PathTruncations, PathTruncation{
+		Original: "meeting notes.zip", Path: filepath.Join(fileDir, "meeting n~xNotes.zip"), Token: "boxNotes",
+	})
+	runPathBudget = nil
+
+	// 跳过附件下载时保留原有的链接
+	dlConfig.Output.SkipFileDownload = true
+	api.calls["DownloadAttachment"] = 0
+	assert.NoError(t, downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/doc1", &dlOpts))
+	assert.Equal(t, 0, api.calls["DownloadAttachment"])
+	data, err = os.ReadFile(filepath.Join(outputDir, "Doc1.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "[report.pdf](boxReport)")
+	}
+}
+
+func TestDownloadDocumentsChunks(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.format = formatChunks
+	dlOpts.chunkMaxTokens = 2000
+	dlOpts.chunkCharsPerToken = 2
+	api := newFakeAPI()
+	api.docs = map[string]string{"doc1": "Doc1", "doc2": "Doc2"}
+	api.folders["fld"] = []*lark.GetDriveFileListRespFile{
+		{Token: "doc2", Name: "Doc2", Type: "docx", URL: "https://domain.feishu.cn/docx/doc2"},
+		{Token: "doc1", Name: "Doc1", Type: "docx", URL: "https://domain.feishu.cn/docx/doc1"},
+	}
+
+	_, err := downloadDocuments(context.Background(), api, "https://domain.feishu.cn/drive/folder/fld")
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Doc1.jsonl"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), `"heading_path":["Doc1"]`)
+		assert.Contains(t, string(data), `"text":"content of Doc1"`)
+		assert.Contains(t, string(data), `"url":"https://domain.feishu.cn/docx/doc1#`)
+	}
+
+	// 合并输出时按文档排序写入同一个文件
+	runChunks = &chunkCollector{}
+	defer func() { runChunks = nil }()
+	_, err = downloadDocuments(context.Background(), api, "https://domain.feishu.cn/drive/folder/fld")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, runChunks.write(outputDir))
+	data, err = os.ReadFile(filepath.Join(outputDir, combinedChunksFile))
+	if assert.NoError(t, err) {
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if assert.Len(t, lines, 2) {
+			assert.Contains(t, lines[0], `"title":"Doc1"`)
+			assert.Contains(t, lines[1], `"title":"Doc2"`)
+		}
+	}
+}
+
+func TestBlockAnchorURL(t *testing.T) {
+	assert.Equal(t, "https://domain.feishu.cn/docx/doc1#blk",
+		blockAnchorURL("https://domain.feishu.cn/docx/doc1#old", "blk"))
+	assert.Equal(t, "https://domain.feishu.cn/docx/doc1",
+		blockAnchorURL("https://domain.feishu.cn/docx/doc1", ""))
+}
+
+func TestHandleDownloadCommandMissingCredentials(t *testing.T) {
+	setupDownloadTest(t)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("APPDATA", os.Getenv("XDG_CONFIG_HOME"))
+
+	err := handleDownloadCommand("https://domain.feishu.cn/docx/doc1")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "feishu2md config --appId")
+	}
+}
+
+func TestDownloadWikiPathBudget(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	runPathBudget = newPathBudget(240, dlConfig.Output.ImageDir)
+	defer func() { runPathBudget = nil }()
+
+	// 12层嵌套、每层标题60个汉字的知识库
+	api := newFakeAPI()
+	api.wikiName = strings.Repeat("空", 60)
+	parent := ""
+	for level := 0; level < 12; level++ {
+		token := fmt.Sprintf("wikcnAbCdEfGhIjKlMn%02d", level)
+		title := fmt.Sprintf("%02d%s", level, strings.Repeat("层", 60))
+		api.addNode(parent, token, "docx", fmt.Sprintf("doc%02d", level), title)
+		parent = token
+	}
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 12, report.SuccessCount)
+	assert.NotEmpty(t, report.PathTruncations)
+
+	limit := runPathBudget.limit
+	docs := 0
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		assert.LessOrEqual(t, len(path), limit, path)
+		if info.IsDir() {
+			// 目录下的图片和附属文件同样不能超出预算
+			image := filepath.Join(path, dlConfig.Output.ImageDir, strings.Repeat("x", imageNameBytes))
+			assert.LessOrEqual(t, len(image), limit, image)
+		} else if strings.HasSuffix(path, ".md") {
+			docs++
+			assert.LessOrEqual(t, len(strings.TrimSuffix(path, ".md")+sidecarSuffix), limit, path)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 12, docs)
+
+	// 截断记录可以对应到实际存在的目录或文件
+	for _, truncation := range report.PathTruncations {
+		assert.NotEqual(t, truncation.Original, filepath.Base(truncation.Path))
+		matches, _ := filepath.Glob(truncation.Path + "*")
+		assert.NotEmpty(t, matches, truncation.Path)
+	}
+}
+
+func TestPathBudgetExhausted(t *testing.T) {
+	budget := newPathBudget(80, "static")
+	_, err := budget.dirName(strings.Repeat("a", 60), "title", "token", 1)
+	assert.Error(t, err)
+	_, err = budget.dirName("out", "title", "token", 4)
+	assert.Error(t, err)
+	name, err := budget.dirName("out", strings.Repeat("层", 30), "wikcnABCDEF", 1)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(name, "~ABCDEF"), name)
+}
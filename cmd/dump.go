@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// docxDump OPEN API 原始响应的转储格式，convert 命令可据此离线生成Markdown
+type docxDump struct {
+	URL      string             `json:"url,omitempty"`
+	Document *lark.DocxDocument `json:"document"`
+	Blocks   []*lark.DocxBlock  `json:"blocks"`
+}
+
+type ConvertOpts struct {
+	outputDir string
+}
+
+var convertOpts = ConvertOpts{}
+
+// dumpPath 返回转储文件路径，指定 --dump-dir 时集中存放并以文档token命名
+func dumpPath(opts *DownloadOpts, docToken string) string {
+	dir := opts.outputDir
+	if opts.dumpDir != "" {
+		dir = opts.dumpDir
+	}
+	name := fmt.Sprintf("%s.json", docToken)
+	if opts.dumpGzip {
+		name += ".gz"
+	}
+	return filepath.Join(dir, name)
+}
+
+// writeDump 原子写入转储文件，可选gzip压缩
+func writeDump(opts *DownloadOpts, docToken string, dump *docxDump) (string, error) {
+	outputPath := dumpPath(opts, docToken)
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return "", err
+	}
+	data := []byte(utils.PrettyPrint(dump))
+	if opts.dumpGzip {
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		if _, err := zw.Write(data); err != nil {
+			return "", err
+		}
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+		data = buf.Bytes()
+	}
+	if err := runSyncer.WriteFile(outputPath, data, 0o644); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// readDump 读取转储文件，根据文件头自动识别gzip压缩
+func readDump(path string) (*docxDump, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read gzipped dump %s", path)
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, errors.Wrapf(err, "failed to read gzipped dump %s", path)
+		}
+	}
+	dump := new(docxDump)
+	if err := json.Unmarshal(data, dump); err != nil {
+		return nil, errors.Wrapf(err, "invalid dump %s", path)
+	}
+	if dump.Document == nil {
+		return nil, errors.Errorf("invalid dump %s: missing document", path)
+	}
+	return dump, nil
+}
+
+// handleConvertCommand 将转储的json离线转换为Markdown，不访问OPEN API
+func handleConvertCommand(paths []string) error {
+	configPath, err := core.GetConfigFilePath()
+	if err != nil {
+		return err
+	}
+	config, err := core.ReadConfigFromFile(configPath)
+	if err != nil {
+		return err
+	}
+	if err := config.Output.Validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(convertOpts.outputDir, 0o755); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		dump, err := readDump(path)
+		if err != nil {
+			return err
+		}
+		parser := core.NewParser(config.Output)
+		markdown := parser.ParseDocxContent(dump.Document, dump.Blocks)
+		frontMatter, body, err := config.Output.FormatDocument(core.DocumentMeta{
+			Title:        dump.Document.Title,
+			URL:          dump.URL,
+			Token:        dump.Document.DocumentID,
+			Revision:     dump.Document.RevisionID,
+			DownloadedAt: config.Output.Now(),
+		}, markdown)
+		// 与下载相同，格式化失败时写入未格式化的内容
+		var formatErr *core.FormatError
+		if errors.As(err, &formatErr) {
+			warnf("Warning: %s: format_failed: %v, writing the unformatted markdown\n", path, formatErr.Panic)
+		} else if err != nil {
+			return err
+		}
+		result := frontMatter + parser.RestoreGalleries(parser.RestoreCodeFenceAttrs(body))
+
+		mdName := fmt.Sprintf("%s.md", utils.SanitizeFileName(dump.Document.Title))
+		outputPath := filepath.Join(convertOpts.outputDir, mdName)
+		if err := runSyncer.WriteFile(outputPath, config.Output.NormalizeText([]byte(result)), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Converted %s to %s\n", path, outputPath)
+	}
+	return nil
+}
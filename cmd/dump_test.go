@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chyroc/lark"
+)
+
+func TestDumpLocation(t *testing.T) {
+	dir := t.TempDir()
+	dump := &docxDump{
+		URL:      "https://domain.feishu.cn/docx/doxcnToken",
+		Document: &lark.DocxDocument{DocumentID: "doxcnToken", Title: "Title"},
+		Blocks:   []*lark.DocxBlock{{BlockID: "doxcnToken"}},
+	}
+	tests := []struct {
+		name string
+		opts DownloadOpts
+		want string
+	}{
+		{
+			name: "next to markdown",
+			opts: DownloadOpts{outputDir: filepath.Join(dir, "md"), dump: true},
+			want: filepath.Join(dir, "md", "doxcnToken.json"),
+		},
+		{
+			name: "dump dir",
+			opts: DownloadOpts{outputDir: filepath.Join(dir, "md"), dump: true,
+				dumpDir: filepath.Join(dir, "dumps")},
+			want: filepath.Join(dir, "dumps", "doxcnToken.json"),
+		},
+		{
+			name: "gzip",
+			opts: DownloadOpts{outputDir: filepath.Join(dir, "md"), dump: true,
+				dumpDir: filepath.Join(dir, "dumps"), dumpGzip: true},
+			want: filepath.Join(dir, "dumps", "doxcnToken.json.gz"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 批量模式下每个文档的选项由用户选项派生，转储设置不能丢失
+			opts := tt.opts.forDir(filepath.Join(tt.opts.outputDir, "sub"))
+			if tt.opts.dumpDir == "" {
+				tt.want = filepath.Join(filepath.Dir(tt.want), "sub", filepath.Base(tt.want))
+			}
+			path, err := writeDump(&opts, "doxcnToken", dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tt.want {
+				t.Errorf("dump written to %s, want %s", path, tt.want)
+			}
+			got, err := readDump(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.URL != dump.URL || got.Document.Title != "Title" || len(got.Blocks) != 1 {
+				t.Errorf("unexpected dump content: %+v", got)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "dumps", "doxcnToken.json")); err != nil {
+		t.Errorf("uncompressed dump missing: %v", err)
+	}
+}
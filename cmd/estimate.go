@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+// statusPlanned --dry-run 时遍历到、未下载的文档在报告中的状态
+const statusPlanned = "planned"
+
+// runMetrics 统计本次运行每个接口方法的调用次数和耗时，写入报告的 api_calls
+var runMetrics *core.Metrics
+
+// RunEstimate --estimate 的估算结果。calls 与实际运行报告中 api_calls 的调用次数一一对应，
+// 可在运行后检查估算的准确度
+type RunEstimate struct {
+	Documents   map[string]int `json:"documents"` // 按类型统计的待下载文档数
+	Calls       map[string]int `json:"calls"`     // 按接口方法统计的调用次数，包括遍历时已发出的调用
+	Requests    int            `json:"requests"`  // 预计的请求总数，读取文档块和表格的分页也计算在内
+	Images      int            `json:"images"`
+	Attachments int            `json:"attachments"`
+	// 每个文档的平均图片数和附件数的来源："previous_report" 或 "heuristics"
+	Basis       string  `json:"basis"`
+	RateLimit   float64 `json:"rate_limit"`
+	Concurrency int     `json:"concurrency"`
+	LatencyMS   int64   `json:"latency_ms"` // 估算使用的单次请求耗时
+	MinSeconds  float64 `json:"min_seconds"`
+	MaxSeconds  float64 `json:"max_seconds"`
+}
+
+// validateDryRun --estimate 只能与 --dry-run 一起使用，空跑不写入任何文档，也就没有可提交的内容
+func validateDryRun(opts *DownloadOpts) error {
+	if opts.estimate && !opts.dryRun {
+		return errors.New("--estimate only works with --dry-run")
+	}
+	if opts.dryRun && opts.gitCommit {
+		return errors.New("--dry-run can not be used with --git-commit")
+	}
+	return nil
+}
+
+// plannedType 待下载文档的类型：遍历时已知节点类型，否则从链接推断，知识库链接按文档计算
+func plannedType(url string, opts *DownloadOpts) string {
+	if opts.objType != "" {
+		return opts.objType
+	}
+	docType, _, err := utils.ValidateDocumentURL(url)
+	if err == nil && isSheetType(sheetObjType(docType)) {
+		return sheetObjType(docType)
+	}
+	return docxType
+}
+
+// plannedResult --dry-run 时记录的结果，不读取文档内容
+func plannedResult(url string, opts *DownloadOpts) DownloadResult {
+	return DownloadResult{URL: url, OutputDir: opts.outputDir, Status: statusPlanned,
+		Type: plannedType(url, opts), Time: dlConfig.Output.Now()}
+}
+
+// fillRunMetrics 将接口调用统计写入下载报告，指定 --estimate 时同时写入估算结果
+func fillRunMetrics(report *BatchDownloadReport) {
+	if runMetrics != nil {
+		report.APICalls = runMetrics.Snapshot()
+	}
+	if dlOpts.estimate {
+		report.Estimate = estimateRun(report, latestReport(dlOpts.outputDir))
+	}
+}
+
+// latestReport 返回输出目录中最近一次实际下载的报告，用于估算每个文档的图片和附件数
+func latestReport(outputDir string) *BatchDownloadReport {
+	paths, _ := filepath.Glob(filepath.Join(outputDir, "report_*.json"))
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	for _, path := range paths {
+		report, err := readDownloadReport(path)
+		if err == nil && report.Estimate == nil && report.SuccessCount > 0 && len(report.APICalls) > 0 {
+			return report
+		}
+	}
+	return nil
+}
+
+// estimateRun 根据遍历得到的文档数和每个文档的平均调用数估算接口调用和耗时，不发出任何请求
+func estimateRun(report *BatchDownloadReport, previous *BatchDownloadReport) *RunEstimate {
+	conf := dlConfig.Estimate
+	e := &RunEstimate{
+		Documents: make(map[string]int),
+		Calls:     make(map[string]int),
+		Basis:     "heuristics",
+		RateLimit: dlConfig.Feishu.RateLimit,
+	}
+	imagesPerDoc, attachmentsPerDoc := conf.ImagesPerDocument, conf.AttachmentsPerDocument
+	if previous != nil {
+		calls := make(map[string]int)
+		for _, m := range previous.APICalls {
+			calls[m.Method] = m.Calls
+		}
+		docs := float64(previous.SuccessCount)
+		imagesPerDoc = float64(calls["DownloadImage"]+calls["DownloadImageRaw"]) / docs
+		attachmentsPerDoc = float64(calls["DownloadAttachment"]) / docs
+		e.Basis = "previous_report"
+	}
+
+	wikiNodes := 0
+	for _, result := range report.Results {
+		if result.Status != statusPlanned {
+			continue
+		}
+		e.Documents[result.Type]++
+		if strings.Contains(result.URL, "/wiki/") {
+			wikiNodes++
+		}
+	}
+	docx := e.Documents[docxType]
+	sheetRequests := conf.RequestsPerSheet
+	if dlConfig.Sheet.FormulaMode == core.SheetFormulaFormulas || dlConfig.Sheet.FormulaMode == core.SheetFormulaBoth {
+		// 读取公式时每个区域多请求一次，表格信息和工作表列表不变
+		sheetRequests = sheetRequests*2 - 2
+	}
+	if sheetRequests < 1 {
+		sheetRequests = 1
+	}
+
+	e.Calls["GetWikiNodeInfo"] = wikiNodes
+	e.Calls["GetDocxContent"] = docx
+	e.Calls["GetSheetContent"] = e.Documents[sheetType]
+	e.Calls["GetBitableRecords"] = e.Documents[bitableType]
+	e.Calls["DownloadDriveFile"] = e.Documents[fileNodeType]
+	if dlConfig.Output.ListStartFromBlock {
+		e.Calls["GetDocxListSequences"] = docx
+	}
+	if dlConfig.Output.Cover == "image" {
+		e.Calls["GetDocxCover"] = docx
+		e.Images += docx
+	}
+	if !dlConfig.Output.SkipImgDownload {
+		e.Images += int(math.Round(float64(docx) * imagesPerDoc))
+		method := "DownloadImage"
+		if dlConfig.Output.UseHashImageNames {
+			method = "DownloadImageRaw"
+		}
+		e.Calls[method] = e.Images
+	}
+	if !dlConfig.Output.SkipFileDownload {
+		e.Attachments = int(math.Round(float64(docx) * attachmentsPerDoc))
+		e.Calls["DownloadAttachment"] = e.Attachments
+	}
+	for method, n := range e.Calls {
+		if n == 0 {
+			delete(e.Calls, method)
+		}
+	}
+
+	// 遍历时的调用已经发生，按实际次数计入，同时用于测量单次请求的耗时
+	latency, _ := conf.Latency()
+	var traversalCalls int
+	var traversalTime time.Duration
+	for _, m := range report.APICalls {
+		e.Calls[m.Method] += m.Calls
+		traversalCalls += m.Calls
+		traversalTime += m.Duration
+	}
+	if traversalCalls > 0 && traversalTime > 0 {
+		latency = traversalTime / time.Duration(traversalCalls)
+	}
+	e.LatencyMS = latency.Milliseconds()
+
+	for _, n := range e.Calls {
+		e.Requests += n
+	}
+	// 读取文档还需要一次文档信息请求和若干块分页，表格需要读取工作表和数值分页
+	e.Requests += int(math.Round(float64(docx) * conf.BlockPagesPerDocument))
+	e.Requests += int(math.Round(float64(e.Documents[sheetType]+e.Documents[bitableType]) * (sheetRequests - 1)))
+
+	// 最快时两个阶段都用满并发，最慢时只有读取阶段的并发且请求耗时翻倍；频率限制是下限
+	content, image := stageConcurrency(&dlOpts)
+	e.Concurrency = content + image
+	requests := float64(e.Requests)
+	e.MinSeconds = requests * latency.Seconds() / float64(content+image)
+	e.MaxSeconds = requests * 2 * latency.Seconds() / float64(content)
+	if e.RateLimit > 0 {
+		e.MinSeconds = math.Max(e.MinSeconds, requests/e.RateLimit)
+		e.MaxSeconds = math.Max(e.MaxSeconds, requests/e.RateLimit)
+	}
+	return e
+}
+
+// printEstimate 打印估算的调用预算和耗时范围
+func printEstimate(e *RunEstimate) {
+	types := make([]string, 0, len(e.Documents))
+	total := 0
+	for t, n := range e.Documents {
+		types = append(types, fmt.Sprintf("%s %d", t, n))
+		total += n
+	}
+	sort.Strings(types)
+	methods := make([]string, 0, len(e.Calls))
+	for method := range e.Calls {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	fmt.Println("\n" + strings.Repeat("=", 50))
+	fmt.Println("下载估算")
+	fmt.Println(strings.Repeat("=", 50))
+	fmt.Printf("待下载文档: %d (%s)\n", total, strings.Join(types, ", "))
+	fmt.Printf("图片: %d, 附件: %d (依据: %s)\n", e.Images, e.Attachments, e.Basis)
+	fmt.Println("接口调用:")
+	for _, method := range methods {
+		fmt.Printf("  %-20s %d\n", method, e.Calls[method])
+	}
+	fmt.Printf("预计请求数: %d\n", e.Requests)
+	rate := "不限"
+	if e.RateLimit > 0 {
+		rate = fmt.Sprintf("%g/s", e.RateLimit)
+	}
+	fmt.Printf("预计耗时: %s - %s (频率限制 %s, 并发 %d, 单次请求 %dms)\n",
+		secondsDuration(e.MinSeconds), secondsDuration(e.MaxSeconds), rate, e.Concurrency, e.LatencyMS)
+	fmt.Println(strings.Repeat("=", 50))
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds)) * time.Second
+}
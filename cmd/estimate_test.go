@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunEstimate(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.dryRun = true
+	dlOpts.estimate = true
+	runMetrics = core.NewMetrics()
+	t.Cleanup(func() { runMetrics = nil })
+	api := newFakeWiki()
+	api.images["docA"] = []string{"imgA"}
+	api.addDoc("", "A")
+	api.addNode("", "wikS", "sheet", "shtS", "S")
+	api.addDoc("wikA", "A1")
+	api.addDoc("wikA", "A2")
+	client := core.WithMiddleware(api, runMetrics.Middleware())
+
+	report, err := downloadWiki(context.Background(), client, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// 空跑不读取文档内容，也不写入文档
+	assert.Equal(t, 0, api.callCount("GetDocxContent"))
+	assert.Equal(t, 0, api.callCount("DownloadImage"))
+	assert.Equal(t, 4, report.TotalFiles)
+	assert.Equal(t, 4, report.PlannedCount)
+	assert.Equal(t, 0, report.SuccessCount)
+	_, err = os.Stat(filepath.Join(outputDir, "Space"))
+	assert.True(t, os.IsNotExist(err))
+
+	e := report.Estimate
+	if !assert.NotNil(t, e) {
+		return
+	}
+	assert.Equal(t, map[string]int{docxType: 3, sheetType: 1}, e.Documents)
+	assert.Equal(t, "heuristics", e.Basis)
+	assert.Equal(t, 9, e.Images)
+	assert.Equal(t, 3, e.Calls["GetDocxContent"])
+	assert.Equal(t, 1, e.Calls["GetSheetContent"])
+	assert.Equal(t, 9, e.Calls["DownloadImage"])
+	// 遍历时的调用按实际次数计入
+	assert.Equal(t, api.callCount("GetWikiNodeList"), e.Calls["GetWikiNodeList"])
+	assert.LessOrEqual(t, e.MinSeconds, e.MaxSeconds)
+	assert.NotEmpty(t, report.APICalls)
+	for _, m := range report.APICalls {
+		assert.NotEqual(t, "GetDocxContent", m.Method)
+	}
+}
+
+func TestEstimateFromPreviousReport(t *testing.T) {
+	setupDownloadTest(t)
+	dlConfig.Feishu.RateLimit = 10
+	report := newBatchDownloadReport()
+	for i := 0; i < 10; i++ {
+		report.Results = append(report.Results, DownloadResult{URL: "https://domain.feishu.cn/docx/doc", Status: statusPlanned, Type: docxType})
+	}
+	previous := &BatchDownloadReport{SuccessCount: 4, APICalls: []core.MethodMetrics{
+		{Method: "GetDocxContent", Calls: 4},
+		{Method: "DownloadImage", Calls: 2},
+		{Method: "DownloadAttachment", Calls: 4},
+	}}
+
+	e := estimateRun(report, previous)
+	assert.Equal(t, "previous_report", e.Basis)
+	assert.Equal(t, 5, e.Images)
+	assert.Equal(t, 10, e.Attachments)
+	assert.Equal(t, 10, e.Calls["GetDocxContent"])
+	assert.Equal(t, 10+5+10+10, e.Requests)
+	// 频率限制是耗时的下限
+	assert.Equal(t, 3.5, e.MinSeconds)
+	assert.GreaterOrEqual(t, e.MaxSeconds, e.MinSeconds)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fileNamer 按 output.file_name_template 生成文档文件名，同一目录下已被其他文档
+// 占用的名称追加 " (2)"、" (3)"……。批量和wiki下载在遍历时按顺序预留名称，
+// 并发下载完成的先后不影响结果，为nil时（单个文档）不去重
+type fileNamer struct {
+	mu     sync.Mutex
+	names  map[string]string // 目录和文档token -> 文件名
+	owners map[string]string // 目录和小写文件名 -> 文档token，兼容大小写不敏感的文件系统
+}
+
+func newFileNamer() *fileNamer {
+	return &fileNamer{names: make(map[string]string), owners: make(map[string]string)}
+}
+
+// claim 返回dir下文档的文件名（不含扩展名），已预留过的文档直接返回预留的名称
+func (n *fileNamer) claim(dir, title, token string) string {
+	base := dlConfig.Output.FileName(title, token)
+	if name := runOverrides.fileName(token); name != "" {
+		base = name
+	}
+	// --legacy-map 中的旧文件名优先
+	if name := runLegacyMap.fileName(token); name != "" {
+		base = name
+	}
+	if n == nil {
+		return base
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := filepath.Join(dir, token)
+	if name, ok := n.names[key]; ok {
+		return name
+	}
+	name := base
+	for i := 2; ; i++ {
+		owner, taken := n.owners[filepath.Join(dir, strings.ToLower(name))]
+		if !taken || owner == token {
+			break
+		}
+		name = fmt.Sprintf("%s (%d)", base, i)
+	}
+	n.owners[filepath.Join(dir, strings.ToLower(name))] = token
+	n.names[key] = name
+	return name
+}
+
+// claimed 文档是否已有预留的名称
+func (n *fileNamer) claimed(dir, token string) bool {
+	if n == nil {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.names[filepath.Join(dir, token)]
+	return ok
+}
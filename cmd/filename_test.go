@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadDocumentsFileNameCollision(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeAPI()
+	api.docs = map[string]string{"doc1": "Notes", "doc2": "Notes", "doc3": "notes", "doc4": "Notes"}
+	api.folders["fld"] = []*lark.GetDriveFileListRespFile{
+		{Token: "doc1", Name: "Notes", Type: "docx", URL: "https://domain.feishu.cn/docx/doc1"},
+		{Token: "doc2", Name: "Notes", Type: "docx", URL: "https://domain.feishu.cn/docx/doc2"},
+		{Token: "doc3", Name: "notes", Type: "docx", URL: "https://domain.feishu.cn/docx/doc3"},
+		{Token: "sub", Name: "Sub", Type: "folder"},
+	}
+	// 不同目录下的同名文档不冲突
+	api.folders["sub"] = []*lark.GetDriveFileListRespFile{
+		{Token: "doc4", Name: "Notes", Type: "docx", URL: "https://domain.feishu.cn/docx/doc4"},
+	}
+
+	report, err := downloadDocuments(context.Background(), api, "https://domain.feishu.cn/drive/folder/fld")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 4, report.SuccessCount)
+	// 按遍历顺序命名，与下载完成的先后无关
+	filenames := map[string]string{}
+	for _, result := range report.Results {
+		filenames[result.URL] = result.Filename
+	}
+	assert.Equal(t, map[string]string{
+		"https://domain.feishu.cn/docx/doc1": "Notes.md",
+		"https://domain.feishu.cn/docx/doc2": "Notes (2).md",
+		"https://domain.feishu.cn/docx/doc3": "notes (3).md",
+		"https://domain.feishu.cn/docx/doc4": "Notes.md",
+	}, filenames)
+	for token, path := range map[string]string{
+		"doc1": "Notes.md", "doc2": "Notes (2).md", "doc3": "notes (3).md", "doc4": filepath.Join("Sub", "Notes.md"),
+	} {
+		data, err := os.ReadFile(filepath.Join(outputDir, path))
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(data), "/docx/"+token)
+		}
+	}
+}
+
+func TestDownloadWikiFileNameTemplate(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlConfig.Output.FileNameTemplate = "{title}_{token}"
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addNode("", "wikB", "docx", "docB", "A")
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var filenames []string
+	for _, result := range report.Results {
+		filenames = append(filenames, result.Filename)
+	}
+	sort.Strings(filenames)
+	assert.Equal(t, []string{"A_docA.md", "A_docB.md"}, filenames)
+	assertFileExists(t, filepath.Join(outputDir, "Space", "A_docA.md"))
+	assertFileExists(t, filepath.Join(outputDir, "Space", "A_docB.md"))
+}
+
+func TestDownloadSingleFileName(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlConfig.Output.FileNameTemplate = "{title}_{token}"
+	api := newFakeAPI()
+	api.docs = map[string]string{"docA": "A"}
+
+	// 单个文档的报告记录实际写入的文件名
+	url := "https://domain.feishu.cn/docx/docA"
+	report, err := downloadSingle(context.Background(), api, url)
+	if !assert.NoError(t, err) || !assert.Len(t, report.Results, 1) {
+		return
+	}
+	result := report.Results[0]
+	assert.Equal(t, 1, report.SuccessCount)
+	assert.Equal(t, "success", result.Status)
+	assert.Equal(t, "A_docA.md", result.Filename)
+	assert.Equal(t, outputDir, result.OutputDir)
+	assert.Equal(t, "docA", result.ObjToken)
+	assert.Equal(t, url, result.ObjURL)
+	assertFileExists(t, filepath.Join(outputDir, "A_docA.md"))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/pkg/errors"
+)
+
+const (
+	// docxType 新版文档的对象类型
+	docxType = "docx"
+	// fileNodeType 上传到知识库或文件夹中的文件（如pdf、pptx）的对象类型
+	fileNodeType = "file"
+	// sheetType 电子表格的对象类型
+	sheetType = "sheet"
+	// bitableType 多维表格的对象类型
+	bitableType = "bitable"
+	// defaultDownloadTypes --types 的默认值
+	defaultDownloadTypes = docxType + "," + fileNodeType + "," + sheetType + "," + bitableType
+)
+
+// fileIcon 索引中标记上传文件的图标，与目录结构中的一致
+var fileIcon = outlineTypeIcons[fileNodeType]
+
+// validateTypes 检查 --types，只支持 docx、file、sheet 和 bitable
+func validateTypes(opts *DownloadOpts) error {
+	types := downloadTypes(opts)
+	if len(types) == 0 {
+		return errors.Errorf("--types must list at least one of %s", defaultDownloadTypes)
+	}
+	for t := range types {
+		if t != docxType && t != fileNodeType && !isSheetType(t) {
+			return errors.Errorf("unknown --types %q, expect a comma separated list of %s", t, defaultDownloadTypes)
+		}
+	}
+	return nil
+}
+
+// downloadTypes 解析 --types，未指定时下载文档、上传的文件和表格
+func downloadTypes(opts *DownloadOpts) map[string]bool {
+	value := opts.types
+	if value == "" {
+		value = defaultDownloadTypes
+	}
+	types := make(map[string]bool)
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = true
+		}
+	}
+	return types
+}
+
+// wantsType 遍历时是否下载该类型的节点
+func (opts *DownloadOpts) wantsType(objType string) bool {
+	return downloadTypes(opts)[objType]
+}
+
+// fileNodeName 上传文件保存的文件名，按 output.file_name_template 命名并保留原扩展名
+func fileNodeName(opts *DownloadOpts, title, fileToken string) string {
+	ext := filepath.Ext(title)
+	return documentBaseName(opts, strings.TrimSuffix(title, ext), fileToken) + ext
+}
+
+// claimFileNode 遍历时为上传文件预留名称，与文档共用同一目录下的去重
+func claimFileNode(names *fileNamer, dir, title, fileToken string) {
+	names.claim(dir, strings.TrimSuffix(title, filepath.Ext(title)), fileToken)
+}
+
+// checkFileNode 按 output.file_node_extensions 过滤上传文件
+func checkFileNode(title string) error {
+	if !dlConfig.Output.AllowFileNode(title) {
+		return errors.Errorf("the extension of %q is not listed in output.file_node_extensions", title)
+	}
+	return nil
+}
+
+// writeFileNode 下载上传的文件到节点在目录树中的位置，大小超出 output.file_node_max_mb 时不写入
+func writeFileNode(ctx context.Context, client core.API, doc *fetchedDocument, opts *DownloadOpts) error {
+	if err := os.MkdirAll(opts.outputDir, 0o755); err != nil {
+		return err
+	}
+	outputPath := filepath.Join(opts.outputDir, fileNodeName(opts, doc.title, doc.docToken))
+	size, err := client.DownloadDriveFile(ctx, doc.docToken, outputPath, dlConfig.Output.FileNodeMaxBytes())
+	doc.size = size
+	if errors.Is(err, core.ErrFileTooLarge) {
+		return errors.Errorf("%s is larger than output.file_node_max_mb (%d MB)", doc.title, dlConfig.Output.FileNodeMaxMB)
+	}
+	if err != nil {
+		return err
+	}
+	runDedup.dedupFile(outputPath)
+	runFiles.Add(outputPath)
+	hash, err := fileContentHash(outputPath)
+	if err != nil {
+		return err
+	}
+	runManifest.recordFile(fileNodeType, doc.docToken, doc.title, doc.url, doc.source, outputPath, opts.tags, hash)
+	runLinks.add(outputPath, false, doc.source.tokens()...)
+	logf("Downloaded file (%d bytes) to %s\n", size, outputPath)
+	return nil
+}
+
+// fileContentHash 与 contentHash 相同格式的文件摘要，不将整个文件读入内存
+func fileContentHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
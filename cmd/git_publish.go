@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const defaultGitMessage = "feishu2md: sync {{.SuccessCount}}/{{.TotalFiles}} documents" +
+	"{{if .ErrorCount}}, {{.ErrorCount}} failed{{end}} ({{.Duration}})"
+
+// fileRecorder 记录本次运行写入或删除的文件，供发布步骤精确暂存
+type fileRecorder struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
+
+var runFiles = &fileRecorder{paths: make(map[string]struct{})}
+
+func (r *fileRecorder) Add(paths ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range paths {
+		r.paths[filepath.Clean(p)] = struct{}{}
+	}
+}
+
+func (r *fileRecorder) List() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	paths := make([]string, 0, len(r.paths))
+	for p := range r.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// changedFiles 清单差异中新增、修改和删除的文档，移动的文档包括新旧两个路径，以及清单、TAGS.md 和 CHANGES.md。
+// documents 为两次清单记录的全部文档，其中不在差异中的文档即使本次重新写入，内容也没有变化
+func (r *manifestRecorder) changedFiles() (changed []string, documents map[string]bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	path := func(p string) string {
+		return filepath.Join(r.rootDir, filepath.FromSlash(p))
+	}
+	documents = make(map[string]bool)
+	for _, m := range []*Manifest{r.previous, r.manifest} {
+		if m == nil {
+			continue
+		}
+		for _, entry := range m.Documents {
+			documents[path(entry.Path)] = true
+		}
+	}
+	for _, changes := range [][]ManifestChange{r.diff.Added, r.diff.Changed, r.diff.Moved, r.diff.Removed} {
+		for _, c := range changes {
+			changed = append(changed, path(c.Path))
+			if c.OldPath != "" {
+				changed = append(changed, path(c.OldPath))
+			}
+		}
+	}
+	changed = append(changed, path(manifestFileName), path(tagsFileName))
+	if r.previous != nil {
+		changed = append(changed, path(changesFileName))
+	}
+	return changed, documents
+}
+
+// publishPathspecs 本次运行需要暂存的文件，相对dir。文档以清单差异为准，清单不记录的图片、附件、
+// 报告等文件以本次写入的记录为准；单个文档下载没有清单，暂存本次写入的全部文件
+func publishPathspecs(dir string) ([]string, error) {
+	var paths []string
+	documents := map[string]bool{}
+	if runManifest != nil && runManifest.diff != nil {
+		paths, documents = runManifest.changedFiles()
+	}
+	for _, p := range runFiles.List() {
+		if !documents[p] {
+			paths = append(paths, p)
+		}
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var pathspecs []string
+	for _, p := range paths {
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(absDir, absPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if !seen[rel] {
+			seen[rel] = true
+			pathspecs = append(pathspecs, rel)
+		}
+	}
+	sort.Strings(pathspecs)
+	return pathspecs, nil
+}
+
+// knownPathspecs 去掉磁盘上不存在、git 也没有跟踪的路径，例如上一次清单中早已手工删除的文档，
+// 否则 git add 会因路径不匹配而失败
+func knownPathspecs(dir string, pathspecs []string) ([]string, error) {
+	var known, missing []string
+	for _, p := range pathspecs {
+		if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(p))); err == nil {
+			known = append(known, p)
+		} else {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) == 0 {
+		return known, nil
+	}
+	out, err := runGit(dir, "", append([]string{"ls-files", "-z", "--"}, missing...)...)
+	if err != nil {
+		return nil, err
+	}
+	tracked := make(map[string]bool)
+	for _, p := range strings.Split(out, "\x00") {
+		tracked[p] = true
+	}
+	for _, p := range missing {
+		if tracked[p] {
+			known = append(known, p)
+		}
+	}
+	sort.Strings(known)
+	return known, nil
+}
+
+// gitMessageData 提交信息模板可用的字段
+type gitMessageData struct {
+	*BatchDownloadReport
+	ChangedFiles int
+}
+
+func runGit(dir string, stdin string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), errors.Errorf("git %s: %v\n%s",
+			strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// checkGitWorkTree 在下载开始前检查git环境，避免下载完成后才发现无法提交
+func checkGitWorkTree(dir string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("--git-commit requires the git executable in PATH")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if out, err := runGit(dir, "", "rev-parse", "--is-inside-work-tree"); err != nil ||
+		strings.TrimSpace(out) != "true" {
+		return errors.Errorf("--git-commit: output directory %s is not inside a git work tree", dir)
+	}
+	if _, err := template.New("git-message").Parse(dlOpts.gitMessage); err != nil {
+		return errors.Wrap(err, "invalid --git-message template")
+	}
+	if dlOpts.gitAllowDirty {
+		return nil
+	}
+	out, err := runGit(dir, "", "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(out) != "" {
+		return errors.Errorf("--git-commit: work tree has uncommitted changes, "+
+			"commit or stash them first (or use --git-allow-dirty):\n%s", out)
+	}
+	return nil
+}
+
+// publishGitCommit 暂存本次运行新增、修改、移动和删除的文件并提交，可选推送
+func publishGitCommit(report *BatchDownloadReport, dir string) error {
+	if report.ErrorCount > dlOpts.gitMaxFailures {
+		fmt.Printf("Skip git commit: %d failed documents exceed the allowed %d\n",
+			report.ErrorCount, dlOpts.gitMaxFailures)
+		return nil
+	}
+
+	pathspecs, err := publishPathspecs(dir)
+	if err != nil {
+		return err
+	}
+	if pathspecs, err = knownPathspecs(dir, pathspecs); err != nil {
+		return err
+	}
+	if len(pathspecs) == 0 {
+		fmt.Println("Skip git commit: no files were written")
+		return nil
+	}
+	// 通过stdin传递路径，避免文件过多时超出命令行长度限制
+	stdin := strings.Join(pathspecs, "\x00")
+	if _, err := runGit(dir, stdin, "add", "-A",
+		"--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return err
+	}
+	staged, err := runGit(dir, "", "diff", "--cached", "--name-only", "--relative", "-z")
+	if err != nil {
+		return err
+	}
+	written := make(map[string]bool, len(pathspecs))
+	for _, p := range pathspecs {
+		written[p] = true
+	}
+	changed := 0
+	for _, p := range strings.Split(staged, "\x00") {
+		if written[p] {
+			changed++
+		}
+	}
+	if changed == 0 {
+		fmt.Println("Skip git commit: exported files are unchanged")
+		return nil
+	}
+
+	tmpl, err := template.New("git-message").Parse(dlOpts.gitMessage)
+	if err != nil {
+		return errors.Wrap(err, "invalid --git-message template")
+	}
+	message := new(strings.Builder)
+	if err := tmpl.Execute(message, gitMessageData{report, changed}); err != nil {
+		return errors.Wrap(err, "invalid --git-message template")
+	}
+
+	if _, err := runGit(dir, stdin, "commit", "--only", "-m", message.String(),
+		"--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return err
+	}
+	fmt.Printf("Committed %d changed files to git\n", changed)
+
+	if dlOpts.gitPush {
+		if _, err := runGit(dir, "", "push"); err != nil {
+			return err
+		}
+		fmt.Println("Pushed the commit to the remote repository")
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupGitTest 在输出目录中初始化只有一次提交的git仓库，不读取用户的git配置
+func setupGitTest(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	outputDir := setupDownloadTest(t)
+	runFiles = &fileRecorder{paths: make(map[string]struct{})}
+	dlOpts.gitMessage = defaultGitMessage
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	gitOutput(t, outputDir, "init", "-q")
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "README.md"), []byte("mirror\n"), 0o644))
+	gitOutput(t, outputDir, "add", "README.md")
+	gitOutput(t, outputDir, "commit", "-q", "-m", "init")
+	return outputDir
+}
+
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := runGit(dir, "", args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// committedFiles 最近一次提交的文件及其状态，如 "A Space/A.md"
+func committedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	out := gitOutput(t, dir, "show", "--name-status", "--format=", "HEAD")
+	var files []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.Contains(line, "report_") {
+			files = append(files, strings.Join(strings.Fields(line), " "))
+		}
+	}
+	return files
+}
+
+func TestPublishGitCommit(t *testing.T) {
+	outputDir := setupGitTest(t)
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addDoc("", "B")
+	run := func() *BatchDownloadReport {
+		t.Helper()
+		runManifest = newManifestRecorder(outputDir)
+		runManifest.prune = dlOpts.prune
+		report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		runManifest.fillReport(report)
+		assert.NoError(t, runManifest.write(report))
+		return report
+	}
+
+	report := run()
+	assert.NoError(t, publishGitCommit(report, outputDir))
+	assert.Equal(t, []string{
+		"A .feishu2md-manifest.json", "A Space/A.md", "A Space/B.md", "A TAGS.md",
+	}, committedFiles(t, outputDir))
+	assert.True(t, strings.HasPrefix(gitOutput(t, outputDir, "log", "-1", "--format=%s"),
+		"feishu2md: sync 2/2 documents ("))
+
+	// 第二次运行B已从知识空间删除，A重新写入但没有变化，无关的文件不会被提交
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "notes.txt"), []byte("draft\n"), 0o644))
+	api.wikiNodes[""] = api.wikiNodes[""][:1]
+	dlOpts.prune = true
+	report = run()
+	assert.NoError(t, publishGitCommit(report, outputDir))
+	files := committedFiles(t, outputDir)
+	assert.Contains(t, files, "D Space/B.md")
+	assert.Contains(t, files, "A CHANGES.md")
+	assert.Contains(t, files, "M .feishu2md-manifest.json")
+	for _, file := range files {
+		assert.NotContains(t, file, "Space/A.md")
+		assert.NotContains(t, file, "notes.txt")
+	}
+	assert.Equal(t, "?? notes.txt\n", gitOutput(t, outputDir, "status", "--porcelain"))
+}
+
+func TestPublishGitCommitMaxFailures(t *testing.T) {
+	outputDir := setupGitTest(t)
+	path := filepath.Join(outputDir, "Doc.md")
+	assert.NoError(t, os.WriteFile(path, []byte("# Doc\n"), 0o644))
+	runFiles.Add(path)
+	head := gitOutput(t, outputDir, "rev-parse", "HEAD")
+
+	// 失败的文档数超过允许值时不提交
+	report := &BatchDownloadReport{TotalFiles: 2, SuccessCount: 1, ErrorCount: 1}
+	assert.NoError(t, publishGitCommit(report, outputDir))
+	assert.Equal(t, head, gitOutput(t, outputDir, "rev-parse", "HEAD"))
+
+	dlOpts.gitMaxFailures = 1
+	assert.NoError(t, publishGitCommit(report, outputDir))
+	assert.Equal(t, []string{"A Doc.md"}, committedFiles(t, outputDir))
+	assert.Contains(t, gitOutput(t, outputDir, "log", "-1", "--format=%s"), ", 1 failed")
+}
+
+func TestCheckGitWorkTree(t *testing.T) {
+	outputDir := setupGitTest(t)
+	assert.NoError(t, checkGitWorkTree(outputDir))
+	assert.ErrorContains(t, checkGitWorkTree(t.TempDir()), "not inside a git work tree")
+
+	// 工作区有无关改动时默认报错
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "notes.txt"), []byte("draft\n"), 0o644))
+	assert.ErrorContains(t, checkGitWorkTree(outputDir), "uncommitted changes")
+	dlOpts.gitAllowDirty = true
+	assert.NoError(t, checkGitWorkTree(outputDir))
+
+	dlOpts.gitMessage = "{{.Missing"
+	assert.ErrorContains(t, checkGitWorkTree(outputDir), "invalid --git-message template")
+
+	// PATH 中没有git
+	t.Setenv("PATH", t.TempDir())
+	assert.ErrorContains(t, checkGitWorkTree(outputDir), "requires the git executable")
+}
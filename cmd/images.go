@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// imageIndexFileName 按内容哈希命名图片时，记录图片token与文件名对应关系的文件，位于图片目录中
+const imageIndexFileName = ".feishu2md-images.json"
+
+// imageHashLen 文件名中哈希的长度，加上扩展名不超过路径预算中为图片保留的长度
+const imageHashLen = 32
+
+// imageStore 按内容哈希命名图片，所有文档共用输出根目录下的图片目录，为nil时按token命名。
+// 已记录的token不再下载，并发的文档引用同一张图片时只下载一次
+type imageStore struct {
+	mu      sync.Mutex
+	dir     string
+	names   map[string]string // 图片token -> 文件名，包括之前运行的记录
+	pending map[string]*imageFetch
+	changed bool
+}
+
+// imageFetch 一张正在下载的图片，其他引用它的文档等待下载完成
+type imageFetch struct {
+	done chan struct{}
+	path string
+	err  error
+}
+
+var runImages *imageStore
+
+// newImageStore 读取图片目录中之前运行的记录，记录损坏时只告警，图片按需重新下载
+func newImageStore(dir string) *imageStore {
+	s := &imageStore{dir: dir, names: make(map[string]string), pending: make(map[string]*imageFetch)}
+	data, err := os.ReadFile(filepath.Join(dir, imageIndexFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			warnf("Warning: ignore the image index: %v\n", err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(utils.TrimBOM(data), &s.names); err != nil {
+		warnf("Warning: ignore the image index: %v\n", err)
+		s.names = make(map[string]string)
+	}
+	return s
+}
+
+// fetch 返回图片的本地路径，图片目录中已有该token的文件时不再请求
+func (s *imageStore) fetch(ctx context.Context, client core.API, imgToken string) (string, error) {
+	s.mu.Lock()
+	if name, ok := s.names[imgToken]; ok {
+		path := filepath.Join(s.dir, name)
+		if _, err := os.Stat(path); err == nil {
+			s.mu.Unlock()
+			return path, nil
+		}
+		delete(s.names, imgToken)
+		s.changed = true
+	}
+	if f, ok := s.pending[imgToken]; ok {
+		s.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.path, f.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	f := &imageFetch{done: make(chan struct{})}
+	s.pending[imgToken] = f
+	s.mu.Unlock()
+
+	f.path, f.err = s.download(ctx, client, imgToken)
+
+	s.mu.Lock()
+	delete(s.pending, imgToken)
+	if f.err == nil {
+		s.names[imgToken] = filepath.Base(f.path)
+		s.changed = true
+	}
+	s.mu.Unlock()
+	close(f.done)
+	return f.path, f.err
+}
+
+// download 下载图片并以内容哈希命名，内容相同的图片只保存一份
+func (s *imageStore) download(ctx context.Context, client core.API, imgToken string) (string, error) {
+	filename, data, err := client.DownloadImageRaw(ctx, imgToken, s.dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	path := filepath.Join(s.dir, hex.EncodeToString(sum[:])[:imageHashLen]+filepath.Ext(filename))
+	if utils.SameContent(path, data) {
+		return path, nil
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := runDedup.writeFile(path, data); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// write 有新下载的图片时更新图片目录中的记录
+func (s *imageStore) write() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexPath := filepath.Join(s.dir, imageIndexFileName)
+	if !s.changed {
+		if _, err := os.Stat(indexPath); err == nil {
+			runFiles.Add(indexPath)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(s.names, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	if err := runSyncer.WriteFile(indexPath, dlConfig.Output.NormalizeText(data), 0o644); err != nil {
+		return errors.Wrap(err, "failed to write the image index")
+	}
+	runFiles.Add(indexPath)
+	s.changed = false
+	return nil
+}
+
+// downloadImage 下载图片，返回本地路径和文档中引用图片的链接。按内容哈希命名时
+// 图片统一存放在输出根目录的图片目录，链接相对文档所在的目录
+// BoardExport 导出为图片的画板，带有 draw.io 源数据时记录另存的 .drawio 文件
+type BoardExport struct {
+	Token  string `json:"token"`
+	Image  string `json:"image"`
+	DrawIO string `json:"drawio,omitempty"`
+}
+
+// downloadBoard 将画板下载为图片目录中的png图片，返回图片链接，带有 draw.io 源数据时
+// 在图片旁另存同名的 .drawio 文件
+func downloadBoard(ctx context.Context, client core.API, board core.Board, opts *DownloadOpts) (link string, export BoardExport, err error) {
+	path, err := client.DownloadBoardImage(ctx, board.Token, filepath.Join(opts.outputDir, dlConfig.Output.ImageDir))
+	if err != nil {
+		return "", export, err
+	}
+	runDedup.dedupFile(path)
+	runFiles.Add(path)
+	link = path
+	if runImages != nil {
+		link = relativeLink(opts.outputDir, path)
+	}
+	export = BoardExport{Token: board.Token, Image: path}
+	if board.DrawIO == "" {
+		return link, export, nil
+	}
+	export.DrawIO = strings.TrimSuffix(path, filepath.Ext(path)) + ".drawio"
+	if err := runSyncer.WriteFile(export.DrawIO, []byte(board.DrawIO), 0o644); err != nil {
+		return "", export, err
+	}
+	runFiles.Add(export.DrawIO)
+	return link, export, nil
+}
+
+// docxBoards 读取文档中的画板，失败时只告警，画板不会导出
+func docxBoards(ctx context.Context, client core.API, docx *lark.DocxDocument, blocks []*lark.DocxBlock) map[string]core.Board {
+	for _, block := range blocks {
+		if block.BlockType != core.DocxBlockTypeBoard {
+			continue
+		}
+		boards, err := client.GetDocxBoards(ctx, docx.DocumentID)
+		if err != nil {
+			warnf("Warning: failed to get the boards of %s: %v\n", docx.Title, err)
+			return nil
+		}
+		return boards
+	}
+	return nil
+}
+
+func downloadImage(ctx context.Context, client core.API, imgToken string, opts *DownloadOpts) (path, link string, err error) {
+	if runImages != nil {
+		path, err = runImages.fetch(ctx, client, imgToken)
+		if err != nil {
+			return "", "", err
+		}
+		runFiles.Add(path)
+		return path, relativeLink(opts.outputDir, path), nil
+	}
+	path, err = client.DownloadImage(ctx, imgToken, filepath.Join(opts.outputDir, dlConfig.Output.ImageDir))
+	if err != nil {
+		return "", "", err
+	}
+	runDedup.dedupFile(path)
+	runFiles.Add(path)
+	return path, path, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+// legacyMap --legacy-map 指定的旧版导出工具的文件路径，匹配的文档写入旧路径而不是按标题生成的路径，
+// 清单记录的就是旧路径，链接改写、目录和同步删除都以它为准
+type legacyMap struct {
+	mu      sync.Mutex
+	rootDir string
+	paths   map[string]string // 文档token -> 相对输出根目录的旧路径，以 / 分隔，读取后不再修改
+	names   map[string]string // 匹配的文档token -> 旧文件名（不含扩展名）
+	matched map[string]bool   // 已匹配的映射token
+}
+
+var runLegacyMap *legacyMap
+
+// loadLegacyMap 读取 .csv 或 .json 格式的映射文件，旧路径相对输出根目录rootDir。
+// csv 每行为文档token和旧路径，可以有 token,path 表头；json 为token到旧路径的对象
+func loadLegacyMap(file, rootDir string) (*legacyMap, error) {
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	data = utils.TrimBOM(data)
+	var entries map[string]string
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		entries, err = parseLegacyCSV(data)
+	case ".json":
+		err = json.Unmarshal(data, &entries)
+	default:
+		return nil, errors.Errorf("unsupported legacy map %s, expect a .csv or .json file", file)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid legacy map %s", file)
+	}
+
+	m := &legacyMap{rootDir: rootDir, paths: make(map[string]string),
+		names: make(map[string]string), matched: make(map[string]bool)}
+	owners := make(map[string]string) // 小写路径 -> 文档token
+	for token, legacyPath := range entries {
+		p, err := cleanLegacyPath(legacyPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: path of %s", file, token)
+		}
+		if owner, ok := owners[strings.ToLower(p)]; ok {
+			return nil, errors.Errorf("%s: %s and %s map to the same path %s", file, owner, token, p)
+		}
+		owners[strings.ToLower(p)] = token
+		m.paths[token] = p
+	}
+	fmt.Printf("Using %d legacy paths in %s\n", len(m.paths), file)
+	return m, nil
+}
+
+func parseLegacyCSV(data []byte) (map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	entries := make(map[string]string)
+	for i := 0; ; i++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		token := strings.TrimSpace(record[0])
+		if i == 0 && strings.EqualFold(token, "token") {
+			continue
+		}
+		if _, ok := entries[token]; ok {
+			return nil, errors.Errorf("duplicate token %s", token)
+		}
+		entries[token] = record[1]
+	}
+}
+
+// cleanLegacyPath 检查旧路径必须是输出根目录下的文件，返回以 / 分隔的路径
+func cleanLegacyPath(legacyPath string) (string, error) {
+	p := strings.ReplaceAll(strings.TrimSpace(legacyPath), `\`, "/")
+	if p == "" || path.IsAbs(p) || filepath.IsAbs(legacyPath) {
+		return "", errors.Errorf("invalid path %q, expect a path relative to the output directory", legacyPath)
+	}
+	p = path.Clean(p)
+	for _, name := range strings.Split(p, "/") {
+		if name == ".." || utils.SanitizeFileName(name) != name {
+			return "", errors.Errorf("invalid path %q, expect a path inside the output directory", legacyPath)
+		}
+	}
+	if strings.TrimSuffix(path.Base(p), path.Ext(p)) == "" {
+		return "", errors.Errorf("invalid path %q, expect a file name", legacyPath)
+	}
+	return p, nil
+}
+
+// redirect 文档docToken或其wiki节点token有旧路径时，改为输出到旧路径所在的目录
+func (m *legacyMap) redirect(opts *DownloadOpts, docToken, nodeToken string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, token := range []string{docToken, nodeToken} {
+		p, ok := m.paths[token]
+		if !ok {
+			continue
+		}
+		m.matched[token] = true
+		m.names[docToken] = strings.TrimSuffix(path.Base(p), path.Ext(p))
+		opts.outputDir = filepath.Join(m.rootDir, filepath.FromSlash(path.Dir(p)))
+		return
+	}
+}
+
+// fileName 匹配到的旧文件名（不含扩展名），扩展名由输出格式决定，没有时返回空
+func (m *legacyMap) fileName(token string) string {
+	if m == nil {
+		return ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.names[token]
+}
+
+// unmatched 本次运行没有匹配到任何文档的映射token
+func (m *legacyMap) unmatched() []string {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tokens []string
+	for token := range m.paths {
+		if !m.matched[token] {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// fillReport 将未匹配的映射记录到下载报告中，空跑时不读取文档，不记录
+func (m *legacyMap) fillReport(report *BatchDownloadReport) {
+	if m == nil || dlOpts.dryRun {
+		return
+	}
+	report.LegacyUnmatched = nil
+	for _, token := range m.unmatched() {
+		report.LegacyUnmatched = append(report.LegacyUnmatched, LegacyPath{Token: token, Path: m.paths[token]})
+	}
+}
+
+// LegacyPath 映射文件中的一条旧路径
+type LegacyPath struct {
+	Token string `json:"token"`
+	Path  string `json:"path"`
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLegacyMap(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLegacyMap(t *testing.T) {
+	dir := t.TempDir()
+	m, err := loadLegacyMap("", dir)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	for content, msg := range map[string]string{
+		"docA,../outside.md\n":               "inside the output directory",
+		"docA,/abs/a.md\n":                   "relative to the output directory",
+		"docA,a/b?.md\n":                     "inside the output directory",
+		"docA,a/.md\n":                       "expect a file name",
+		"docA,a.md\ndocB,A.md\n":             "map to the same path",
+		"docA,a.md\ndocA,b.md\n":             "duplicate token",
+		"docA,a.md,extra\n":                  "wrong number of fields",
+		"token,path\ndocA,guides/a.md\ndocB": "wrong number of fields",
+	} {
+		_, err := loadLegacyMap(writeLegacyMap(t, dir, "map.csv", content), dir)
+		assert.ErrorContains(t, err, msg, content)
+	}
+	_, err = loadLegacyMap(writeLegacyMap(t, dir, "map.yaml", "docA: a.md\n"), dir)
+	assert.ErrorContains(t, err, "expect a .csv or .json file")
+
+	// 表头、注释和 Windows 路径分隔符
+	m, err = loadLegacyMap(writeLegacyMap(t, dir, "map.csv",
+		"\ufefftoken,path\n# exported by v1\ndocA, guides\\Getting Started.md\ndocB,./b.md\n"), dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{"docA": "guides/Getting Started.md", "docB": "b.md"}, m.paths)
+	}
+	m, err = loadLegacyMap(writeLegacyMap(t, dir, "map.json", `{"docA": "guides/a.md"}`), dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{"docA": "guides/a.md"}, m.paths)
+	}
+}
+
+func TestDownloadWikiLegacyMap(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addDoc("", "B")
+	api.addDoc("wikA", "A1")
+	var err error
+	// docA 按文档token匹配，docA1 按wiki节点token匹配
+	runLegacyMap, err = loadLegacyMap(writeLegacyMap(t, t.TempDir(), "legacy.json", `{
+  "docA": "old/Guide.md",
+  "wikA1": "old/nested/Child Page.md",
+  "docGone": "old/removed.md"
+}`), outputDir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	runManifest = newManifestRecorder(outputDir)
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 3, report.SuccessCount)
+	assertFileExists(t, filepath.Join(outputDir, "old", "Guide.md"))
+	assertFileExists(t, filepath.Join(outputDir, "old", "nested", "Child Page.md"))
+	assertFileExists(t, filepath.Join(outputDir, "Space", "B.md"))
+	_, err = os.Stat(filepath.Join(outputDir, "Space", "A.md"))
+	assert.True(t, os.IsNotExist(err))
+
+	dirs := make(map[string]string)
+	for _, result := range report.Results {
+		dirs[result.Filename] = result.OutputDir
+	}
+	assert.Equal(t, filepath.Join(outputDir, "old"), dirs["Guide.md"])
+	// 清单以旧路径为准
+	assert.Equal(t, "old/Guide.md", runManifest.manifest.Documents["docA"].Path)
+	assert.Equal(t, "old/nested/Child Page.md", runManifest.manifest.Documents["docA1"].Path)
+	assert.Equal(t, []LegacyPath{{Token: "docGone", Path: "old/removed.md"}}, report.LegacyUnmatched)
+}
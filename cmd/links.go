@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// feishuDocLinkRegexp 匹配Markdown链接、自动链接和HTML href中指向飞书文档的地址，
+// 分组依次为前缀、文档token、查询参数和锚点、自动链接的结尾
+var feishuDocLinkRegexp = regexp.MustCompile(
+	`(\]\(<?|href="|<)https?://[\w.-]+/(?:wiki|docx)/([A-Za-z0-9]+)((?:[?#][^\s)>"]*)?)(>?)`)
+
+// linkIndex 记录本次下载的文档token与本地Markdown文件的对应关系，
+// 下载完成后将文档间的链接改写为相对路径，为nil时不改写
+type linkIndex struct {
+	mu    sync.Mutex
+	paths map[string]string // 知识库节点token或文档token -> Markdown文件路径
+	files []string          // 本次写入、需要改写的Markdown文件
+}
+
+var runLinks *linkIndex
+
+func newLinkIndex() *linkIndex {
+	return &linkIndex{paths: make(map[string]string)}
+}
+
+// validateRewriteLinks 只有批量和wiki下载才有多个文档可以互相链接
+func validateRewriteLinks(opts *DownloadOpts) error {
+	if !opts.rewriteLinks {
+		return nil
+	}
+	if !opts.batch && !opts.wiki && opts.spaceName == "" && !opts.hasURLList() && opts.retryReport == "" {
+		return errors.New("--rewrite-links only works with --batch, --wiki, --from-file or --retry")
+	}
+	if opts.fileExt() != ".md" {
+		return errors.New("--rewrite-links only works with the markdown format")
+	}
+	return nil
+}
+
+// add 记录文档的本地路径，written为false时只作为链接目标（如同步时跳过的文档）
+func (l *linkIndex) add(path string, written bool, tokens ...string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, token := range tokens {
+		l.paths[token] = path
+	}
+	if written {
+		l.files = append(l.files, path)
+	}
+}
+
+// addManifest 将清单中的Markdown文档作为链接目标，重试时链接到之前已下载的文档
+func (l *linkIndex) addManifest(manifest *Manifest, rootDir string) {
+	if l == nil || manifest == nil {
+		return
+	}
+	for token, entry := range manifest.Documents {
+		if entry.Type == "" && filepath.Ext(entry.Path) == ".md" {
+			path := filepath.Join(rootDir, filepath.FromSlash(entry.Path))
+			l.add(path, false, append(entry.DocumentSource.tokens(), token)...)
+		}
+	}
+}
+
+// rewriteLinks 改写content中指向已下载文档的链接，指向自身的链接（如原文档链接）保持不变。
+// 本地没有对应锚点，查询参数和锚点都会去掉
+func (l *linkIndex) rewriteLinks(path, content string) (string, int) {
+	count := 0
+	result := feishuDocLinkRegexp.ReplaceAllStringFunc(content, func(match string) string {
+		groups := feishuDocLinkRegexp.FindStringSubmatch(match)
+		target, ok := l.paths[groups[2]]
+		if !ok || target == path {
+			return match
+		}
+		rel, err := filepath.Rel(filepath.Dir(path), target)
+		if err != nil {
+			return match
+		}
+		link := filepath.ToSlash(rel)
+		if !strings.HasPrefix(link, "../") {
+			link = "./" + link
+		}
+		count++
+		escaped := strings.ReplaceAll(link, " ", "%20")
+		switch prefix, suffix := groups[1], groups[4]; prefix {
+		case "](<":
+			return prefix + link + suffix
+		case "<":
+			// 相对路径不能作为自动链接，改为以文件名为文字的普通链接
+			name := strings.TrimSuffix(filepath.Base(target), filepath.Ext(target))
+			return fmt.Sprintf("[%s](%s)", name, escaped)
+		default:
+			return prefix + escaped + suffix
+		}
+	})
+	return result, count
+}
+
+// rewrite 改写本次写入的全部Markdown文件，并在报告中记录每个文件改写的链接数
+func (l *linkIndex) rewrite(report *BatchDownloadReport, rootDir string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sort.Strings(l.files)
+	for _, path := range l.files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to rewrite links in %s", path)
+		}
+		content, count := l.rewriteLinks(path, string(data))
+		if count == 0 {
+			continue
+		}
+		if err := runDedup.writeFile(path, dlConfig.Output.NormalizeText([]byte(content))); err != nil {
+			return err
+		}
+		if report.RewrittenLinks == nil {
+			report.RewrittenLinks = make(map[string]int)
+		}
+		rel := path
+		if r, err := filepath.Rel(rootDir, path); err == nil {
+			rel = r
+		}
+		report.RewrittenLinks[filepath.ToSlash(rel)] = count
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRewriteLinks(t *testing.T) {
+	assert.NoError(t, validateRewriteLinks(&DownloadOpts{}))
+	assert.NoError(t, validateRewriteLinks(&DownloadOpts{rewriteLinks: true, wiki: true}))
+	assert.NoError(t, validateRewriteLinks(&DownloadOpts{rewriteLinks: true, spaceName: "Space"}))
+	assert.NoError(t, validateRewriteLinks(&DownloadOpts{rewriteLinks: true, retryReport: "report.json"}))
+	assert.Error(t, validateRewriteLinks(&DownloadOpts{rewriteLinks: true}))
+	assert.Error(t, validateRewriteLinks(&DownloadOpts{rewriteLinks: true, batch: true, format: formatText}))
+}
+
+func TestRewriteLinks(t *testing.T) {
+	index := newLinkIndex()
+	index.add("out/Space/设计文档/架构.md", true, "wikArch", "docArch")
+	index.add("out/Space/My Notes.md", false, "wikNotes")
+	index.add("out/Space/Home.md", true, "wikHome")
+
+	content := "> 原文档链接: [Home](https://x.feishu.cn/wiki/wikHome)\n\n" +
+		"[架构](https://x.feishu.cn/wiki/wikArch?from=from_copylink#part-abc) " +
+		"[doc](https://x.feishu.cn/docx/docArch) " +
+		"<https://x.feishu.cn/wiki/wikNotes> " +
+		"[notes](<https://x.feishu.cn/wiki/wikNotes>) " +
+		`<a href="https://x.feishu.cn/wiki/wikNotes#abc">notes</a> ` +
+		"[outside](https://x.feishu.cn/wiki/wikOther)"
+	result, count := index.rewriteLinks("out/Space/Home.md", content)
+	assert.Equal(t, 5, count)
+	assert.Equal(t, "> 原文档链接: [Home](https://x.feishu.cn/wiki/wikHome)\n\n"+
+		"[架构](./设计文档/架构.md) "+
+		"[doc](./设计文档/架构.md) "+
+		"[My Notes](./My%20Notes.md) "+
+		"[notes](<./My Notes.md>) "+
+		`<a href="./My%20Notes.md">notes</a> `+
+		"[outside](https://x.feishu.cn/wiki/wikOther)", result)
+
+	result, count = index.rewriteLinks("out/Space/设计文档/架构.md", "[home](https://x.feishu.cn/wiki/wikHome)")
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "[home](../Home.md)", result)
+}
+
+func TestDownloadWikiRewriteLinks(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	runLinks = newLinkIndex()
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addDoc("", "C")
+	api.addDoc("wikA", "A1")
+	api.links["docA1"] = []string{
+		"https://domain.feishu.cn/wiki/wikC",
+		"https://domain.feishu.cn/docx/docA",
+		"https://domain.feishu.cn/wiki/wikOther",
+	}
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]int{"Space/A/A1.md": 2}, report.RewrittenLinks)
+	data, err := os.ReadFile(filepath.Join(outputDir, "Space", "A", "A1.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "(../C.md)")
+		assert.Contains(t, string(data), "(../A.md)")
+		assert.Contains(t, string(data), "(https://domain.feishu.cn/wiki/wikOther)")
+		// 原文档链接仍指向飞书
+		assert.Contains(t, string(data), "https://domain.feishu.cn/wiki/wikA1")
+	}
+}
@@ -3,19 +3,26 @@ package main
 import (
 	"log"
 	"os"
-	"strings"
 
 	"github.com/urfave/cli/v2"
 )
 
-var version = "v2-test"
-
 func main() {
 	app := &cli.App{
 		Name:    "feishu2md",
-		Version: strings.TrimSpace(string(version)),
+		Version: currentBuildInfo().String(),
 		Usage:   "Download feishu/larksuite document to markdown file",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "check-update",
+				Value: false,
+				Usage: "Check whether a newer release is available",
+			},
+		},
 		Action: func(ctx *cli.Context) error {
+			if ctx.Bool("check-update") {
+				return handleCheckUpdate()
+			}
 			cli.ShowAppHelp(ctx)
 			return nil
 		},
@@ -59,6 +66,47 @@ func main() {
 						Usage:       "Dump json response of the OPEN API",
 						Destination: &dlOpts.dump,
 					},
+					&cli.StringFlag{
+						Name:        "dump-dir",
+						Usage:       "Collect the dumped json files in this directory instead of next to the markdown",
+						Destination: &dlOpts.dumpDir,
+					},
+					&cli.BoolFlag{
+						Name:        "dump-gzip",
+						Value:       false,
+						Usage:       "Compress the dumped json files with gzip",
+						Destination: &dlOpts.dumpGzip,
+					},
+					&cli.StringFlag{
+						Name:        "format",
+						Value:       "md",
+						Usage:       "Output format, md, text (plain text in reading order for search indexing) or chunks (jsonl for LLM ingestion)",
+						Destination: &dlOpts.format,
+					},
+					&cli.BoolFlag{
+						Name:        "text-keep-links",
+						Value:       false,
+						Usage:       "Keep link urls after the anchor text (with --format text)",
+						Destination: &dlOpts.textKeepLinks,
+					},
+					&cli.IntFlag{
+						Name:        "chunk-max-tokens",
+						Value:       2000,
+						Usage:       "Approximate token limit of each chunk (with --format chunks)",
+						Destination: &dlOpts.chunkMaxTokens,
+					},
+					&cli.Float64Flag{
+						Name:        "chunk-chars-per-token",
+						Value:       2,
+						Usage:       "Characters per token used to estimate the chunk size, lower it for chinese text",
+						Destination: &dlOpts.chunkCharsPerToken,
+					},
+					&cli.BoolFlag{
+						Name:        "chunks-combined",
+						Value:       false,
+						Usage:       "Write the chunks of all documents to one chunks.jsonl instead of one file per document",
+						Destination: &dlOpts.chunksCombined,
+					},
 					&cli.BoolFlag{
 						Name:        "batch",
 						Value:       false,
@@ -71,22 +119,229 @@ func main() {
 						Usage:       "Download all documents within the wiki.",
 						Destination: &dlOpts.wiki,
 					},
+					&cli.BoolFlag{
+						Name:        "sync",
+						Value:       false,
+						Usage:       "Skip documents whose revision is unchanged since the last run recorded in the manifest (with --batch or --wiki)",
+						Destination: &dlOpts.sync,
+					},
+					&cli.BoolFlag{
+						Name:        "prune",
+						Value:       false,
+						Usage:       "Delete the local files of documents removed remotely (with --sync)",
+						Destination: &dlOpts.prune,
+					},
+					&cli.BoolFlag{
+						Name:        "pin-resolutions",
+						Value:       false,
+						Usage:       "Reuse the wiki node and space name resolutions recorded in the manifest, only looking up new ones",
+						Destination: &dlOpts.pinResolutions,
+					},
+					&cli.BoolFlag{
+						Name:        "re-resolve",
+						Value:       false,
+						Usage:       "Look up every resolution again even with --pin-resolutions, reporting the ones that changed",
+						Destination: &dlOpts.reResolve,
+					},
+					&cli.BoolFlag{
+						Name:        "dry-run",
+						Value:       false,
+						Usage:       "Only traverse and list the documents that would be downloaded in the report, without reading or writing any document",
+						Destination: &dlOpts.dryRun,
+					},
+					&cli.BoolFlag{
+						Name:        "estimate",
+						Value:       false,
+						Usage:       "With --dry-run, estimate the API calls, images and duration of the download and store them in the report",
+						Destination: &dlOpts.estimate,
+					},
+					&cli.BoolFlag{
+						Name:        "rewrite-links",
+						Value:       false,
+						Usage:       "Rewrite links between the downloaded documents to relative local paths (with --batch, --wiki, --from-file or --retry)",
+						Destination: &dlOpts.rewriteLinks,
+					},
+					&cli.BoolFlag{
+						Name:        "front-matter",
+						Usage:       "Write a YAML front matter instead of the title heading and source link, overrides output.front_matter for this run",
+						Destination: &dlOpts.frontMatter,
+					},
+					&cli.IntFlag{
+						Name:        "max-concurrency",
+						Aliases:     []string{"concurrency"},
+						Usage:       "Maximum number of documents downloaded at the same time, 1 downloads them one by one in order (default: download.concurrency or 10)",
+						Destination: &dlOpts.maxConcurrency,
+					},
+					&cli.IntFlag{
+						Name:        "content-concurrency",
+						Usage:       "Number of documents whose content is fetched at the same time (default: half of --max-concurrency)",
+						Destination: &dlOpts.contentConcurrency,
+					},
+					&cli.IntFlag{
+						Name:        "image-concurrency",
+						Usage:       "Number of documents whose images are downloaded and written at the same time (default: --max-concurrency)",
+						Destination: &dlOpts.imageConcurrency,
+					},
+					&cli.StringFlag{
+						Name:        "status-addr",
+						Usage:       "Serve the progress as json on http://<addr>/status and accept POST /cancel during the run, e.g. 127.0.0.1:8090",
+						Destination: &dlOpts.statusAddr,
+					},
+					&cli.StringFlag{
+						Name:        "retry",
+						Usage:       "Download again the failed documents of a previous report, into its output directory unless -o is given",
+						Destination: &dlOpts.retryReport,
+					},
+					&cli.StringFlag{
+						Name:        "from-file",
+						Usage:       "Download the document urls listed one per line in the file, - for stdin",
+						Destination: &dlOpts.fromFile,
+					},
+					&cli.StringFlag{
+						Name:        "legacy-map",
+						Usage:       "Write the documents listed in the CSV or JSON file of doc token to legacy relative path at their legacy paths",
+						Destination: &dlOpts.legacyMap,
+					},
+					&cli.BoolFlag{
+						Name:        "strict-format",
+						Usage:       "Fail the document when formatting the markdown fails, instead of writing it unformatted with a warning",
+						Destination: &dlOpts.strictFormat,
+					},
+					&cli.BoolFlag{
+						Name:        "from-project",
+						Usage:       "Download the sources listed in the feishu2md.yaml of the output or current directory",
+						Destination: &dlOpts.fromProject,
+					},
+					&cli.BoolFlag{
+						Name:        "no-project-config",
+						Usage:       "Ignore the feishu2md.yaml of the output or current directory",
+						Destination: &dlOpts.noProjectConfig,
+					},
+					&cli.StringSliceFlag{
+						Name:  "sink",
+						Usage: "Also write the result to zip:<file>, report:<file> or summary[:<file>|-] (repeatable)",
+					},
+					&cli.StringFlag{
+						Name:        "space-name",
+						Usage:       "Download the wiki space with this name instead of its url, the argument becomes the optional site url",
+						Destination: &dlOpts.spaceName,
+					},
 					&cli.BoolFlag{
 						Name:        "outline",
 						Value:       false,
-						Usage:       "只生成Wiki目录结构的Markdown文档，不下载实际内容",
+						Usage:       "只生成Wiki或文件夹目录结构的Markdown文档，不下载实际内容；与--wiki或--batch一起使用时下载后生成链接到本地文件的目录",
 						Destination: &dlOpts.wikiOutline,
 					},
+					&cli.IntFlag{
+						Name:        "outline-depth",
+						Value:       0,
+						Usage:       "生成目录结构时的最大层级，0表示不限制",
+						Destination: &dlOpts.outlineDepth,
+					},
 					&cli.BoolFlag{
 						Name:        "outline-with-links",
 						Value:       false,
-						Usage:       "生成Wiki目录结构时包含文章链接（需要与--outline一起使用）",
+						Usage:       "生成目录结构时包含文章链接（需要与--outline一起使用）",
 						Destination: &dlOpts.wikiOutlineWithLinks,
 					},
+					&cli.StringFlag{
+						Name:        "outline-format",
+						Value:       outlineFormatMarkdown,
+						Usage:       "目录结构的格式，md 或 json",
+						Destination: &dlOpts.outlineFormat,
+					},
+					&cli.BoolFlag{
+						Name:        "outline-no-icons",
+						Value:       false,
+						Usage:       "目录结构中不添加节点类型的emoji标识",
+						Destination: &dlOpts.outlineNoIcons,
+					},
+					&cli.BoolFlag{
+						Name:        "with-permissions",
+						Value:       false,
+						Usage:       "Save the space members and sharing settings to permissions.json (with --wiki)",
+						Destination: &dlOpts.withPermissions,
+					},
+					&cli.StringFlag{
+						Name:        "exclude-drafts",
+						Usage:       "Skip wiki nodes and files whose title starts with this prefix, e.g. \"[草稿]\"",
+						Destination: &dlOpts.excludeDrafts,
+					},
+					&cli.BoolFlag{
+						Name:        "include-hidden",
+						Value:       false,
+						Usage:       "Also export wiki nodes hidden from space visitors, when the node list tells the visibility",
+						Destination: &dlOpts.includeHidden,
+					},
+					&cli.StringFlag{
+						Name:        "types",
+						Value:       defaultDownloadTypes,
+						Usage:       "Comma separated node types to download with --batch or --wiki, docx, file (uploaded files such as pdf), sheet and bitable",
+						Destination: &dlOpts.types,
+					},
+					&cli.BoolFlag{
+						Name:        "force-empty",
+						Value:       false,
+						Usage:       "Write the report and root folder even when no documents are found",
+						Destination: &dlOpts.forceEmpty,
+					},
+					&cli.IntFlag{
+						Name:        "empty-exit-code",
+						Value:       3,
+						Usage:       "Exit code when no documents are found, 0 treats it as success",
+						Destination: &dlOpts.emptyExitCode,
+					},
+					&cli.IntFlag{
+						Name:        "max-path-bytes",
+						Value:       0,
+						Usage:       "Truncate folder and file names to keep every path within this many bytes, 0 uses 240 (200 on Windows), -1 disables it",
+						Destination: &dlOpts.maxPathBytes,
+					},
+					&cli.StringFlag{
+						Name:        "dedup-against",
+						Usage:       "与指定的历史快照目录对比，内容相同的文件以硬链接代替写入",
+						Destination: &dlOpts.dedupAgainst,
+					},
+					&cli.BoolFlag{
+						Name:        "git-commit",
+						Value:       false,
+						Usage:       "Commit the files written by this run when the output directory is inside a git work tree",
+						Destination: &dlOpts.gitCommit,
+					},
+					&cli.BoolFlag{
+						Name:        "git-push",
+						Value:       false,
+						Usage:       "Push after committing (requires --git-commit)",
+						Destination: &dlOpts.gitPush,
+					},
+					&cli.StringFlag{
+						Name:        "git-message",
+						Value:       defaultGitMessage,
+						Usage:       "Commit message template, fields of the download report are available",
+						Destination: &dlOpts.gitMessage,
+					},
+					&cli.BoolFlag{
+						Name:        "git-allow-dirty",
+						Value:       false,
+						Usage:       "Allow committing when the work tree has unrelated uncommitted changes",
+						Destination: &dlOpts.gitAllowDirty,
+					},
+					&cli.IntFlag{
+						Name:        "git-max-failures",
+						Value:       0,
+						Usage:       "Skip the commit when more documents than this failed to download",
+						Destination: &dlOpts.gitMaxFailures,
+					},
 				},
 				ArgsUsage: "<url>",
 				Action: func(ctx *cli.Context) error {
-					if ctx.NArg() == 0 {
+					dlOpts.sinks = ctx.StringSlice("sink")
+					dlOpts.outputDirSet = ctx.IsSet("output")
+					dlOpts.frontMatterSet = ctx.IsSet("front-matter")
+					dlOpts.setFlags = projectFlagNames(ctx.LocalFlagNames())
+					if ctx.NArg() == 0 && (dlOpts.spaceName != "" || dlOpts.fromFile != "" || dlOpts.retryReport != "" || dlOpts.fromProject) {
+						return handleDownloadCommand("")
+					} else if ctx.NArg() == 0 {
 						return cli.Exit("Please specify the document/folder/wiki url", 1)
 					} else {
 						url := ctx.Args().First()
@@ -94,6 +349,148 @@ func main() {
 					}
 				},
 			},
+			{
+				Name:      "cache",
+				Usage:     "Show statistics of the local cache or clear it",
+				ArgsUsage: "stats|clear",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() == 0 {
+						return cli.Exit("Please specify stats or clear", 1)
+					}
+					return handleCacheCommand(ctx.Args().First())
+				},
+			},
+			{
+				Name:      "changes",
+				Usage:     "Compare two download manifests and list the added, changed, moved and removed documents",
+				ArgsUsage: "<old-manifest> <new-manifest>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Value: false,
+						Usage: "Print the changes as json",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 2 {
+						return cli.Exit("Please specify the old and new manifest files", 1)
+					}
+					return handleChangesCommand(ctx.Args().Get(0), ctx.Args().Get(1), ctx.Bool("json"))
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "Mark the word level changes of a document since the local export or a dump in a separate markdown file",
+				ArgsUsage: "<url>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "inline",
+						Value: true,
+						Usage: "Mark the insertions and deletions inline in the document, the only mode for now",
+					},
+					&cli.StringFlag{
+						Name:        "against",
+						Usage:       "Compare against this exported markdown file or dump (.json or .json.gz) instead of the export found in --dir",
+						Destination: &diffOpts.against,
+					},
+					&cli.StringFlag{
+						Name:        "dir",
+						Aliases:     []string{"d"},
+						Value:       "./",
+						Usage:       "The root directory of the local export, where the manifest and images are looked up",
+						Destination: &diffOpts.dir,
+					},
+					&cli.StringFlag{
+						Name:        "output",
+						Aliases:     []string{"o"},
+						Usage:       "The file to write the changes to, <title>.diff.md in the current directory by default",
+						Destination: &diffOpts.output,
+					},
+					&cli.StringFlag{
+						Name:        "style",
+						Value:       "html",
+						Usage:       "How the changes are marked, html (<ins>/<del>) or critic (CriticMarkup {++ ++}/{-- --})",
+						Destination: &diffOpts.style,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						return cli.Exit("Please specify the document url", 1)
+					}
+					return handleDiffCommand(ctx.Args().First())
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "Check whether a local mirror is current by reading only the revision of every document in its manifest",
+				ArgsUsage: "<mirror-dir>",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:        "sample",
+						Value:       0,
+						Usage:       "Only check this many randomly picked documents, 0 checks all of them",
+						Destination: &verifyOpts.sample,
+					},
+					&cli.BoolFlag{
+						Name:        "json",
+						Value:       false,
+						Usage:       "Print the results as json",
+						Destination: &verifyOpts.json,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						return cli.Exit("Please specify the mirror directory", 1)
+					}
+					return handleVerifyCommand(ctx.Args().First())
+				},
+			},
+			{
+				Name:  "version",
+				Usage: "Print the version, commit and build environment",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "json",
+						Value:       false,
+						Usage:       "Print the build information as json",
+						Destination: &versionOpts.json,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return handleVersionCommand()
+				},
+			},
+			{
+				Name:      "tags",
+				Usage:     "Regenerate TAGS.md next to a download manifest",
+				ArgsUsage: "<manifest>",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						return cli.Exit("Please specify the manifest file", 1)
+					}
+					return handleTagsCommand(ctx.Args().First())
+				},
+			},
+			{
+				Name:  "convert",
+				Usage: "Convert dumped json files (optionally gzipped) to markdown offline",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "output",
+						Aliases:     []string{"o"},
+						Value:       "./",
+						Usage:       "Specify the output directory for the markdown files",
+						Destination: &convertOpts.outputDir,
+					},
+				},
+				ArgsUsage: "<dump.json[.gz]>...",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() == 0 {
+						return cli.Exit("Please specify the dumped json file(s)", 1)
+					}
+					return handleConvertCommand(ctx.Args().Slice())
+				},
+			},
 		},
 	}
 
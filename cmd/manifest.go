@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// manifestFileName 批量和wiki下载时写入输出目录的清单文件
+const manifestFileName = ".feishu2md-manifest.json"
+
+const manifestVersion = 1
+
+// ManifestEntry 记录一个文档的导出位置和内容摘要
+type ManifestEntry struct {
+	Token       string `json:"token"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Path        string `json:"path"` // 相对清单所在目录，使用 / 分隔
+	RevisionID  int64  `json:"revision_id"`
+	ContentHash string `json:"content_hash"`
+	// 文档在知识库或文件夹中的上级目录标题，由外向内排列
+	Tags []string `json:"tags,omitempty"`
+	// 上传的文件为 "file"，表格为 "sheet" 或 "bitable"，文档为空
+	Type string `json:"type,omitempty"`
+	// 知识库中的文档同时记录节点链接和文档链接
+	DocumentSource
+}
+
+// Manifest 一次下载运行导出的全部文档，按文档token索引
+type Manifest struct {
+	Version     int                       `json:"version"`
+	GeneratedAt time.Time                 `json:"generated_at"`
+	Documents   map[string]*ManifestEntry `json:"documents"`
+	// 从链接列表下载时各文件夹和知识空间的根目录，与报告中的 roots 相同
+	Roots []RootDir `json:"roots,omitempty"`
+	// 本次运行中需要查询接口的链接解析，键为 kind:input
+	Resolutions map[string]*Resolution `json:"resolutions,omitempty"`
+}
+
+// manifestRecorder 收集本次运行写入的文档，为nil时不生成清单
+type manifestRecorder struct {
+	mu       sync.Mutex
+	rootDir  string
+	manifest *Manifest
+	previous *Manifest // 上一次运行的清单，不存在或损坏时为nil
+	sync     bool      // 跳过版本号与上一次清单相同的文档
+	prune    bool      // 删除远端已删除文档的本地文件
+	partial  bool      // 只下载了部分文档（--retry），其余文档沿用上一次的记录
+	// write 之后与上一次清单的差异，没有上一次的清单时全部为新增，--git-commit 据此暂存文档
+	diff *ManifestDiff
+}
+
+var runManifest *manifestRecorder
+
+// newManifestRecorder 创建清单记录并读取rootDir中上一次的清单，
+// 清单损坏时只告警，按全量下载处理
+func newManifestRecorder(rootDir string) *manifestRecorder {
+	previous, err := readManifest(filepath.Join(rootDir, manifestFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: ignore the previous manifest: %v\n", err)
+		}
+		previous = nil
+	}
+	return &manifestRecorder{
+		rootDir: rootDir,
+		manifest: &Manifest{
+			Version:   manifestVersion,
+			Documents: make(map[string]*ManifestEntry),
+		},
+		previous: previous,
+	}
+}
+
+// relPath 返回相对清单所在目录、以 / 分隔的路径
+func (r *manifestRecorder) relPath(outputPath string) string {
+	path := outputPath
+	if rel, err := filepath.Rel(r.rootDir, outputPath); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+// unchanged 同步模式下，文档版本号和输出路径都与上一次相同且本地文件仍然存在时返回true
+func (r *manifestRecorder) unchanged(docToken string, revisionID int64, outputPath string) bool {
+	if !r.syncing() {
+		return false
+	}
+	entry, ok := r.previous.Documents[docToken]
+	if !ok || entry.RevisionID != revisionID || entry.Path != r.relPath(outputPath) {
+		return false
+	}
+	_, err := os.Stat(outputPath)
+	return err == nil
+}
+
+// keep 沿用上一次清单中跳过的文档，标题和标签以本次为准
+func (r *manifestRecorder) keep(docx *lark.DocxDocument, docToken, url string, source DocumentSource, tags []string) {
+	if r == nil || r.previous == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := *r.previous.Documents[docToken]
+	entry.Title = docx.Title
+	entry.URL = url
+	entry.Tags = tags
+	entry.DocumentSource = source
+	r.manifest.Documents[docToken] = &entry
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// record 记录写入outputPath的文档，哈希基于写入的内容，没有实际改动的新版本不会被视为修改
+func (r *manifestRecorder) record(docx *lark.DocxDocument, docToken, url string, source DocumentSource, outputPath string, tags []string, content []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.manifest.Documents[docToken] = &ManifestEntry{
+		Token:          docToken,
+		Title:          docx.Title,
+		URL:            url,
+		Path:           r.relPath(outputPath),
+		RevisionID:     docx.RevisionID,
+		ContentHash:    contentHash(content),
+		Tags:           tags,
+		DocumentSource: source,
+	}
+}
+
+// recordFile 记录下载的上传文件或表格，不按版本号跳过，按内容摘要比较变化
+func (r *manifestRecorder) recordFile(objType, fileToken, title, url string, source DocumentSource, outputPath string, tags []string, hash string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.manifest.Documents[fileToken] = &ManifestEntry{
+		Token:          fileToken,
+		Title:          title,
+		URL:            url,
+		Path:           r.relPath(outputPath),
+		ContentHash:    hash,
+		Tags:           tags,
+		Type:           objType,
+		DocumentSource: source,
+	}
+}
+
+// readManifest 读取清单文件，文件不存在时返回 os.ErrNotExist
+func readManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(utils.TrimBOM(data), manifest); err != nil {
+		return nil, errors.Wrapf(err, "invalid manifest %s", path)
+	}
+	if manifest.Documents == nil {
+		manifest.Documents = make(map[string]*ManifestEntry)
+	}
+	return manifest, nil
+}
+
+func writeManifest(path string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 同步模式依赖清单判断哪些文档无需下载，不受 output.fsync 影响
+	return utils.WriteFileDurable(path, dlConfig.Output.NormalizeText(data), 0o644)
+}
+
+// write 写入本次运行的清单和 TAGS.md，存在上一次的清单时生成 CHANGES.md。
+// 下载失败和按 overrides.yaml 跳过的文档以及重试时未下载的文档沿用上一次的记录，避免被误报为删除
+func (r *manifestRecorder) write(report *BatchDownloadReport) error {
+	if r == nil {
+		return nil
+	}
+	manifestPath := filepath.Join(r.rootDir, manifestFileName)
+	previous := r.previous
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current := r.manifest
+	current.GeneratedAt = dlConfig.Output.Now()
+	if report != nil {
+		current.Roots = report.Roots
+	}
+	current.Resolutions = runResolutions.resolutions()
+	if previous != nil && report != nil {
+		kept := keptURLs(report)
+		for token, entry := range previous.Documents {
+			if _, ok := current.Documents[token]; !ok && (r.partial || kept[entry.URL]) {
+				current.Documents[token] = entry
+			}
+		}
+	}
+
+	if err := writeManifest(manifestPath, current); err != nil {
+		return err
+	}
+	runFiles.Add(manifestPath)
+	if err := writeTags(r.rootDir, current); err != nil {
+		return err
+	}
+
+	base := previous
+	if base == nil {
+		base = &Manifest{}
+	}
+	r.diff = diffManifests(base, current)
+	if previous == nil {
+		return nil
+	}
+	diff := r.diff
+	changesPath := filepath.Join(r.rootDir, changesFileName)
+	changes := dlConfig.Output.NormalizeText([]byte(renderChanges(diff, current.GeneratedAt)))
+	if err := runSyncer.WriteFile(changesPath, changes, 0o644); err != nil {
+		return err
+	}
+	runFiles.Add(changesPath)
+	fmt.Printf("变更记录: 新增 %d，修改 %d，移动 %d，删除 %d，详见 %s\n",
+		len(diff.Added), len(diff.Changed), len(diff.Moved), len(diff.Removed), changesPath)
+	return nil
+}
+
+// sortedEntries 按路径排序，保证输出稳定
+func sortedEntries(entries []*ManifestEntry) []*ManifestEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
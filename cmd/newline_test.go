@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewlinePolicy(t *testing.T) {
+	tests := []struct {
+		newline string
+		bom     bool
+		want    string
+	}{
+		{utils.NewlineLF, false,
+			"# A\n\n> 原文档链接: [A](https://domain.feishu.cn/wiki/wikA)\n\n# A\n\ncontent of A\n"},
+		{utils.NewlineCRLF, true,
+			"\xEF\xBB\xBF# A\r\n\r\n> 原文档链接: [A](https://domain.feishu.cn/wiki/wikA)\r\n\r\n# A\r\n\r\ncontent of A\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.newline, func(t *testing.T) {
+			outputDir := setupDownloadTest(t)
+			dlConfig.Output.Newline = tt.newline
+			dlConfig.Output.BOM = tt.bom
+			api := newFakeWiki()
+			api.addDoc("", "A")
+			url := "https://domain.feishu.cn/wiki/settings/123"
+			run := func() {
+				t.Helper()
+				runManifest = newManifestRecorder(outputDir)
+				report, err := downloadWiki(context.Background(), api, url)
+				if assert.NoError(t, err) {
+					assert.NoError(t, runManifest.write(report))
+				}
+			}
+
+			run()
+			mdPath := filepath.Join(outputDir, "Space", "A.md")
+			first, err := os.ReadFile(mdPath)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, string(first))
+			for _, name := range []string{manifestFileName, tagsFileName} {
+				data, err := os.ReadFile(filepath.Join(outputDir, name))
+				if assert.NoError(t, err) {
+					assertLineEndings(t, data, tt.newline, tt.bom)
+				}
+			}
+
+			// 内容和设置都不变时，再次运行得到完全相同的文件，上一次的清单也能正常读取
+			run()
+			second, err := os.ReadFile(mdPath)
+			if assert.NoError(t, err) {
+				assert.Equal(t, first, second)
+			}
+			data, err := os.ReadFile(filepath.Join(outputDir, changesFileName))
+			if assert.NoError(t, err) {
+				assertLineEndings(t, data, tt.newline, tt.bom)
+			}
+		})
+	}
+}
+
+func assertLineEndings(t *testing.T, data []byte, newline string, bom bool) {
+	t.Helper()
+	assert.Equal(t, bom, bytes.HasPrefix(data, []byte("\xEF\xBB\xBF")))
+	crlf := bytes.Count(data, []byte("\r\n"))
+	if newline == utils.NewlineCRLF {
+		assert.Equal(t, bytes.Count(data, []byte("\n")), crlf)
+		assert.Positive(t, crlf)
+	} else {
+		assert.Zero(t, bytes.Count(data, []byte("\r")))
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+// outlineNode 目录树节点，wiki节点和云空间文件共用，也是 --outline-format json 输出的节点
+type outlineNode struct {
+	Token    string `json:"token"`
+	Title    string `json:"title"`
+	ObjType  string `json:"obj_type"`
+	URL      string `json:"url"`
+	HasChild bool   `json:"has_child"`
+	// 与 --wiki 或 --batch 一起使用时，已下载文档相对目录结构文档的路径
+	Path     string         `json:"path,omitempty"`
+	Children []*outlineNode `json:"children"`
+}
+
+// outlineDocument --outline-format json 输出的目录树，字段保持稳定
+type outlineDocument struct {
+	Title       string         `json:"title"`
+	Type        string         `json:"type"` // "wiki" 或 "folder"
+	URL         string         `json:"url"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	NodeCount   int            `json:"node_count"`
+	Nodes       []*outlineNode `json:"nodes"`
+}
+
+const (
+	outlineFormatMarkdown = "md"
+	outlineFormatJSON     = "json"
+)
+
+// outlineSource 目录树的数据来源，parent为nil时列出根节点
+type outlineSource struct {
+	Name         string
+	Token        string // 知识空间id或文件夹token，用于 output.file_name_template 的 {token}
+	Kind         string
+	Type         string // "wiki" 或 "folder"，用于json输出
+	URL          string
+	listChildren func(ctx context.Context, parent *outlineNode) ([]*outlineNode, error)
+}
+
+// 各类型节点的标识
+var outlineTypeIcons = map[string]string{
+	"docx":     "📄",
+	"doc":      "📄",
+	"sheet":    "📊",
+	"bitable":  "🗃️",
+	"mindnote": "🧠",
+	"file":     "📎",
+	"slides":   "📽️",
+	"folder":   "📁",
+}
+
+func newWikiOutlineSource(ctx context.Context, client core.API, url string) (*outlineSource, error) {
+	prefixURL, spaceID, err := utils.ValidateWikiURL(url)
+	if err != nil {
+		return nil, err
+	}
+	// 获取Wiki空间名称
+	wikiName, err := client.GetWikiName(ctx, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	if wikiName == "" {
+		return nil, fmt.Errorf("获取Wiki名称失败")
+	}
+	return &outlineSource{
+		Name:  wikiName,
+		Token: spaceID,
+		Kind:  "Wiki",
+		Type:  "wiki",
+		URL:   url,
+		listChildren: func(ctx context.Context, parent *outlineNode) ([]*outlineNode, error) {
+			var parentToken *string
+			if parent != nil {
+				parentToken = &parent.Token
+			}
+			nodes, err := client.GetWikiNodeList(ctx, spaceID, parentToken)
+			if err != nil {
+				return nil, err
+			}
+			children := make([]*outlineNode, 0, len(nodes))
+			for _, n := range nodes {
+				// 目录中同样不列出对访客隐藏的节点
+				if isExcludedHidden(n) {
+					continue
+				}
+				children = append(children, &outlineNode{
+					Token:    n.NodeToken,
+					Title:    n.Title,
+					ObjType:  n.ObjType,
+					URL:      fmt.Sprintf("%s/wiki/%s", prefixURL, n.NodeToken),
+					HasChild: n.HasChild,
+				})
+			}
+			return children, nil
+		},
+	}, nil
+}
+
+func newFolderOutlineSource(ctx context.Context, client core.API, url string) (*outlineSource, error) {
+	folderToken, err := utils.ValidateFolderURL(url)
+	if err != nil {
+		return nil, err
+	}
+	folderName, err := client.GetDriveFolderName(ctx, folderToken)
+	if err != nil {
+		return nil, err
+	}
+	if folderName == "" {
+		return nil, fmt.Errorf("获取文件夹名称失败")
+	}
+	return &outlineSource{
+		Name:  folderName,
+		Token: folderToken,
+		Kind:  "文件夹",
+		Type:  "folder",
+		URL:   url,
+		listChildren: func(ctx context.Context, parent *outlineNode) ([]*outlineNode, error) {
+			token := folderToken
+			if parent != nil {
+				token = parent.Token
+			}
+			files, err := client.GetDriveFolderFileList(ctx, nil, &token)
+			if err != nil {
+				return nil, err
+			}
+			children := make([]*outlineNode, 0, len(files))
+			for _, f := range files {
+				children = append(children, &outlineNode{
+					Token:    f.Token,
+					Title:    f.Name,
+					ObjType:  f.Type,
+					URL:      f.URL,
+					HasChild: f.Type == "folder",
+				})
+			}
+			return children, nil
+		},
+	}, nil
+}
+
+// buildOutlineTree 递归构建目录树，maxDepth为0时不限制深度，
+// 循环引用和超过 download.max_depth 的节点与下载时一样不列出
+func buildOutlineTree(ctx context.Context, source *outlineSource, guard *traversalGuard, parent *outlineNode, depth, maxDepth int) ([]*outlineNode, error) {
+	listed, err := source.listChildren(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	// 目录中同样不列出草稿
+	nodes := make([]*outlineNode, 0, len(listed))
+	for _, node := range listed {
+		if isExcludedDraft(node.Title) {
+			continue
+		}
+		if reason := guard.check(node.Token, depth+1); reason != "" {
+			warnf("Warning: left %s (%s) out of the outline: %s\n", node.Title, node.Token, reason)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	for _, node := range nodes {
+		// json中没有子节点的节点输出空数组而不是null
+		node.Children = []*outlineNode{}
+		if !node.HasChild || (maxDepth > 0 && depth+1 >= maxDepth) {
+			continue
+		}
+		if node.Children, err = buildOutlineTree(ctx, source, guard, node, depth+1, maxDepth); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// validateOutlineFormat 检查 --outline-format
+func validateOutlineFormat(format string) error {
+	switch format {
+	case "", outlineFormatMarkdown, outlineFormatJSON:
+		return nil
+	}
+	return errors.Errorf("invalid --outline-format %q, expect \"md\" or \"json\"", format)
+}
+
+// localOutlinePaths 按下载报告中的链接索引已下载文档的本地路径，用于目录结构中的本地链接
+func localOutlinePaths(report *BatchDownloadReport) map[string]string {
+	paths := make(map[string]string)
+	if report == nil {
+		return paths
+	}
+	for _, result := range report.Results {
+		if result.Status == "error" || result.Filename == "" {
+			continue
+		}
+		paths[result.URL] = filepath.Join(result.OutputDir, result.Filename)
+	}
+	return paths
+}
+
+// linkLocalOutline 将目录树中已下载的节点指向相对outputDir的本地文件
+func linkLocalOutline(nodes []*outlineNode, localPaths map[string]string, outputDir string) {
+	for _, node := range nodes {
+		if path, ok := localPaths[node.URL]; ok {
+			node.Path = relativeLink(outputDir, path)
+		}
+		linkLocalOutline(node.Children, localPaths, outputDir)
+	}
+}
+
+// generateOutline 生成Wiki或文件夹目录树的文档，localPaths不为nil时（与 --wiki 或 --batch
+// 一起使用）链接指向本次下载的本地文件
+func generateOutline(ctx context.Context, client core.API, url string, localPaths map[string]string) error {
+	var source *outlineSource
+	var err error
+	if _, _, wikiErr := utils.ValidateWikiURL(url); wikiErr == nil {
+		source, err = newWikiOutlineSource(ctx, client, url)
+	} else if _, folderErr := utils.ValidateFolderURL(url); folderErr == nil {
+		source, err = newFolderOutlineSource(ctx, client, url)
+	} else {
+		return fmt.Errorf("--outline only supports wiki settings or drive folder URLs")
+	}
+	if err != nil {
+		return err
+	}
+
+	// 创建输出目录
+	if _, err := os.Stat(dlOpts.outputDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dlOpts.outputDir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	// 递归生成目录树
+	tree, err := buildOutlineTree(ctx, source, newTraversalGuard(), nil, 0, dlOpts.outlineDepth)
+	if err != nil {
+		return err
+	}
+
+	if localPaths != nil {
+		linkLocalOutline(tree, localPaths, dlOpts.outputDir)
+	}
+
+	outputPath := filepath.Join(dlOpts.outputDir, outlineFileName(source, dlOpts.outlineFormat))
+	generatedAt := time.Now()
+	var data []byte
+	if dlOpts.outlineFormat == outlineFormatJSON {
+		total, _ := countOutlineNodes(tree)
+		data, err = json.MarshalIndent(&outlineDocument{
+			Title:       source.Name,
+			Type:        source.Type,
+			URL:         source.URL,
+			GeneratedAt: dlConfig.Output.InLocation(generatedAt),
+			NodeCount:   total,
+			Nodes:       tree,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+	} else {
+		data = []byte(renderOutlineMarkdown(source, tree, generatedAt))
+	}
+
+	// 写入文件
+	if err = os.WriteFile(outputPath, dlConfig.Output.NormalizeText(data), 0o644); err != nil {
+		return err
+	}
+	runFiles.Add(outputPath)
+
+	fmt.Printf("%s目录结构已保存到: %s\n", source.Kind, outputPath)
+	return nil
+}
+
+// renderOutlineMarkdown 生成目录树的Markdown文档
+func renderOutlineMarkdown(source *outlineSource, tree []*outlineNode, generatedAt time.Time) string {
+	var sb strings.Builder
+	if dlConfig.Output.FrontMatter {
+		total, _ := countOutlineNodes(tree)
+		sb.WriteString(core.RenderFrontMatter([]core.FrontMatterField{
+			{Key: "title", Value: fmt.Sprintf("%s 目录结构", source.Name)},
+			{Key: "generated_at", Value: dlConfig.Output.FormatTime(generatedAt)},
+			{Key: "source", Value: source.URL},
+			{Key: "node_count", Value: total},
+		}))
+	}
+	sb.WriteString(fmt.Sprintf("# %s 目录结构\n\n", source.Name))
+	sb.WriteString(fmt.Sprintf("> 生成时间: %s\n\n", dlConfig.Output.FormatTime(generatedAt)))
+	sb.WriteString(fmt.Sprintf("> 原%s链接: [%s](%s)\n\n", source.Kind, source.Name, source.URL))
+	if dlConfig.Output.FrontMatter {
+		sb.WriteString(outlineSummary(tree))
+	}
+	writeOutlineMarkdown(&sb, tree, "", dlOpts.wikiOutlineWithLinks)
+	return sb.String()
+}
+
+// outlineFileName 目录结构文档的文件名，按 output.file_name_template 生成，标题为"<名称>_目录结构"，
+// 默认模板下与之前的文件名相同
+func outlineFileName(source *outlineSource, format string) string {
+	ext := ".md"
+	if format == outlineFormatJSON {
+		ext = ".json"
+	}
+	return dlConfig.Output.FileName(source.Name+"_目录结构", source.Token) + ext
+}
+
+// countOutlineNodes 统计节点总数及各类型的数量
+func countOutlineNodes(nodes []*outlineNode) (int, map[string]int) {
+	total := 0
+	counts := make(map[string]int)
+	var walk func(nodes []*outlineNode)
+	walk = func(nodes []*outlineNode) {
+		for _, node := range nodes {
+			total++
+			counts[node.ObjType]++
+			walk(node.Children)
+		}
+	}
+	walk(nodes)
+	return total, counts
+}
+
+// outlineSummary 按类型汇总节点数量，数量多的类型在前
+func outlineSummary(nodes []*outlineNode) string {
+	total, counts := countOutlineNodes(nodes)
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if counts[types[i]] != counts[types[j]] {
+			return counts[types[i]] > counts[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	parts := make([]string, 0, len(types))
+	for _, t := range types {
+		parts = append(parts, fmt.Sprintf("%s %d", t, counts[t]))
+	}
+	return fmt.Sprintf("> 共 %d 个节点: %s\n\n", total, strings.Join(parts, ", "))
+}
+
+// writeOutlineMarkdown 将目录树渲染为嵌套列表
+func writeOutlineMarkdown(sb *strings.Builder, nodes []*outlineNode, indent string, withLinks bool) {
+	for _, node := range nodes {
+		// 根据withLinks参数决定是否生成链接，已下载的节点优先链接到本地文件
+		if withLinks {
+			link := node.URL
+			if node.Path != "" {
+				link = node.Path
+				if strings.ContainsAny(link, " ()<>") {
+					link = "<" + link + ">"
+				}
+			}
+			sb.WriteString(fmt.Sprintf("%s- [%s](%s)", indent, node.Title, link))
+		} else {
+			sb.WriteString(fmt.Sprintf("%s- %s", indent, node.Title))
+		}
+
+		// 添加节点类型标识，部分渲染器无法显示emoji时可以通过 --outline-no-icons 去掉
+		if !dlOpts.outlineNoIcons {
+			sb.WriteString(outlineMarker(node))
+		}
+		sb.WriteString("\n")
+
+		writeOutlineMarkdown(sb, node.Children, indent+"  ", withLinks)
+	}
+}
+
+// outlineMarker 节点类型标识，上传的文件附上扩展名，便于区分pdf、pptx等
+func outlineMarker(node *outlineNode) string {
+	if icon, ok := outlineTypeIcons[node.ObjType]; ok {
+		if ext := strings.TrimPrefix(filepath.Ext(node.Title), "."); node.ObjType == fileNodeType && ext != "" {
+			return " " + icon + " " + strings.ToLower(ext)
+		}
+		return " " + icon
+	}
+	if node.HasChild {
+		return " 📁"
+	}
+	return ""
+}
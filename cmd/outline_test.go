@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOutlineFakeAPI() *fakeAPI {
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addNode("", "wikB", "mindnote", "bmnB", "B")
+	api.addNode("wikA", "wikA1", "docx", "docA1", "A1 notes")
+	return api
+}
+
+func TestGenerateOutlineJSON(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.outlineFormat = outlineFormatJSON
+	err := generateOutline(context.Background(), newOutlineFakeAPI(), "https://domain.feishu.cn/wiki/settings/123", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Space_目录结构.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var outline outlineDocument
+	assert.NoError(t, json.Unmarshal(data, &outline))
+	assert.Equal(t, "Space", outline.Title)
+	assert.Equal(t, "wiki", outline.Type)
+	assert.Equal(t, 3, outline.NodeCount)
+	if assert.Len(t, outline.Nodes, 2) {
+		a := outline.Nodes[0]
+		assert.Equal(t, "wikA", a.Token)
+		assert.Equal(t, "docx", a.ObjType)
+		assert.True(t, a.HasChild)
+		assert.Equal(t, "https://domain.feishu.cn/wiki/wikA", a.URL)
+		if assert.Len(t, a.Children, 1) {
+			assert.Equal(t, "A1 notes", a.Children[0].Title)
+		}
+		assert.Empty(t, a.Path)
+	}
+	// 叶子节点的children为空数组，便于下游按固定结构解析
+	assert.Contains(t, string(data), `"children": []`)
+	assert.NotContains(t, string(data), `"children": null`)
+	assert.Error(t, validateOutlineFormat("yaml"))
+}
+
+func TestWikiOutlineLocalLinks(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.wikiOutlineWithLinks = true
+	dlOpts.outlineNoIcons = true
+	api := newOutlineFakeAPI()
+	url := "https://domain.feishu.cn/wiki/settings/123"
+
+	report, err := downloadWiki(context.Background(), api, url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, generateOutline(context.Background(), api, url, localOutlinePaths(report))) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Space_目录结构.md"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	outline := string(data)
+	assert.Contains(t, outline, "- [A](./Space/A.md)\n")
+	assert.Contains(t, outline, "  - [A1 notes](<./Space/A/A1 notes.md>)\n")
+	// 未下载的节点仍链接到原文
+	assert.Contains(t, outline, "- [B](https://domain.feishu.cn/wiki/wikB)\n")
+	assert.NotContains(t, outline, "📄")
+	// 本地链接都能找到对应的文件
+	for _, rel := range []string{"Space/A.md", "Space/A/A1 notes.md"} {
+		assertFileExists(t, filepath.Join(outputDir, filepath.FromSlash(rel)))
+	}
+	assert.True(t, strings.HasPrefix(outline, "# Space 目录结构\n"))
+}
+
+func TestOutlineFileNameTemplate(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlConfig.Output.FileNameTemplate = "{title}_{token}"
+	err := generateOutline(context.Background(), newOutlineFakeAPI(), "https://domain.feishu.cn/wiki/settings/123", nil)
+	if assert.NoError(t, err) {
+		assertFileExists(t, filepath.Join(outputDir, "Space_目录结构_123.md"))
+	}
+}
+
+func TestFolderOutline(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.wikiOutlineWithLinks = true
+	api := newFakeAPI()
+	api.folderNames["fld"] = "Team Docs"
+	api.folders["fld"] = []*lark.GetDriveFileListRespFile{
+		{Token: "docG", Name: "Guide", Type: "docx", URL: "https://domain.feishu.cn/docx/docG"},
+		{Token: "sub", Name: "Sub", Type: "folder", URL: "https://domain.feishu.cn/drive/folder/sub"},
+		{Token: "shtB", Name: "Budget", Type: "sheet", URL: "https://domain.feishu.cn/sheets/shtB"},
+	}
+	api.folders["sub"] = []*lark.GetDriveFileListRespFile{
+		{Token: "deep", Name: "Deep", Type: "folder", URL: "https://domain.feishu.cn/drive/folder/deep"},
+		{Token: "docN", Name: "Notes", Type: "docx", URL: "https://domain.feishu.cn/docx/docN"},
+	}
+	api.folders["deep"] = []*lark.GetDriveFileListRespFile{
+		{Token: "boxP", Name: "Plan.PDF", Type: "file", URL: "https://domain.feishu.cn/file/boxP"},
+	}
+	url := "https://domain.feishu.cn/drive/folder/fld"
+
+	// 文件名取自根文件夹名称，子文件夹按层级缩进，节点附上类型标识
+	if !assert.NoError(t, generateOutline(context.Background(), api, url, nil)) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Team Docs_目录结构.md"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	outline := string(data)
+	assert.True(t, strings.HasPrefix(outline, "# Team Docs 目录结构\n"))
+	assert.Contains(t, outline, "> 原文件夹链接: [Team Docs]("+url+")\n")
+	assert.Contains(t, outline, "- [Guide](https://domain.feishu.cn/docx/docG) 📄\n"+
+		"- [Sub](https://domain.feishu.cn/drive/folder/sub) 📁\n"+
+		"  - [Deep](https://domain.feishu.cn/drive/folder/deep) 📁\n"+
+		"    - [Plan.PDF](https://domain.feishu.cn/file/boxP) 📎 pdf\n"+
+		"  - [Notes](https://domain.feishu.cn/docx/docN) 📄\n"+
+		"- [Budget](https://domain.feishu.cn/sheets/shtB) 📊\n")
+
+	// 与wiki相同的层级限制和json格式
+	dlOpts.outlineDepth = 2
+	dlOpts.outlineFormat = outlineFormatJSON
+	if !assert.NoError(t, generateOutline(context.Background(), api, url, nil)) {
+		return
+	}
+	data, err = os.ReadFile(filepath.Join(outputDir, "Team Docs_目录结构.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var doc outlineDocument
+	assert.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "folder", doc.Type)
+	assert.Equal(t, "Team Docs", doc.Title)
+	assert.Equal(t, 5, doc.NodeCount)
+	if assert.Len(t, doc.Nodes, 3) && assert.Len(t, doc.Nodes[1].Children, 2) {
+		assert.Empty(t, doc.Nodes[1].Children[0].Children)
+	}
+}
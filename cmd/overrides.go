@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// overridesFileName 输出根目录中按文档token记录的手工调整，重新导出后再次应用
+const overridesFileName = "overrides.yaml"
+
+const (
+	overrideSkip              = "skip"
+	overrideFilename          = "filename"
+	overridePatch             = "patch"
+	overrideAppendFrontMatter = "append_front_matter"
+)
+
+// errOverrideSkipped 文档在 overrides.yaml 中标记为 skip，不下载也不覆盖本地文件
+var errOverrideSkipped = errors.New("document is skipped by " + overridesFileName)
+
+// Override 一个文档的覆盖规则
+type Override struct {
+	// Skip 不下载该文档，本地文件和清单记录保持不变
+	Skip bool `yaml:"skip"`
+	// Filename 代替标题的文件名，扩展名由输出格式决定
+	Filename string `yaml:"filename"`
+	// Patch 文档写入后应用的 unified diff，相对输出根目录
+	Patch string `yaml:"patch"`
+	// AppendFrontMatter 追加到 Markdown front matter 的字段，没有 front matter 时新建
+	AppendFrontMatter map[string]interface{} `yaml:"append_front_matter"`
+}
+
+// AppliedOverride 对一个文档应用的覆盖规则及其结果，记录在下载报告中
+type AppliedOverride struct {
+	Directive string `json:"directive"`
+	Status    string `json:"status"` // "applied" or "failed"
+	Error     string `json:"error,omitempty"`
+}
+
+// overrideSet 本次运行读取的覆盖规则，为nil时没有 overrides.yaml
+type overrideSet struct {
+	rootDir   string
+	overrides map[string]*Override // 文档token -> 规则
+}
+
+var runOverrides *overrideSet
+
+// loadOverrides 读取rootDir中的 overrides.yaml，文件不存在时返回nil
+func loadOverrides(rootDir string) (*overrideSet, error) {
+	path := filepath.Join(rootDir, overridesFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]*Override)
+	decoder := yaml.NewDecoder(bytes.NewReader(utils.TrimBOM(data)))
+	// 拼写错误的规则不会被静默忽略
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&overrides); err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.Wrapf(err, "invalid %s", path)
+	}
+	for token, override := range overrides {
+		if override == nil {
+			return nil, errors.Errorf("%s: %s has no directives", path, token)
+		}
+		if override.Filename != "" && (strings.ContainsAny(override.Filename, `/\`) ||
+			utils.SanitizeFileName(override.Filename) != override.Filename) {
+			return nil, errors.Errorf("%s: invalid filename %q of %s, expect a file name without directories",
+				path, override.Filename, token)
+		}
+		if override.Patch != "" {
+			if _, err := os.Stat(filepath.Join(rootDir, override.Patch)); err != nil {
+				return nil, errors.Wrapf(err, "%s: patch of %s", path, token)
+			}
+		}
+	}
+	fmt.Printf("Using %d overrides in %s\n", len(overrides), path)
+	return &overrideSet{rootDir: rootDir, overrides: overrides}, nil
+}
+
+func (s *overrideSet) lookup(token string) *Override {
+	if s == nil {
+		return nil
+	}
+	return s.overrides[token]
+}
+
+// skipped 文档是否标记为 skip
+func (s *overrideSet) skipped(token string) bool {
+	override := s.lookup(token)
+	return override != nil && override.Skip
+}
+
+// fileName 覆盖的文件名（不含扩展名），没有时返回空
+func (s *overrideSet) fileName(token string) string {
+	override := s.lookup(token)
+	if override == nil || override.Filename == "" {
+		return ""
+	}
+	return strings.TrimSuffix(override.Filename, filepath.Ext(override.Filename))
+}
+
+// apply 在文档写入path后应用补丁和追加的 front matter，失败时只告警，文档保持导出的内容
+func (s *overrideSet) apply(token, path string) []AppliedOverride {
+	override := s.lookup(token)
+	if override == nil {
+		return nil
+	}
+	var applied []AppliedOverride
+	record := func(directive string, err error) {
+		result := AppliedOverride{Directive: directive, Status: "applied"}
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			warnf("Warning: %s of %s in %s failed: %v\n", directive, token, overridesFileName, err)
+		}
+		applied = append(applied, result)
+	}
+	if override.Filename != "" {
+		record(overrideFilename, nil)
+	}
+	if override.Patch != "" {
+		record(overridePatch, s.applyPatch(override.Patch, path))
+	}
+	if len(override.AppendFrontMatter) > 0 {
+		record(overrideAppendFrontMatter, appendFrontMatter(path, override.AppendFrontMatter))
+	}
+	return applied
+}
+
+func (s *overrideSet) applyPatch(patchPath, path string) error {
+	patch, err := os.ReadFile(filepath.Join(s.rootDir, patchPath))
+	if err != nil {
+		return err
+	}
+	return rewriteText(path, func(text string) (string, error) {
+		return utils.ApplyPatch(text, string(patch))
+	})
+}
+
+// appendFrontMatter 将fields追加到 front matter 的末尾，同名字段以追加的为准
+func appendFrontMatter(path string, fields map[string]interface{}) error {
+	if filepath.Ext(path) != ".md" {
+		return errors.Errorf("%s only applies to markdown, not %s", overrideAppendFrontMatter, filepath.Base(path))
+	}
+	return rewriteText(path, func(text string) (string, error) {
+		var frontMatter, body string
+		if strings.HasPrefix(text, "---\n") {
+			end := strings.Index(text[4:], "\n---\n")
+			if end < 0 {
+				return "", errors.New("the front matter is not closed")
+			}
+			frontMatter, body = text[4:4+end], text[4+end+5:]
+		} else {
+			body = "\n" + text
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(frontMatter), &doc); err != nil {
+			return "", errors.Wrap(err, "invalid front matter")
+		}
+		mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if len(doc.Content) > 0 {
+			if mapping = doc.Content[0]; mapping.Kind != yaml.MappingNode {
+				return "", errors.New("the front matter is not a mapping")
+			}
+		}
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := &yaml.Node{}
+			if err := value.Encode(fields[key]); err != nil {
+				return "", err
+			}
+			setMappingValue(mapping, key, value)
+		}
+		buf := new(bytes.Buffer)
+		encoder := yaml.NewEncoder(buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(mapping); err != nil {
+			return "", err
+		}
+		return "---\n" + buf.String() + "---\n" + body, nil
+	})
+}
+
+// setMappingValue 替换mapping中key的值，没有时追加到末尾
+func setMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// rewriteText 以 "\n" 换行修改文本文件，写回时按 output.newline 和 output.bom 处理
+func rewriteText(path string, rewrite func(text string) (string, error)) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	text, err := rewrite(string(utils.NormalizeText(data, utils.NewlineLF, false)))
+	if err != nil {
+		return err
+	}
+	return runSyncer.WriteFile(path, dlConfig.Output.NormalizeText([]byte(text)), 0o644)
+}
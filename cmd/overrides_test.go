@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeOverrides(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, overridesFileName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	overrides, err := loadOverrides(dir)
+	assert.NoError(t, err)
+	assert.Nil(t, overrides)
+
+	for content, msg := range map[string]string{
+		"docA:\n  skipped: true\n":          "not found in type",
+		"docA:\n  filename: a/b.md\n":       "invalid filename",
+		"docA:\n  patch: missing.diff\n":    "patch of docA",
+		"docA:\n":                           "has no directives",
+		"docA:\n  append_front_matter: 1\n": "invalid",
+	} {
+		writeOverrides(t, dir, content)
+		_, err := loadOverrides(dir)
+		assert.ErrorContains(t, err, msg, content)
+	}
+
+	writeOverrides(t, dir, "docA:\n  skip: true\ndocB:\n  filename: custom.md\n")
+	overrides, err = loadOverrides(dir)
+	if assert.NoError(t, err) {
+		assert.True(t, overrides.skipped("docA"))
+		assert.False(t, overrides.skipped("docB"))
+		assert.Equal(t, "custom", overrides.fileName("docB"))
+		assert.Empty(t, overrides.fileName("docC"))
+	}
+}
+
+func TestDownloadWikiOverrides(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addDoc("", "B")
+	api.addDoc("", "C")
+	api.addDoc("", "D")
+	run := func() *BatchDownloadReport {
+		runManifest = newManifestRecorder(outputDir)
+		runManifest.sync = dlOpts.sync
+		runManifest.prune = dlOpts.prune
+		report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+		if assert.NoError(t, err) {
+			runManifest.fillReport(report)
+			assert.NoError(t, runManifest.write(report))
+		}
+		return report
+	}
+	run()
+	// 手工修改过的文档
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "Space", "A.md"), []byte("fixed by hand\n"), 0o644))
+
+	patch := "--- a/C.md\n+++ b/C.md\n@@ -5,3 +5,3 @@\n # C\n \n-content of C\n+content of C, fixed\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "fix-c.diff"), []byte(patch), 0o644))
+	stale := "--- a/D.md\n+++ b/D.md\n@@ -7,1 +7,1 @@\n-old content of D\n+new content of D\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "fix-d.diff"), []byte(stale), 0o644))
+	writeOverrides(t, outputDir, `
+docA:
+  skip: true
+docB:
+  filename: custom.md
+  append_front_matter:
+    draft: false
+    tags: [manual]
+docC:
+  patch: fix-c.diff
+docD:
+  patch: fix-d.diff
+`)
+	var err error
+	runOverrides, err = loadOverrides(outputDir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	dlOpts.sync = true
+	dlOpts.prune = true
+	api.revisions = map[string]int64{"docA": 2, "docB": 2, "docC": 2, "docD": 2}
+	report := run()
+
+	// 跳过的文档保留本地文件和清单记录，不视为删除
+	assert.Equal(t, "skipped", report.Results[0].Status)
+	assert.Equal(t, []AppliedOverride{{Directive: overrideSkip, Status: "applied"}}, report.Results[0].Overrides)
+	data, _ := os.ReadFile(filepath.Join(outputDir, "Space", "A.md"))
+	assert.Equal(t, "fixed by hand\n", string(data))
+	assert.Empty(t, report.Removed)
+	assert.Contains(t, runManifest.manifest.Documents, "docA")
+
+	// 文件名和 front matter
+	assert.Equal(t, "custom.md", report.Results[1].Filename)
+	data, err = os.ReadFile(filepath.Join(outputDir, "Space", "custom.md"))
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(string(data), "---\ndraft: false\ntags:\n  - manual\n---\n\n# B\n"), string(data))
+	}
+	assert.Equal(t, []AppliedOverride{
+		{Directive: overrideFilename, Status: "applied"},
+		{Directive: overrideAppendFrontMatter, Status: "applied"},
+	}, report.Results[1].Overrides)
+
+	// 补丁
+	data, _ = os.ReadFile(filepath.Join(outputDir, "Space", "C.md"))
+	assert.Contains(t, string(data), "content of C, fixed\n")
+	assert.Equal(t, []AppliedOverride{{Directive: overridePatch, Status: "applied"}}, report.Results[2].Overrides)
+
+	// 无法应用的补丁只记录失败，文档保持导出的内容
+	assert.Equal(t, "success", report.Results[3].Status)
+	if assert.Len(t, report.Results[3].Overrides, 1) {
+		assert.Equal(t, "failed", report.Results[3].Overrides[0].Status)
+		assert.Contains(t, report.Results[3].Overrides[0].Error, "does not apply")
+	}
+	data, _ = os.ReadFile(filepath.Join(outputDir, "Space", "D.md"))
+	assert.Contains(t, string(data), "content of D\n")
+	applied, failed := countOverrides(report)
+	assert.Equal(t, 4, applied)
+	assert.Equal(t, 1, failed)
+}
+
+func TestDownloadSingleOverrideSkip(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeAPI()
+	api.docs = map[string]string{"docA": "A"}
+	writeOverrides(t, outputDir, "docA:\n  skip: true\n")
+	var err error
+	if runOverrides, err = loadOverrides(outputDir); !assert.NoError(t, err) {
+		return
+	}
+
+	// 单个文档被跳过时计入跳过而不是成功
+	report, err := downloadSingle(context.Background(), api, "https://domain.feishu.cn/docx/docA")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, report.TotalFiles)
+	assert.Equal(t, 0, report.SuccessCount)
+	assert.Equal(t, 1, report.SkippedCount)
+	if assert.Len(t, report.Results, 1) {
+		assert.Equal(t, "skipped", report.Results[0].Status)
+		assert.Equal(t, []AppliedOverride{{Directive: overrideSkip, Status: "applied"}}, report.Results[0].Overrides)
+	}
+	_, err = os.Stat(filepath.Join(outputDir, "A.md"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+// PathTruncation 记录因路径长度预算被截断的名称，便于按原标题找到文件
+type PathTruncation struct {
+	Original string `json:"original"`
+	Path     string `json:"path"`
+	Token    string `json:"token"`
+}
+
+const (
+	minNameBytes   = 8  // 截断后的名称至少保留的字节数，足够放下token后缀
+	imageNameBytes = 40 // 图片以token或内容哈希命名，加上扩展名不超过该长度
+	sidecarSuffix  = ".meta.json"
+)
+
+// pathBudget 在遍历目录时为每一层分配路径长度预算，保证文档、图片和附属文件
+// 的路径都不超过上限，为nil时不做限制
+type pathBudget struct {
+	mu          sync.Mutex
+	limit       int
+	reserve     int // 目录下最长的图片或附属文件路径所需的字节数
+	truncations map[string]PathTruncation
+}
+
+var runPathBudget *pathBudget
+
+func newPathBudget(limit int, imageDir string) *pathBudget {
+	if limit == 0 {
+		limit = utils.DefaultMaxPathBytes()
+	}
+	reserve := 1 + minNameBytes + len(sidecarSuffix)
+	if image := 1 + len(imageDir) + 1 + imageNameBytes; image > reserve {
+		reserve = image
+	}
+	return &pathBudget{
+		limit:       limit,
+		reserve:     reserve,
+		truncations: make(map[string]PathTruncation),
+	}
+}
+
+// dirName 返回parent下子目录的名称，depth为该目录及其下目录的总层数，
+// 剩余预算按层数平均分配，保证最深的目录也有空间
+func (b *pathBudget) dirName(parent, name, token string, depth int) (string, error) {
+	if b == nil {
+		return name, nil
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	// 每一层还需要一个路径分隔符
+	avail := b.limit - len(parent) - b.reserve
+	maxBytes := avail/depth - 1
+	if maxBytes < minNameBytes {
+		return "", errors.Errorf(
+			"path budget of %d bytes cannot fit %d nested folders under %s, starting at %q "+
+				"(raise --max-path-bytes or use a shorter output directory)",
+			b.limit, depth, parent, name)
+	}
+	return b.truncate(parent, name, maxBytes, token), nil
+}
+
+// fileName 返回dir下文档文件的名称（不含扩展名），预留最长附属文件后缀的空间
+func (b *pathBudget) fileName(dir, name, token string) string {
+	if b == nil {
+		return name
+	}
+	maxBytes := b.limit - len(dir) - 1 - len(sidecarSuffix)
+	if maxBytes < minNameBytes {
+		maxBytes = minNameBytes
+	}
+	return b.truncate(dir, name, maxBytes, token)
+}
+
+// attachmentNamer 返回dir下附件的命名函数，附件名连同token后缀不超过剩余的
+// 路径预算，为nil时不做限制
+func (b *pathBudget) attachmentNamer(dir string) core.AttachmentNamer {
+	if b == nil {
+		return nil
+	}
+	maxBytes := b.limit - len(dir) - 1
+	if maxBytes < minNameBytes {
+		maxBytes = minNameBytes
+	}
+	return func(name, fileToken string) string {
+		saved := core.AttachmentName(name, fileToken, maxBytes)
+		if saved != core.AttachmentName(name, fileToken, 0) {
+			path := filepath.Join(dir, saved)
+			b.mu.Lock()
+			b.truncations[path] = PathTruncation{Original: name, Path: path, Token: fileToken}
+			b.mu.Unlock()
+		}
+		return saved
+	}
+}
+
+func (b *pathBudget) truncate(parent, name string, maxBytes int, token string) string {
+	truncated := utils.TruncateName(name, maxBytes, token)
+	if truncated != name {
+		path := filepath.Join(parent, truncated)
+		b.mu.Lock()
+		b.truncations[path] = PathTruncation{Original: name, Path: path, Token: token}
+		b.mu.Unlock()
+	}
+	return truncated
+}
+
+// fillReport 将截断记录按路径排序写入下载报告
+func (b *pathBudget) fillReport(report *BatchDownloadReport) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	report.PathTruncations = make([]PathTruncation, 0, len(b.truncations))
+	for _, t := range b.truncations {
+		report.PathTruncations = append(report.PathTruncations, t)
+	}
+	sort.Slice(report.PathTruncations, func(i, j int) bool {
+		return report.PathTruncations[i].Path < report.PathTruncations[j].Path
+	})
+}
+
+// documentBaseName 返回文档输出文件的名称（不含扩展名），各种输出格式共用
+func documentBaseName(opts *DownloadOpts, title, docToken string) string {
+	name := opts.names.claim(opts.outputDir, title, docToken)
+	return runPathBudget.fileName(opts.outputDir, name, docToken)
+}
+
+// dirDepth 统计目录下还有多少层子目录，启用路径预算时才需要
+type dirDepth struct {
+	depths   map[string]int
+	children func(ctx context.Context, token string) ([]string, error)
+}
+
+func newDirDepth(children func(ctx context.Context, token string) ([]string, error)) *dirDepth {
+	if runPathBudget == nil {
+		return nil
+	}
+	return &dirDepth{depths: make(map[string]int), children: children}
+}
+
+// of 返回token对应的目录及其下目录的总层数
+func (d *dirDepth) of(ctx context.Context, token string) (int, error) {
+	if d == nil {
+		return 1, nil
+	}
+	if depth, ok := d.depths[token]; ok {
+		return depth, nil
+	}
+	// 子目录中再次出现的祖先按1层计，遍历时会跳过它
+	d.depths[token] = 1
+	subdirs, err := d.children(ctx, token)
+	if err != nil {
+		delete(d.depths, token)
+		return 0, err
+	}
+	depth := 1
+	for _, sub := range subdirs {
+		subDepth, err := d.of(ctx, sub)
+		if err != nil {
+			delete(d.depths, token)
+			return 0, err
+		}
+		if subDepth+1 > depth {
+			depth = subDepth + 1
+		}
+	}
+	d.depths[token] = depth
+	return depth, nil
+}
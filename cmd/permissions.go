@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+)
+
+// SpacePermissionMember 知识空间成员或文档协作者
+type SpacePermissionMember struct {
+	MemberType string `json:"member_type"`
+	MemberID   string `json:"member_id"`
+	Role       string `json:"role"`
+	Name       string `json:"name,omitempty"`
+}
+
+// DocumentPermission 单个文档的协作者和链接分享设置
+type DocumentPermission struct {
+	Title           string                  `json:"title"`
+	NodeToken       string                  `json:"node_token"`
+	ObjToken        string                  `json:"obj_token"`
+	ObjType         string                  `json:"obj_type"`
+	LinkShareEntity string                  `json:"link_share_entity,omitempty"`
+	ExternalAccess  bool                    `json:"external_access"`
+	Collaborators   []SpacePermissionMember `json:"collaborators"`
+}
+
+// SpacePermissions 导出时知识空间的权限快照
+type SpacePermissions struct {
+	SpaceID     string                  `json:"space_id"`
+	SpaceName   string                  `json:"space_name"`
+	SpaceType   string                  `json:"space_type,omitempty"`
+	Visibility  string                  `json:"visibility,omitempty"`
+	GeneratedAt time.Time               `json:"generated_at"`
+	Members     []SpacePermissionMember `json:"members"`
+	Documents   []DocumentPermission    `json:"documents"`
+	Warnings    []string                `json:"warnings,omitempty"`
+}
+
+// permissionNode 遍历wiki时记录的文档节点
+type permissionNode struct {
+	Title     string
+	NodeToken string
+	ObjToken  string
+	ObjType   string
+}
+
+// userNameResolver 将open id解析为用户名，缺少通讯录权限时只记录id
+type userNameResolver struct {
+	client   core.API
+	names    map[string]string
+	disabled bool
+}
+
+func (r *userNameResolver) resolve(ctx context.Context, perms *SpacePermissions, openID string) string {
+	if r.disabled || openID == "" {
+		return ""
+	}
+	if name, ok := r.names[openID]; ok {
+		return name
+	}
+	name, err := r.client.GetUserName(ctx, openID)
+	if err != nil {
+		r.disabled = true
+		perms.warn("failed to resolve user names, recording ids only: %v", err)
+		return ""
+	}
+	r.names[openID] = name
+	return name
+}
+
+func (p *SpacePermissions) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Printf("Warning: %s\n", msg)
+	p.Warnings = append(p.Warnings, msg)
+}
+
+// writeSpacePermissions 在空间根目录写入permissions.json，查询失败只记录告警
+func writeSpacePermissions(ctx context.Context, client core.API,
+	spaceID, spaceName, folderPath string, nodes []permissionNode,
+) error {
+	perms := &SpacePermissions{
+		SpaceID:     spaceID,
+		SpaceName:   spaceName,
+		GeneratedAt: dlConfig.Output.Now(),
+		Members:     make([]SpacePermissionMember, 0),
+		Documents:   make([]DocumentPermission, 0, len(nodes)),
+	}
+	resolver := &userNameResolver{client: client, names: make(map[string]string)}
+
+	if space, err := client.GetWikiSpace(ctx, spaceID); err != nil {
+		perms.warn("failed to get the settings of space %s: %v", spaceID, err)
+	} else if space != nil {
+		perms.SpaceType = space.SpaceType
+		perms.Visibility = space.Visibility
+	}
+
+	if members, err := client.GetWikiSpaceMembers(ctx, spaceID); err != nil {
+		perms.warn("failed to list the members of space %s: %v", spaceID, err)
+	} else {
+		for _, m := range members {
+			member := SpacePermissionMember{MemberType: m.MemberType, MemberID: m.MemberID, Role: m.MemberRole}
+			if m.MemberType == "openid" {
+				member.Name = resolver.resolve(ctx, perms, m.MemberID)
+			}
+			perms.Members = append(perms.Members, member)
+		}
+	}
+
+	for _, n := range nodes {
+		doc := DocumentPermission{
+			Title:         n.Title,
+			NodeToken:     n.NodeToken,
+			ObjToken:      n.ObjToken,
+			ObjType:       n.ObjType,
+			Collaborators: make([]SpacePermissionMember, 0),
+		}
+		if public, err := client.GetDocPublicPermission(ctx, n.ObjToken, n.ObjType); err != nil {
+			perms.warn("failed to get the sharing settings of %s: %v", n.Title, err)
+		} else if public != nil {
+			doc.LinkShareEntity = public.LinkShareEntity
+			doc.ExternalAccess = public.ExternalAccess
+		}
+		if members, err := client.GetDocCollaborators(ctx, n.ObjToken, n.ObjType); err != nil {
+			perms.warn("failed to list the collaborators of %s: %v", n.Title, err)
+		} else {
+			for _, m := range members {
+				member := SpacePermissionMember{MemberType: m.MemberType, MemberID: m.MemberOpenID, Role: m.Perm}
+				if m.MemberType == "user" {
+					member.Name = resolver.resolve(ctx, perms, m.MemberOpenID)
+				}
+				doc.Collaborators = append(doc.Collaborators, member)
+			}
+		}
+		perms.Documents = append(perms.Documents, doc)
+	}
+
+	outputPath := filepath.Join(folderPath, "permissions.json")
+	data := dlConfig.Output.NormalizeText([]byte(utils.PrettyPrint(perms)))
+	if err := runSyncer.WriteFile(outputPath, data, 0o644); err != nil {
+		return err
+	}
+	runFiles.Add(outputPath)
+	fmt.Printf("Saved permission snapshot to %s\n", outputPath)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPermissionAPI() *fakeAPI {
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addDoc("wikA", "A1")
+	api.members = []core.WikiSpaceMember{
+		{MemberType: "openid", MemberID: "ou_1", MemberRole: "admin"},
+		{MemberType: "opendepartmentid", MemberID: "od_1", MemberRole: "member"},
+	}
+	api.collabs["docA"] = []*lark.GetDriveMemberPermissionListRespMember{
+		{MemberType: "user", MemberOpenID: "ou_2", Perm: "edit"},
+		{MemberType: "chat", MemberOpenID: "oc_1", Perm: "view"},
+	}
+	api.public["docA"] = &lark.GetDrivePublicPermissionRespPermissionPublic{
+		LinkShareEntity: "tenant_readable", ExternalAccess: true,
+	}
+	return api
+}
+
+// downloadPermissions 下载知识空间，返回文档A的内容和权限快照
+func downloadPermissions(t *testing.T, api *fakeAPI, withPermissions bool) (string, *SpacePermissions) {
+	t.Helper()
+	outputDir := setupDownloadTest(t)
+	dlOpts.withPermissions = withPermissions
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) || !assert.Equal(t, 2, report.SuccessCount) {
+		t.FailNow()
+	}
+	doc, err := os.ReadFile(filepath.Join(outputDir, "Space", "A.md"))
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "Space", "permissions.json"))
+	if !withPermissions {
+		assert.True(t, os.IsNotExist(err))
+		return string(doc), nil
+	}
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var perms SpacePermissions
+	assert.NoError(t, json.Unmarshal(data, &perms))
+	return string(doc), &perms
+}
+
+func TestWriteSpacePermissions(t *testing.T) {
+	api := newPermissionAPI()
+	api.userNames = map[string]string{"ou_1": "Alice", "ou_2": "Bob"}
+	plain, _ := downloadPermissions(t, api, false)
+	assert.Zero(t, api.callCount("GetWikiSpaceMembers"))
+
+	// 权限快照写在空间根目录，文档输出不变
+	doc, perms := downloadPermissions(t, api, true)
+	assert.Equal(t, plain, doc)
+	assert.Equal(t, "123", perms.SpaceID)
+	assert.Equal(t, "Space", perms.SpaceName)
+	assert.Equal(t, []SpacePermissionMember{
+		{MemberType: "openid", MemberID: "ou_1", Role: "admin", Name: "Alice"},
+		{MemberType: "opendepartmentid", MemberID: "od_1", Role: "member"},
+	}, perms.Members)
+	// 子节点先于父节点遍历
+	if assert.Len(t, perms.Documents, 2) {
+		assert.Equal(t, "wikA1", perms.Documents[0].NodeToken)
+		assert.Empty(t, perms.Documents[0].Collaborators)
+		assert.Equal(t, DocumentPermission{
+			Title: "A", NodeToken: "wikA", ObjToken: "docA", ObjType: "docx",
+			LinkShareEntity: "tenant_readable", ExternalAccess: true,
+			Collaborators: []SpacePermissionMember{
+				{MemberType: "user", MemberID: "ou_2", Role: "edit", Name: "Bob"},
+				{MemberType: "chat", MemberID: "oc_1", Role: "view"},
+			},
+		}, perms.Documents[1])
+	}
+	assert.Empty(t, perms.Warnings)
+}
+
+func TestWriteSpacePermissionsWithoutContactScope(t *testing.T) {
+	api := newPermissionAPI()
+	plain, _ := downloadPermissions(t, api, false)
+
+	// 缺少通讯录权限时只记录id并告警一次
+	doc, perms := downloadPermissions(t, api, true)
+	assert.Equal(t, plain, doc)
+	assert.Equal(t, 1, api.callCount("GetUserName"))
+	assert.Equal(t, SpacePermissionMember{MemberType: "openid", MemberID: "ou_1", Role: "admin"}, perms.Members[0])
+	if assert.Len(t, perms.Documents, 2) && assert.Len(t, perms.Documents[1].Collaborators, 2) {
+		assert.Equal(t, "ou_2", perms.Documents[1].Collaborators[0].MemberID)
+		assert.Empty(t, perms.Documents[1].Collaborators[0].Name)
+	}
+	if assert.Len(t, perms.Warnings, 1) {
+		assert.Contains(t, perms.Warnings[0], "failed to resolve user names, recording ids only")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/pkg/errors"
+)
+
+// downloadJob 流水线中的一个文档，index为提交顺序，报告按该顺序排列
+type downloadJob struct {
+	index int
+	url   string
+	opts  DownloadOpts
+	doc   *fetchedDocument
+}
+
+// downloadPipeline 将文档下载分为两个阶段：读取内容的阶段主要等待接口返回，
+// 下载图片并写入的阶段主要占用带宽。两个阶段各自并发，通过有界channel连接，
+// 下载当前文档图片的同时预先读取后续文档的内容
+type downloadPipeline struct {
+	ctx       context.Context
+	client    core.API
+	jobs      chan *downloadJob
+	fetched   chan *downloadJob
+	fetchWG   sync.WaitGroup
+	writeWG   sync.WaitGroup
+	mu        sync.Mutex
+	results   []DownloadResult
+	submitted int
+	// sequential 并发数为1时不启动worker，提交时依次读取并写入，便于调试
+	sequential bool
+}
+
+// stageConcurrency 返回两个阶段的并发数，未指定时由 --max-concurrency 推导：
+// 读取内容受接口频率限制，取一半即可
+func stageConcurrency(opts *DownloadOpts) (content, image int) {
+	limit := opts.maxConcurrency
+	if limit <= 0 {
+		limit = maxConcurrency
+	}
+	content, image = opts.contentConcurrency, opts.imageConcurrency
+	if content <= 0 {
+		content = (limit + 1) / 2
+	}
+	if image <= 0 {
+		image = limit
+	}
+	return content, image
+}
+
+// validateConcurrency 并发数不能为负数，0表示使用默认值
+func validateConcurrency(opts *DownloadOpts) error {
+	if opts.maxConcurrency < 0 || opts.contentConcurrency < 0 || opts.imageConcurrency < 0 {
+		return errors.New("--max-concurrency, --content-concurrency and --image-concurrency must not be negative")
+	}
+	return nil
+}
+
+func newDownloadPipeline(ctx context.Context, client core.API) *downloadPipeline {
+	content, image := stageConcurrency(&dlOpts)
+	p := &downloadPipeline{
+		ctx:     ctx,
+		client:  client,
+		jobs:    make(chan *downloadJob, content),
+		fetched: make(chan *downloadJob, image),
+	}
+	if content == 1 && image == 1 {
+		p.sequential = true
+		return p
+	}
+	for i := 1; i <= content; i++ {
+		p.fetchWG.Add(1)
+		go p.fetchWorker(fmt.Sprintf("content-%d", i))
+	}
+	for i := 1; i <= image; i++ {
+		p.writeWG.Add(1)
+		go p.writeWorker(fmt.Sprintf("image-%d", i))
+	}
+	return p
+}
+
+// submit 提交一个文档，两个阶段都忙时阻塞遍历，避免积压过多读取完的内容
+func (p *downloadPipeline) submit(url string, opts DownloadOpts) {
+	job := &downloadJob{index: p.submitted, url: url, opts: opts}
+	p.submitted++
+	runProgress.add()
+	if dlOpts.dryRun {
+		p.plan(job)
+		return
+	}
+	if p.sequential {
+		p.process(job)
+		return
+	}
+	p.jobs <- job
+}
+
+// plan 空跑时只记录遍历到的文档，不读取内容
+func (p *downloadPipeline) plan(job *downloadJob) {
+	result := plannedResult(job.url, &job.opts)
+	runProgress.finish(result.Status)
+	p.store(job.index, result)
+}
+
+// fail 在提交顺序中记录一个无法下载的链接，不经过两个阶段
+func (p *downloadPipeline) fail(url string, opts DownloadOpts, err error) {
+	job := &downloadJob{index: p.submitted, url: url, opts: opts}
+	p.submitted++
+	runProgress.add()
+	p.finish(job, err)
+}
+
+// process 在当前goroutine中依次完成两个阶段
+func (p *downloadPipeline) process(job *downloadJob) {
+	runProgress.begin("content-1", job.url)
+	err := p.ctx.Err()
+	if err == nil {
+		job.doc, err = fetchDocument(p.ctx, p.client, job.url, &job.opts)
+	}
+	runProgress.idle("content-1")
+	if err == nil {
+		runProgress.begin("image-1", job.url)
+		err = writeDocument(p.ctx, p.client, job.doc, &job.opts)
+		runProgress.idle("image-1")
+	}
+	p.finish(job, err)
+}
+
+// wait 等待两个阶段处理完全部文档，返回按提交顺序排列的结果。
+// 取消后剩余的文档不再请求接口，直接记为失败
+func (p *downloadPipeline) wait() []DownloadResult {
+	close(p.jobs)
+	p.fetchWG.Wait()
+	close(p.fetched)
+	p.writeWG.Wait()
+	runProgress.end()
+	return p.results
+}
+
+// fetchWorker 读取内容阶段的worker，name用于在状态接口中显示正在处理的文档
+func (p *downloadPipeline) fetchWorker(name string) {
+	defer p.fetchWG.Done()
+	for job := range p.jobs {
+		runProgress.begin(name, job.url)
+		err := p.ctx.Err()
+		if err == nil {
+			job.doc, err = fetchDocument(p.ctx, p.client, job.url, &job.opts)
+		}
+		runProgress.idle(name)
+		if err != nil {
+			p.finish(job, err)
+			continue
+		}
+		p.fetched <- job
+	}
+}
+
+// writeWorker 下载图片并写入阶段的worker
+func (p *downloadPipeline) writeWorker(name string) {
+	defer p.writeWG.Done()
+	for job := range p.fetched {
+		runProgress.begin(name, job.url)
+		err := p.ctx.Err()
+		if err == nil {
+			err = writeDocument(p.ctx, p.client, job.doc, &job.opts)
+		}
+		runProgress.idle(name)
+		p.finish(job, err)
+	}
+}
+
+func (p *downloadPipeline) finish(job *downloadJob, err error) {
+	result := documentResult(job.url, job.doc, err, &job.opts)
+	runProgress.finish(result.Status)
+	p.store(job.index, result)
+}
+
+func (p *downloadPipeline) store(index int, result DownloadResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.results) <= index {
+		p.results = append(p.results, DownloadResult{})
+	}
+	p.results[index] = result
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedAPI 附件下载阻塞到gate关闭，模拟占满带宽的图片下载阶段
+type gatedAPI struct {
+	*fakeAPI
+	gate chan struct{}
+}
+
+func (g *gatedAPI) DownloadAttachment(ctx context.Context, fileToken, dir string, namer core.AttachmentNamer) (string, error) {
+	select {
+	case <-g.gate:
+	case <-ctx.Done():
+		return fileToken, ctx.Err()
+	}
+	return g.fakeAPI.DownloadAttachment(ctx, fileToken, dir, namer)
+}
+
+func newGatedAPI(docs int) (*gatedAPI, []string) {
+	api := newFakeAPI()
+	var urls []string
+	for i := 0; i < docs; i++ {
+		token := fmt.Sprintf("doc%d", i)
+		api.docs[token] = fmt.Sprintf("Doc%d", i)
+		api.attachments[token] = []*lark.DocxBlockFile{{Token: "box" + token, Name: token + ".zip"}}
+		urls = append(urls, "https://domain.feishu.cn/docx/"+token)
+	}
+	return &gatedAPI{fakeAPI: api, gate: make(chan struct{})}, urls
+}
+
+func waitFor(t *testing.T, cond func() bool) bool {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestStageConcurrency(t *testing.T) {
+	content, image := stageConcurrency(&DownloadOpts{})
+	assert.Equal(t, [2]int{5, 10}, [2]int{content, image})
+	content, image = stageConcurrency(&DownloadOpts{maxConcurrency: 3})
+	assert.Equal(t, [2]int{2, 3}, [2]int{content, image})
+	content, image = stageConcurrency(&DownloadOpts{maxConcurrency: 3, contentConcurrency: 8, imageConcurrency: 1})
+	assert.Equal(t, [2]int{8, 1}, [2]int{content, image})
+	assert.Error(t, validateConcurrency(&DownloadOpts{imageConcurrency: -1}))
+}
+
+func TestDownloadPipelinePrefetch(t *testing.T) {
+	setupDownloadTest(t)
+	dlOpts.contentConcurrency = 2
+	dlOpts.imageConcurrency = 1
+	api, urls := newGatedAPI(6)
+
+	p := newDownloadPipeline(context.Background(), api)
+	submitted := make(chan struct{})
+	go func() {
+		for _, url := range urls {
+			p.submit(url, dlOpts.forDir(dlOpts.outputDir))
+		}
+		close(submitted)
+	}()
+	// 图片阶段卡在第一个文档时，后续文档的内容仍被预先读取：
+	// 写入中的1个、channel中的1个，以及两个读取协程各持有的1个
+	assert.True(t, waitFor(t, func() bool { return api.callCount("GetDocxContent") == 4 }),
+		"expected the content of 4 documents to be prefetched, got %d", api.callCount("GetDocxContent"))
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 4, api.callCount("GetDocxContent"), "prefetch must stay bounded")
+
+	close(api.gate)
+	<-submitted
+	results := p.wait()
+	if assert.Len(t, results, len(urls)) {
+		for i, result := range results {
+			assert.Equal(t, urls[i], result.URL, "results keep the submission order")
+			assert.Equal(t, "success", result.Status)
+			assert.Equal(t, fmt.Sprintf("Doc%d.md", i), result.Filename)
+		}
+	}
+}
+
+func TestDownloadPipelineCancel(t *testing.T) {
+	setupDownloadTest(t)
+	dlOpts.contentConcurrency = 2
+	dlOpts.imageConcurrency = 1
+	api, urls := newGatedAPI(6)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := newDownloadPipeline(ctx, api)
+	done := make(chan []DownloadResult)
+	go func() {
+		for _, url := range urls {
+			p.submit(url, dlOpts.forDir(dlOpts.outputDir))
+		}
+		done <- p.wait()
+	}()
+	assert.True(t, waitFor(t, func() bool { return api.callCount("GetDocxContent") == 4 }))
+	// 取消后两个阶段都排空，剩余文档不再请求接口
+	cancel()
+	select {
+	case results := <-done:
+		if assert.Len(t, results, len(urls)) {
+			for i, result := range results {
+				assert.Equal(t, urls[i], result.URL)
+				assert.Equal(t, "error", result.Status)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pipeline did not drain after cancellation")
+	}
+	assert.Equal(t, 4, api.callCount("GetDocxContent"))
+	assert.Equal(t, 0, api.callCount("DownloadAttachment"))
+}
+
+func TestDownloadPipelineSequential(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.maxConcurrency = 1
+	api, urls := newGatedAPI(3)
+	close(api.gate)
+
+	p := newDownloadPipeline(context.Background(), api)
+	for i, url := range urls {
+		p.submit(url, dlOpts.forDir(dlOpts.outputDir))
+		// 并发数为1时提交即完成，不会预先读取下一个文档
+		assertFileExists(t, filepath.Join(outputDir, fmt.Sprintf("Doc%d.md", i)))
+		assert.Equal(t, i+1, api.callCount("GetDocxContent"))
+	}
+	results := p.wait()
+	if assert.Len(t, results, len(urls)) {
+		for i, result := range results {
+			assert.Equal(t, urls[i], result.URL)
+		}
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := &progressLine{out: out, start: time.Now()}
+	p.add()
+	p.add()
+	p.finish("success")
+	p.finish("error")
+	p.printf("Warning: %s\n", "slow")
+	p.end()
+	assert.Equal(t, "\r0/1 done, 0 failed, 0s elapsed"+
+		"\r0/2 done, 0 failed, 0s elapsed"+
+		"\r1/2 done, 0 failed, 0s elapsed"+
+		"\r2/2 done, 1 failed, 0s elapsed"+
+		"\r"+strings.Repeat(" ", 30)+"\rWarning: slow\n"+
+		"\r2/2 done, 1 failed, 0s elapsed\n", out.String())
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/pkg/errors"
+)
+
+// PostProcessDocument 每个文件的处理命令从标准输入读取的文档信息
+type PostProcessDocument struct {
+	Path     string   `json:"path"`
+	Title    string   `json:"title"`
+	URL      string   `json:"url"`
+	Token    string   `json:"token"`
+	Revision int64    `json:"revision"`
+	Type     string   `json:"type,omitempty"` // 表格为 "sheet" 或 "bitable"，文档为空
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// postProcessor 按 output.post_process 对写入的文件执行外部命令，为nil时不执行。
+// 命令可能修改文件，清单和报告仍以本程序写入的内容为准
+type postProcessor struct {
+	conf    core.PostProcessConfig
+	timeout time.Duration
+}
+
+var runPostProcess *postProcessor
+
+// newPostProcessor 未配置命令时返回nil
+func newPostProcessor(conf core.PostProcessConfig) (*postProcessor, error) {
+	if !conf.Enabled() {
+		return nil, nil
+	}
+	timeout, err := conf.TimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+	return &postProcessor{conf: conf, timeout: timeout}, nil
+}
+
+func (p *postProcessor) hasFileCommand() bool {
+	return p != nil && len(p.conf.FileCommand) > 0
+}
+
+// file 对写入的markdown文件执行处理命令
+func (p *postProcessor) file(ctx context.Context, doc PostProcessDocument) error {
+	if !p.hasFileCommand() {
+		return nil
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return p.exec(ctx, p.conf.FileCommand, doc.Path, data)
+}
+
+// run 全部文档写入后以下载报告执行一次处理命令
+func (p *postProcessor) run(ctx context.Context, outputDir string, report *BatchDownloadReport) error {
+	if p == nil || len(p.conf.RunCommand) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return p.exec(ctx, p.conf.RunCommand, outputDir, data)
+}
+
+// exec 执行命令并将输出逐行写入日志，按 on_failure 决定失败时告警还是返回错误
+func (p *postProcessor) exec(ctx context.Context, command []string, target string, stdin []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], append(command[1:len(command):len(command)], target)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	// 命令的子进程仍持有输出时，超时后不再等待
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if line != "" {
+			warnf("[post-process %s] %s\n", target, line)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = errors.Errorf("timed out after %s", p.timeout)
+	}
+	err = errors.Wrapf(err, "post-process command %s failed for %s", command[0], target)
+	if p.conf.OnFailure == core.PostProcessFail {
+		return err
+	}
+	warnf("Warning: %v\n", err)
+	return nil
+}
+
+// writeMarkdown 写入markdown文件并执行处理命令。配置了处理命令时先写入新文件，
+// 处理完成后再与参考快照去重，避免命令改动与快照共享的文件
+func writeMarkdown(ctx context.Context, doc PostProcessDocument, data []byte) error {
+	data = dlConfig.Output.NormalizeText(data)
+	if !runPostProcess.hasFileCommand() {
+		return runDedup.writeFile(doc.Path, data)
+	}
+	if err := runSyncer.WriteFile(doc.Path, data, 0o644); err != nil {
+		return err
+	}
+	if err := runPostProcess.file(ctx, doc); err != nil {
+		return err
+	}
+	runDedup.dedupFile(doc.Path)
+	return nil
+}
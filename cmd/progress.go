@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressLine 汇总本次运行的下载进度，在终端底部刷新为单行，如 "42/180 done, 3 failed, 2m10s elapsed"，
+// 状态接口也读取同一份数据。显示进度时单个文档的下载信息不再逐条输出，失败原因见最后的摘要
+type progressLine struct {
+	mu        sync.Mutex
+	out       io.Writer // 为nil时只汇总不显示
+	start     time.Time
+	submitted int
+	done      int
+	skipped   int
+	failed    int
+	width     int                     // 上一次输出的长度，刷新时用空格覆盖
+	active    map[string]activeWorker // worker名称 -> 正在处理的文档
+}
+
+// activeWorker 流水线中一个worker正在处理的文档
+type activeWorker struct {
+	URL       string    `json:"url"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// runProgress 为nil时不汇总进度，单个文档的信息照常输出
+var runProgress *progressLine
+
+// newProgressLine 只在标准输出为终端时显示进度，重定向到文件时保留逐条输出，只汇总给状态接口
+func newProgressLine() *progressLine {
+	p := &progressLine{start: time.Now()}
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		p.out = os.Stdout
+	}
+	return p
+}
+
+// showing 是否在终端显示进度
+func (p *progressLine) showing() bool {
+	return p != nil && p.out != nil
+}
+
+// add 记录提交的文档，wiki遍历时总数随遍历增加
+func (p *progressLine) add() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.submitted++
+	p.render()
+}
+
+// finish 记录一个文档的下载结果
+func (p *progressLine) finish(status string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	switch status {
+	case "error":
+		p.failed++
+	case "skipped":
+		p.skipped++
+	}
+	p.render()
+}
+
+// begin 记录worker开始处理文档，同一worker处理下一个文档时覆盖
+func (p *progressLine) begin(worker, url string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active == nil {
+		p.active = make(map[string]activeWorker)
+	}
+	p.active[worker] = activeWorker{URL: url, StartedAt: time.Now()}
+}
+
+// idle 记录worker处理完当前文档
+func (p *progressLine) idle(worker string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.active, worker)
+}
+
+// printf 在进度上方输出一行告警，再重新绘制进度
+func (p *progressLine) printf(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.out, "\r%s\r", strings.Repeat(" ", p.width))
+	fmt.Fprintf(p.out, format, args...)
+	p.render()
+}
+
+// end 结束进度行，之后的输出从新的一行开始
+func (p *progressLine) end() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.out != nil && p.width > 0 {
+		fmt.Fprintln(p.out)
+		p.width = 0
+	}
+}
+
+func (p *progressLine) render() {
+	if p.out == nil {
+		return
+	}
+	line := fmt.Sprintf("%d/%d done, %d failed, %s elapsed",
+		p.done, p.submitted, p.failed, time.Since(p.start).Round(time.Second))
+	pad := ""
+	if n := p.width - len(line); n > 0 {
+		pad = strings.Repeat(" ", n)
+	}
+	fmt.Fprintf(p.out, "\r%s%s", line, pad)
+	p.width = len(line)
+}
+
+// logf 输出单个文档的下载信息，显示进度时省略
+func logf(format string, args ...interface{}) {
+	if runProgress.showing() {
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// warnf 输出下载过程中的告警，显示进度时在进度上方输出
+func warnf(format string, args ...interface{}) {
+	if runProgress.showing() {
+		runProgress.printf(format, args...)
+		return
+	}
+	fmt.Printf(format, args...)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfigFileName 输出目录（或当前目录）中的项目配置，与镜像一起纳入版本管理，
+// 作为全局配置与命令行选项之间的一层
+const projectConfigFileName = "feishu2md.yaml"
+
+// ProjectOptions 项目配置中的下载选项，命令行中指定的同名选项优先
+type ProjectOptions struct {
+	// --from-project 下载的链接，只有一个时按链接类型以 --batch 或 --wiki 下载，
+	// 多个时与 --from-file 的列表相同
+	Sources       []string `json:"sources"`
+	Format        string   `json:"format"`
+	Types         []string `json:"types"`
+	ExcludeDrafts string   `json:"exclude_drafts"`
+	IncludeHidden *bool    `json:"include_hidden"`
+	Sync          *bool    `json:"sync"`
+	Prune         *bool    `json:"prune"`
+	RewriteLinks  *bool    `json:"rewrite_links"`
+}
+
+// projectConfigSections 项目配置中与全局配置同名的部分，按全局配置的字段合并
+var projectConfigSections = map[string]bool{
+	"feishu": true, "output": true, "http": true, "cache": true,
+	"download": true, "sheet": true, "estimate": true,
+}
+
+// projectCredentialKeys 凭证只能来自全局配置，项目配置会被提交到共享的仓库
+var projectCredentialKeys = [][2]string{
+	{"feishu", "app_id"},
+	{"feishu", "app_secret"},
+	{"download", "status_token"},
+}
+
+// findProjectConfig 依次查找输出目录和当前目录中的项目配置，都没有时返回空
+func findProjectConfig(outputDir string) string {
+	candidates := []string{filepath.Join(outputDir, projectConfigFileName), projectConfigFileName}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// readProjectConfig 读取项目配置，将其中的配置合并到config，返回下载选项。
+// 只覆盖项目配置中出现的字段，列表整体替换
+func readProjectConfig(path string, config *core.Config) (*ProjectOptions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(utils.TrimBOM(data), &doc); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", path)
+	}
+	sections := make(map[string]interface{})
+	options := make(map[string]interface{})
+	for key, value := range doc {
+		if projectConfigSections[key] {
+			sections[key] = value
+		} else {
+			options[key] = value
+		}
+	}
+	for _, key := range projectCredentialKeys {
+		if section, ok := sections[key[0]].(map[string]interface{}); ok {
+			if _, ok := section[key[1]]; ok {
+				return nil, errors.Errorf("%s must not contain %s.%s, credentials are only read from the global config",
+					path, key[0], key[1])
+			}
+		}
+	}
+	if err := decodeProjectJSON(sections, config); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", path)
+	}
+	project := &ProjectOptions{}
+	if err := decodeProjectJSON(options, project); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", path)
+	}
+	return project, nil
+}
+
+// decodeProjectJSON 经由json按字段标签解码，未知的字段视为错误，避免拼写错误被静默忽略
+func decodeProjectJSON(value interface{}, v interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// apply 将命令行中未指定的选项设为项目配置中的值
+func (project *ProjectOptions) apply(opts *DownloadOpts) {
+	set := func(flag string) bool { return opts.setFlags[flag] }
+	if project.Format != "" && !set("format") {
+		opts.format = project.Format
+	}
+	if len(project.Types) > 0 && !set("types") {
+		opts.types = strings.Join(project.Types, ",")
+	}
+	if project.ExcludeDrafts != "" && !set("exclude-drafts") {
+		opts.excludeDrafts = project.ExcludeDrafts
+	}
+	if project.IncludeHidden != nil && !set("include-hidden") {
+		opts.includeHidden = *project.IncludeHidden
+	}
+	if project.Sync != nil && !set("sync") {
+		opts.sync = *project.Sync
+	}
+	if project.Prune != nil && !set("prune") {
+		opts.prune = *project.Prune
+	}
+	if project.RewriteLinks != nil && !set("rewrite-links") {
+		opts.rewriteLinks = *project.RewriteLinks
+	}
+}
+
+// applySources --from-project 时以项目配置中的链接代替参数，返回单个链接时的下载地址
+func (project *ProjectOptions) applySources(opts *DownloadOpts, path string) (string, error) {
+	switch len(project.Sources) {
+	case 0:
+		return "", errors.Errorf("--from-project needs the sources to download in %s", path)
+	case 1:
+		url := project.Sources[0]
+		if _, err := utils.ValidateFolderURL(url); err == nil {
+			opts.batch = true
+		} else if _, _, err := utils.ValidateWikiURL(url); err == nil {
+			opts.wiki = true
+		}
+		return url, nil
+	}
+	opts.sources = project.Sources
+	return "", nil
+}
+
+// validateFromProject 项目配置已经指定了全部链接，不能再指定链接或其他下载模式
+func validateFromProject(opts *DownloadOpts, url string) error {
+	if !opts.fromProject {
+		return nil
+	}
+	if opts.noProjectConfig {
+		return errors.New("--from-project can not be used with --no-project-config")
+	}
+	if opts.batch || opts.wiki || opts.spaceName != "" || opts.fromFile != "" || opts.retryReport != "" {
+		return errors.New("--from-project can not be used with --batch, --wiki, --space-name, --from-file or --retry")
+	}
+	if url != "" {
+		return errors.New("--from-project takes no url argument")
+	}
+	return nil
+}
+
+// loadProjectConfig 合并项目配置到本次运行的配置和选项，返回要下载的链接
+func loadProjectConfig(url string) (string, error) {
+	if err := validateFromProject(&dlOpts, url); err != nil {
+		return "", err
+	}
+	if dlOpts.noProjectConfig {
+		return url, nil
+	}
+	path := findProjectConfig(dlOpts.outputDir)
+	if path == "" {
+		if dlOpts.fromProject {
+			return "", errors.Errorf("--from-project found no %s in %s or the current directory",
+				projectConfigFileName, dlOpts.outputDir)
+		}
+		return url, nil
+	}
+	project, err := readProjectConfig(path, &dlConfig)
+	if err != nil {
+		return "", err
+	}
+	project.apply(&dlOpts)
+	if dlOpts.fromProject {
+		if url, err = project.applySources(&dlOpts, path); err != nil {
+			return "", err
+		}
+	}
+	fmt.Printf("Using the project config %s\n", path)
+	return url, nil
+}
+
+// projectFlagNames 命令行中指定的选项名，优先于项目配置
+func projectFlagNames(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
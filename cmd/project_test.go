@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeProjectConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, projectConfigFileName)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProjectConfigPrecedence(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlConfig = *core.NewConfig("id", "secret")
+	dlConfig.Output.Sinks = []string{"zip:global.zip"}
+	writeProjectConfig(t, outputDir, `
+output:
+  image_dir: assets
+  front_matter: true
+  sinks: ["report:project.json"]
+sheet:
+  formula_mode: both
+format: text
+types: [docx, sheet]
+exclude_drafts: "[草稿]"
+sync: true
+`)
+	// 命令行中指定的 --format 优先于项目配置
+	dlOpts.format = "md"
+	dlOpts.setFlags = projectFlagNames([]string{"format"})
+
+	url, err := loadProjectConfig("https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "https://domain.feishu.cn/wiki/settings/123", url)
+
+	// 项目配置覆盖全局配置中出现的字段，其余字段和凭证保持不变，列表整体替换
+	assert.Equal(t, "assets", dlConfig.Output.ImageDir)
+	assert.True(t, dlConfig.Output.FrontMatter)
+	assert.Equal(t, []string{"report:project.json"}, dlConfig.Output.Sinks)
+	assert.Equal(t, core.SheetFormulaBoth, dlConfig.Sheet.FormulaMode)
+	assert.Equal(t, "UTC", dlConfig.Output.Timezone)
+	assert.Equal(t, "id", dlConfig.Feishu.AppId)
+	assert.Equal(t, "secret", dlConfig.Feishu.AppSecret)
+
+	assert.Equal(t, "md", dlOpts.format)
+	assert.Equal(t, "docx,sheet", dlOpts.types)
+	assert.Equal(t, "[草稿]", dlOpts.excludeDrafts)
+	assert.True(t, dlOpts.sync)
+	assert.False(t, dlOpts.prune)
+}
+
+func TestProjectConfigSources(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	writeProjectConfig(t, outputDir, "sources:\n  - https://domain.feishu.cn/wiki/settings/123\n")
+
+	// 单个链接按类型决定下载模式
+	dlOpts.fromProject = true
+	url, err := loadProjectConfig("")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://domain.feishu.cn/wiki/settings/123", url)
+		assert.True(t, dlOpts.wiki)
+		assert.False(t, dlOpts.batch)
+	}
+
+	// 多个链接按链接列表下载
+	dlOpts = DownloadOpts{outputDir: outputDir, fromProject: true}
+	writeProjectConfig(t, outputDir, `
+sources:
+  - https://domain.feishu.cn/drive/folder/fldA
+  - https://domain.feishu.cn/docx/docB
+`)
+	url, err = loadProjectConfig("")
+	if assert.NoError(t, err) {
+		assert.Empty(t, url)
+		assert.Equal(t, []string{"https://domain.feishu.cn/drive/folder/fldA", "https://domain.feishu.cn/docx/docB"}, dlOpts.sources)
+		assert.True(t, dlOpts.hasURLList())
+		assert.False(t, dlOpts.batch)
+	}
+
+	dlOpts = DownloadOpts{outputDir: outputDir, fromProject: true}
+	_, err = loadProjectConfig("https://domain.feishu.cn/docx/docB")
+	assert.ErrorContains(t, err, "takes no url argument")
+
+	dlOpts = DownloadOpts{outputDir: outputDir, fromProject: true, noProjectConfig: true}
+	_, err = loadProjectConfig("")
+	assert.ErrorContains(t, err, "--no-project-config")
+
+	dlOpts = DownloadOpts{outputDir: t.TempDir(), fromProject: true}
+	_, err = loadProjectConfig("")
+	assert.ErrorContains(t, err, "found no feishu2md.yaml")
+
+	writeProjectConfig(t, outputDir, "format: text\n")
+	dlOpts = DownloadOpts{outputDir: outputDir, fromProject: true}
+	_, err = loadProjectConfig("")
+	assert.ErrorContains(t, err, "needs the sources")
+}
+
+func TestProjectConfigIgnoredOrRejected(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	writeProjectConfig(t, outputDir, "format: text\noutput:\n  image_dir: assets\n")
+
+	// --no-project-config 不读取项目配置
+	dlOpts.noProjectConfig = true
+	_, err := loadProjectConfig("https://domain.feishu.cn/docx/docB")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "static", dlConfig.Output.ImageDir)
+		assert.Empty(t, dlOpts.format)
+	}
+
+	// 凭证只能来自全局配置
+	for _, content := range []string{
+		"feishu:\n  app_id: id\n",
+		"feishu:\n  app_secret: secret\n",
+		"download:\n  status_token: token\n",
+	} {
+		path := writeProjectConfig(t, outputDir, content)
+		_, err := readProjectConfig(path, core.NewConfig("", ""))
+		assert.ErrorContains(t, err, "must not contain", content)
+	}
+
+	// 拼写错误的字段不会被静默忽略
+	for _, content := range []string{"formats: text\n", "output:\n  image_dirs: assets\n"} {
+		path := writeProjectConfig(t, outputDir, content)
+		_, err := readProjectConfig(path, core.NewConfig("", ""))
+		assert.ErrorContains(t, err, "unknown field", content)
+	}
+
+	// 允许设置请求频率等非凭证的字段
+	path := writeProjectConfig(t, outputDir, "feishu:\n  rate_limit: 2\n")
+	config := core.NewConfig("id", "secret")
+	if _, err := readProjectConfig(path, config); assert.NoError(t, err) {
+		assert.Equal(t, 2.0, config.Feishu.RateLimit)
+		assert.Equal(t, "id", config.Feishu.AppId)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// qualityReviewLimit 摘要中最多列出的低分文档数，完整结果见报告中的 quality
+const qualityReviewLimit = 10
+
+// lowQualityResults 转换得分低于 download.quality_threshold 的文档，得分最低的在前
+func lowQualityResults(report *BatchDownloadReport) []DownloadResult {
+	threshold := dlConfig.Download.ReviewThreshold()
+	var results []DownloadResult
+	for _, result := range report.Results {
+		if result.Quality != nil && result.Quality.Score < threshold {
+			results = append(results, result)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Quality.Score < results[j].Quality.Score
+	})
+	return results
+}
+
+// printQualityReview 列出需要人工检查的低分文档
+func printQualityReview(report *BatchDownloadReport) {
+	results := lowQualityResults(report)
+	if len(results) == 0 {
+		return
+	}
+	fmt.Printf("转换质量: %d 个文档低于 %v%%，建议人工检查，详见报告中的 quality\n",
+		len(results), dlConfig.Download.ReviewThreshold())
+	for i, result := range results {
+		if i == qualityReviewLimit {
+			fmt.Printf("  ... 以及另外 %d 个文档\n", len(results)-qualityReviewLimit)
+			break
+		}
+		q := result.Quality
+		fmt.Printf("  %5.1f%%  %s（降级 %d，丢弃 %d）\n", q.Score,
+			filepath.Join(result.OutputDir, result.Filename), q.Degraded, q.Dropped)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadResultQuality(t *testing.T) {
+	setupDownloadTest(t)
+	api := newFakeAPI()
+	api.docs["docA"] = "A"
+	report, err := downloadURLList(context.Background(), api, []string{"https://domain.feishu.cn/docx/docA"})
+	if !assert.NoError(t, err) || !assert.Len(t, report.Results, 1) {
+		return
+	}
+	assert.Equal(t, &core.ConversionQuality{Supported: 1, Score: 100}, report.Results[0].Quality)
+	assert.Empty(t, lowQualityResults(report))
+}
+
+func TestLowQualityResults(t *testing.T) {
+	setupDownloadTest(t)
+	report := &BatchDownloadReport{Results: []DownloadResult{
+		{Filename: "A.md", Quality: &core.ConversionQuality{Score: 95}},
+		{Filename: "B.md", Quality: &core.ConversionQuality{Score: 40}},
+		{Filename: "C.md", Quality: &core.ConversionQuality{Score: 80}},
+		{Filename: "D.txt"},
+	}}
+	var names []string
+	for _, result := range lowQualityResults(report) {
+		names = append(names, result.Filename)
+	}
+	// 默认低于90分的文档需要检查，得分最低的在前
+	assert.Equal(t, []string{"B.md", "C.md"}, names)
+
+	dlConfig.Download.QualityThreshold = 50
+	if results := lowQualityResults(report); assert.Len(t, results, 1) {
+		assert.Equal(t, "B.md", results[0].Filename)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/pkg/errors"
+)
+
+const (
+	resolutionWikiNode  = "wiki_node"  // 知识库节点token解析为文档类型和token
+	resolutionSpaceName = "space_name" // 知识空间名称解析为空间id
+	resolutionWikiObj   = "wiki_obj"   // 以文档链接访问的文档解析为所在的知识库节点
+)
+
+// Resolution 一次需要查询接口的链接解析，记录在清单中，--pin-resolutions 时直接复用
+type Resolution struct {
+	Kind       string    `json:"kind"`
+	Input      string    `json:"input"`
+	Type       string    `json:"type"`
+	Token      string    `json:"token"`
+	Title      string    `json:"title,omitempty"`
+	SpaceID    string    `json:"space_id,omitempty"` // 知识库节点所在的空间
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// sameTarget 两次解析是否指向同一个对象，标题的改动不算
+func (res *Resolution) sameTarget(other *Resolution) bool {
+	return res.Type == other.Type && res.Token == other.Token
+}
+
+func (res *Resolution) String() string {
+	return res.Type + "/" + res.Token
+}
+
+// ResolutionChange 重新解析的结果与清单中记录的不同，通常是文档被移动或替换
+type ResolutionChange struct {
+	Kind     string      `json:"kind"`
+	Input    string      `json:"input"`
+	Recorded *Resolution `json:"recorded"`
+	Resolved *Resolution `json:"resolved"`
+}
+
+// resolutionRecorder 记录本次运行的解析结果，为nil时每次都查询接口且不做记录
+type resolutionRecorder struct {
+	mu       sync.Mutex
+	previous map[string]*Resolution // 上一次清单中的记录
+	pin      bool                   // 复用上一次的记录，只查询新出现的输入
+	current  map[string]*Resolution
+	changes  []ResolutionChange
+	pinned   int
+}
+
+var runResolutions *resolutionRecorder
+
+func resolutionKey(kind, input string) string {
+	return kind + ":" + input
+}
+
+// newResolutionRecorder 读取rootDir中上一次清单的解析记录，清单的告警由清单记录负责
+func newResolutionRecorder(rootDir string, pin bool) *resolutionRecorder {
+	r := &resolutionRecorder{pin: pin, current: make(map[string]*Resolution)}
+	if previous, err := readManifest(filepath.Join(rootDir, manifestFileName)); err == nil {
+		r.previous = previous.Resolutions
+	} else if pin && os.IsNotExist(err) {
+		fmt.Printf("No manifest in %s yet, resolving every link and recording the results\n", rootDir)
+	}
+	return r
+}
+
+// lookup 固定解析结果时返回上一次的记录
+func (r *resolutionRecorder) lookup(key string) *Resolution {
+	if r == nil || !r.pin {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res, ok := r.previous[key]
+	if !ok {
+		return nil
+	}
+	if _, ok := r.current[key]; !ok {
+		r.pinned++
+	}
+	r.current[key] = res
+	return res
+}
+
+// record 记录新的解析结果，与上一次不同时告警并写入报告
+func (r *resolutionRecorder) record(key string, res *Resolution) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.current[key]; ok {
+		return
+	}
+	r.current[key] = res
+	if prev, ok := r.previous[key]; ok && !prev.sameTarget(res) {
+		r.changes = append(r.changes, ResolutionChange{Kind: res.Kind, Input: res.Input, Recorded: prev, Resolved: res})
+		warnf("Warning: %s %s now resolves to %s, the manifest recorded %s\n", res.Kind, res.Input, res, prev)
+	}
+}
+
+// wikiNode 将知识库节点解析为对应的文档
+func (r *resolutionRecorder) wikiNode(ctx context.Context, client core.API, nodeToken string) (*Resolution, error) {
+	key := resolutionKey(resolutionWikiNode, nodeToken)
+	if res := r.lookup(key); res != nil {
+		return res, nil
+	}
+	node, err := client.GetWikiNodeInfo(ctx, nodeToken)
+	if err != nil {
+		return nil, err
+	}
+	res := &Resolution{Kind: resolutionWikiNode, Input: nodeToken, Type: node.ObjType, Token: node.ObjToken,
+		Title: node.Title, SpaceID: node.SpaceID, ResolvedAt: dlConfig.Output.Now()}
+	r.record(key, res)
+	return res, nil
+}
+
+// wikiObj 查询以文档链接访问的文档所在的知识库节点，不在知识库中的文档返回错误且不做记录
+func (r *resolutionRecorder) wikiObj(ctx context.Context, client core.API, objType, objToken string) (*Resolution, error) {
+	key := resolutionKey(resolutionWikiObj, objToken)
+	if res := r.lookup(key); res != nil {
+		return res, nil
+	}
+	node, err := client.GetWikiNodeByObj(ctx, objToken, objType)
+	if err != nil {
+		return nil, err
+	}
+	res := &Resolution{Kind: resolutionWikiObj, Input: objToken, Type: "wiki", Token: node.NodeToken,
+		Title: node.Title, SpaceID: node.SpaceID, ResolvedAt: dlConfig.Output.Now()}
+	r.record(key, res)
+	return res, nil
+}
+
+// spaceName 将知识空间名称解析为空间id，名称不区分大小写
+func (r *resolutionRecorder) spaceName(ctx context.Context, client core.API, name string) (*Resolution, error) {
+	input := strings.ToLower(strings.TrimSpace(name))
+	key := resolutionKey(resolutionSpaceName, input)
+	if res := r.lookup(key); res != nil {
+		return res, nil
+	}
+	spaces, err := client.GetWikiSpaceList(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list wiki spaces")
+	}
+	space, err := findSpaceByName(spaces, name)
+	if err != nil {
+		return nil, err
+	}
+	res := &Resolution{Kind: resolutionSpaceName, Input: input, Type: "space", Token: space.SpaceID,
+		Title: space.Name, ResolvedAt: dlConfig.Output.Now()}
+	r.record(key, res)
+	return res, nil
+}
+
+// resolutions 本次运行用到的解析结果，写入清单
+func (r *resolutionRecorder) resolutions() map[string]*Resolution {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.current) == 0 {
+		return nil
+	}
+	resolutions := make(map[string]*Resolution, len(r.current))
+	for key, res := range r.current {
+		resolutions[key] = res
+	}
+	return resolutions
+}
+
+// fillReport 将复用的解析数和发生变化的解析写入下载报告
+func (r *resolutionRecorder) fillReport(report *BatchDownloadReport) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report.PinnedResolutions = r.pinned
+	changes := append([]ResolutionChange(nil), r.changes...)
+	sort.Slice(changes, func(i, j int) bool {
+		return resolutionKey(changes[i].Kind, changes[i].Input) < resolutionKey(changes[j].Kind, changes[j].Input)
+	})
+	report.ResolutionChanges = changes
+}
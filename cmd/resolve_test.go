@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinResolutions(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeAPI()
+	api.docs["docB"] = "B"
+	api.addDoc("", "A")
+	url := "https://domain.feishu.cn/wiki/wikA"
+	run := func(pin bool) *BatchDownloadReport {
+		t.Helper()
+		runResolutions = newResolutionRecorder(outputDir, pin)
+		runManifest = newManifestRecorder(outputDir)
+		report := newBatchDownloadReport()
+		assert.NoError(t, downloadDocument(context.Background(), api, url, &dlOpts))
+		runResolutions.fillReport(report)
+		assert.NoError(t, runManifest.write(report))
+		return report
+	}
+
+	run(false)
+	manifest, err := readManifest(filepath.Join(outputDir, manifestFileName))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if res := manifest.Resolutions["wiki_node:wikA"]; assert.NotNil(t, res) {
+		assert.Equal(t, "docx/docA", res.String())
+	}
+
+	// 节点移动后，固定的解析结果不再查询接口
+	api.wikiNodes[""][0].ObjToken = "docB"
+	calls := api.callCount("GetWikiNodeInfo")
+	report := run(true)
+	assert.Equal(t, calls, api.callCount("GetWikiNodeInfo"))
+	assert.Equal(t, 1, report.PinnedResolutions)
+	assert.Empty(t, report.ResolutionChanges)
+	assertFileExists(t, filepath.Join(outputDir, "A.md"))
+
+	// 重新解析时报告与记录不同的结果
+	report = run(false)
+	assert.Equal(t, 0, report.PinnedResolutions)
+	if assert.Len(t, report.ResolutionChanges, 1) {
+		change := report.ResolutionChanges[0]
+		assert.Equal(t, "wikA", change.Input)
+		assert.Equal(t, "docx/docA", change.Recorded.String())
+		assert.Equal(t, "docx/docB", change.Resolved.String())
+	}
+	assertFileExists(t, filepath.Join(outputDir, "B.md"))
+	manifest, err = readManifest(filepath.Join(outputDir, manifestFileName))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "docx/docB", manifest.Resolutions["wiki_node:wikA"].String())
+	}
+}
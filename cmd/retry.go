@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// readDownloadReport 读取之前生成的下载报告
+func readDownloadReport(path string) (*BatchDownloadReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &BatchDownloadReport{}
+	if err := json.Unmarshal(utils.TrimBOM(data), report); err != nil {
+		return nil, errors.Wrapf(err, "invalid download report %s", path)
+	}
+	return report, nil
+}
+
+// validateRetry 重试的文档都来自报告，不能再指定链接或其他下载模式
+func validateRetry(opts *DownloadOpts, url string) error {
+	if opts.retryReport == "" {
+		return nil
+	}
+	if opts.batch || opts.wiki || opts.spaceName != "" || opts.wikiOutline || opts.fromFile != "" {
+		return errors.New("--retry can not be used with --batch, --wiki, --space-name, --outline or --from-file")
+	}
+	if url != "" {
+		return errors.New("--retry takes no url argument")
+	}
+	return nil
+}
+
+// retryRootDir 报告写在输出目录的根目录下，未通过 -o 指定时输出到报告所在的目录
+func retryRootDir(opts *DownloadOpts) string {
+	if opts.outputDirSet {
+		return opts.outputDir
+	}
+	return filepath.Dir(opts.retryReport)
+}
+
+// retryDir 返回重试时文档的输出目录，保持其相对原输出目录的位置，
+// 旧版本的报告没有记录目录时输出到根目录
+func retryDir(previous *BatchDownloadReport, result DownloadResult, rootDir string) string {
+	if previous.OutputDir == "" || result.OutputDir == "" {
+		return rootDir
+	}
+	rel, err := filepath.Rel(previous.OutputDir, result.OutputDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rootDir
+	}
+	return filepath.Join(rootDir, rel)
+}
+
+// retryDownloads 重新下载报告中失败的文档，其余结果原样保留，生成合并后的报告
+func retryDownloads(ctx context.Context, client core.API, reportPath string) (*BatchDownloadReport, error) {
+	previous, err := readDownloadReport(reportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := newBatchDownloadReport()
+	report.TotalFiles = previous.TotalFiles
+	report.ExcludedDrafts = previous.ExcludedDrafts
+	report.ExcludedHidden = previous.ExcludedHidden
+	results := append([]DownloadResult(nil), previous.Results...)
+
+	if runManifest != nil {
+		runLinks.addManifest(runManifest.previous, runManifest.rootDir)
+	}
+	pipeline := newDownloadPipeline(ctx, client)
+	var retried []int
+	for i, result := range previous.Results {
+		if result.Status != "error" {
+			continue
+		}
+		opts := dlOpts.forDir(retryDir(previous, result, dlOpts.outputDir))
+		pipeline.submit(result.URL, opts)
+		retried = append(retried, i)
+	}
+	fmt.Printf("Retrying %d failed documents of %s\n", len(retried), reportPath)
+	for i, result := range pipeline.wait() {
+		results[retried[i]] = result
+	}
+
+	finishBatchReport(report, results)
+	return report, nil
+}
+
+// retryExitError 重试后仍有失败的文档时以非零状态退出，便于在脚本中判断
+func retryExitError(report *BatchDownloadReport) error {
+	if report.ErrorCount == 0 {
+		return nil
+	}
+	return cli.Exit(fmt.Sprintf("%d documents still failed, retry again with the new report", report.ErrorCount), 1)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// moveReport 将输出目录中唯一的下载报告移动到dir，避免与重试生成的报告同名
+func moveReport(t *testing.T, outputDir, dir string) string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(outputDir, "report_*.json"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected one report in %s, got %v: %v", outputDir, paths, err)
+	}
+	path := filepath.Join(dir, filepath.Base(paths[0]))
+	if err := os.Rename(paths[0], path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRetryDownloads(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	api.failDocs["docA1"] = true
+	api.failDocs["docC"] = true
+	api.addDoc("", "A")
+	api.addDoc("", "C")
+	api.addDoc("wikA", "A1")
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, report.ErrorCount)
+	// 子节点先于父节点提交
+	assert.Equal(t, "https://domain.feishu.cn/wiki/wikA1", report.Results[0].URL)
+	assert.Equal(t, filepath.Join(outputDir, "Space", "A"), report.Results[0].OutputDir)
+
+	// 报告移到别处后通过 -o 指定原输出目录，只重试失败的文档，嵌套目录保持不变
+	reportPath := moveReport(t, outputDir, t.TempDir())
+	delete(api.failDocs, "docA1")
+	dlOpts.retryReport = reportPath
+	dlOpts.outputDirSet = true
+	dlOpts.outputDir = retryRootDir(&dlOpts)
+	contentCalls := api.callCount("GetDocxContent")
+	merged, err := retryDownloads(context.Background(), api, reportPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, contentCalls+2, api.callCount("GetDocxContent"))
+	assert.Equal(t, 3, merged.TotalFiles)
+	assert.Equal(t, 2, merged.SuccessCount)
+	assert.Equal(t, 1, merged.ErrorCount)
+	if assert.Len(t, merged.Results, 3) {
+		assert.Equal(t, "success", merged.Results[0].Status)
+		assert.Equal(t, "A1.md", merged.Results[0].Filename)
+		assert.Equal(t, report.Results[1], merged.Results[1], "successful entries are carried over")
+		assert.Equal(t, "error", merged.Results[2].Status)
+	}
+	assertFileExists(t, filepath.Join(outputDir, "Space", "A", "A1.md"))
+	assert.Error(t, retryExitError(merged))
+
+	// 未指定 -o 时输出到报告所在的目录
+	retryDir := t.TempDir()
+	reportPath = moveReport(t, outputDir, retryDir)
+	delete(api.failDocs, "docC")
+	dlOpts.retryReport = reportPath
+	dlOpts.outputDirSet = false
+	dlOpts.outputDir = retryRootDir(&dlOpts)
+	merged, err = retryDownloads(context.Background(), api, reportPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, merged.SuccessCount)
+		assert.NoError(t, retryExitError(merged))
+	}
+	assertFileExists(t, filepath.Join(retryDir, "Space", "C.md"))
+}
+
+func TestRetryDir(t *testing.T) {
+	previous := &BatchDownloadReport{OutputDir: "out"}
+	assert.Equal(t, filepath.Join("new", "Space", "A"),
+		retryDir(previous, DownloadResult{OutputDir: filepath.Join("out", "Space", "A")}, "new"))
+	assert.Equal(t, "new", retryDir(previous, DownloadResult{}, "new"))
+	assert.Equal(t, "new", retryDir(previous, DownloadResult{OutputDir: "elsewhere"}, "new"))
+	assert.Equal(t, "new", retryDir(&BatchDownloadReport{}, DownloadResult{OutputDir: "out"}, "new"))
+}
+
+func TestValidateRetry(t *testing.T) {
+	assert.NoError(t, validateRetry(&DownloadOpts{retryReport: "report.json"}, ""))
+	assert.Error(t, validateRetry(&DownloadOpts{retryReport: "report.json"}, "https://domain.feishu.cn/docx/doc1"))
+	assert.Error(t, validateRetry(&DownloadOpts{retryReport: "report.json", wiki: true}, ""))
+}
+
+func TestRetryDownloadsManifestAndLinks(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	api.failDocs["docB"] = true
+	api.links["docB"] = []string{"https://domain.feishu.cn/wiki/wikA"}
+	api.addDoc("", "A")
+	api.addDoc("", "B")
+	runManifest = newManifestRecorder(outputDir)
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) || !assert.NoError(t, runManifest.write(report)) {
+		return
+	}
+	assert.NotContains(t, runManifest.manifest.Documents, "docB")
+
+	// 重试的文档写入清单，之前成功的文档沿用上一次的记录，也作为链接改写的目标
+	reportPath := moveReport(t, outputDir, t.TempDir())
+	delete(api.failDocs, "docB")
+	dlOpts.retryReport = reportPath
+	dlOpts.outputDirSet = true
+	runManifest = newManifestRecorder(outputDir)
+	runManifest.partial = true
+	runLinks = newLinkIndex()
+	merged, err := retryDownloads(context.Background(), api, reportPath)
+	if !assert.NoError(t, err) || !assert.NoError(t, runManifest.write(merged)) {
+		return
+	}
+	assert.Equal(t, 2, merged.SuccessCount)
+	assert.Empty(t, merged.Removed)
+	assert.Contains(t, runManifest.manifest.Documents, "docA")
+	assert.Equal(t, "Space/B.md", runManifest.manifest.Documents["docB"].Path)
+	if assert.Len(t, runManifest.diff.Added, 1) {
+		assert.Equal(t, "Space/B.md", runManifest.diff.Added[0].Path)
+	}
+	assert.Empty(t, runManifest.diff.Removed)
+	assert.Equal(t, map[string]int{"Space/B.md": 1}, merged.RewrittenLinks)
+	data, err := os.ReadFile(filepath.Join(outputDir, "Space", "B.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "(./A.md)")
+	}
+}
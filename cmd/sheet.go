@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+// isSheetType 是否为电子表格或多维表格，两者都按 output.sheet_format 导出为表格
+func isSheetType(objType string) bool {
+	return objType == sheetType || objType == bitableType
+}
+
+// sheetObjType 将链接中的路径（/sheets/、/base/）转换为对象类型
+func sheetObjType(urlType string) string {
+	switch urlType {
+	case "sheets":
+		return sheetType
+	case "base":
+		return bitableType
+	}
+	return urlType
+}
+
+// fetchSheet 读取电子表格或多维表格的全部工作表，合并单元格按显示的值导出，
+// 公式按 sheet.formula_mode 导出
+func fetchSheet(ctx context.Context, client core.API, url string, source DocumentSource, objType, token string) (*fetchedDocument, error) {
+	var sheet *core.Spreadsheet
+	var err error
+	if objType == bitableType {
+		sheet, err = client.GetBitableRecords(ctx, token)
+	} else {
+		sheet, err = client.GetSheetContent(ctx, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sheet = sheet.WithFormulaMode(dlConfig.Sheet.FormulaMode)
+	return &fetchedDocument{url: url, docToken: token, source: source,
+		objType: objType, title: sheet.Title, sheet: sheet}, nil
+}
+
+// sheetFileNames 表格导出的文件名：markdown 格式为一个文件，csv 格式每个工作表一个文件，
+// 只有一个工作表时不追加工作表名称
+func sheetFileNames(opts *DownloadOpts, doc *fetchedDocument) []string {
+	baseName := documentBaseName(opts, doc.title, doc.docToken)
+	if dlConfig.Output.SheetFormat != core.SheetFormatCSV {
+		return []string{baseName + ".md"}
+	}
+	if len(doc.sheet.Tabs) <= 1 {
+		return []string{baseName + ".csv"}
+	}
+	names := make([]string, len(doc.sheet.Tabs))
+	for i, tab := range doc.sheet.Tabs {
+		names[i] = baseName + "." + utils.SanitizeFileName(tab.Title) + ".csv"
+	}
+	return names
+}
+
+// writeSheet 按 output.sheet_format 将表格写入输出目录，不受 --format 影响
+func writeSheet(ctx context.Context, doc *fetchedDocument, opts *DownloadOpts) error {
+	if err := os.MkdirAll(opts.outputDir, 0o755); err != nil {
+		return err
+	}
+	names := sheetFileNames(opts, doc)
+	contents := make([][]byte, len(names))
+	var frontMatter string
+	if dlConfig.Output.SheetFormat == core.SheetFormatCSV {
+		for i, tab := range doc.sheet.Tabs {
+			data, err := tab.CSV()
+			if err != nil {
+				return errors.Wrapf(err, "failed to write the tab %s of %s", tab.Title, doc.title)
+			}
+			contents[i] = data
+		}
+	} else {
+		var body string
+		var err error
+		frontMatter, body, err = dlConfig.Output.FormatDocument(core.DocumentMeta{
+			Title:        doc.title,
+			URL:          doc.url,
+			Token:        doc.docToken,
+			Revision:     doc.sheet.Revision,
+			DownloadedAt: dlConfig.Output.Now(),
+		}, core.RenderSheetMarkdown(doc.sheet))
+		if err := formatFallback(doc, doc.title, err, opts); err != nil {
+			return err
+		}
+		contents[0] = []byte(frontMatter + body)
+	}
+
+	var all []byte
+	for i, name := range names {
+		outputPath := filepath.Join(opts.outputDir, name)
+		var err error
+		if dlConfig.Output.SheetFormat == core.SheetFormatCSV {
+			err = runDedup.writeFile(outputPath, dlConfig.Output.NormalizeText(contents[i]))
+		} else {
+			err = writeMarkdown(ctx, PostProcessDocument{
+				Path:     outputPath,
+				Title:    doc.title,
+				URL:      doc.url,
+				Token:    doc.docToken,
+				Revision: doc.sheet.Revision,
+				Type:     doc.objType,
+				Tags:     opts.tags,
+			}, contents[i])
+		}
+		if err != nil {
+			return err
+		}
+		runFiles.Add(outputPath)
+		all = append(all, contents[i]...)
+		logf("Downloaded %s to %s\n", doc.objType, outputPath)
+	}
+	// 清单和链接以第一个文件为准
+	outputPath := filepath.Join(opts.outputDir, names[0])
+	// 哈希不含 front matter，其中的下载时间每次都不同
+	runManifest.recordFile(doc.objType, doc.docToken, doc.title, doc.url, doc.source, outputPath, opts.tags, contentHash(all[len(frontMatter):]))
+	runLinks.add(outputPath, false, doc.source.tokens()...)
+	return nil
+}
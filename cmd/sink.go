@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+// sink 输出目录之外的附加输出目标，在目录、清单都写入完成后依次执行，
+// 复用本次导出的结果，不会重新下载
+type sink interface {
+	String() string
+	write(rootDir string, report *BatchDownloadReport) error
+}
+
+// parseSinks 解析 kind:target 形式的输出目标，在开始下载前发现配置错误
+func parseSinks(specs []string) ([]sink, error) {
+	sinks := make([]sink, 0, len(specs))
+	for _, spec := range specs {
+		kind, target, _ := strings.Cut(spec, ":")
+		switch kind {
+		case "zip":
+			if target == "" {
+				return nil, errors.Errorf("invalid sink %q, expect zip:<file>", spec)
+			}
+			sinks = append(sinks, zipSink{path: target})
+		case "report":
+			if target == "" {
+				return nil, errors.Errorf("invalid sink %q, expect report:<file>", spec)
+			}
+			sinks = append(sinks, reportSink{path: target})
+		case "summary":
+			if target == "" {
+				target = "-"
+			}
+			sinks = append(sinks, summarySink{path: target})
+		default:
+			return nil, errors.Errorf("invalid sink %q, expect zip:<file>, report:<file> or summary[:<file>|-]", spec)
+		}
+	}
+	return sinks, nil
+}
+
+// runSinks 执行全部输出目标，某个目标失败只告警并继续，输出目录不受影响
+func runSinks(sinks []sink, rootDir string, report *BatchDownloadReport) error {
+	var failed []string
+	for _, s := range sinks {
+		if err := s.write(rootDir, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: output sink %s failed: %v\n", s, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", s, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("%d of %d output sinks failed, the output directory %s is complete:\n  %s",
+			len(failed), len(sinks), rootDir, strings.Join(failed, "\n  "))
+	}
+	return nil
+}
+
+// zipSink 将输出目录打包为zip，边遍历边写入临时文件，完成后再替换目标文件
+type zipSink struct {
+	path string
+}
+
+func (s zipSink) String() string { return "zip:" + s.path }
+
+func (s zipSink) write(rootDir string, report *BatchDownloadReport) error {
+	archivePath, err := filepath.Abs(s.path)
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeZip(pw, rootDir, archivePath))
+	}()
+	err = utils.WriteReaderAtomic(s.path, pr, 0o644)
+	pr.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Archived %s to %s\n", rootDir, s.path)
+	return nil
+}
+
+// writeZip 打包rootDir下的文件，跳过git目录、写入中的临时文件和归档文件自身
+func writeZip(w io.Writer, rootDir, archivePath string) error {
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(rootDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".feishu2md-") {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && abs == archivePath {
+			return nil
+		}
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// reportSink 将下载报告另存一份，例如上传到制品库的路径
+type reportSink struct {
+	path string
+}
+
+func (s reportSink) String() string { return "report:" + s.path }
+
+func (s reportSink) write(rootDir string, report *BatchDownloadReport) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	return utils.WriteFileDurable(s.path, dlConfig.Output.NormalizeText([]byte(utils.PrettyPrint(report))), 0o644)
+}
+
+// SinkSummary 下载结果的简要统计，"-" 表示输出到标准输出
+type SinkSummary struct {
+	OutputDir    string `json:"output_dir"`
+	TotalFiles   int    `json:"total_files"`
+	SuccessCount int    `json:"success_count"`
+	SkippedCount int    `json:"skipped_count"`
+	ErrorCount   int    `json:"error_count"`
+	Duration     string `json:"duration"`
+}
+
+type summarySink struct {
+	path string
+}
+
+func (s summarySink) String() string { return "summary:" + s.path }
+
+func (s summarySink) write(rootDir string, report *BatchDownloadReport) error {
+	data, err := json.Marshal(SinkSummary{
+		OutputDir:    rootDir,
+		TotalFiles:   report.TotalFiles,
+		SuccessCount: report.SuccessCount,
+		SkippedCount: report.SkippedCount,
+		ErrorCount:   report.ErrorCount,
+		Duration:     report.Duration,
+	})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if s.path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path, dlConfig.Output.NormalizeText(data), 0o644)
+}
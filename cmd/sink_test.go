@@ -0,0 +1,82 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSinks(t *testing.T) {
+	sinks, err := parseSinks([]string{"zip:out.zip", "report:dist/report.json", "summary", "summary:s.json"})
+	if assert.NoError(t, err) {
+		var names []string
+		for _, s := range sinks {
+			names = append(names, s.String())
+		}
+		assert.Equal(t, []string{"zip:out.zip", "report:dist/report.json", "summary:-", "summary:s.json"}, names)
+	}
+	for _, spec := range []string{"zip", "report:", "dir:out", ""} {
+		_, err := parseSinks([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestRunSinks(t *testing.T) {
+	rootDir := filepath.Join(t.TempDir(), "out")
+	artifacts := t.TempDir()
+	for path, content := range map[string]string{
+		"Space/A.md":         "a",
+		"Space/img/x.png":    "x",
+		".git/HEAD":          "ref",
+		"Space/.feishu2md-1": "partial",
+	} {
+		path = filepath.Join(rootDir, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	report := &BatchDownloadReport{TotalFiles: 2, SuccessCount: 1, ErrorCount: 1, Duration: "1s"}
+
+	sinks, err := parseSinks([]string{
+		// 目标目录不存在，失败后其余输出目标照常执行
+		"zip:" + filepath.Join(artifacts, "missing", "broken.zip"),
+		"zip:" + filepath.Join(rootDir, "export.zip"),
+		"report:" + filepath.Join(artifacts, "dist", "report.json"),
+		"summary:" + filepath.Join(artifacts, "summary.json"),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = runSinks(sinks, rootDir, report)
+	assert.ErrorContains(t, err, "1 of 4 output sinks failed")
+
+	// 归档不包含git目录、临时文件和归档自身
+	zr, err := zip.OpenReader(filepath.Join(rootDir, "export.zip"))
+	if assert.NoError(t, err) {
+		defer zr.Close()
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		sort.Strings(names)
+		assert.Equal(t, []string{"Space/A.md", "Space/img/x.png"}, names)
+	}
+
+	data, err := os.ReadFile(filepath.Join(artifacts, "dist", "report.json"))
+	if assert.NoError(t, err) {
+		saved := &BatchDownloadReport{}
+		assert.NoError(t, json.Unmarshal(data, saved))
+		assert.Equal(t, 1, saved.ErrorCount)
+	}
+	data, err = os.ReadFile(filepath.Join(artifacts, "summary.json"))
+	if assert.NoError(t, err) {
+		summary := &SinkSummary{}
+		assert.NoError(t, json.Unmarshal(data, summary))
+		assert.Equal(t, SinkSummary{OutputDir: rootDir, TotalFiles: 2, SuccessCount: 1, ErrorCount: 1, Duration: "1s"}, *summary)
+	}
+	assertFileExists(t, filepath.Join(rootDir, "Space", "A.md"))
+}
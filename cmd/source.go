@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/Wsine/feishu2md/core"
+)
+
+// DocumentSource 文档的两种链接：知识库中的文档既能以节点链接打开，也能以文档链接调用接口，
+// 无论从哪一种链接下载，下载结果和侧车元数据中都同时记录两者
+type DocumentSource struct {
+	NodeToken string `json:"node_token,omitempty"` // 知识库节点token，不在知识库中的文档为空
+	NodeURL   string `json:"node_url,omitempty"`
+	ObjToken  string `json:"obj_token,omitempty"` // 文档、表格或上传文件本身的token
+	ObjURL    string `json:"obj_url,omitempty"`
+	SpaceID   string `json:"space_id,omitempty"`
+}
+
+var siteURLRegexp = regexp.MustCompile(`^https://[\w-.]+`)
+
+// objURLPaths 对象类型在链接中的路径
+var objURLPaths = map[string]string{
+	docxType:     "docx",
+	sheetType:    "sheets",
+	bitableType:  "base",
+	fileNodeType: "file",
+}
+
+// newDocumentSource 按下载链接所在的站点拼出节点和文档的链接
+func newDocumentSource(url, objType, objToken string, node *Resolution) DocumentSource {
+	site := siteURLRegexp.FindString(url)
+	source := DocumentSource{ObjToken: objToken}
+	if path, ok := objURLPaths[objType]; ok && site != "" {
+		source.ObjURL = site + "/" + path + "/" + objToken
+	}
+	if node != nil {
+		source.NodeToken = node.Input
+		if node.Kind == resolutionWikiObj {
+			source.NodeToken = node.Token
+		}
+		source.SpaceID = node.SpaceID
+		if site != "" {
+			source.NodeURL = site + "/wiki/" + source.NodeToken
+		}
+	}
+	return source
+}
+
+// lookupWikiNode 以文档链接直接下载时查询文档所在的知识库节点，不在知识库中时返回nil。
+// 遍历文件夹和知识库时已知对象类型，文件夹中的文档不在知识库中，无需查询
+func lookupWikiNode(ctx context.Context, client core.API, objType, objToken string, opts *DownloadOpts) *Resolution {
+	if opts.objType != "" {
+		return nil
+	}
+	node, err := runResolutions.wikiObj(ctx, client, objType, objToken)
+	if err != nil {
+		logf("No wiki node hosts %s %s: %v\n", objType, objToken, err)
+		return nil
+	}
+	return node
+}
+
+// tokens 指向该文档的全部token，改写链接时都指向同一个本地文件
+func (s *DocumentSource) tokens() []string {
+	tokens := []string{s.ObjToken}
+	if s.NodeToken != "" {
+		tokens = append(tokens, s.NodeToken)
+	}
+	return tokens
+}
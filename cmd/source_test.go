@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSourceFakeAPI() *fakeAPI {
+	api := newFakeWiki()
+	api.docs["docB"] = "B"
+	api.addDoc("", "A").SpaceID = "123"
+	return api
+}
+
+func TestDocumentSourceViaNodeURL(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	runManifest = newManifestRecorder(outputDir)
+	api := newSourceFakeAPI()
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) || !assert.Len(t, report.Results, 1) {
+		return
+	}
+	expected := DocumentSource{
+		NodeToken: "wikA",
+		NodeURL:   "https://domain.feishu.cn/wiki/wikA",
+		ObjToken:  "docA",
+		ObjURL:    "https://domain.feishu.cn/docx/docA",
+		SpaceID:   "123",
+	}
+	assert.Equal(t, expected, report.Results[0].DocumentSource)
+	assert.Equal(t, expected, runManifest.manifest.Documents["docA"].DocumentSource)
+	// 遍历知识库时已知节点，无需反查
+	assert.Equal(t, 0, api.callCount("GetWikiNodeByObj"))
+}
+
+func TestDocumentSourceViaObjURL(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	runLinks = newLinkIndex()
+	api := newSourceFakeAPI()
+
+	// 以文档链接下载知识库中的文档时反查所在的节点，两种链接都指向同一个本地文件
+	err := downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/docA", &dlOpts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, filepath.Join(outputDir, "A.md"), runLinks.paths["wikA"])
+	assert.Equal(t, filepath.Join(outputDir, "A.md"), runLinks.paths["docA"])
+
+	dlOpts.format = formatText
+	err = downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/docA", &dlOpts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	meta, err := os.ReadFile(filepath.Join(outputDir, "A.meta.json"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(meta), `"node_token": "wikA"`)
+		assert.Contains(t, string(meta), `"node_url": "https://domain.feishu.cn/wiki/wikA"`)
+		assert.Contains(t, string(meta), `"obj_url": "https://domain.feishu.cn/docx/docA"`)
+		assert.Contains(t, string(meta), `"space_id": "123"`)
+	}
+
+	// 不在知识库中的文档只记录文档链接
+	err = downloadDocument(context.Background(), api, "https://domain.feishu.cn/docx/docB", &dlOpts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	meta, err = os.ReadFile(filepath.Join(outputDir, "B.meta.json"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(meta), `"obj_token": "docB"`)
+		assert.NotContains(t, string(meta), `"node_token"`)
+	}
+}
+
+func TestDocumentSourceViaFolder(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	runLinks = newLinkIndex()
+	api := newSourceFakeAPI()
+	api.folders["fld"] = []*lark.GetDriveFileListRespFile{
+		{Token: "docB", Name: "B", Type: "docx", URL: "https://domain.feishu.cn/docx/docB"},
+	}
+
+	report, err := downloadDocuments(context.Background(), api, "https://domain.feishu.cn/drive/folder/fld")
+	if !assert.NoError(t, err) || !assert.Len(t, report.Results, 1) {
+		return
+	}
+	assert.Equal(t, DocumentSource{ObjToken: "docB", ObjURL: "https://domain.feishu.cn/docx/docB"},
+		report.Results[0].DocumentSource)
+	assert.Equal(t, filepath.Join(outputDir, "B.md"), runLinks.paths["docB"])
+	// 文件夹中的文档不在知识库中，不逐个反查
+	assert.Equal(t, 0, api.callCount("GetWikiNodeByObj"))
+}
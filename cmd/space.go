@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// defaultSiteURL 按名称指定知识空间且没有给出站点地址时，用于拼接文档链接
+const defaultSiteURL = "https://www.feishu.cn"
+
+// findSpaceByName 按名称查找知识空间，忽略大小写和首尾空白，重名时列出所有候选
+func findSpaceByName(spaces []*lark.GetWikiSpaceListRespItem, name string) (*lark.GetWikiSpaceListRespItem, error) {
+	want := strings.TrimSpace(name)
+	var matches []*lark.GetWikiSpaceListRespItem
+	for _, space := range spaces {
+		if strings.EqualFold(strings.TrimSpace(space.Name), want) {
+			matches = append(matches, space)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return nil, errors.Errorf("no wiki space named %q among the %d spaces accessible to the app, "+
+			"make sure the app is added as a member of the space", want, len(spaces))
+	}
+	candidates := make([]string, 0, len(matches))
+	for _, space := range matches {
+		candidates = append(candidates, fmt.Sprintf("%s (space_id %s)", space.Name, space.SpaceID))
+	}
+	return nil, errors.Errorf("wiki space name %q is ambiguous, use the space url instead of one of:\n  %s",
+		want, strings.Join(candidates, "\n  "))
+}
+
+// resolveSpaceURL 将知识空间名称解析为空间设置页的链接，之后按给出链接的方式下载
+func resolveSpaceURL(ctx context.Context, client core.API, name, siteURL string) (string, error) {
+	space, err := runResolutions.spaceName(ctx, client, name)
+	if err != nil {
+		return "", err
+	}
+	if siteURL == "" {
+		siteURL = defaultSiteURL
+	}
+	url := strings.TrimSuffix(siteURL, "/") + "/wiki/settings/" + space.Token
+	fmt.Printf("Resolved wiki space %q to %s\n", space.Title, url)
+	return url, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSpaces() []*lark.GetWikiSpaceListRespItem {
+	return []*lark.GetWikiSpaceListRespItem{
+		{Name: "工程知识库", SpaceID: "101"},
+		{Name: "Design Docs", SpaceID: "102"},
+		{Name: "Team", SpaceID: "103"},
+		{Name: " team ", SpaceID: "104"},
+	}
+}
+
+func TestFindSpaceByName(t *testing.T) {
+	space, err := findSpaceByName(testSpaces(), " 工程知识库 ")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "101", space.SpaceID)
+	}
+	space, err = findSpaceByName(testSpaces(), "design docs")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "102", space.SpaceID)
+	}
+
+	// 重名的空间报错并列出候选
+	_, err = findSpaceByName(testSpaces(), "TEAM")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "ambiguous")
+		assert.Contains(t, err.Error(), "space_id 103")
+		assert.Contains(t, err.Error(), "space_id 104")
+	}
+
+	_, err = findSpaceByName(testSpaces(), "Design")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no wiki space named \"Design\"")
+	}
+}
+
+func TestResolveSpaceURL(t *testing.T) {
+	api := newFakeAPI()
+	api.spaces = testSpaces()
+
+	url, err := resolveSpaceURL(context.Background(), api, "工程知识库", "https://domain.feishu.cn/")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://domain.feishu.cn/wiki/settings/101", url)
+	}
+	url, err = resolveSpaceURL(context.Background(), api, "Design Docs", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, defaultSiteURL+"/wiki/settings/102", url)
+	}
+	_, err = resolveSpaceURL(context.Background(), api, "missing", "")
+	assert.Error(t, err)
+}
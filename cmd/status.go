@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// runStatus /status 返回的运行状态，与终端进度读取同一份汇总数据
+type runStatus struct {
+	Submitted      int            `json:"submitted"`
+	Done           int            `json:"done"`
+	Success        int            `json:"success"`
+	Skipped        int            `json:"skipped"`
+	Failed         int            `json:"failed"`
+	StartTime      time.Time      `json:"start_time"`
+	ElapsedSeconds float64        `json:"elapsed_seconds"`
+	DocsPerMinute  float64        `json:"docs_per_minute"`
+	Workers        []workerStatus `json:"workers"`
+	Cancelled      bool           `json:"cancelled"`
+}
+
+// workerStatus 一个worker正在处理的文档
+type workerStatus struct {
+	Worker string `json:"worker"`
+	activeWorker
+}
+
+// status 复制当前的汇总数据，只在锁内拷贝计数，频繁请求也不会阻塞下载
+func (p *progressLine) status() runStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elapsed := time.Since(p.start)
+	s := runStatus{
+		Submitted:      p.submitted,
+		Done:           p.done,
+		Skipped:        p.skipped,
+		Failed:         p.failed,
+		Success:        p.done - p.skipped - p.failed,
+		StartTime:      p.start,
+		ElapsedSeconds: elapsed.Seconds(),
+		Workers:        make([]workerStatus, 0, len(p.active)),
+	}
+	if minutes := elapsed.Minutes(); minutes > 0 {
+		s.DocsPerMinute = float64(p.done) / minutes
+	}
+	for name, w := range p.active {
+		s.Workers = append(s.Workers, workerStatus{Worker: name, activeWorker: w})
+	}
+	sort.Slice(s.Workers, func(i, j int) bool { return s.Workers[i].Worker < s.Workers[j].Worker })
+	return s
+}
+
+// validateStatusAddr 检查 --status-addr 为 host:port 形式
+func validateStatusAddr(opts *DownloadOpts) error {
+	if opts.statusAddr == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(opts.statusAddr); err != nil {
+		return errors.Errorf("invalid --status-addr %q, expect host:port such as 127.0.0.1:8090", opts.statusAddr)
+	}
+	return nil
+}
+
+// statusHandler 提供 GET /status 和 POST /cancel，配置了 download.status_token 时
+// 需要在查询参数 token 中携带
+func statusHandler(ctx context.Context, cancel context.CancelFunc, progress *progressLine, token string) http.Handler {
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(w, r) {
+			return
+		}
+		s := progress.status()
+		s.Cancelled = ctx.Err() != nil
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(s)
+	})
+	// 取消与 Ctrl-C 相同：不再开始新的请求，已提交的文档记为失败后照常生成报告
+	mux.HandleFunc("/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(w, r) {
+			return
+		}
+		cancel()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return mux
+}
+
+// startStatusServer 在addr上提供状态接口直到返回的函数被调用，监听失败时直接返回错误
+func startStatusServer(addr string, handler http.Handler) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen on --status-addr")
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go server.Serve(ln)
+	fmt.Printf("Serving the download status on http://%s/status\n", ln.Addr())
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
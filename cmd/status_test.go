@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusHandler(t *testing.T) {
+	progress := &progressLine{start: time.Now()}
+	progress.add()
+	progress.add()
+	progress.add()
+	progress.finish("success")
+	progress.finish("skipped")
+	progress.begin("image-1", "https://domain.feishu.cn/docx/doc3")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(statusHandler(ctx, cancel, progress, "secret"))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/status")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/status?token=secret")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var status runStatus
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	resp.Body.Close()
+	assert.Equal(t, 3, status.Submitted)
+	assert.Equal(t, 2, status.Done)
+	assert.Equal(t, 1, status.Success)
+	assert.Equal(t, 1, status.Skipped)
+	assert.False(t, status.Cancelled)
+	if assert.Len(t, status.Workers, 1) {
+		assert.Equal(t, "image-1", status.Workers[0].Worker)
+		assert.Equal(t, "https://domain.feishu.cn/docx/doc3", status.Workers[0].URL)
+	}
+
+	// 取消只接受POST
+	resp, err = http.Get(server.URL + "/cancel?token=secret")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+	resp, err = http.Post(server.URL+"/cancel?token=secret", "", nil)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+	assert.Error(t, ctx.Err())
+
+	progress.idle("image-1")
+	assert.Empty(t, progress.status().Workers)
+}
+
+func TestValidateStatusAddr(t *testing.T) {
+	assert.NoError(t, validateStatusAddr(&DownloadOpts{}))
+	assert.NoError(t, validateStatusAddr(&DownloadOpts{statusAddr: "127.0.0.1:8090"}))
+	assert.Error(t, validateStatusAddr(&DownloadOpts{statusAddr: "8090"}))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// errSkipped 同步模式下文档与上一次清单相同，不重新下载
+var errSkipped = errors.New("document is unchanged since the last sync")
+
+// RemovedDocument 上一次清单中有、本次远端已不存在的文档
+type RemovedDocument struct {
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	Path   string `json:"path"`
+	Pruned bool   `json:"pruned,omitempty"` // 本地文件已通过 --prune 删除
+}
+
+// validateSyncOpts 同步依赖批量和wiki下载生成的清单
+func validateSyncOpts(opts *DownloadOpts) error {
+	if !opts.sync {
+		if opts.prune {
+			return errors.New("--prune only works with --sync")
+		}
+		return nil
+	}
+	if !opts.batch && !opts.wiki && opts.spaceName == "" {
+		return errors.New("--sync only works with --batch or --wiki")
+	}
+	if opts.format == formatChunks && opts.chunksCombined {
+		return errors.New("--sync can not be used with --chunks-combined, which rewrites every chunk")
+	}
+	return nil
+}
+
+// syncing 是否启用同步且有可比较的上一次清单，清单缺失或损坏时全量下载
+func (r *manifestRecorder) syncing() bool {
+	return r != nil && r.sync && r.previous != nil
+}
+
+// keptURLs 返回本次下载失败或按 overrides.yaml 跳过的文档链接，这些文档沿用上一次的记录
+func keptURLs(report *BatchDownloadReport) map[string]bool {
+	kept := make(map[string]bool)
+	for _, result := range report.Results {
+		if result.Status == "error" || overrideSkippedResult(result) {
+			kept[result.URL] = true
+		}
+	}
+	return kept
+}
+
+func overrideSkippedResult(result DownloadResult) bool {
+	for _, override := range result.Overrides {
+		if override.Directive == overrideSkip {
+			return true
+		}
+	}
+	return false
+}
+
+// fillReport 将远端已删除的文档写入下载报告，启用 --prune 时删除对应的本地文件。
+// 下载失败和按 overrides.yaml 跳过的文档不视为删除，重试只下载部分文档，不判断删除
+func (r *manifestRecorder) fillReport(report *BatchDownloadReport) {
+	if r == nil || r.previous == nil || r.partial {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := keptURLs(report)
+	// 多个文档共用的文件（如合并的分块文件）仍被引用时不删除
+	inUse := make(map[string]bool)
+	for _, entry := range r.manifest.Documents {
+		inUse[entry.Path] = true
+	}
+	var removed []*ManifestEntry
+	for token, entry := range r.previous.Documents {
+		if _, ok := r.manifest.Documents[token]; !ok && !kept[entry.URL] {
+			removed = append(removed, entry)
+		}
+	}
+	for _, entry := range sortedEntries(removed) {
+		doc := RemovedDocument{Title: entry.Title, URL: entry.URL, Path: entry.Path}
+		if r.prune && !inUse[entry.Path] {
+			if err := r.pruneFile(entry.Path); err != nil {
+				fmt.Printf("Warning: failed to prune %s: %v\n", entry.Path, err)
+			} else {
+				doc.Pruned = true
+			}
+		}
+		report.Removed = append(report.Removed, doc)
+	}
+}
+
+// pruneFile 删除文档文件及其附属文件，并清理因此变空的目录，图片可能被共用因此保留
+func (r *manifestRecorder) pruneFile(path string) error {
+	fullPath := filepath.Join(r.rootDir, filepath.FromSlash(path))
+	paths := []string{fullPath}
+	if strings.HasSuffix(fullPath, ".txt") {
+		paths = append(paths, strings.TrimSuffix(fullPath, ".txt")+sidecarSuffix)
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		runFiles.Add(p)
+	}
+	root := filepath.Clean(r.rootDir)
+	for dir := filepath.Dir(fullPath); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
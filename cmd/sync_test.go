@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSyncOpts(t *testing.T) {
+	assert.NoError(t, validateSyncOpts(&DownloadOpts{}))
+	assert.NoError(t, validateSyncOpts(&DownloadOpts{sync: true, prune: true, wiki: true}))
+	assert.NoError(t, validateSyncOpts(&DownloadOpts{sync: true, spaceName: "Space"}))
+	assert.Error(t, validateSyncOpts(&DownloadOpts{prune: true, wiki: true}))
+	assert.Error(t, validateSyncOpts(&DownloadOpts{sync: true}))
+	assert.Error(t, validateSyncOpts(&DownloadOpts{sync: true, batch: true, format: formatChunks, chunksCombined: true}))
+}
+
+func TestDownloadWikiSync(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.sync = true
+	api := newFakeWiki()
+	api.revisions = map[string]int64{"docA": 1, "docB": 1, "docC": 1}
+	api.addDoc("", "A")
+	api.addDoc("", "B")
+	api.addDoc("", "C")
+	api.addDoc("wikC", "C1")
+	run := func() *BatchDownloadReport {
+		runManifest = newManifestRecorder(outputDir)
+		runManifest.sync = dlOpts.sync
+		runManifest.prune = dlOpts.prune
+		report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+		if assert.NoError(t, err) {
+			assert.NoError(t, runManifest.write(report))
+		}
+		return report
+	}
+
+	// 没有清单时全量下载
+	report := run()
+	assert.Equal(t, 4, report.SuccessCount)
+
+	// 版本号未变化的文档全部跳过，不再读取内容
+	contentCalls := api.calls["GetDocxContent"]
+	report = run()
+	assert.Equal(t, 0, report.SuccessCount)
+	assert.Equal(t, 4, report.SkippedCount)
+	assert.Equal(t, contentCalls, api.calls["GetDocxContent"])
+	manifest, err := readManifest(filepath.Join(outputDir, manifestFileName))
+	if assert.NoError(t, err) {
+		assert.Len(t, manifest.Documents, 4)
+	}
+
+	// 版本号变化的文档重新下载，远端删除的文档报告并清理
+	api.revisions["docA"] = 2
+	api.wikiNodes[""] = api.wikiNodes[""][:2]
+	dlOpts.prune = true
+	report = run()
+	assert.Equal(t, 1, report.SuccessCount)
+	assert.Equal(t, 1, report.SkippedCount)
+	if assert.Len(t, report.Removed, 2) {
+		assert.Equal(t, RemovedDocument{Title: "C", URL: "https://domain.feishu.cn/wiki/wikC", Path: "Space/C.md", Pruned: true}, report.Removed[0])
+		assert.Equal(t, "Space/C/C1.md", report.Removed[1].Path)
+	}
+	_, err = os.Stat(filepath.Join(outputDir, "Space", "C.md"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(outputDir, "Space", "C"))
+	assert.True(t, os.IsNotExist(err), "empty folders are removed")
+	assertFileExists(t, filepath.Join(outputDir, "Space", "B.md"))
+
+	// 本地文件被删除时重新下载
+	assert.NoError(t, os.Remove(filepath.Join(outputDir, "Space", "B.md")))
+	report = run()
+	assert.Equal(t, 1, report.SuccessCount)
+	assert.Equal(t, 1, report.SkippedCount)
+
+	// 清单损坏时按全量下载处理
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, manifestFileName), []byte("{"), 0o644))
+	report = run()
+	assert.Equal(t, 2, report.SuccessCount)
+	assert.Equal(t, 0, report.SkippedCount)
+}
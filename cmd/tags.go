@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Wsine/feishu2md/core"
+)
+
+const (
+	// tagsFileName 批量和wiki下载时在输出目录生成的标签索引
+	tagsFileName = "TAGS.md"
+	// miscTag 文档数少于 output.tags_min_documents 的标签归入该分组
+	miscTag = "misc"
+)
+
+// appendTag 返回追加了子目录标题的新标签列表，不修改上级共用的切片
+func appendTag(tags []string, title string) []string {
+	next := make([]string, 0, len(tags)+1)
+	next = append(next, tags...)
+	return append(next, title)
+}
+
+// tagGroup 一个标签及其下的文档
+type tagGroup struct {
+	Tag     string
+	Entries []*ManifestEntry
+}
+
+// groupTags 按标签分组清单中的文档，标签按文档数降序、文档按标题排列，
+// 文档数少于minDocs的标签合并到 misc 并放在最后
+func groupTags(manifest *Manifest, minDocs int) []tagGroup {
+	byTag := make(map[string][]*ManifestEntry)
+	for _, entry := range manifest.Documents {
+		for _, tag := range entry.Tags {
+			byTag[tag] = append(byTag[tag], entry)
+		}
+	}
+
+	var groups []tagGroup
+	var misc []*ManifestEntry
+	inMisc := make(map[string]bool)
+	for tag, entries := range byTag {
+		if len(entries) < minDocs {
+			for _, entry := range entries {
+				if !inMisc[entry.Token] {
+					inMisc[entry.Token] = true
+					misc = append(misc, entry)
+				}
+			}
+			continue
+		}
+		groups = append(groups, tagGroup{Tag: tag, Entries: entries})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Entries) != len(groups[j].Entries) {
+			return len(groups[i].Entries) > len(groups[j].Entries)
+		}
+		return groups[i].Tag < groups[j].Tag
+	})
+	if len(misc) > 0 {
+		groups = append(groups, tagGroup{Tag: miscTag, Entries: misc})
+	}
+	for _, group := range groups {
+		sortEntriesByTitle(group.Entries)
+	}
+	return groups
+}
+
+func sortEntriesByTitle(entries []*ManifestEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Title != entries[j].Title {
+			return entries[i].Title < entries[j].Title
+		}
+		return entries[i].Path < entries[j].Path
+	})
+}
+
+// renderTags 渲染标签索引，本地文件链接相对于清单所在目录
+func renderTags(manifest *Manifest, minDocs int) string {
+	sb := new(strings.Builder)
+	sb.WriteString("# 标签索引\n\n")
+	sb.WriteString(fmt.Sprintf("> 生成时间: %s\n\n", dlConfig.Output.FormatTime(manifest.GeneratedAt)))
+	groups := groupTags(manifest, minDocs)
+	if len(groups) == 0 {
+		sb.WriteString("没有带标签的文档。\n")
+		return sb.String()
+	}
+	for _, group := range groups {
+		sb.WriteString(fmt.Sprintf("## %s (%d)\n\n", group.Tag, len(group.Entries)))
+		for _, entry := range group.Entries {
+			line := localLink(entry.Title, entry.Path)
+			if entry.Type != "" {
+				line = outlineTypeIcons[entry.Type] + " " + line
+			}
+			if group.Tag == miscTag {
+				line += " · " + strings.Join(entry.Tags, " / ")
+			}
+			sb.WriteString("- " + line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// writeTags 在rootDir写入 TAGS.md
+func writeTags(rootDir string, manifest *Manifest) error {
+	tagsPath := filepath.Join(rootDir, tagsFileName)
+	content := renderTags(manifest, dlConfig.Output.TagsMinDocuments)
+	if err := runSyncer.WriteFile(tagsPath, dlConfig.Output.NormalizeText([]byte(content)), 0o644); err != nil {
+		return err
+	}
+	runFiles.Add(tagsPath)
+	return nil
+}
+
+// handleTagsCommand 根据已有的清单重新生成 TAGS.md，不访问OPEN API
+func handleTagsCommand(manifestPath string) error {
+	config := core.NewConfig("", "")
+	if configPath, err := core.GetConfigFilePath(); err == nil {
+		if _, err := os.Stat(configPath); err == nil {
+			if config, err = core.ReadConfigFromFile(configPath); err != nil {
+				return err
+			}
+		}
+	}
+	if err := config.Output.Validate(); err != nil {
+		return err
+	}
+	dlConfig = *config
+
+	manifest, err := readManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	rootDir := filepath.Dir(manifestPath)
+	if err := writeTags(rootDir, manifest); err != nil {
+		return err
+	}
+	fmt.Printf("Generated tag index %s\n", filepath.Join(rootDir, tagsFileName))
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupTags(t *testing.T) {
+	manifest := &Manifest{Documents: map[string]*ManifestEntry{
+		"d1": {Token: "d1", Title: "b", Path: "g/b.md", Tags: []string{"guide"}},
+		"d2": {Token: "d2", Title: "a", Path: "g/a.md", Tags: []string{"guide"}},
+		"d3": {Token: "d3", Title: "c", Path: "g/api/c.md", Tags: []string{"guide", "api"}},
+		"d4": {Token: "d4", Title: "d", Path: "faq/d.md", Tags: []string{"faq"}},
+		"d5": {Token: "d5", Title: "e", Path: "e.md"},
+	}}
+
+	groups := groupTags(manifest, 0)
+	if assert.Len(t, groups, 3) {
+		assert.Equal(t, "guide", groups[0].Tag)
+		assert.Equal(t, []string{"a", "b", "c"}, entryTitles(groups[0].Entries))
+		// 文档数相同的标签按名称排序
+		assert.Equal(t, "api", groups[1].Tag)
+		assert.Equal(t, "faq", groups[2].Tag)
+	}
+
+	// 只有一个文档的标签合并到 misc
+	groups = groupTags(manifest, 2)
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "guide", groups[0].Tag)
+		assert.Equal(t, miscTag, groups[1].Tag)
+		assert.Equal(t, []string{"c", "d"}, entryTitles(groups[1].Entries))
+	}
+}
+
+func entryTitles(entries []*ManifestEntry) []string {
+	var titles []string
+	for _, entry := range entries {
+		titles = append(titles, entry.Title)
+	}
+	return titles
+}
+
+func TestDownloadWikiWritesTags(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	api.addDoc("", "A")
+	api.addDoc("", "C")
+	api.addDoc("wikA", "A1")
+	api.addDoc("wikA", "A2")
+
+	runManifest = newManifestRecorder(outputDir)
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) || !assert.NoError(t, runManifest.write(report)) {
+		return
+	}
+
+	manifest, err := readManifest(filepath.Join(outputDir, manifestFileName))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"A"}, manifest.Documents["docA1"].Tags)
+		assert.Empty(t, manifest.Documents["docA"].Tags)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, tagsFileName))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "## A (2)\n\n- [A1](<Space/A/A1.md>)\n- [A2](<Space/A/A2.md>)\n")
+		assert.NotContains(t, string(data), "[C]")
+	}
+
+	// 根据清单重新生成时结果一致，不读取本机的配置文件
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("APPDATA", t.TempDir())
+	assert.NoError(t, os.Remove(filepath.Join(outputDir, tagsFileName)))
+	assert.NoError(t, handleTagsCommand(filepath.Join(outputDir, manifestFileName)))
+	regenerated, err := os.ReadFile(filepath.Join(outputDir, tagsFileName))
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(data), string(regenerated))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+const (
+	formatMarkdown = "md"
+	formatText     = "text"
+	formatChunks   = "chunks"
+)
+
+// validateFormat 检查 --format 参数，空值视为 md
+func validateFormat(format string) error {
+	switch format {
+	case "", formatMarkdown, formatText, formatChunks:
+		return nil
+	}
+	return errors.Errorf("unknown --format %q, expect one of [%s %s %s]",
+		format, formatMarkdown, formatText, formatChunks)
+}
+
+// fileExt 返回当前输出格式的文件后缀
+func (opts *DownloadOpts) fileExt() string {
+	switch opts.format {
+	case formatText:
+		return ".txt"
+	case formatChunks:
+		return ".jsonl"
+	}
+	return ".md"
+}
+
+// TextMeta 纯文本导出时与文本文件并列写入的元数据，便于直接导入搜索索引
+type TextMeta struct {
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	DocumentID string `json:"document_id"`
+	RevisionID int64  `json:"revision_id"`
+	TextFile   string `json:"text_file"`
+	// 知识库中的文档同时记录节点链接和文档链接
+	DocumentSource
+}
+
+// downloadDocumentText 以阅读顺序导出纯文本，不下载图片
+func downloadDocumentText(url string, source DocumentSource, docx *lark.DocxDocument, blocks []*lark.DocxBlock, opts *DownloadOpts) error {
+	docToken := source.ObjToken
+	parser := core.NewTextParser(opts.textKeepLinks)
+	text := parser.ParseDocxContent(docx, blocks)
+
+	if err := prepareOutputDir(url, docToken, docx, blocks, opts); err != nil {
+		return err
+	}
+
+	baseName := documentBaseName(opts, docx.Title, docToken)
+	outputPath := filepath.Join(opts.outputDir, baseName+".txt")
+	if err := runDedup.writeFile(outputPath, dlConfig.Output.NormalizeText([]byte(text))); err != nil {
+		return err
+	}
+	runFiles.Add(outputPath)
+	runManifest.record(docx, docToken, url, source, outputPath, opts.tags, []byte(text))
+
+	meta, err := json.MarshalIndent(&TextMeta{
+		Title:          docx.Title,
+		URL:            url,
+		DocumentID:     docx.DocumentID,
+		RevisionID:     docx.RevisionID,
+		TextFile:       filepath.Base(outputPath),
+		DocumentSource: source,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	metaPath := filepath.Join(opts.outputDir, baseName+sidecarSuffix)
+	if err := runDedup.writeFile(metaPath, dlConfig.Output.NormalizeText(meta)); err != nil {
+		return err
+	}
+	runFiles.Add(metaPath)
+	logf("Downloaded text file to %s\n", outputPath)
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+const (
+	traversalCycle   = "cycle_detected"     // 节点已经遍历过，子节点列表又返回了它的祖先或它自己
+	traversalTooDeep = "max_depth_exceeded" // 超过 download.max_depth
+)
+
+// SkippedNode 遍历知识空间或文件夹时跳过的节点，记录在下载报告中
+type SkippedNode struct {
+	Reason string `json:"reason"` // "cycle_detected" 或 "max_depth_exceeded"
+	Token  string `json:"token"`
+	Title  string `json:"title"`
+	Dir    string `json:"dir"` // 节点所在的本地目录
+	Depth  int    `json:"depth"`
+}
+
+// traversalGuard 记录遍历过的节点。损坏的知识空间中，节点的子节点列表可能再次返回祖先节点，
+// 重复的节点不再展开；无论是否有环，超过最大深度的节点也不再遍历，避免无限递归
+type traversalGuard struct {
+	maxDepth int
+	visited  map[string]bool
+}
+
+func newTraversalGuard() *traversalGuard {
+	return &traversalGuard{maxDepth: dlConfig.Download.TraversalMaxDepth(), visited: make(map[string]bool)}
+}
+
+// check 返回跳过位于depth层（根的子节点为第1层）的节点的原因，可以遍历时返回空并记为已遍历
+func (g *traversalGuard) check(token string, depth int) string {
+	if g.visited[token] {
+		return traversalCycle
+	}
+	if depth > g.maxDepth {
+		return traversalTooDeep
+	}
+	g.visited[token] = true
+	return ""
+}
+
+// skipNode 告警并在报告中记录跳过的节点
+func skipNode(report *BatchDownloadReport, reason, token, title, dir string, depth int) {
+	warnf("Warning: skipped %s (%s) in %s: %s\n", title, token, dir, reason)
+	report.SkippedNodes = append(report.SkippedNodes, SkippedNode{
+		Reason: reason, Token: token, Title: title, Dir: dir, Depth: depth,
+	})
+}
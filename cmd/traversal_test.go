@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCyclicFakeAPI 损坏的知识空间：A1 的子节点列表又返回了祖先 A 和它自己
+func newCyclicFakeAPI() *fakeAPI {
+	api := newFakeWiki()
+	nodeA := api.addDoc("", "A")
+	nodeA1 := api.addDoc("wikA", "A1")
+	api.wikiNodes["wikA1"] = append(api.wikiNodes["wikA1"], nodeA, nodeA1)
+	api.addDoc("wikA1", "A2")
+	return api
+}
+
+func TestDownloadWikiCycle(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	// 统计目录层数同样会遇到环
+	runPathBudget = newPathBudget(240, dlConfig.Output.ImageDir)
+	defer func() { runPathBudget = nil }()
+
+	report, err := downloadWiki(context.Background(), newCyclicFakeAPI(), "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 3, report.TotalFiles)
+	assert.Equal(t, 3, report.SuccessCount)
+	assertFileExists(t, filepath.Join(outputDir, "Space", "A.md"))
+	assertFileExists(t, filepath.Join(outputDir, "Space", "A", "A1.md"))
+	assertFileExists(t, filepath.Join(outputDir, "Space", "A", "A1", "A2.md"))
+
+	dir := filepath.Join(outputDir, "Space", "A", "A1")
+	assert.Equal(t, []SkippedNode{
+		{Reason: traversalCycle, Token: "wikA", Title: "A", Dir: dir, Depth: 3},
+		{Reason: traversalCycle, Token: "wikA1", Title: "A1", Dir: dir, Depth: 3},
+	}, report.SkippedNodes)
+
+	data, err := json.Marshal(report)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), `"reason":"cycle_detected"`)
+	}
+}
+
+func TestDownloadWikiMaxDepth(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlConfig.Download.MaxDepth = 2
+	api := newFakeWiki()
+	// 一条没有环但层级很深的链
+	parent := ""
+	for i := 1; i <= 5; i++ {
+		parent = api.addDoc(parent, fmt.Sprint(i)).NodeToken
+	}
+
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, report.SuccessCount)
+	assertFileExists(t, filepath.Join(outputDir, "Space", "1", "2.md"))
+	if assert.Len(t, report.SkippedNodes, 1) {
+		assert.Equal(t, traversalTooDeep, report.SkippedNodes[0].Reason)
+		assert.Equal(t, "wik3", report.SkippedNodes[0].Token)
+	}
+	_, err = os.Stat(filepath.Join(outputDir, "Space", "1", "2", "3.md"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOutlineCycle(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	dlOpts.outlineFormat = outlineFormatJSON
+	err := generateOutline(context.Background(), newCyclicFakeAPI(), "https://domain.feishu.cn/wiki/settings/123", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "Space_目录结构.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var outline outlineDocument
+	assert.NoError(t, json.Unmarshal(data, &outline))
+	assert.Equal(t, 3, outline.NodeCount)
+	if assert.Len(t, outline.Nodes, 1) && assert.Len(t, outline.Nodes[0].Children, 1) {
+		children := outline.Nodes[0].Children[0].Children
+		if assert.Len(t, children, 1) {
+			assert.Equal(t, "wikA2", children[0].Token)
+		}
+	}
+}
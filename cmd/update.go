@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const latestReleaseAPI = "https://api.github.com/repos/Wsine/feishu2md/releases/latest"
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// parseVersion 解析形如 v2.1.0 的版本号，无法解析时返回false
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	parts := strings.Split(v, ".")
+	nums := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		nums = append(nums, n)
+	}
+	return nums, true
+}
+
+// isNewerVersion 判断latest是否比current更新，无法比较时只要不同即视为更新
+func isNewerVersion(latest, current string) bool {
+	l, lok := parseVersion(latest)
+	c, cok := parseVersion(current)
+	if !lok || !cok {
+		return strings.TrimSpace(latest) != strings.TrimSpace(current)
+	}
+	for i := 0; i < len(l) || i < len(c); i++ {
+		var a, b int
+		if i < len(l) {
+			a = l[i]
+		}
+		if i < len(c) {
+			b = c[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+// handleCheckUpdate 查询GitHub最新发布版本，只提示不自动安装
+func handleCheckUpdate() error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(http.MethodGet, latestReleaseAPI, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to query the latest release")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to query the latest release: %s", resp.Status)
+	}
+	release := githubRelease{}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return err
+	}
+
+	current := currentBuildInfo().Version
+	fmt.Println("Current version:", current)
+	fmt.Println("Latest release: ", release.TagName)
+	if isNewerVersion(release.TagName, current) {
+		fmt.Println("A newer version is available:", release.HTMLURL)
+	} else {
+		fmt.Println("You are running the latest version")
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+// readURLList 读取每行一个的文档链接，忽略空行和以 # 开头的注释行，重复的链接只保留一个
+func readURLList(r io.Reader) ([]string, error) {
+	var urls []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+		seen[line] = true
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// openURLList 打开 --from-file 指定的文件，"-" 表示标准输入
+func openURLList(path string) ([]string, error) {
+	if path == "-" {
+		return readURLList(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readURLList(f)
+}
+
+// RootDir 链接列表中的文件夹或知识空间，下载到输出目录下以其名称命名的目录
+type RootDir struct {
+	URL   string `json:"url"`
+	Token string `json:"token"` // 文件夹token或知识空间id
+	Name  string `json:"name"`
+	Dir   string `json:"dir"` // 相对输出目录，使用 / 分隔
+	// 与其他根目录重名（不区分大小写）时目录名追加了token的末尾几位
+	Renamed bool `json:"renamed,omitempty"`
+}
+
+// listRoot 链接列表中需要遍历的文件夹或知识空间
+type listRoot struct {
+	RootDir
+	folder    bool   // 文件夹，否则为知识空间
+	prefixURL string // 知识空间的站点地址
+	err       error  // 获取名称失败时记为该链接的失败
+}
+
+// isListRoot 链接是否为文件夹或知识空间
+func isListRoot(url string) bool {
+	if _, err := utils.ValidateFolderURL(url); err == nil {
+		return true
+	}
+	_, _, err := utils.ValidateWikiURL(url)
+	return err == nil
+}
+
+// hasListRoots 链接列表中是否有文件夹或知识空间
+func hasListRoots(urls []string) bool {
+	for _, url := range urls {
+		if isListRoot(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveListRoots 获取列表中文件夹和知识空间的名称作为根目录名。名称相同（不区分大小写）
+// 的根目录全部追加 "~" 和token的末尾几位，结果只取决于token，与列表顺序无关
+func resolveListRoots(ctx context.Context, client core.API, urls []string) map[string]*listRoot {
+	roots := make(map[string]*listRoot)
+	var ordered []*listRoot
+	for _, url := range urls {
+		root := &listRoot{RootDir: RootDir{URL: url}}
+		if folderToken, err := utils.ValidateFolderURL(url); err == nil {
+			root.folder = true
+			root.Token = folderToken
+			root.Name, root.err = client.GetDriveFolderName(ctx, folderToken)
+		} else if prefixURL, spaceID, err := utils.ValidateWikiURL(url); err == nil {
+			root.prefixURL = prefixURL
+			root.Token = spaceID
+			root.Name, root.err = client.GetWikiName(ctx, spaceID)
+		} else {
+			continue
+		}
+		if root.err == nil && root.Name == "" {
+			root.Name = root.Token
+		}
+		roots[url] = root
+		if root.err == nil {
+			ordered = append(ordered, root)
+		}
+	}
+
+	byName := make(map[string][]*listRoot)
+	for _, root := range ordered {
+		key := strings.ToLower(utils.SanitizeFileName(root.Name))
+		byName[key] = append(byName[key], root)
+	}
+	for _, root := range ordered {
+		dir := utils.SanitizeFileName(root.Name)
+		if same := byName[strings.ToLower(dir)]; len(same) > 1 {
+			suffix := root.Token
+			if len(suffix) > 6 {
+				suffix = suffix[len(suffix)-6:]
+			}
+			dir += "~" + suffix
+			root.Renamed = true
+			if same[0] == root {
+				warnf("Warning: %d folders or wiki spaces are named %q, adding the tail of their tokens to the directory names\n", len(same), root.Name)
+			}
+		}
+		root.Dir = dir
+	}
+	return roots
+}
+
+// walk 遍历根下的文档并提交到流水线，文档以根的名称作为第一个标签
+func (root *listRoot) walk(ctx context.Context, client core.API, pipeline *downloadPipeline, report *BatchDownloadReport, names *fileNamer) error {
+	tags := appendTag(nil, root.Name)
+	if root.folder {
+		walker := newFolderWalker(client, pipeline, report, names)
+		dir, err := walker.rootDir(ctx, dlOpts.outputDir, root.Dir, root.Token)
+		if err != nil {
+			return err
+		}
+		root.Dir = filepath.ToSlash(filepath.Base(dir))
+		return walker.walk(ctx, dir, root.Token, tags, 0)
+	}
+	walker := newWikiWalker(client, pipeline, report, names, root.prefixURL, root.Token)
+	dir, err := walker.rootDir(ctx, dlOpts.outputDir, root.Dir)
+	if err != nil {
+		return err
+	}
+	root.Dir = filepath.ToSlash(filepath.Base(dir))
+	return walker.walk(ctx, dir, nil, tags, 0)
+}
+
+// hasURLList 链接来自 --from-file 或项目配置中的多个 sources
+func (opts *DownloadOpts) hasURLList() bool {
+	return opts.fromFile != "" || len(opts.sources) > 0
+}
+
+// validateFromFile 链接列表已经指定了全部文档，不能再指定链接或其他下载模式
+func validateFromFile(opts *DownloadOpts, url string) error {
+	if opts.fromFile == "" {
+		return nil
+	}
+	if opts.batch || opts.wiki || opts.spaceName != "" || opts.wikiOutline {
+		return errors.New("--from-file can not be used with --batch, --wiki, --space-name or --outline")
+	}
+	if url != "" {
+		return errors.New("--from-file takes no url argument")
+	}
+	return nil
+}
+
+// downloadURLList 并发下载列表中的文档（可以来自不同的文件夹和知识库）到输出目录，
+// 列表中的文件夹和知识空间下载到以其名称命名的子目录。无效的链接记为失败而不中断下载，
+// 结果按列表顺序写入同一份报告
+func downloadURLList(ctx context.Context, client core.API, urls []string) (*BatchDownloadReport, error) {
+	report := newBatchDownloadReport()
+	if len(urls) == 0 && !dlOpts.forceEmpty {
+		return report, errNoDocuments
+	}
+	if err := os.MkdirAll(dlOpts.outputDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	// 文件夹和知识空间下载到各自的根目录，名称在提交任何文档前确定
+	roots := resolveListRoots(ctx, client, urls)
+
+	// 单独列出的文档都写入同一目录，标题相同时按下载完成的先后去重命名
+	opts := dlOpts.forDir(dlOpts.outputDir)
+	opts.names = newFileNamer()
+
+	pipeline := newDownloadPipeline(ctx, client)
+	for _, url := range urls {
+		root, ok := roots[url]
+		if !ok {
+			report.TotalFiles++
+			pipeline.submit(url, opts)
+			continue
+		}
+		// 无法遍历的根记为该链接的失败，已提交的文档照常下载
+		err := root.err
+		if err == nil {
+			err = root.walk(ctx, client, pipeline, report, opts.names)
+		}
+		if err != nil {
+			report.TotalFiles++
+			pipeline.fail(url, opts, err)
+		}
+	}
+	results := pipeline.wait()
+	for _, url := range urls {
+		if root, ok := roots[url]; ok && root.err == nil {
+			report.Roots = append(report.Roots, root.RootDir)
+		}
+	}
+	if report.TotalFiles == 0 && !dlOpts.forceEmpty {
+		return report, errNoDocuments
+	}
+	finishBatchReport(report, results)
+	return report, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadURLList(t *testing.T) {
+	urls, err := readURLList(strings.NewReader(`
+# 设计文档
+https://domain.feishu.cn/docx/doc1
+
+  https://domain.feishu.cn/wiki/wik2#part-abc
+https://domain.feishu.cn/docx/doc1
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"https://domain.feishu.cn/docx/doc1",
+			"https://domain.feishu.cn/wiki/wik2#part-abc",
+		}, urls)
+	}
+}
+
+func TestValidateFromFile(t *testing.T) {
+	assert.NoError(t, validateFromFile(&DownloadOpts{}, "https://domain.feishu.cn/docx/doc1"))
+	assert.NoError(t, validateFromFile(&DownloadOpts{fromFile: "-"}, ""))
+	assert.Error(t, validateFromFile(&DownloadOpts{fromFile: "-"}, "https://domain.feishu.cn/docx/doc1"))
+	assert.Error(t, validateFromFile(&DownloadOpts{fromFile: "-", wiki: true}, ""))
+}
+
+func TestDownloadURLList(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeAPI()
+	api.docs = map[string]string{"doc1": "Doc1", "doc3": "Doc1"}
+	api.addNode("space", "wik2", "docx", "doc2", "Doc2")
+	urls := []string{
+		"https://domain.feishu.cn/docx/doc1",
+		"not a url",
+		"https://domain.feishu.cn/wiki/wik2",
+		"https://domain.feishu.cn/docx/doc3",
+	}
+
+	report, err := downloadURLList(context.Background(), api, urls)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 4, report.TotalFiles)
+	assert.Equal(t, 3, report.SuccessCount)
+	assert.Equal(t, 1, report.ErrorCount)
+	// 结果按列表顺序排列，无效的链接记为失败
+	if assert.Len(t, report.Results, 4) {
+		for i, url := range urls {
+			assert.Equal(t, url, report.Results[i].URL)
+		}
+		assert.Equal(t, "error", report.Results[1].Status)
+		assert.Equal(t, "Doc2.md", report.Results[2].Filename)
+	}
+	assertFileExists(t, filepath.Join(outputDir, "Doc2.md"))
+	// 来自不同位置的同名文档不会互相覆盖
+	names := []string{report.Results[0].Filename, report.Results[3].Filename}
+	assert.ElementsMatch(t, []string{"Doc1.md", "Doc1 (2).md"}, names)
+	for _, name := range names {
+		assertFileExists(t, filepath.Join(outputDir, name))
+	}
+}
+
+func TestDownloadURLListEmpty(t *testing.T) {
+	setupDownloadTest(t)
+	_, err := downloadURLList(context.Background(), newFakeAPI(), nil)
+	assert.ErrorIs(t, err, errNoDocuments)
+}
+
+func TestDownloadURLListRootCollisions(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	runManifest = newManifestRecorder(outputDir)
+	api := newFakeAPI()
+	api.docs = map[string]string{"docA": "SpecA", "docB": "SpecB", "doc1": "Doc1"}
+	api.folderNames = map[string]string{"fldcnAAAAAA1": "产品", "fldcnBBBBBB2": "产品", "fldcnCCCCCC3": "设计"}
+	api.folders["fldcnAAAAAA1"] = []*lark.GetDriveFileListRespFile{
+		{Token: "docA", Name: "SpecA", Type: "docx", URL: "https://domain.feishu.cn/docx/docA"},
+	}
+	api.folders["fldcnBBBBBB2"] = []*lark.GetDriveFileListRespFile{
+		{Token: "docB", Name: "SpecB", Type: "docx", URL: "https://domain.feishu.cn/docx/docB"},
+	}
+	api.wikiName = "产品"
+	api.addNode("", "wikW", "docx", "docW", "SpecW")
+	urls := []string{
+		"https://domain.feishu.cn/drive/folder/fldcnAAAAAA1",
+		"https://domain.feishu.cn/docx/doc1",
+		"https://domain.feishu.cn/wiki/settings/spaceWWWWW9",
+		"https://domain.feishu.cn/drive/folder/fldcnBBBBBB2",
+		"https://domain.feishu.cn/drive/folder/fldcnCCCCCC3",
+	}
+
+	report, err := downloadURLList(context.Background(), api, urls)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 4, report.TotalFiles)
+	assert.Equal(t, 4, report.SuccessCount)
+	// 重名的根目录都追加token末尾几位，不重名的保持原名
+	if assert.Len(t, report.Roots, 4) {
+		assert.Equal(t, "产品~AAAAA1", report.Roots[0].Dir)
+		assert.Equal(t, "产品~WWWWW9", report.Roots[1].Dir)
+		assert.Equal(t, "产品~BBBBB2", report.Roots[2].Dir)
+		assert.Equal(t, "设计", report.Roots[3].Dir)
+		assert.True(t, report.Roots[0].Renamed)
+		assert.False(t, report.Roots[3].Renamed)
+	}
+	assertFileExists(t, filepath.Join(outputDir, "Doc1.md"))
+	assertFileExists(t, filepath.Join(outputDir, "产品~AAAAA1", "SpecA.md"))
+	assertFileExists(t, filepath.Join(outputDir, "产品~BBBBB2", "SpecB.md"))
+	assertFileExists(t, filepath.Join(outputDir, "产品~WWWWW9", "SpecW.md"))
+	// 一个根的文件不会落入另一个根的目录
+	for _, dir := range []string{"产品~AAAAA1", "产品~BBBBB2", "产品~WWWWW9"} {
+		entries, err := os.ReadDir(filepath.Join(outputDir, dir))
+		if assert.NoError(t, err) {
+			assert.Len(t, entries, 1, dir)
+		}
+	}
+	_, err = os.Stat(filepath.Join(outputDir, "产品"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, runManifest.write(report))
+	manifest, err := readManifest(filepath.Join(outputDir, manifestFileName))
+	if assert.NoError(t, err) {
+		assert.Equal(t, report.Roots, manifest.Roots)
+		assert.Equal(t, "产品~BBBBB2/SpecB.md", manifest.Documents["docB"].Path)
+	}
+}
+
+func TestHasListRoots(t *testing.T) {
+	assert.False(t, hasListRoots([]string{"https://domain.feishu.cn/docx/doc1", "https://domain.feishu.cn/wiki/wik2"}))
+	assert.True(t, hasListRoots([]string{"https://domain.feishu.cn/wiki/settings/123"}))
+	assert.True(t, hasListRoots([]string{"https://domain.feishu.cn/drive/folder/fld"}))
+}
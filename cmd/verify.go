@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+type VerifyOpts struct {
+	sample int  // 随机抽查的文档数，0 表示全部
+	json   bool // 以json输出结果
+}
+
+var verifyOpts = VerifyOpts{}
+
+const (
+	verifyCurrent   = "current"
+	verifyStale     = "stale"     // 远端版本号与清单不同，或本地文件缺失
+	verifyOrphaned  = "orphaned"  // 远端文档已删除
+	verifyUnchecked = "unchecked" // 上传的文件和表格没有版本号，无法只读取元数据判断
+	verifyError     = "error"
+)
+
+// VerifyResult 一个文档的校验结果
+type VerifyResult struct {
+	Token          string `json:"token"`
+	Title          string `json:"title"`
+	Path           string `json:"path"`
+	Status         string `json:"status"`
+	LocalRevision  int64  `json:"local_revision,omitempty"`
+	RemoteRevision int64  `json:"remote_revision,omitempty"`
+	Missing        bool   `json:"missing,omitempty"` // 本地文件不存在
+	Error          string `json:"error,omitempty"`
+}
+
+// VerifyReport 镜像的校验结果，只输出不写入文件
+type VerifyReport struct {
+	MirrorDir      string         `json:"mirror_dir"`
+	TotalDocuments int            `json:"total_documents"`
+	Checked        int            `json:"checked"` // --sample 时为抽查的文档数
+	Counts         map[string]int `json:"counts"`
+	Results        []VerifyResult `json:"results"`
+}
+
+// stale 是否有过期或已删除的文档
+func (r *VerifyReport) stale() bool {
+	return r.Counts[verifyStale]+r.Counts[verifyOrphaned] > 0
+}
+
+// handleVerifyCommand 只读取文档的版本号，检查镜像是否与远端一致，不写入任何文件
+func handleVerifyCommand(mirrorDir string) error {
+	if verifyOpts.sample < 0 {
+		return errors.Errorf("--sample must not be negative, got %d", verifyOpts.sample)
+	}
+	config, err := readCredentialConfig()
+	if err != nil {
+		return err
+	}
+	dlConfig = *config
+	httpClient, err := core.NewHTTPClient(dlConfig.HTTP)
+	if err != nil {
+		return err
+	}
+	// 每个文档仍需一次元数据请求，同样受 feishu.rate_limit 限制
+	clientOpts := append(dlConfig.Feishu.ClientOptions(), core.WithHTTPClient(httpClient))
+	client := core.NewClient(dlConfig.Feishu.AppId, dlConfig.Feishu.AppSecret, clientOpts...)
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	report, err := verifyMirror(context.Background(), client, mirrorDir, verifyOpts.sample, rng)
+	if err != nil {
+		return err
+	}
+	if verifyOpts.json {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Print(renderVerifyReport(report))
+	}
+	return verifyExitError(report)
+}
+
+// verifyMirror 按清单逐个读取文档的版本号，sample 大于0时只随机抽查其中的 sample 个
+func verifyMirror(ctx context.Context, client core.API, mirrorDir string, sample int, rng *rand.Rand) (*VerifyReport, error) {
+	manifest, err := readManifest(filepath.Join(mirrorDir, manifestFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("%s has no %s, download it with --batch or --wiki first", mirrorDir, manifestFileName)
+		}
+		return nil, err
+	}
+	var entries []*ManifestEntry
+	for _, entry := range manifest.Documents {
+		entries = append(entries, entry)
+	}
+	entries = sortedEntries(entries)
+	if sample > 0 && sample < len(entries) {
+		picked := make([]*ManifestEntry, 0, sample)
+		for _, i := range rng.Perm(len(entries))[:sample] {
+			picked = append(picked, entries[i])
+		}
+		entries = sortedEntries(picked)
+	}
+
+	report := &VerifyReport{
+		MirrorDir:      mirrorDir,
+		TotalDocuments: len(manifest.Documents),
+		Checked:        len(entries),
+		Counts:         make(map[string]int),
+		Results:        []VerifyResult{},
+	}
+	for _, entry := range entries {
+		result := verifyEntry(ctx, client, mirrorDir, entry)
+		report.Counts[result.Status]++
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func verifyEntry(ctx context.Context, client core.API, mirrorDir string, entry *ManifestEntry) VerifyResult {
+	result := VerifyResult{Token: entry.Token, Title: entry.Title, Path: entry.Path, LocalRevision: entry.RevisionID}
+	if _, err := os.Stat(filepath.Join(mirrorDir, filepath.FromSlash(entry.Path))); err != nil {
+		result.Missing = true
+	}
+	if entry.Type != "" {
+		result.Status = verifyUnchecked
+		if result.Missing {
+			result.Status = verifyStale
+		}
+		return result
+	}
+	docx, err := client.GetDocxDocument(ctx, entry.Token)
+	switch {
+	case core.IsNotFound(err):
+		result.Status = verifyOrphaned
+	case err != nil:
+		result.Status = verifyError
+		result.Error = err.Error()
+	default:
+		result.RemoteRevision = docx.RevisionID
+		result.Status = verifyCurrent
+		if result.Missing || docx.RevisionID != entry.RevisionID {
+			result.Status = verifyStale
+		}
+	}
+	return result
+}
+
+func renderVerifyReport(report *VerifyReport) string {
+	sb := new(strings.Builder)
+	for _, result := range report.Results {
+		switch result.Status {
+		case verifyStale:
+			if result.Missing {
+				fmt.Fprintf(sb, "stale     %s (missing locally)\n", result.Path)
+			} else {
+				fmt.Fprintf(sb, "stale     %s (revision %d, remote %d)\n", result.Path, result.LocalRevision, result.RemoteRevision)
+			}
+		case verifyOrphaned:
+			fmt.Fprintf(sb, "orphaned  %s (deleted remotely)\n", result.Path)
+		case verifyError:
+			fmt.Fprintf(sb, "error     %s: %s\n", result.Path, result.Error)
+		}
+	}
+	fmt.Fprintf(sb, "Verified %d of %d documents: %d current, %d stale, %d orphaned, %d unchecked, %d errors\n",
+		report.Checked, report.TotalDocuments, report.Counts[verifyCurrent], report.Counts[verifyStale],
+		report.Counts[verifyOrphaned], report.Counts[verifyUnchecked], report.Counts[verifyError])
+	return sb.String()
+}
+
+// verifyExitError 有过期或已删除的文档时以1退出，只是部分文档无法读取时以2退出，便于定时任务告警
+func verifyExitError(report *VerifyReport) error {
+	if report.stale() {
+		return cli.Exit(fmt.Sprintf("%d documents of the mirror are stale or orphaned",
+			report.Counts[verifyStale]+report.Counts[verifyOrphaned]), 1)
+	}
+	if report.Counts[verifyError] > 0 {
+		return cli.Exit(fmt.Sprintf("%d documents could not be verified", report.Counts[verifyError]), 2)
+	}
+	return nil
+}
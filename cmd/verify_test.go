@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+func TestVerifyMirror(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	api.revisions = map[string]int64{"docA": 1, "docB": 1, "docC": 1, "docD": 1}
+	api.addDoc("", "A")
+	api.addDoc("", "B")
+	api.addDoc("", "C")
+	api.addDoc("", "D")
+	runManifest = newManifestRecorder(outputDir)
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) || !assert.NoError(t, runManifest.write(report)) {
+		return
+	}
+	rng := rand.New(rand.NewSource(1))
+
+	verified, err := verifyMirror(context.Background(), api, outputDir, 0, rng)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 4, verified.Counts[verifyCurrent])
+		assert.NoError(t, verifyExitError(verified))
+	}
+
+	// 远端更新、本地丢失、远端删除和无法读取的文档分别报告
+	api.revisions["docA"] = 2
+	assert.NoError(t, os.Remove(filepath.Join(outputDir, "Space", "B.md")))
+	delete(api.docs, "docC")
+	api.failDocs["docD"] = true
+	modTimes := listFiles(t, outputDir)
+
+	verified, err = verifyMirror(context.Background(), api, outputDir, 0, rng)
+	if !assert.NoError(t, err) || !assert.Len(t, verified.Results, 4) {
+		return
+	}
+	assert.Equal(t, VerifyResult{Token: "docA", Title: "A", Path: "Space/A.md", Status: verifyStale,
+		LocalRevision: 1, RemoteRevision: 2}, verified.Results[0])
+	assert.Equal(t, verifyStale, verified.Results[1].Status)
+	assert.True(t, verified.Results[1].Missing)
+	assert.Equal(t, verifyOrphaned, verified.Results[2].Status)
+	assert.Equal(t, verifyError, verified.Results[3].Status)
+	output := renderVerifyReport(verified)
+	assert.Contains(t, output, "stale     Space/A.md (revision 1, remote 2)")
+	assert.Contains(t, output, "orphaned  Space/C.md (deleted remotely)")
+	assert.Contains(t, output, "Verified 4 of 4 documents: 0 current, 2 stale, 1 orphaned, 0 unchecked, 1 errors")
+	exitErr, ok := verifyExitError(verified).(cli.ExitCoder)
+	if assert.True(t, ok) {
+		assert.Equal(t, 1, exitErr.ExitCode())
+	}
+	// 校验不写入任何文件
+	assert.Equal(t, modTimes, listFiles(t, outputDir))
+
+	// 只有无法读取的文档时以2退出
+	verified = &VerifyReport{Counts: map[string]int{verifyCurrent: 3, verifyError: 1}}
+	exitErr, ok = verifyExitError(verified).(cli.ExitCoder)
+	if assert.True(t, ok) {
+		assert.Equal(t, 2, exitErr.ExitCode())
+	}
+}
+
+func TestVerifyMirrorSample(t *testing.T) {
+	outputDir := setupDownloadTest(t)
+	api := newFakeWiki()
+	for _, name := range []string{"A", "B", "C", "D", "E"} {
+		api.addDoc("", name)
+	}
+	runManifest = newManifestRecorder(outputDir)
+	report, err := downloadWiki(context.Background(), api, "https://domain.feishu.cn/wiki/settings/123")
+	if !assert.NoError(t, err) || !assert.NoError(t, runManifest.write(report)) {
+		return
+	}
+
+	calls := api.callCount("GetDocxDocument")
+	verified, err := verifyMirror(context.Background(), api, outputDir, 2, rand.New(rand.NewSource(1)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, verified.TotalDocuments)
+		assert.Equal(t, 2, verified.Checked)
+		assert.Len(t, verified.Results, 2)
+		assert.Equal(t, calls+2, api.callCount("GetDocxDocument"))
+	}
+
+	_, err = verifyMirror(context.Background(), api, t.TempDir(), 0, rand.New(rand.NewSource(1)))
+	assert.ErrorContains(t, err, "has no "+manifestFileName)
+}
+
+// listFiles 目录下所有文件的修改时间
+func listFiles(t *testing.T, dir string) map[string]int64 {
+	t.Helper()
+	files := make(map[string]int64)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files[path] = info.ModTime().UnixNano()
+		}
+		return err
+	})
+	assert.NoError(t, err)
+	return files
+}
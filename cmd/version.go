@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// 发布时通过 -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..." 注入，
+// 留空时从 Go 工具链写入二进制的构建信息中读取
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// develVersion 既没有注入也无法从构建信息得到版本号时使用，如 go run
+const develVersion = "devel"
+
+// BuildInfo 程序的版本和构建环境，输出到 --version、version 命令和下载报告中
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // 构建时工作区有未提交的修改
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	// 是否启用cgo，发布的静态二进制应为false，才能在 Alpine 等 musl 系统中运行
+	CgoEnabled bool `json:"cgo_enabled"`
+}
+
+type VersionOpts struct {
+	json bool // 以json输出构建信息
+}
+
+var versionOpts = VersionOpts{}
+
+// currentBuildInfo 本程序的构建信息
+func currentBuildInfo() BuildInfo {
+	info, _ := debug.ReadBuildInfo()
+	return newBuildInfo(info, version, commit, buildDate)
+}
+
+// newBuildInfo 以注入的值为准，缺少的字段由 go build 记录的模块版本和 vcs 信息补全
+func newBuildInfo(info *debug.BuildInfo, version, commit, buildDate string) BuildInfo {
+	build := BuildInfo{
+		Version:   strings.TrimSpace(version),
+		Commit:    strings.TrimSpace(commit),
+		BuildDate: strings.TrimSpace(buildDate),
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info != nil {
+		build.GoVersion = info.GoVersion
+		// go install 安装的模块带有版本号，本地构建为 (devel)
+		if build.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			build.Version = info.Main.Version
+		}
+		var goos, goarch string
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if build.Commit == "" {
+					build.Commit = setting.Value
+				}
+			case "vcs.time":
+				if build.BuildDate == "" {
+					build.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				build.Modified = setting.Value == "true"
+			case "CGO_ENABLED":
+				build.CgoEnabled = setting.Value == "1"
+			case "GOOS":
+				goos = setting.Value
+			case "GOARCH":
+				goarch = setting.Value
+			}
+		}
+		if goos != "" && goarch != "" {
+			build.Platform = goos + "/" + goarch
+		}
+	}
+	if build.Version == "" {
+		build.Version = develVersion
+	}
+	return build
+}
+
+// shortCommit 缩短为 git 默认的7位
+func (b BuildInfo) shortCommit() string {
+	if len(b.Commit) > 7 {
+		return b.Commit[:7]
+	}
+	return b.Commit
+}
+
+// String 单行的版本说明，如 v2.1.0 (commit 1a2b3c4, built 2024-01-02T03:04:05Z, go1.21.5 linux/arm64)
+func (b BuildInfo) String() string {
+	details := []string{}
+	if b.Commit != "" {
+		commit := "commit " + b.shortCommit()
+		if b.Modified {
+			commit += "-dirty"
+		}
+		details = append(details, commit)
+	}
+	if b.BuildDate != "" {
+		details = append(details, "built "+b.BuildDate)
+	}
+	details = append(details, b.GoVersion+" "+b.Platform)
+	if b.CgoEnabled {
+		details = append(details, "cgo")
+	}
+	return fmt.Sprintf("%s (%s)", b.Version, strings.Join(details, ", "))
+}
+
+// handleVersionCommand 打印构建信息，--json 时输出json便于脚本读取
+func handleVersionCommand() error {
+	build := currentBuildInfo()
+	if !versionOpts.json {
+		fmt.Println("feishu2md", build)
+		return nil
+	}
+	data, err := json.MarshalIndent(build, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
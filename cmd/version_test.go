@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBuildInfo(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.21.5",
+		Main:      debug.Module{Path: "github.com/Wsine/feishu2md", Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "CGO_ENABLED", Value: "0"},
+			{Key: "GOARCH", Value: "arm64"},
+			{Key: "GOOS", Value: "linux"},
+			{Key: "vcs.revision", Value: "1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b"},
+			{Key: "vcs.time", Value: "2024-01-02T03:04:05Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	// 没有注入时从构建信息补全
+	build := newBuildInfo(info, "", "", "")
+	assert.Equal(t, BuildInfo{
+		Version:   develVersion,
+		Commit:    "1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b",
+		BuildDate: "2024-01-02T03:04:05Z",
+		Modified:  true,
+		GoVersion: "go1.21.5",
+		Platform:  "linux/arm64",
+	}, build)
+	assert.Equal(t, "devel (commit 1a2b3c4-dirty, built 2024-01-02T03:04:05Z, go1.21.5 linux/arm64)", build.String())
+
+	// 注入的值优先
+	build = newBuildInfo(info, " v2.1.0\n", "abcdef0", "2024-02-03T00:00:00Z")
+	assert.Equal(t, "v2.1.0", build.Version)
+	assert.Equal(t, "abcdef0", build.Commit)
+	assert.Equal(t, "2024-02-03T00:00:00Z", build.BuildDate)
+
+	// go install 安装的模块版本
+	info.Main.Version = "v2.0.1"
+	assert.Equal(t, "v2.0.1", newBuildInfo(info, "", "", "").Version)
+
+	data, err := json.Marshal(newBuildInfo(nil, "v2.1.0", "", ""))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), `"version":"v2.1.0"`)
+		assert.Contains(t, string(data), `"cgo_enabled":false`)
+		assert.NotContains(t, string(data), `"commit"`)
+	}
+}
+
+func TestNoCgoDependencies(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go list")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	// 标准库中 net 等包的cgo实现在 CGO_ENABLED=0 时有纯Go的替代，第三方包则没有，
+	// 会使 Alpine 和 ARM64 的静态交叉编译失败
+	cmd := exec.Command("go", "list", "-deps",
+		"-f", "{{if and .CgoFiles (not .Standard)}}{{.ImportPath}}{{end}}", ".", "../web")
+	cmd.Env = append(cmd.Environ(), "CGO_ENABLED=1")
+	out, err := cmd.Output()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, strings.TrimSpace(string(out)))
+
+	// 图片解码和 DNS 解析在不启用cgo时同样可用
+	cmd = exec.Command("go", "list", "-deps", ".", "../web")
+	cmd.Env = append(cmd.Environ(), "CGO_ENABLED=0", "GOOS=linux", "GOARCH=arm64")
+	out, err = cmd.CombinedOutput()
+	if assert.NoError(t, err, string(out)) {
+		assert.NotContains(t, strings.Fields(string(out)), "runtime/cgo")
+	}
+}
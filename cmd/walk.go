@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+)
+
+// folderWalker 遍历云空间文件夹，将其中的文档提交到下载流水线并计入报告
+type folderWalker struct {
+	client   core.API
+	pipeline *downloadPipeline
+	report   *BatchDownloadReport
+	names    *fileNamer
+	listed   map[string][]*lark.GetDriveFileListRespFile // 统计子目录层数时已列出的文件夹不再重复请求
+	depths   *dirDepth
+	guard    *traversalGuard
+}
+
+func newFolderWalker(client core.API, pipeline *downloadPipeline, report *BatchDownloadReport, names *fileNamer) *folderWalker {
+	w := &folderWalker{
+		client:   client,
+		pipeline: pipeline,
+		report:   report,
+		names:    names,
+		listed:   make(map[string][]*lark.GetDriveFileListRespFile),
+		guard:    newTraversalGuard(),
+	}
+	w.depths = newDirDepth(func(ctx context.Context, folderToken string) ([]string, error) {
+		files, err := w.list(ctx, folderToken)
+		var subdirs []string
+		for _, file := range files {
+			if file.Type == "folder" && !isExcludedDraft(file.Name) {
+				subdirs = append(subdirs, file.Token)
+			}
+		}
+		return subdirs, err
+	})
+	return w
+}
+
+func (w *folderWalker) list(ctx context.Context, folderToken string) ([]*lark.GetDriveFileListRespFile, error) {
+	if files, ok := w.listed[folderToken]; ok {
+		return files, nil
+	}
+	files, err := w.client.GetDriveFolderFileList(ctx, nil, &folderToken)
+	if err == nil {
+		w.listed[folderToken] = files
+	}
+	return files, err
+}
+
+// checkVisibility 指定 --include-hidden 而节点列表中没有可见性时提示一次，
+// 此时无法区分隐藏节点，所有节点都会导出
+func (w *wikiWalker) checkVisibility(nodes []*core.WikiNode) {
+	if !dlOpts.includeHidden || w.warned {
+		return
+	}
+	for _, n := range nodes {
+		if n.Hidden == nil {
+			warnf("Warning: the wiki node list does not tell the visibility of nodes, --include-hidden has no effect\n")
+			w.warned = true
+			return
+		}
+	}
+}
+
+// rootDir 返回parent下以文件夹名称命名的根目录
+func (w *folderWalker) rootDir(ctx context.Context, parent, name, folderToken string) (string, error) {
+	depth, err := w.depths.of(ctx, folderToken)
+	if err != nil {
+		return "", err
+	}
+	dirName, err := runPathBudget.dirName(parent, utils.SanitizeFileName(name), folderToken, depth)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, dirName), nil
+}
+
+// walk 递归遍历文件夹，子文件夹对应同名的子目录，depth 为该文件夹的层数，根为0
+func (w *folderWalker) walk(ctx context.Context, folderPath, folderToken string, tags []string, depth int) error {
+	if depth == 0 {
+		w.guard.visited[folderToken] = true
+	}
+	files, err := w.list(ctx, folderToken)
+	if err != nil {
+		return err
+	}
+	opts := dlOpts.forDir(folderPath)
+	opts.tags = tags
+	opts.names = w.names
+	for _, file := range files {
+		if isExcludedDraft(file.Name) {
+			w.report.ExcludedDrafts++
+			continue
+		}
+		if reason := w.guard.check(file.Token, depth+1); reason != "" {
+			skipNode(w.report, reason, file.Token, file.Name, folderPath, depth+1)
+			continue
+		}
+		if file.Type == "folder" {
+			dirDepth, err := w.depths.of(ctx, file.Token)
+			if err != nil {
+				return err
+			}
+			folderName, err := runPathBudget.dirName(folderPath, file.Name, file.Token, dirDepth)
+			if err != nil {
+				return err
+			}
+			subPath := filepath.Join(folderPath, folderName)
+			if err := w.walk(ctx, subPath, file.Token, appendTag(tags, file.Name), depth+1); err != nil {
+				return err
+			}
+		} else if (file.Type == docxType || isSheetType(file.Type)) && dlOpts.wantsType(file.Type) {
+			// concurrently download the document
+			w.names.claim(folderPath, file.Name, file.Token)
+			w.report.TotalFiles++
+			opts.objType = file.Type
+			w.pipeline.submit(file.URL, opts)
+		}
+	}
+	return nil
+}
+
+// wikiWalker 遍历知识空间，将其中的文档和上传的文件提交到下载流水线并计入报告
+type wikiWalker struct {
+	client    core.API
+	pipeline  *downloadPipeline
+	report    *BatchDownloadReport
+	names     *fileNamer
+	prefixURL string
+	spaceID   string
+	listed    map[string][]*core.WikiNode // 已列出的节点不再重复请求，""表示根节点
+	depths    *dirDepth
+	guard     *traversalGuard
+	permNodes []permissionNode // 遍历到的文档节点，用于导出权限快照
+	warned    bool             // 已提示节点列表中没有可见性
+}
+
+func newWikiWalker(client core.API, pipeline *downloadPipeline, report *BatchDownloadReport, names *fileNamer, prefixURL, spaceID string) *wikiWalker {
+	w := &wikiWalker{
+		client:    client,
+		pipeline:  pipeline,
+		report:    report,
+		names:     names,
+		prefixURL: prefixURL,
+		spaceID:   spaceID,
+		listed:    make(map[string][]*core.WikiNode),
+		guard:     newTraversalGuard(),
+	}
+	w.depths = newDirDepth(func(ctx context.Context, nodeToken string) ([]string, error) {
+		nodes, err := w.list(ctx, nodeToken)
+		var subdirs []string
+		for _, n := range nodes {
+			if n.HasChild && !isExcludedDraft(n.Title) && !isExcludedHidden(n) {
+				subdirs = append(subdirs, n.NodeToken)
+			}
+		}
+		return subdirs, err
+	})
+	return w
+}
+
+func (w *wikiWalker) list(ctx context.Context, parentNodeToken string) ([]*core.WikiNode, error) {
+	if nodes, ok := w.listed[parentNodeToken]; ok {
+		return nodes, nil
+	}
+	var parent *string
+	if parentNodeToken != "" {
+		parent = &parentNodeToken
+	}
+	nodes, err := w.client.GetWikiNodeList(ctx, w.spaceID, parent)
+	if err == nil {
+		w.listed[parentNodeToken] = nodes
+		w.checkVisibility(nodes)
+	}
+	return nodes, err
+}
+
+// rootDir 返回parent下以知识空间名称命名的根目录
+func (w *wikiWalker) rootDir(ctx context.Context, parent, name string) (string, error) {
+	depth, err := w.depths.of(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	dirName, err := runPathBudget.dirName(parent, utils.SanitizeFileName(name), w.spaceID, depth)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, dirName), nil
+}
+
+// walk 递归遍历parentNodeToken的子节点，有子节点的节点对应以标题命名的子目录，
+// depth 为parentNodeToken的层数，根为0
+func (w *wikiWalker) walk(ctx context.Context, folderPath string, parentNodeToken *string, tags []string, depth int) error {
+	parent := ""
+	if parentNodeToken != nil {
+		parent = *parentNodeToken
+	}
+	nodes, err := w.list(ctx, parent)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		// 对访客隐藏的节点及其子节点默认不导出
+		if isExcludedHidden(n) {
+			w.report.ExcludedHidden++
+			continue
+		}
+		// 草稿节点及其子节点都不导出，在其他过滤条件之后判断
+		if isExcludedDraft(n.Title) {
+			w.report.ExcludedDrafts++
+			continue
+		}
+		// 损坏的知识空间中子节点可能是已经遍历过的祖先节点
+		if reason := w.guard.check(n.NodeToken, depth+1); reason != "" {
+			skipNode(w.report, reason, n.NodeToken, n.Title, folderPath, depth+1)
+			continue
+		}
+
+		// 如果是有子文档的wiki节点，创建以标题命名的文件夹
+		if n.HasChild {
+			dirDepth, err := w.depths.of(ctx, n.NodeToken)
+			if err != nil {
+				return err
+			}
+			folderName, err := runPathBudget.dirName(folderPath, utils.SanitizeFileName(n.Title), n.NodeToken, dirDepth)
+			if err != nil {
+				return err
+			}
+			// 文件夹在写入其中的文档时才创建，子节点全部被过滤时不留下空目录
+			currentPath := filepath.Join(folderPath, folderName)
+
+			// 递归处理子节点
+			if err := w.walk(ctx, currentPath, &n.NodeToken, appendTag(tags, n.Title), depth+1); err != nil {
+				return err
+			}
+		}
+
+		// 如果是文档或上传的文件，下载它
+		if !dlOpts.wantsType(n.ObjType) {
+			continue
+		}
+		switch n.ObjType {
+		case docxType, sheetType, bitableType:
+			w.names.claim(folderPath, n.Title, n.ObjToken)
+		case fileNodeType:
+			if err := checkFileNode(n.Title); err != nil {
+				warnf("Skipped %s: %v\n", n.Title, err)
+				continue
+			}
+			claimFileNode(w.names, folderPath, n.Title, n.ObjToken)
+		default:
+			continue
+		}
+		w.permNodes = append(w.permNodes, permissionNode{
+			Title: n.Title, NodeToken: n.NodeToken, ObjToken: n.ObjToken, ObjType: n.ObjType,
+		})
+		opts := dlOpts.forDir(folderPath)
+		opts.tags = tags
+		opts.names = w.names
+		opts.objType = n.ObjType
+		w.report.TotalFiles++
+		w.pipeline.submit(w.prefixURL+"/wiki/"+n.NodeToken, opts)
+	}
+	return nil
+}
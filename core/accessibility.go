@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HTMLConfig controls the html written into the markdown, such as the
+// tables, the image tags and the galleries, for documents published as
+// html pages.
+type HTMLConfig struct {
+	// Accessibility fixes what basic accessibility checks flag: images get
+	// alt text, the first row of tables becomes a header row of <th
+	// scope="col"> cells and skipped heading levels are closed up. What was
+	// fixed or could not be is reported in Parser.Warnings.
+	Accessibility bool `json:"accessibility"`
+	// Lang is the language of the documents, such as "zh-CN", written to
+	// the default front matter as lang and available to its template.
+	Lang string `json:"lang"`
+}
+
+// DefaultImageAlt is the alt text of images without a caption when
+// output.html.accessibility is enabled.
+const DefaultImageAlt = "image"
+
+var langTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+func (conf *HTMLConfig) Validate() error {
+	if conf.Lang != "" && !langTag.MatchString(conf.Lang) {
+		return errors.Errorf("invalid output.html.lang %q, expect a language tag like \"zh-CN\"", conf.Lang)
+	}
+	return nil
+}
+
+// ImageAltText returns the alt text of an image with the caption, which
+// may be empty.
+func ImageAltText(caption string) string {
+	if caption == "" {
+		return DefaultImageAlt
+	}
+	return DefaultImageAlt + ": " + caption
+}
+
+func (p *Parser) warnf(format string, args ...interface{}) {
+	p.Warnings = append(p.Warnings, fmt.Sprintf(format, args...))
+}
+
+// fixHeadingLevel returns the level a heading is rendered at. With
+// accessibility a heading deeper than one level below the previous one is
+// promoted to close the gap, and none goes below h6 which markdown lacks.
+// The document title is the h1.
+func (p *Parser) fixHeadingLevel(text string, level int) int {
+	fixed := level
+	if fixed > p.lastHeadingLevel+1 {
+		fixed = p.lastHeadingLevel + 1
+	}
+	if fixed > 6 {
+		fixed = 6
+	}
+	if fixed != level {
+		p.warnf("heading %q skips from h%d to h%d, rendered as h%d", text, p.lastHeadingLevel, level, fixed)
+	}
+	p.lastHeadingLevel = fixed
+	return fixed
+}
+
+// tableCellTag returns the tag of a table cell, the cells of the first row
+// are column headers with accessibility.
+func (p *Parser) tableCellTag(rowIndex int, content string) (openTag, closeTag string) {
+	if !p.accessible || rowIndex > 0 {
+		return "<td", "</td>"
+	}
+	if strings.TrimSpace(strings.ReplaceAll(content, "<br/>", "")) == "" {
+		p.emptyHeaders++
+	}
+	return `<th scope="col"`, "</th>"
+}
+
+// accessibilityWarnings summarizes the fixes repeated for many elements
+// once the document is parsed.
+func (p *Parser) accessibilityWarnings() {
+	if !p.accessible {
+		return
+	}
+	if p.altlessImages > 0 {
+		p.warnf("%d images have no caption, their alt text is %q", p.altlessImages, DefaultImageAlt)
+	}
+	if p.emptyHeaders > 0 {
+		p.warnf("%d table header cells are empty and can not be announced", p.emptyHeaders)
+	}
+}
@@ -0,0 +1,89 @@
+package core_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// renderAccessibility parses the accessibility fixture, resolving the images
+// and restoring the galleries the way the download does before formatting.
+func renderAccessibility(t *testing.T, config core.OutputConfig) (string, *core.Parser) {
+	t.Helper()
+	doc, blocks := loadTestdocx(t, "testaccessibility")
+	parser := core.NewParser(config)
+	md := parser.ParseDocxContent(doc, blocks)
+	for _, token := range parser.ImgTokens {
+		md = parser.ResolveImage(md, token, "static/"+token+".png", 0, 0)
+	}
+	return parser.RestoreGalleries(md), parser
+}
+
+func TestParseAccessibility(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	config.GalleryTemplate = "html"
+	config.HTML = core.HTMLConfig{Accessibility: true, Lang: "en"}
+	assert.NoError(t, config.Validate())
+	md, parser := renderAccessibility(t, config)
+
+	goldenPath := path.Join(utils.RootDir(), "testdata", "testaccessibility.md")
+	if *updateGolden {
+		assert.NoError(t, os.WriteFile(goldenPath, []byte(md), 0o644))
+	}
+	expected, err := os.ReadFile(goldenPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), md)
+
+	// the h4 right after an h2 is promoted, the h3 after it is kept
+	assert.Contains(t, md, "\n### Details\n")
+	assert.Contains(t, md, "\n### Screenshots\n")
+	assert.Contains(t, md, "![image](static/boxcnA11yImage1.png)")
+	assert.Contains(t, md, `<th scope="col">Feature<br/></th>`)
+	assert.Contains(t, md, "<td>Export<br/></td>")
+	assert.Contains(t, md, `alt="image: Step 1"`)
+	assert.Contains(t, md, `alt="image"><`)
+	assert.Equal(t, []string{
+		`heading "Details" skips from h2 to h4, rendered as h3`,
+		`2 images have no caption, their alt text is "image"`,
+		"1 table header cells are empty and can not be announced",
+	}, parser.Warnings)
+}
+
+func TestParseAccessibilityDisabled(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	config.GalleryTemplate = "hugo"
+	md, parser := renderAccessibility(t, config)
+	assert.Contains(t, md, "\n#### Details\n")
+	assert.Contains(t, md, "![](static/boxcnA11yImage1.png)")
+	assert.NotContains(t, md, "<th")
+	assert.NotContains(t, md, "alt=")
+	assert.Empty(t, parser.Warnings)
+
+	config.HTML.Accessibility = true
+	md, _ = renderAccessibility(t, config)
+	assert.Contains(t, md, `figure src="static/boxcnA11yGallery1.png" alt="image: Step 1" caption="Step 1"`)
+	assert.Equal(t, 3, strings.Count(md, " alt="))
+}
+
+func TestAccessibilityLang(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	config.HTML.Lang = "zh_CN"
+	assert.Error(t, config.Validate())
+	config.HTML.Lang = "zh-CN"
+	assert.NoError(t, config.Validate())
+
+	config.FrontMatter = true
+	frontMatter, err := config.DocumentFrontMatter(core.DocumentMeta{Title: "A"})
+	assert.NoError(t, err)
+	assert.Contains(t, frontMatter, "lang: \"zh-CN\"\n")
+
+	config.FrontMatterTemplate = "lang: {{.Lang}}"
+	frontMatter, err = config.DocumentFrontMatter(core.DocumentMeta{Title: "A"})
+	assert.NoError(t, err)
+	assert.Equal(t, "---\nlang: zh-CN\n---\n\n", frontMatter)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+
+	"github.com/chyroc/lark"
+)
+
+// DocxAPI reads the content of docx documents.
+type DocxAPI interface {
+	GetDocxDocument(ctx context.Context, docToken string) (*lark.DocxDocument, error)
+	GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error)
+	GetDocxCover(ctx context.Context, docToken string) (string, error)
+	GetDocxListSequences(ctx context.Context, documentID string) (map[string]string, error)
+	GetDocxBoards(ctx context.Context, documentID string) (map[string]Board, error)
+}
+
+// WikiAPI walks wiki spaces.
+type WikiAPI interface {
+	GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWikiNodeRespNode, error)
+	GetWikiNodeByObj(ctx context.Context, objToken, objType string) (*lark.GetWikiNodeRespNode, error)
+	GetWikiName(ctx context.Context, spaceID string) (string, error)
+	GetWikiNodeList(ctx context.Context, spaceID string, parentNodeToken *string) ([]*WikiNode, error)
+	GetWikiSpace(ctx context.Context, spaceID string) (*lark.GetWikiSpaceRespSpace, error)
+	GetWikiSpaceList(ctx context.Context) ([]*lark.GetWikiSpaceListRespItem, error)
+	GetWikiSpaceMembers(ctx context.Context, spaceID string) ([]WikiSpaceMember, error)
+}
+
+// DriveAPI lists drive folders and reads file permissions.
+type DriveAPI interface {
+	GetDriveFolderFileList(ctx context.Context, pageToken *string, folderToken *string) ([]*lark.GetDriveFileListRespFile, error)
+	GetDriveFolderName(ctx context.Context, folderToken string) (string, error)
+	GetDocCollaborators(ctx context.Context, token, objType string) ([]*lark.GetDriveMemberPermissionListRespMember, error)
+	GetDocPublicPermission(ctx context.Context, token, objType string) (*lark.GetDrivePublicPermissionRespPermissionPublic, error)
+}
+
+// MediaAPI downloads images, attachments and uploaded files.
+type MediaAPI interface {
+	DownloadImage(ctx context.Context, imgToken, outDir string) (string, error)
+	DownloadImageRaw(ctx context.Context, imgToken, imgDir string) (string, []byte, error)
+	DownloadAttachment(ctx context.Context, fileToken, dir string, namer AttachmentNamer) (string, error)
+	DownloadBoardImage(ctx context.Context, boardToken, dir string) (string, error)
+	DownloadDriveFile(ctx context.Context, fileToken, path string, maxBytes int64) (int64, error)
+}
+
+// SheetAPI reads spreadsheets and bitables as displayed.
+type SheetAPI interface {
+	GetSheetContent(ctx context.Context, sheetToken string) (*Spreadsheet, error)
+	GetBitableRecords(ctx context.Context, appToken string) (*Spreadsheet, error)
+}
+
+// ContactAPI resolves user information.
+type ContactAPI interface {
+	GetUserName(ctx context.Context, openID string) (string, error)
+}
+
+// API is everything the exporter needs from a backend. Client implements it
+// with the lark open api; decorators such as WithMiddleware and
+// NewCachedAPI compose around any implementation.
+type API interface {
+	DocxAPI
+	WikiAPI
+	DriveAPI
+	MediaAPI
+	SheetAPI
+	ContactAPI
+}
+
+var _ API = (*Client)(nil)
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// AttachmentNamer returns the file name an attachment is saved under, given
+// its original file name and file token.
+type AttachmentNamer func(name, fileToken string) string
+
+// AttachmentName appends "~" with the tail of the file token before the
+// extension, so that attachments sharing a name never take each other's
+// file, whichever document is written first. The rest of the name is cut on
+// a rune boundary to fit maxBytes, 0 means no limit. Names falling back to
+// the token are already unique and stay as they are.
+func AttachmentName(name, fileToken string, maxBytes int) string {
+	if name == fileToken {
+		if maxBytes > 0 {
+			return utils.TruncateName(name, maxBytes, fileToken)
+		}
+		return name
+	}
+	ext := filepath.Ext(name)
+	tail := fileToken
+	if len(tail) > 6 {
+		tail = tail[len(tail)-6:]
+	}
+	suffix := "~" + tail + ext
+	stem := strings.TrimSuffix(name, ext)
+	if maxBytes > 0 && len(stem)+len(suffix) > maxBytes {
+		if maxBytes <= len(suffix) {
+			return utils.TruncateName(name, maxBytes, fileToken)
+		}
+		for len(stem)+len(suffix) > maxBytes {
+			_, size := utf8.DecodeLastRuneInString(stem)
+			stem = stem[:len(stem)-size]
+		}
+		// Windows does not allow names ending with a space or a dot
+		stem = strings.TrimRight(stem, " .")
+	}
+	return stem + suffix
+}
+
+// attachmentFileName takes the original file name from the
+// Content-Disposition header, falling back to the token.
+func attachmentFileName(header http.Header, fileToken string) string {
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		if name := utils.SanitizeFileName(filepath.Base(params["filename"])); name != "" && name != "." {
+			return name
+		}
+	}
+	return fileToken
+}
+
+// ErrFileTooLarge is returned by DownloadDriveFile for files over the size
+// limit, nothing is written for them.
+var ErrFileTooLarge = errors.New("file exceeds the size limit")
+
+func (c *Client) openMedia(ctx context.Context, fileToken string) (*http.Response, error) {
+	return c.openDownload(ctx, "/open-apis/drive/v1/medias/"+fileToken+"/download", "DownloadDriveMedia")
+}
+
+func (c *Client) openDownload(ctx context.Context, path, method string) (*http.Response, error) {
+	token, _, err := c.larkClient.Auth.GetTenantAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, openBaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var apiErr struct {
+		Code int64  `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Code != 0 {
+		return resp, lark.NewError("Drive", method, apiErr.Code, apiErr.Msg)
+	}
+	return resp, errors.Errorf("request fail: %s", resp.Status)
+}
+
+// callDownload opens a download through the rate limiter and retries.
+func (c *Client) callDownload(ctx context.Context, open func() (*http.Response, error)) (*http.Response, error) {
+	var resp *http.Response
+	err := c.call(ctx, func() (*lark.Response, error) {
+		var err error
+		resp, err = open()
+		if resp == nil {
+			return nil, err
+		}
+		return &lark.Response{StatusCode: resp.StatusCode, Header: resp.Header}, err
+	})
+	return resp, err
+}
+
+// DownloadAttachment streams the attachment into dir under the name given
+// by namer, without holding the whole file in memory. A nil namer uses
+// AttachmentName without limit.
+func (c *Client) DownloadAttachment(ctx context.Context, fileToken, dir string, namer AttachmentNamer) (string, error) {
+	resp, err := c.callDownload(ctx, func() (*http.Response, error) {
+		return c.openMedia(ctx, fileToken)
+	})
+	if err != nil {
+		return fileToken, err
+	}
+	defer resp.Body.Close()
+
+	name := attachmentFileName(resp.Header, fileToken)
+	if namer != nil {
+		name = namer(name, fileToken)
+	} else {
+		name = AttachmentName(name, fileToken, 0)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fileToken, err
+	}
+	// replace instead of writing through, the old file may be hard linked
+	if err := c.syncer.WriteReader(path, resp.Body, 0o644); err != nil {
+		return fileToken, err
+	}
+	return path, nil
+}
+
+// sizeReader counts the bytes read and fails once more than max are read,
+// so a file without Content-Length can not exceed the limit either.
+type sizeReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (s *sizeReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	if s.max > 0 && s.n > s.max {
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
+
+// DownloadDriveFile streams an uploaded drive file, such as a pdf pinned
+// into a wiki space, to path and returns its size. Files larger than
+// maxBytes fail with ErrFileTooLarge, 0 means no limit.
+func (c *Client) DownloadDriveFile(ctx context.Context, fileToken, path string, maxBytes int64) (int64, error) {
+	resp, err := c.callDownload(ctx, func() (*http.Response, error) {
+		return c.openDownload(ctx, "/open-apis/drive/v1/files/"+fileToken+"/download", "DownloadDriveFile")
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return resp.ContentLength, errors.Wrapf(ErrFileTooLarge, "%s has %d bytes", fileToken, resp.ContentLength)
+	}
+
+	body := &sizeReader{r: resp.Body, max: maxBytes}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	if err := c.syncer.WriteReader(path, body, 0o644); err != nil {
+		if errors.Is(err, ErrFileTooLarge) {
+			return body.n, errors.Wrapf(ErrFileTooLarge, "%s has more than %d bytes", fileToken, maxBytes)
+		}
+		return body.n, err
+	}
+	return body.n, nil
+}
@@ -0,0 +1,165 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+)
+
+// attachmentTransport serves every media as a file named by the
+// Content-Disposition header of the given token.
+type attachmentTransport struct {
+	names map[string]string // file token -> Content-Disposition
+}
+
+func (a *attachmentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.URL.Path, "tenant_access_token") {
+		return respond(http.StatusOK, `{"code":0,"tenant_access_token":"t","expire":7200}`), nil
+	}
+	if req.Header.Get("Authorization") != "Bearer t" {
+		return respond(http.StatusBadRequest, `{"code":99991661,"msg":"missing access token"}`), nil
+	}
+	token := filepath.Base(filepath.Dir(req.URL.Path))
+	disposition, ok := a.names[token]
+	if !ok {
+		return respond(http.StatusNotFound, `{"code":1061004,"msg":"file not found"}`), nil
+	}
+	resp := respond(http.StatusOK, "content of "+token)
+	resp.Header.Set("Content-Type", "application/octet-stream")
+	resp.Header.Set("Content-Disposition", disposition)
+	return resp, nil
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	transport := &attachmentTransport{names: map[string]string{
+		"boxcnAAAAAA1": `attachment; filename="report.pdf"`,
+		"boxcnBBBBBB2": `attachment; filename="report.pdf"`,
+		"boxcnCCCCCC3": `attachment; filename*=UTF-8''%E5%91%A8%E6%8A%A5.zip`,
+		"boxcnDDDDDD4": `attachment`,
+	}}
+	client := core.NewClient("id", "secret",
+		core.WithHTTPClient(&http.Client{Transport: transport}),
+		core.WithRateLimit(0),
+		core.WithRetry(0, time.Millisecond),
+	)
+	dir := t.TempDir()
+	download := func(token string) string {
+		t.Helper()
+		path, err := client.DownloadAttachment(context.Background(), token, dir, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != "content of "+token {
+			t.Errorf("unexpected content %q of %s: %v", data, path, err)
+		}
+		return filepath.Base(path)
+	}
+
+	tests := []struct {
+		token string
+		name  string
+	}{
+		// the tail of the token keeps attachments with the same name apart
+		{"boxcnBBBBBB2", "report~BBBBB2.pdf"},
+		{"boxcnAAAAAA1", "report~AAAAA1.pdf"},
+		{"boxcnAAAAAA1", "report~AAAAA1.pdf"},
+		{"boxcnCCCCCC3", "周报~CCCCC3.zip"},
+		{"boxcnDDDDDD4", "boxcnDDDDDD4"},
+	}
+	for _, tt := range tests {
+		if name := download(tt.token); name != tt.name {
+			t.Errorf("expected %s to be saved as %s, got %s", tt.token, tt.name, name)
+		}
+	}
+
+	if _, err := client.DownloadAttachment(context.Background(), "boxcnMissing", dir, nil); err == nil ||
+		!strings.Contains(err.Error(), "1061004") {
+		t.Errorf("expected the api error, got %v", err)
+	}
+}
+
+func TestAttachmentName(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int
+		expected string
+	}{
+		{"report.pdf", 0, "report~AAAAA1.pdf"},
+		{"report.pdf", 17, "report~AAAAA1.pdf"},
+		// the extension and the token tail survive the truncation
+		{"report.pdf", 15, "repo~AAAAA1.pdf"},
+		{"周报 汇总.pdf", 18, "周报~AAAAA1.pdf"},
+		{"boxcnAAAAAA1", 0, "boxcnAAAAAA1"},
+		// the extension does not fit, the name is truncated as a whole
+		{"report.pdf", 8, "r~AAAAA1"},
+	}
+	for _, tt := range tests {
+		if name := core.AttachmentName(tt.name, "boxcnAAAAAA1", tt.maxBytes); name != tt.expected {
+			t.Errorf("expected %s within %d bytes to be %s, got %s", tt.name, tt.maxBytes, tt.expected, name)
+		}
+	}
+}
+
+func TestDownloadDriveFile(t *testing.T) {
+	transport := &attachmentTransport{names: map[string]string{
+		"boxcnUpload1": `attachment; filename="slides.pptx"`,
+	}}
+	client := core.NewClient("id", "secret",
+		core.WithHTTPClient(&http.Client{Transport: transport}),
+		core.WithRateLimit(0),
+		core.WithRetry(0, time.Millisecond),
+	)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nested", "slides.pptx")
+	size, err := client.DownloadDriveFile(context.Background(), "boxcnUpload1", path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "content of boxcnUpload1" || size != int64(len(data)) {
+		t.Errorf("unexpected content %q (%d bytes) of %s: %v", data, size, path, err)
+	}
+
+	// over the limit nothing is written
+	tooLarge := filepath.Join(dir, "too-large.pptx")
+	if _, err := client.DownloadDriveFile(context.Background(), "boxcnUpload1", tooLarge, 4); !errors.Is(err, core.ErrFileTooLarge) {
+		t.Errorf("expected ErrFileTooLarge, got %v", err)
+	}
+	if _, err := os.Stat(tooLarge); !os.IsNotExist(err) {
+		t.Errorf("expected %s not to be written, got %v", tooLarge, err)
+	}
+}
+
+func TestParseDocxBlockFile(t *testing.T) {
+	doc := &lark.DocxDocument{DocumentID: "doc"}
+	blocks := []*lark.DocxBlock{
+		{BlockID: "doc", BlockType: lark.DocxBlockTypePage, Children: []string{"view"},
+			Page: &lark.DocxBlockText{Elements: []*lark.DocxTextElement{
+				{TextRun: &lark.DocxTextElementTextRun{Content: "Title"}},
+			}}},
+		{BlockID: "view", BlockType: lark.DocxBlockTypeView, ParentID: "doc", Children: []string{"file"},
+			View: &lark.DocxBlockView{}},
+		{BlockID: "file", BlockType: lark.DocxBlockTypeFile, ParentID: "view",
+			File: &lark.DocxBlockFile{Token: "boxcnFile", Name: "[draft] report.pdf"}},
+	}
+	parser := core.NewParser(core.NewConfig("", "").Output)
+	markdown := parser.ParseDocxContent(doc, blocks)
+	if !strings.Contains(markdown, `[\[draft\] report.pdf](boxcnFile)`) {
+		t.Errorf("unexpected markdown %q", markdown)
+	}
+	if len(parser.FileTokens) != 1 || parser.FileTokens[0] != "boxcnFile" {
+		t.Errorf("unexpected file tokens %v", parser.FileTokens)
+	}
+	markdown = parser.ResolveFile(markdown, "boxcnFile", "./files/[draft] report.pdf")
+	if !strings.Contains(markdown, `(<./files/[draft] report.pdf>)`) {
+		t.Errorf("unexpected resolved markdown %q", markdown)
+	}
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chyroc/lark"
+)
+
+// DocxBlockTypeBoard is the board block ("画板"), which the sdk does not
+// declare. Its data only reaches the parser through SetBoards.
+const DocxBlockTypeBoard lark.DocxBlockType = 43
+
+// Board is a board block of a document. DrawIO holds the draw.io xml found
+// in the block data, empty when the block only has the whiteboard token.
+type Board struct {
+	Token  string
+	DrawIO string
+}
+
+type getDocxBoardsResp struct {
+	Code int64  `json:"code,omitempty"`
+	Msg  string `json:"msg,omitempty"`
+	Data struct {
+		Items []struct {
+			BlockID   string                     `json:"block_id"`
+			BlockType lark.DocxBlockType         `json:"block_type"`
+			Board     map[string]json.RawMessage `json:"board"`
+		} `json:"items"`
+		PageToken string `json:"page_token"`
+		HasMore   bool   `json:"has_more"`
+	} `json:"data"`
+}
+
+// GetDocxBoards returns the board blocks of the document by block id. The
+// lark sdk drops the board data, so the blocks are listed again directly.
+// Any string of the board data holding a draw.io diagram is kept as its
+// editable source.
+func (c *Client) GetDocxBoards(ctx context.Context, documentID string) (map[string]Board, error) {
+	boards := make(map[string]Board)
+	var pageToken *string
+	for {
+		resp := new(getDocxBoardsResp)
+		err := c.call(ctx, func() (*lark.Response, error) {
+			response, err := c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+				Scope:                 "Drive",
+				API:                   "GetDocxBlockListOfDocument",
+				Method:                "GET",
+				URL:                   openBaseURL + "/open-apis/docx/v1/documents/:document_id/blocks",
+				Body:                  &getDocxListSequencesReq{DocumentID: documentID, PageToken: pageToken},
+				NeedTenantAccessToken: true,
+			}, resp)
+			if err == nil {
+				err = codeError("GetDocxBlockListOfDocument", resp.Code, resp.Msg)
+			}
+			return response, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Data.Items {
+			if item.BlockType != DocxBlockTypeBoard || item.Board == nil {
+				continue
+			}
+			board := Board{}
+			json.Unmarshal(item.Board["token"], &board.Token)
+			if board.Token == "" {
+				continue
+			}
+			for key, value := range item.Board {
+				var s string
+				if key != "token" && json.Unmarshal(value, &s) == nil && isDrawIO(s) {
+					board.DrawIO = s
+					break
+				}
+			}
+			boards[item.BlockID] = board
+		}
+		if !resp.Data.HasMore {
+			break
+		}
+		pageToken = &resp.Data.PageToken
+	}
+	return boards, nil
+}
+
+// isDrawIO tells the xml of a draw.io file or of a bare diagram model.
+func isDrawIO(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "<mxfile") || strings.HasPrefix(s, "<mxGraphModel")
+}
+
+// DownloadBoardImage saves the board rendered as a png image into dir,
+// named by the whiteboard token.
+func (c *Client) DownloadBoardImage(ctx context.Context, boardToken, dir string) (string, error) {
+	resp, err := c.callDownload(ctx, func() (*http.Response, error) {
+		return c.openDownload(ctx, "/open-apis/board/v1/whiteboards/"+boardToken+"/download_as_image", "DownloadBoardImage")
+	})
+	if err != nil {
+		return boardToken, err
+	}
+	defer resp.Body.Close()
+
+	path := filepath.Join(dir, boardToken+".png")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return boardToken, err
+	}
+	// replace instead of writing through, the old file may be hard linked
+	if err := c.syncer.WriteReader(path, resp.Body, 0o644); err != nil {
+		return boardToken, err
+	}
+	return path, nil
+}
+
+// SetBoards gives the parser the board blocks returned by GetDocxBoards.
+// Without them board blocks are dropped.
+func (p *Parser) SetBoards(boards map[string]Board) {
+	p.boards = boards
+}
+
+// ParseDocxBlockBoard renders the board as an image linked to its token,
+// replaced by ResolveBoard once the image is downloaded.
+func (p *Parser) ParseDocxBlockBoard(board Board) string {
+	p.Boards = append(p.Boards, board)
+	return p.RenderImage(board.Token, 0, 0) + "\n"
+}
+
+// ResolveBoard replaces the board token with the link of its image, followed
+// by an html comment naming the editable draw.io file when there is one. An
+// empty link removes the board.
+func (p *Parser) ResolveBoard(markdown, token, link, drawIOLink string) string {
+	placeholder := p.RenderImage(token, 0, 0)
+	if link == "" {
+		return strings.Replace(markdown, placeholder+"\n", "", 1)
+	}
+	image := p.RenderImage(link, 0, 0)
+	if drawIOLink != "" {
+		image += fmt.Sprintf("\n\n<!-- editable draw.io source: %s -->", drawIOLink)
+	}
+	return strings.Replace(markdown, placeholder, image, 1)
+}
@@ -0,0 +1,51 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDocxBoards(t *testing.T) {
+	client := newSheetClient(map[string]string{
+		"/open-apis/docx/v1/documents/doxcn1/blocks": `{"code":0,"data":{"has_more":false,"items":[
+			{"block_id":"doxcn1","block_type":1,"children":["b1","b2"]},
+			{"block_id":"b1","block_type":43,"board":{"token":"brdFlow","align":2,"source":"<mxfile><diagram/></mxfile>"}},
+			{"block_id":"b2","block_type":43,"board":{"token":"brdSketch","align":2}},
+			{"block_id":"b3","block_type":2,"text":{"elements":[]}}]}}`,
+	})
+	boards, err := client.GetDocxBoards(context.Background(), "doxcn1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]core.Board{
+			"b1": {Token: "brdFlow", DrawIO: "<mxfile><diagram/></mxfile>"},
+			"b2": {Token: "brdSketch"},
+		}, boards)
+	}
+}
+
+func TestParseDocxBlockBoard(t *testing.T) {
+	doc := &lark.DocxDocument{DocumentID: "doc"}
+	blocks := []*lark.DocxBlock{
+		{BlockID: "doc", BlockType: lark.DocxBlockTypePage, Children: []string{"b1", "b2"},
+			Page: &lark.DocxBlockText{}},
+		{BlockID: "b1", BlockType: core.DocxBlockTypeBoard, ParentID: "doc"},
+		{BlockID: "b2", BlockType: core.DocxBlockTypeBoard, ParentID: "doc"},
+	}
+
+	// without the board data the blocks are dropped as before
+	parser := core.NewParser(core.NewConfig("", "").Output)
+	assert.NotContains(t, parser.ParseDocxContent(doc, blocks), "![")
+	assert.Equal(t, 2, parser.Quality().Dropped)
+
+	parser = core.NewParser(core.NewConfig("", "").Output)
+	parser.SetBoards(map[string]core.Board{"b1": {Token: "brdFlow", DrawIO: "<mxfile/>"}, "b2": {Token: "brdSketch"}})
+	md := parser.ParseDocxContent(doc, blocks)
+	assert.Equal(t, []core.Board{{Token: "brdFlow", DrawIO: "<mxfile/>"}, {Token: "brdSketch"}}, parser.Boards)
+	md = parser.ResolveBoard(md, "brdFlow", "static/brdFlow.png", "static/brdFlow.drawio")
+	md = parser.ResolveBoard(md, "brdSketch", "", "")
+	assert.Contains(t, md, "![](static/brdFlow.png)\n\n<!-- editable draw.io source: static/brdFlow.drawio -->")
+	assert.NotContains(t, md, "brdSketch")
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"sync"
+
+	"github.com/chyroc/lark"
+)
+
+// cachedAPI remembers the metadata lookups that are repeated while walking
+// a space. Document content is not cached to keep memory bounded.
+type cachedAPI struct {
+	API
+	mu        sync.Mutex
+	wikiNodes map[string]*lark.GetWikiNodeRespNode
+	wikiNames map[string]string
+}
+
+// NewCachedAPI returns an API caching successful wiki node and space name
+// lookups of api.
+func NewCachedAPI(api API) API {
+	return &cachedAPI{
+		API:       api,
+		wikiNodes: make(map[string]*lark.GetWikiNodeRespNode),
+		wikiNames: make(map[string]string),
+	}
+}
+
+func (a *cachedAPI) GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWikiNodeRespNode, error) {
+	a.mu.Lock()
+	node, ok := a.wikiNodes[token]
+	a.mu.Unlock()
+	if ok {
+		return node, nil
+	}
+	node, err := a.API.GetWikiNodeInfo(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.wikiNodes[token] = node
+	a.mu.Unlock()
+	return node, nil
+}
+
+func (a *cachedAPI) GetWikiName(ctx context.Context, spaceID string) (string, error) {
+	a.mu.Lock()
+	name, ok := a.wikiNames[spaceID]
+	a.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+	name, err := a.API.GetWikiName(ctx, spaceID)
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	a.wikiNames[spaceID] = name
+	a.mu.Unlock()
+	return name, nil
+}
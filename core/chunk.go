@@ -0,0 +1,175 @@
+package core
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chyroc/lark"
+)
+
+// ChunkOptions limits the size of the chunks produced for LLM ingestion.
+type ChunkOptions struct {
+	MaxTokens int
+	// CharsPerToken is the heuristic used to estimate the token count,
+	// around 4 for english and 1.5 for chinese text.
+	CharsPerToken float64
+}
+
+// Chunk is a piece of a document under one heading path. BlockID is the
+// block the chunk starts at, which can be used as the anchor of the url.
+type Chunk struct {
+	HeadingPath []string `json:"heading_path"`
+	Text        string   `json:"text"`
+	BlockID     string   `json:"block_id"`
+	Tokens      int      `json:"tokens"`
+}
+
+// EstimateTokens approximates the token count by the number of characters.
+func EstimateTokens(text string, charsPerToken float64) int {
+	if charsPerToken <= 0 {
+		charsPerToken = 1
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / charsPerToken))
+}
+
+type chunkParagraph struct {
+	blockID string
+	text    string
+}
+
+// ParseDocxChunks splits the plain text of the document on heading
+// boundaries, then by paragraph when a section exceeds the token limit. The
+// heading path starts with the document title.
+func (t *TextParser) ParseDocxChunks(doc *lark.DocxDocument, blocks []*lark.DocxBlock, opts ChunkOptions) []Chunk {
+	t.index(blocks)
+	entryBlock := t.parser.blockMap[doc.DocumentID]
+	if entryBlock == nil {
+		return nil
+	}
+
+	c := &chunker{opts: opts, path: []string{doc.Title}, levels: []int{0}}
+	t.parser.walkChunks(c, entryBlock.Children)
+	c.flush()
+	return c.chunks
+}
+
+// walkChunks renders the blocks between the headings as plain text.
+func (p *Parser) walkChunks(c *chunker, children []string) {
+	for _, childId := range children {
+		b := p.blockMap[childId]
+		if b == nil {
+			continue
+		}
+		if b.BlockType >= lark.DocxBlockTypeHeading1 && b.BlockType <= lark.DocxBlockTypeHeading9 {
+			level := headingLevel(b.BlockType)
+			c.flush()
+			c.enterHeading(level, strings.TrimSpace(p.plainInline(docxHeadingText(b, level))))
+			c.anchor = b.BlockID
+			p.walkChunks(c, b.Children)
+			continue
+		}
+		text := strings.TrimSpace(p.ParseDocxBlock(b, 0))
+		if text != "" {
+			c.paragraphs = append(c.paragraphs, chunkParagraph{blockID: b.BlockID, text: text})
+		}
+	}
+}
+
+type chunker struct {
+	opts       ChunkOptions
+	path       []string
+	levels     []int
+	anchor     string // the heading of the current section, empty before any
+	paragraphs []chunkParagraph
+	chunks     []Chunk
+}
+
+func (c *chunker) enterHeading(level int, title string) {
+	for len(c.levels) > 1 && c.levels[len(c.levels)-1] >= level {
+		c.levels = c.levels[:len(c.levels)-1]
+		c.path = c.path[:len(c.path)-1]
+	}
+	c.levels = append(c.levels, level)
+	c.path = append(c.path, title)
+}
+
+// flush packs the paragraphs of the current section into chunks.
+func (c *chunker) flush() {
+	if len(c.paragraphs) == 0 {
+		return
+	}
+	path := append([]string(nil), c.path...)
+	var texts []string
+	blockID := c.anchor
+	emit := func() {
+		if len(texts) == 0 {
+			return
+		}
+		text := strings.Join(texts, "\n\n")
+		c.chunks = append(c.chunks, Chunk{
+			HeadingPath: path,
+			Text:        text,
+			BlockID:     blockID,
+			Tokens:      EstimateTokens(text, c.opts.CharsPerToken),
+		})
+		texts = nil
+	}
+	for _, para := range c.paragraphs {
+		for _, piece := range c.splitParagraph(para.text) {
+			candidate := strings.Join(append(texts, piece), "\n\n")
+			if len(texts) > 0 && c.exceeds(candidate) {
+				emit()
+				blockID = para.blockID
+			}
+			if blockID == "" {
+				blockID = para.blockID
+			}
+			texts = append(texts, piece)
+		}
+	}
+	emit()
+	c.paragraphs = nil
+}
+
+func (c *chunker) exceeds(text string) bool {
+	return c.opts.MaxTokens > 0 && EstimateTokens(text, c.opts.CharsPerToken) > c.opts.MaxTokens
+}
+
+// splitParagraph cuts a paragraph larger than the limit by lines, and by
+// characters for a single overlong line.
+func (c *chunker) splitParagraph(text string) []string {
+	if !c.exceeds(text) {
+		return []string{text}
+	}
+	maxChars := int(float64(c.opts.MaxTokens) * c.opts.CharsPerToken)
+	if maxChars < 1 {
+		maxChars = 1
+	}
+	var pieces []string
+	cur := new(strings.Builder)
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		for len(runes) > maxChars {
+			if cur.Len() > 0 {
+				pieces = append(pieces, cur.String())
+				cur.Reset()
+			}
+			pieces = append(pieces, string(runes[:maxChars]))
+			runes = runes[maxChars:]
+		}
+		line = string(runes)
+		if cur.Len() > 0 && utf8.RuneCountInString(cur.String())+1+len(runes) > maxChars {
+			pieces = append(pieces, cur.String())
+			cur.Reset()
+		}
+		if cur.Len() > 0 {
+			cur.WriteString("\n")
+		}
+		cur.WriteString(line)
+	}
+	if cur.Len() > 0 {
+		pieces = append(pieces, cur.String())
+	}
+	return pieces
+}
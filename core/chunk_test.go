@@ -0,0 +1,42 @@
+package core_test
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDocxChunks(t *testing.T) {
+	doc, blocks := loadTestdocx(t, "testdocx.1")
+	opts := core.ChunkOptions{MaxTokens: 200, CharsPerToken: 2}
+	chunks := core.NewTextParser(false).ParseDocxChunks(doc, blocks, opts)
+
+	data, err := json.MarshalIndent(chunks, "", "  ")
+	assert.NoError(t, err)
+	goldenPath := path.Join(utils.RootDir(), "testdata", "testdocx.1.chunks.json")
+	if *updateGolden {
+		assert.NoError(t, os.WriteFile(goldenPath, data, 0o644))
+	}
+	expected, err := os.ReadFile(goldenPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(data))
+
+	for _, chunk := range chunks {
+		assert.Equal(t, doc.Title, chunk.HeadingPath[0])
+		assert.NotEmpty(t, chunk.BlockID)
+		assert.LessOrEqual(t, chunk.Tokens, opts.MaxTokens)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 3, core.EstimateTokens("abcdefghij", 4))
+	assert.Equal(t, 2, core.EstimateTokens("飞书文档", 2))
+	assert.Equal(t, 0, core.EstimateTokens("", 2))
+	assert.Equal(t, 5, core.EstimateTokens(strings.Repeat("a", 5), 0))
+}
@@ -4,33 +4,107 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/Wsine/feishu2md/utils"
 	"github.com/chyroc/lark"
-	"github.com/chyroc/lark_rate_limiter"
+	"golang.org/x/time/rate"
 )
 
+const openBaseURL = "https://open.feishu.cn"
+
+// Client sends every request through a rate limiter and retries the ones
+// hitting the frequency limit.
 type Client struct {
-	larkClient *lark.Lark
+	larkClient     *lark.Lark
+	httpClient     *http.Client // streams attachments, which the sdk would buffer
+	limiter        *rate.Limiter
+	maxRetries     int
+	retryBaseDelay time.Duration
+	syncer         *utils.Syncer
+	sheetFormulas  bool
+}
+
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	httpClient     *http.Client
+	rateLimit      float64
+	maxRetries     int
+	retryBaseDelay time.Duration
+	syncer         *utils.Syncer
+	sheetFormulas  bool
+}
+
+// WithHTTPClient makes every request of the client, including media
+// downloads, go through the given http client.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(o *clientOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithSyncer flushes the downloaded images and attachments with the given
+// syncer, nil leaves it to the operating system.
+func WithSyncer(syncer *utils.Syncer) ClientOption {
+	return func(o *clientOptions) {
+		o.syncer = syncer
+	}
+}
+
+// WithSheetFormulas makes GetSheetContent also read the formula of every
+// cell, which doubles the value requests.
+func WithSheetFormulas(enabled bool) ClientOption {
+	return func(o *clientOptions) {
+		o.sheetFormulas = enabled
+	}
 }
 
-func NewClient(appID, appSecret string) *Client {
+func NewClient(appID, appSecret string, opts ...ClientOption) *Client {
+	options := &clientOptions{
+		rateLimit:      defaultRateLimit,
+		maxRetries:     defaultMaxRetries,
+		retryBaseDelay: defaultRetryBaseDelay,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	larkOpts := []lark.ClientOptionFunc{
+		lark.WithAppCredential(appID, appSecret),
+		lark.WithTimeout(60 * time.Second),
+	}
+	httpClient := http.DefaultClient
+	if options.httpClient != nil {
+		larkOpts = append(larkOpts, lark.WithNetHttpClient(options.httpClient))
+		httpClient = options.httpClient
+	}
 	return &Client{
-		larkClient: lark.New(
-			lark.WithAppCredential(appID, appSecret),
-			lark.WithTimeout(60*time.Second),
-			lark.WithApiMiddleware(lark_rate_limiter.Wait(4, 4)),
-		),
+		larkClient:     lark.New(larkOpts...),
+		httpClient:     httpClient,
+		syncer:         options.syncer,
+		sheetFormulas:  options.sheetFormulas,
+		limiter:        newRateLimiter(options.rateLimit),
+		maxRetries:     options.maxRetries,
+		retryBaseDelay: options.retryBaseDelay,
 	}
 }
 
-func (c *Client) DownloadImage(ctx context.Context, imgToken, outDir string) (string, error) {
-	resp, _, err := c.larkClient.Drive.DownloadDriveMedia(ctx, &lark.DownloadDriveMediaReq{
-		FileToken: imgToken,
+func (c *Client) downloadMedia(ctx context.Context, imgToken string) (*lark.DownloadDriveMediaResp, error) {
+	var resp *lark.DownloadDriveMediaResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		resp, response, err = c.larkClient.Drive.DownloadDriveMedia(ctx, &lark.DownloadDriveMediaReq{
+			FileToken: imgToken,
+		})
+		return response, err
 	})
+	return resp, err
+}
+
+func (c *Client) DownloadImage(ctx context.Context, imgToken, outDir string) (string, error) {
+	resp, err := c.downloadMedia(ctx, imgToken)
 	if err != nil {
 		return imgToken, err
 	}
@@ -40,12 +114,8 @@ func (c *Client) DownloadImage(ctx context.Context, imgToken, outDir string) (st
 	if err != nil {
 		return imgToken, err
 	}
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0o666)
-	if err != nil {
-		return imgToken, err
-	}
-	defer file.Close()
-	_, err = io.Copy(file, resp.File)
+	// replace instead of writing through, the old file may be hard linked
+	err = c.syncer.WriteReader(filename, resp.File, 0o644)
 	if err != nil {
 		return imgToken, err
 	}
@@ -53,9 +123,7 @@ func (c *Client) DownloadImage(ctx context.Context, imgToken, outDir string) (st
 }
 
 func (c *Client) DownloadImageRaw(ctx context.Context, imgToken, imgDir string) (string, []byte, error) {
-	resp, _, err := c.larkClient.Drive.DownloadDriveMedia(ctx, &lark.DownloadDriveMediaReq{
-		FileToken: imgToken,
-	})
+	resp, err := c.downloadMedia(ctx, imgToken)
 	if err != nil {
 		return imgToken, nil, err
 	}
@@ -66,24 +134,41 @@ func (c *Client) DownloadImageRaw(ctx context.Context, imgToken, imgDir string)
 	return filename, buf.Bytes(), nil
 }
 
-func (c *Client) GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error) {
-	resp, _, err := c.larkClient.Drive.GetDocxDocument(ctx, &lark.GetDocxDocumentReq{
-		DocumentID: docToken,
+// GetDocxDocument returns the document meta without its blocks, which is
+// enough to learn the current revision.
+func (c *Client) GetDocxDocument(ctx context.Context, docToken string) (*lark.DocxDocument, error) {
+	var resp *lark.GetDocxDocumentResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		resp, response, err = c.larkClient.Drive.GetDocxDocument(ctx, &lark.GetDocxDocumentReq{
+			DocumentID: docToken,
+		})
+		return response, err
 	})
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	docx := &lark.DocxDocument{
+	return &lark.DocxDocument{
 		DocumentID: resp.Document.DocumentID,
 		RevisionID: resp.Document.RevisionID,
 		Title:      resp.Document.Title,
+	}, nil
+}
+
+func (c *Client) GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error) {
+	docx, err := c.GetDocxDocument(ctx, docToken)
+	if err != nil {
+		return nil, nil, err
 	}
 	var blocks []*lark.DocxBlock
 	var pageToken *string
 	for {
-		resp2, _, err := c.larkClient.Drive.GetDocxBlockListOfDocument(ctx, &lark.GetDocxBlockListOfDocumentReq{
-			DocumentID: docx.DocumentID,
-			PageToken:  pageToken,
+		var resp2 *lark.GetDocxBlockListOfDocumentResp
+		err := c.call(ctx, func() (response *lark.Response, err error) {
+			resp2, response, err = c.larkClient.Drive.GetDocxBlockListOfDocument(ctx, &lark.GetDocxBlockListOfDocumentReq{
+				DocumentID: docx.DocumentID,
+				PageToken:  pageToken,
+			})
+			return response, err
 		})
 		if err != nil {
 			return docx, nil, err
@@ -97,9 +182,118 @@ func (c *Client) GetDocxContent(ctx context.Context, docToken string) (*lark.Doc
 	return docx, blocks, nil
 }
 
+type getDocxCoverReq struct {
+	DocumentID string `path:"document_id" json:"-"`
+}
+
+type getDocxCoverResp struct {
+	Code int64  `json:"code,omitempty"`
+	Msg  string `json:"msg,omitempty"`
+	Data struct {
+		Document struct {
+			Cover *struct {
+				Token string `json:"token"`
+			} `json:"cover"`
+		} `json:"document"`
+	} `json:"data"`
+}
+
+// GetDocxCover returns the media token of the document cover, or an empty
+// string when the document has none. The lark sdk does not expose the cover
+// field yet, so the document meta is requested directly.
+func (c *Client) GetDocxCover(ctx context.Context, docToken string) (string, error) {
+	resp := new(getDocxCoverResp)
+	err := c.call(ctx, func() (*lark.Response, error) {
+		response, err := c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+			Scope:                 "Drive",
+			API:                   "GetDocxDocument",
+			Method:                "GET",
+			URL:                   openBaseURL + "/open-apis/docx/v1/documents/:document_id",
+			Body:                  &getDocxCoverReq{DocumentID: docToken},
+			NeedTenantAccessToken: true,
+		}, resp)
+		if err == nil {
+			err = codeError("GetDocxDocument", resp.Code, resp.Msg)
+		}
+		return response, err
+	})
+	if err != nil {
+		return "", err
+	}
+	if cover := resp.Data.Document.Cover; cover != nil {
+		return cover.Token, nil
+	}
+	return "", nil
+}
+
+type getDocxListSequencesReq struct {
+	DocumentID string  `path:"document_id" json:"-"`
+	PageToken  *string `query:"page_token" json:"-"`
+}
+
+type getDocxListSequencesResp struct {
+	Code int64  `json:"code,omitempty"`
+	Msg  string `json:"msg,omitempty"`
+	Data struct {
+		Items []struct {
+			BlockID string `json:"block_id"`
+			Ordered *struct {
+				Style struct {
+					Sequence string `json:"sequence"`
+				} `json:"style"`
+			} `json:"ordered"`
+		} `json:"items"`
+		PageToken string `json:"page_token"`
+		HasMore   bool   `json:"has_more"`
+	} `json:"data"`
+}
+
+// GetDocxListSequences returns the sequence of the ordered list blocks of
+// the document by block id, such as "37" for an item numbered explicitly or
+// "auto" for one continuing the list. The lark sdk does not expose the
+// field yet, so the blocks are listed again directly.
+func (c *Client) GetDocxListSequences(ctx context.Context, documentID string) (map[string]string, error) {
+	sequences := make(map[string]string)
+	var pageToken *string
+	for {
+		resp := new(getDocxListSequencesResp)
+		err := c.call(ctx, func() (*lark.Response, error) {
+			response, err := c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+				Scope:                 "Drive",
+				API:                   "GetDocxBlockListOfDocument",
+				Method:                "GET",
+				URL:                   openBaseURL + "/open-apis/docx/v1/documents/:document_id/blocks",
+				Body:                  &getDocxListSequencesReq{DocumentID: documentID, PageToken: pageToken},
+				NeedTenantAccessToken: true,
+			}, resp)
+			if err == nil {
+				err = codeError("GetDocxBlockListOfDocument", resp.Code, resp.Msg)
+			}
+			return response, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Data.Items {
+			if item.Ordered != nil && item.Ordered.Style.Sequence != "" {
+				sequences[item.BlockID] = item.Ordered.Style.Sequence
+			}
+		}
+		if !resp.Data.HasMore {
+			break
+		}
+		pageToken = &resp.Data.PageToken
+	}
+	return sequences, nil
+}
+
 func (c *Client) GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWikiNodeRespNode, error) {
-	resp, _, err := c.larkClient.Drive.GetWikiNode(ctx, &lark.GetWikiNodeReq{
-		Token: token,
+	var resp *lark.GetWikiNodeResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		resp, response, err = c.larkClient.Drive.GetWikiNode(ctx, &lark.GetWikiNodeReq{
+			Token: token,
+		})
+		return response, err
 	})
 	if err != nil {
 		return nil, err
@@ -107,23 +301,64 @@ func (c *Client) GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWi
 	return resp.Node, nil
 }
 
-func (c *Client) GetDriveFolderFileList(ctx context.Context, pageToken *string, folderToken *string) ([]*lark.GetDriveFileListRespFile, error) {
-	resp, _, err := c.larkClient.Drive.GetDriveFileList(ctx, &lark.GetDriveFileListReq{
-		PageSize:    nil,
-		PageToken:   pageToken,
-		FolderToken: folderToken,
+type getWikiNodeByObjReq struct {
+	Token   string `query:"token" json:"-"`
+	ObjType string `query:"obj_type" json:"-"`
+}
+
+type getWikiNodeByObjResp struct {
+	Code int64                 `json:"code,omitempty"`
+	Msg  string                `json:"msg,omitempty"`
+	Data *lark.GetWikiNodeResp `json:"data,omitempty"`
+}
+
+// GetWikiNodeByObj returns the wiki node hosting the document objToken of
+// objType, such as "docx" or "sheet". Documents outside of wiki spaces
+// return an error. The lark sdk does not expose the obj_type parameter yet,
+// so the node is requested directly.
+func (c *Client) GetWikiNodeByObj(ctx context.Context, objToken, objType string) (*lark.GetWikiNodeRespNode, error) {
+	resp := new(getWikiNodeByObjResp)
+	err := c.call(ctx, func() (*lark.Response, error) {
+		response, err := c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+			Scope:                 "Drive",
+			API:                   "GetWikiNode",
+			Method:                "GET",
+			URL:                   openBaseURL + "/open-apis/wiki/v2/spaces/get_node",
+			Body:                  &getWikiNodeByObjReq{Token: objToken, ObjType: objType},
+			NeedTenantAccessToken: true,
+		}, resp)
+		if err == nil {
+			err = codeError("GetWikiNode", resp.Code, resp.Msg)
+		}
+		return response, err
 	})
 	if err != nil {
 		return nil, err
 	}
+	if resp.Data == nil || resp.Data.Node == nil {
+		return nil, fmt.Errorf("no wiki node hosts the %s %s", objType, objToken)
+	}
+	return resp.Data.Node, nil
+}
+
+func (c *Client) GetDriveFolderFileList(ctx context.Context, pageToken *string, folderToken *string) ([]*lark.GetDriveFileListRespFile, error) {
+	var resp *lark.GetDriveFileListResp
+	list := func(pageToken *string) error {
+		return c.call(ctx, func() (response *lark.Response, err error) {
+			resp, response, err = c.larkClient.Drive.GetDriveFileList(ctx, &lark.GetDriveFileListReq{
+				PageSize:    nil,
+				PageToken:   pageToken,
+				FolderToken: folderToken,
+			})
+			return response, err
+		})
+	}
+	if err := list(pageToken); err != nil {
+		return nil, err
+	}
 	files := resp.Files
 	for resp.HasMore {
-		resp, _, err = c.larkClient.Drive.GetDriveFileList(ctx, &lark.GetDriveFileListReq{
-			PageSize:    nil,
-			PageToken:   &resp.NextPageToken,
-			FolderToken: folderToken,
-		})
-		if err != nil {
+		if err := list(&resp.NextPageToken); err != nil {
 			return nil, err
 		}
 		files = append(files, resp.Files...)
@@ -131,47 +366,91 @@ func (c *Client) GetDriveFolderFileList(ctx context.Context, pageToken *string,
 	return files, nil
 }
 
-func (c *Client) GetWikiName(ctx context.Context, spaceID string) (string, error) {
-	resp, _, err := c.larkClient.Drive.GetWikiSpace(ctx, &lark.GetWikiSpaceReq{
-		SpaceID: spaceID,
+func (c *Client) GetDriveFolderName(ctx context.Context, folderToken string) (string, error) {
+	var resp *lark.GetDriveFolderMetaResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		resp, response, err = c.larkClient.Drive.GetDriveFolderMeta(ctx, &lark.GetDriveFolderMetaReq{
+			FolderToken: folderToken,
+		})
+		return response, err
 	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Name, nil
+}
 
+func (c *Client) GetWikiName(ctx context.Context, spaceID string) (string, error) {
+	space, err := c.GetWikiSpace(ctx, spaceID)
 	if err != nil {
 		return "", err
 	}
 
-	return resp.Space.Name, nil
+	return space.Name, nil
 }
 
-func (c *Client) GetWikiNodeList(ctx context.Context, spaceID string, parentNodeToken *string) ([]*lark.GetWikiNodeListRespItem, error) {
-	resp, _, err := c.larkClient.Drive.GetWikiNodeList(ctx, &lark.GetWikiNodeListReq{
-		SpaceID:         spaceID,
-		PageSize:        nil,
-		PageToken:       nil,
-		ParentNodeToken: parentNodeToken,
-	})
+type getWikiNodeListReq struct {
+	SpaceID         string  `path:"space_id" json:"-"`
+	PageToken       *string `query:"page_token" json:"-"`
+	ParentNodeToken *string `query:"parent_node_token" json:"-"`
+}
 
-	if err != nil {
+type getWikiNodeListResp struct {
+	Code int64  `json:"code,omitempty"`
+	Msg  string `json:"msg,omitempty"`
+	Data struct {
+		Items     []*WikiNode `json:"items"`
+		PageToken string      `json:"page_token"`
+		HasMore   bool        `json:"has_more"`
+	} `json:"data"`
+}
+
+// WikiNode is a node of the wiki node list. The list is requested directly
+// because the lark sdk drops the fields it does not know, Hidden is nil
+// unless the response tells the visibility of the node to space visitors.
+type WikiNode struct {
+	lark.GetWikiNodeListRespItem
+	Hidden *bool `json:"hidden,omitempty"`
+}
+
+func (c *Client) GetWikiNodeList(ctx context.Context, spaceID string, parentNodeToken *string) ([]*WikiNode, error) {
+	var resp *getWikiNodeListResp
+	list := func(pageToken *string) error {
+		resp = new(getWikiNodeListResp)
+		return c.call(ctx, func() (*lark.Response, error) {
+			response, err := c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+				Scope:  "Drive",
+				API:    "GetWikiNodeList",
+				Method: "GET",
+				URL:    openBaseURL + "/open-apis/wiki/v2/spaces/:space_id/nodes",
+				Body: &getWikiNodeListReq{
+					SpaceID:         spaceID,
+					PageToken:       pageToken,
+					ParentNodeToken: parentNodeToken,
+				},
+				NeedTenantAccessToken: true,
+			}, resp)
+			if err == nil {
+				err = codeError("GetWikiNodeList", resp.Code, resp.Msg)
+			}
+			return response, err
+		})
+	}
+
+	if err := list(nil); err != nil {
 		return nil, err
 	}
 
-	nodes := resp.Items
+	nodes := resp.Data.Items
 	previousPageToken := ""
 
-	for resp.HasMore && previousPageToken != resp.PageToken {
-		previousPageToken = resp.PageToken
-		resp, _, err := c.larkClient.Drive.GetWikiNodeList(ctx, &lark.GetWikiNodeListReq{
-			SpaceID:         spaceID,
-			PageSize:        nil,
-			PageToken:       &resp.PageToken,
-			ParentNodeToken: parentNodeToken,
-		})
-
-		if err != nil {
+	for resp.Data.HasMore && previousPageToken != resp.Data.PageToken {
+		previousPageToken = resp.Data.PageToken
+		if err := list(&previousPageToken); err != nil {
 			return nil, err
 		}
 
-		nodes = append(nodes, resp.Items...)
+		nodes = append(nodes, resp.Data.Items...)
 	}
 
 	return nodes, nil
@@ -120,3 +120,25 @@ func TestGetWikiNodeList(t *testing.T) {
 		t.Errorf("Error: no nodes found")
 	}
 }
+
+func TestWikiNodeVisibility(t *testing.T) {
+	client := newSheetClient(map[string]string{
+		"/open-apis/wiki/v2/spaces/123/nodes": `{"code":0,"data":{"has_more":false,"items":[
+			{"node_token":"wikA","obj_token":"docA","obj_type":"docx","title":"A","has_child":true},
+			{"node_token":"wikB","obj_token":"docB","obj_type":"docx","title":"B","hidden":true}]}}`,
+	})
+	nodes, err := client.GetWikiNodeList(context.Background(), "123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].Title != "A" || !nodes[0].HasChild {
+		t.Fatalf("unexpected nodes %+v", nodes)
+	}
+	// the visibility stays unknown unless the response carries it
+	if nodes[0].Hidden != nil {
+		t.Errorf("expected unknown visibility of A, got %v", *nodes[0].Hidden)
+	}
+	if nodes[1].Hidden == nil || !*nodes[1].Hidden {
+		t.Errorf("expected B to be hidden")
+	}
+}
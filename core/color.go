@@ -0,0 +1,60 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chyroc/lark"
+)
+
+// The css colors closest to the Feishu palette.
+var docxFontColors = map[lark.DocxFontColor]string{
+	lark.DocxFontColorLightPink:   "#d83931",
+	lark.DocxFontColorLightOrange: "#de7802",
+	lark.DocxFontColorLightYellow: "#dc9b04",
+	lark.DocxFontColorLightGreen:  "#2ea121",
+	lark.DocxFontColorLightBlue:   "#245bdb",
+	lark.DocxFontColorLightPurple: "#6425d0",
+	lark.DocxFontColorLightGrey:   "#646a73",
+}
+
+var docxFontBackgroundColors = map[lark.DocxFontBackgroundColor]string{
+	lark.DocxFontBackgroundColorLightPink:   "#fbbfbc",
+	lark.DocxFontBackgroundColorLightOrange: "#fed4a4",
+	lark.DocxFontBackgroundColorLightYellow: "#f8e6ab",
+	lark.DocxFontBackgroundColorLightGreen:  "#d9f5d6",
+	lark.DocxFontBackgroundColorLightBlue:   "#e1eaff",
+	lark.DocxFontBackgroundColorLightPurple: "#ece2fe",
+	lark.DocxFontBackgroundColorLightGrey:   "#f2f3f5",
+	lark.DocxFontBackgroundColorDarkPink:    "#f76964",
+	lark.DocxFontBackgroundColorDarkOrange:  "#ffa53d",
+	lark.DocxFontBackgroundColorDarkYellow:  "#ffe928",
+	lark.DocxFontBackgroundColorDarkGreen:   "#62d256",
+	lark.DocxFontBackgroundColorDarkBlue:    "#4e83fd",
+	lark.DocxFontBackgroundColorDarkPurple:  "#935af6",
+	lark.DocxFontBackgroundColorDarkGrey:    "#bbbfc4",
+	15:                                      "#dee0e3", // 暗银灰色, missing in the sdk
+}
+
+// htmlTextEscaper escapes the text put into html blocks such as tables,
+// where a stray "<" would otherwise open a tag and break the cell.
+var htmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// renderTextRunColor wraps text in a span carrying the text and background
+// colors when output.preserve_colors is on.
+func (p *Parser) renderTextRunColor(style *lark.DocxTextElementStyle, text string) string {
+	if !p.preserveColors || style == nil || text == "" {
+		return text
+	}
+	var css []string
+	if c, ok := docxFontColors[style.TextColor]; ok {
+		css = append(css, "color: "+c)
+	}
+	if c, ok := docxFontBackgroundColors[style.BackgroundColor]; ok {
+		css = append(css, "background-color: "+c)
+	}
+	if len(css) == 0 {
+		return text
+	}
+	return fmt.Sprintf(`<span style="%s">%s</span>`, strings.Join(css, "; "), text)
+}
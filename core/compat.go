@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/88250/lute"
+	"github.com/pkg/errors"
+)
+
+// OutputBehavior groups the defaults that affect the formatting of the
+// generated markdown, so that upgrading the binary does not change existing
+// exports until output.compat_version is bumped.
+type OutputBehavior struct {
+	// TitleMode controls the header prepended to each document,
+	// "heading_link" writes "# title" followed by the source link quote.
+	TitleMode string
+	// AutoSpace inserts spaces between CJK and latin characters.
+	AutoSpace bool
+	// Dialect is the markdown flavor lute renders and the text is escaped
+	// for, output.dialect overrides it.
+	Dialect string
+}
+
+const LatestCompatVersion = "v2"
+
+// OutputBehaviors are the named behavior sets accepted by
+// output.compat_version. Existing entries must never change.
+var OutputBehaviors = map[string]OutputBehavior{
+	"v2": {
+		TitleMode: "heading_link",
+		AutoSpace: true,
+		Dialect:   DialectGFM,
+	},
+}
+
+func CompatVersions() []string {
+	versions := make([]string, 0, len(OutputBehaviors))
+	for v := range OutputBehaviors {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// ResolveCompatVersion returns the compat version in effect and its behavior.
+func (conf *OutputConfig) ResolveCompatVersion() (string, OutputBehavior, error) {
+	version := conf.CompatVersion
+	if version == "" {
+		version = LatestCompatVersion
+	}
+	behavior, ok := OutputBehaviors[version]
+	if !ok {
+		return "", OutputBehavior{}, errors.Errorf(
+			"unknown output.compat_version %q, expect one of %v", version, CompatVersions())
+	}
+	return version, behavior, nil
+}
+
+// ResolveDialect returns output.dialect, or the dialect of the compat
+// version when it is empty.
+func (conf *OutputConfig) ResolveDialect() string {
+	if conf.Dialect != "" {
+		return conf.Dialect
+	}
+	if _, behavior, err := conf.ResolveCompatVersion(); err == nil && behavior.Dialect != "" {
+		return behavior.Dialect
+	}
+	return DialectGFM
+}
+
+func (b OutputBehavior) NewEngine() *lute.Lute {
+	return lute.New(func(l *lute.Lute) {
+		l.RenderOptions.AutoSpace = b.AutoSpace
+	})
+}
+
+// FormatDocument adds the title header to the parsed markdown and formats
+// it. A *FormatError is returned with the unformatted markdown when lute
+// fails on the document.
+func (b OutputBehavior) FormatDocument(title, sourceURL, markdown string) (string, error) {
+	if b.TitleMode == "heading_link" {
+		markdown = fmt.Sprintf("# %s\n\n> 原文档链接: [%s](%s)\n\n%s", title, title, sourceURL, markdown)
+	}
+	return FormatMarkdown(b.NewEngine(), markdown)
+}
+
+// FormatError reports that lute panicked while formatting a document, as
+// it does on some pathological input such as deeply nested emphasis.
+type FormatError struct {
+	Panic interface{}
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("failed to format the markdown: %v", e.Panic)
+}
+
+// luteFormat is replaced by the tests to simulate a panic of lute.
+var luteFormat = func(engine *lute.Lute, markdown string) string {
+	return engine.FormatStr("md", markdown)
+}
+
+// FormatMarkdown formats the markdown with the engine. A panic of lute is
+// recovered as a *FormatError, returned along with the markdown unchanged
+// so that the caller may still write it.
+func FormatMarkdown(engine *lute.Lute, markdown string) (formatted string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			formatted, err = markdown, &FormatError{Panic: r}
+		}
+	}()
+	return luteFormat(engine, markdown), nil
+}
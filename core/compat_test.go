@@ -0,0 +1,89 @@
+package core_test
+
+import (
+	"flag"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/88250/lute"
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files")
+
+func TestCompatVersionsGolden(t *testing.T) {
+	for _, version := range core.CompatVersions() {
+		for _, td := range []string{"testdocx.1", "testdocx.2"} {
+			t.Run(version+"/"+td, func(t *testing.T) {
+				config := core.NewConfig("", "").Output
+				config.CompatVersion = version
+				_, behavior, err := config.ResolveCompatVersion()
+				assert.NoError(t, err)
+
+				doc, blocks := loadTestdocx(t, td)
+				parser := core.NewParser(config)
+				md := parser.ParseDocxContent(doc, blocks)
+				md, err = behavior.FormatDocument(doc.Title, "https://sample.feishu.cn/docx/"+doc.DocumentID, md)
+				assert.NoError(t, err)
+
+				goldenPath := path.Join(utils.RootDir(), "testdata", "compat", version, td+".md")
+				if *updateGolden {
+					assert.NoError(t, os.MkdirAll(path.Dir(goldenPath), 0o755))
+					assert.NoError(t, os.WriteFile(goldenPath, []byte(md), 0o644))
+				}
+				golden, err := os.ReadFile(goldenPath)
+				assert.NoError(t, err)
+				assert.Equal(t, string(golden), md)
+			})
+		}
+	}
+}
+
+func TestResolveCompatVersion(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	version, _, err := config.ResolveCompatVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, core.LatestCompatVersion, version)
+
+	config.CompatVersion = "v0"
+	_, _, err = config.ResolveCompatVersion()
+	assert.Error(t, err)
+	assert.Error(t, config.Validate())
+}
+
+func TestFormatDocumentRecoversPanic(t *testing.T) {
+	// lute panics on some pathological input, simulated here as the
+	// deeply nested emphasis that triggered it can not be reproduced
+	// with every lute version
+	restore := core.SetLuteFormat(func(_ *lute.Lute, markdown string) string {
+		if strings.Contains(markdown, "***") {
+			panic("index out of range [3] with length 3")
+		}
+		return markdown
+	})
+	defer restore()
+
+	config := core.NewConfig("", "").Output
+	meta := core.DocumentMeta{Title: "A", URL: "https://sample.feishu.cn/docx/a"}
+	frontMatter, body, err := config.FormatDocument(meta, "***a***\n")
+	var formatErr *core.FormatError
+	if assert.ErrorAs(t, err, &formatErr) {
+		assert.Equal(t, "index out of range [3] with length 3", formatErr.Panic)
+	}
+	assert.Empty(t, frontMatter)
+	assert.Equal(t, "# A\n\n> 原文档链接: [A](https://sample.feishu.cn/docx/a)\n\n***a***\n", body)
+
+	config.FrontMatter = true
+	frontMatter, body, err = config.FormatDocument(meta, "***a***\n")
+	assert.ErrorAs(t, err, &formatErr)
+	assert.Contains(t, frontMatter, `title: "A"`)
+	assert.Equal(t, "***a***\n", body)
+
+	_, body, err = config.FormatDocument(meta, "a\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "a\n", body)
+}
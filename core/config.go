@@ -5,40 +5,406 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
 )
 
 type Config struct {
-	Feishu FeishuConfig `json:"feishu"`
-	Output OutputConfig `json:"output"`
+	Feishu   FeishuConfig   `json:"feishu"`
+	Output   OutputConfig   `json:"output"`
+	HTTP     HTTPConfig     `json:"http"`
+	Cache    CacheConfig    `json:"cache"`
+	Download DownloadConfig `json:"download"`
+	Sheet    SheetConfig    `json:"sheet"`
+	Estimate EstimateConfig `json:"estimate"`
 }
 
 type FeishuConfig struct {
 	AppId     string `json:"app_id"`
 	AppSecret string `json:"app_secret"`
+	// RateLimit is the requests per second sent to the OPEN API, 0 disables
+	// the limit.
+	RateLimit float64 `json:"rate_limit"`
+	// MaxRetries is how many times a request hitting the frequency limit is
+	// retried.
+	MaxRetries int `json:"max_retries"`
+}
+
+type HTTPConfig struct {
+	CABundle           string `json:"ca_bundle"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+type CacheConfig struct {
+	Dir       string `json:"dir"`
+	TTL       string `json:"ttl"`
+	MaxSizeMB int64  `json:"max_size_mb"`
+}
+
+type DownloadConfig struct {
+	// Concurrency is how many documents of a batch or wiki download are
+	// processed at the same time, 0 uses the default of 10. The
+	// --concurrency flag overrides it.
+	Concurrency int `json:"concurrency"`
+	// StatusToken, when set, is required as the token query parameter of
+	// the endpoints served by --status-addr.
+	StatusToken string `json:"status_token"`
+	// MaxDepth caps how deep wiki nodes and folders are traversed, deeper
+	// nodes are skipped and reported. 0 is DefaultMaxDepth.
+	MaxDepth int `json:"max_depth"`
+	// QualityThreshold is the conversion quality score, in percent, below
+	// which a document is listed for manual review in the summary of a
+	// download. 0 is DefaultQualityThreshold.
+	QualityThreshold float64 `json:"quality_threshold"`
+}
+
+// DefaultMaxDepth is the traversal depth cap when download.max_depth is not
+// set, far deeper than any real space but shallow enough to stop a corrupted
+// one whose nodes list their ancestors as children.
+const DefaultMaxDepth = 64
+
+// DefaultQualityThreshold is the review threshold of the conversion quality
+// score when download.quality_threshold is not set.
+const DefaultQualityThreshold = 90
+
+// EstimateConfig holds the per document averages --estimate assumes when
+// no previous report of the output directory has measured them.
+type EstimateConfig struct {
+	// BlockPagesPerDocument is the average number of block pages read per
+	// document, a page holds up to 500 blocks.
+	BlockPagesPerDocument  float64 `json:"block_pages_per_document"`
+	ImagesPerDocument      float64 `json:"images_per_document"`
+	AttachmentsPerDocument float64 `json:"attachments_per_document"`
+	// RequestsPerSheet is the average number of requests reading a
+	// spreadsheet or a bitable, including its tabs and value pages.
+	RequestsPerSheet float64 `json:"requests_per_sheet"`
+	// CallLatency is the assumed time of a request when the traversal made
+	// none to measure it, such as "300ms".
+	CallLatency string `json:"call_latency"`
+}
+
+func (conf *EstimateConfig) Validate() error {
+	for name, v := range map[string]float64{
+		"block_pages_per_document": conf.BlockPagesPerDocument,
+		"images_per_document":      conf.ImagesPerDocument,
+		"attachments_per_document": conf.AttachmentsPerDocument,
+		"requests_per_sheet":       conf.RequestsPerSheet,
+	} {
+		if v < 0 {
+			return errors.Errorf("invalid estimate.%s %g, expect a non-negative number", name, v)
+		}
+	}
+	if _, err := conf.Latency(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Latency parses CallLatency, empty is 300ms.
+func (conf *EstimateConfig) Latency() (time.Duration, error) {
+	if conf.CallLatency == "" {
+		return defaultCallLatency, nil
+	}
+	d, err := time.ParseDuration(conf.CallLatency)
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("invalid estimate.call_latency %q, expect a duration like \"300ms\"", conf.CallLatency)
+	}
+	return d, nil
+}
+
+const defaultCallLatency = 300 * time.Millisecond
+
+type SheetConfig struct {
+	// FormulaMode is how the formula cells of spreadsheets are exported,
+	// "values" (the default) as displayed, "formulas" as the formula text or
+	// "both" with the formulas of every row in a trailing column. Reading
+	// the formulas doubles the requests of a spreadsheet.
+	FormulaMode string `json:"formula_mode"`
 }
 
 type OutputConfig struct {
 	ImageDir        string `json:"image_dir"`
 	TitleAsFilename bool   `json:"title_as_filename"`
-	UseHTMLTags     bool   `json:"use_html_tags"`
-	SkipImgDownload bool   `json:"skip_img_download"`
+	// FileNameTemplate names the document files, see FileName.
+	FileNameTemplate string `json:"file_name_template"`
+	UseHTMLTags      bool   `json:"use_html_tags"`
+	SkipImgDownload  bool   `json:"skip_img_download"`
+	// UseHashImageNames names the images by a hash of their content and
+	// keeps them in a single image directory under the output root, shared
+	// by the documents of every folder. Images already there are not
+	// downloaded again. False names them by their token next to each
+	// document.
+	UseHashImageNames bool `json:"use_hash_image_names"`
+	// FileDir is where the attachments of file blocks are saved, relative to
+	// the document.
+	FileDir          string `json:"file_dir"`
+	SkipFileDownload bool   `json:"skip_file_download"`
+	CodeFenceAttrs   string `json:"code_fence_attrs"`
+	// CodeLineNumbers asks code_fence_attrs for line numbers on every code
+	// block, the API does not tell whether a block shows them.
+	CodeLineNumbers bool `json:"code_line_numbers"`
+	// Cover is "image" to put the document cover before the body, or
+	// "front_matter" to link it as cover: in the front matter.
+	Cover string `json:"cover"`
+	// IncludeIcons is rejected by Validate, the docx open API does not
+	// return the icon of a document.
+	IncludeIcons  bool   `json:"include_icons,omitempty"`
+	CompatVersion string `json:"compat_version"`
+	BareLinks     string `json:"bare_links"`
+	Timezone      string `json:"timezone"`
+	DateFormat    string `json:"date_format"`
+	FrontMatter   bool   `json:"front_matter"`
+	// FrontMatterTemplate renders the lines of the front matter of the
+	// documents, a text/template over DocumentMeta. Empty writes the
+	// title, source, token, revision and download time.
+	FrontMatterTemplate string `json:"front_matter_template"`
+	ImageDimensions     string `json:"image_dimensions"`
+	PreserveColors      bool   `json:"preserve_colors"`
+	// ListStartFromBlock numbers the first ordered list of a document from
+	// the explicit sequence of its first item, such as 37 for a spec
+	// continuing the list of the previous document, instead of 1.
+	ListStartFromBlock bool `json:"list_start_from_block"`
+	// GalleryTemplate renders runs of consecutive images, "hugo" for the
+	// gallery shortcode, "html" for a flex div or a text/template over
+	// GalleryData. Empty keeps the images as is.
+	GalleryTemplate string `json:"gallery_template"`
+	// GalleryMinImages is the length of the shortest run rendered as a
+	// gallery, 0 is DefaultGalleryMinImages.
+	GalleryMinImages int `json:"gallery_min_images"`
+	// EscapeText escapes the literal markdown characters of plain text,
+	// such as a "*" or a "1." at the start of a line, according to Dialect.
+	EscapeText bool `json:"escape_text"`
+	// Dialect is "gfm" or "commonmark", empty uses the dialect of the
+	// compat version.
+	Dialect string `json:"dialect"`
+	// FileNodeMaxMB skips uploaded files in wiki spaces larger than this,
+	// 0 downloads them regardless of size.
+	FileNodeMaxMB int64 `json:"file_node_max_mb"`
+	// FileNodeExtensions limits the uploaded files downloaded from wiki
+	// spaces to these extensions, e.g. ["pdf", "pptx"]. Empty allows all.
+	FileNodeExtensions []string `json:"file_node_extensions"`
+	// SheetFormat is how spreadsheets and bitables are exported, "markdown"
+	// (the default) renders every tab as a table of one markdown file, "csv"
+	// writes a csv file per tab.
+	SheetFormat string `json:"sheet_format"`
+	// TagsMinDocuments groups the tags with fewer documents under "misc" in
+	// the generated tag index, 0 lists every tag on its own.
+	TagsMinDocuments int `json:"tags_min_documents"`
+	// Fsync is when the exported files are flushed to stable storage, see
+	// utils.FsyncAlways, utils.FsyncBatch and utils.FsyncNever.
+	Fsync string `json:"fsync"`
+	// Newline is the line ending of every generated text file, "lf" (the
+	// default) or "crlf". Images and other binary files are untouched.
+	Newline string `json:"newline"`
+	// BOM starts the generated text files with a UTF-8 byte order mark.
+	BOM bool `json:"bom"`
+	// Sinks are extra outputs written after the output directory, such as
+	// "zip:export.zip", see the --sink flag.
+	Sinks []string `json:"sinks"`
+	// PostProcess runs external commands over the written files and the
+	// report of the run.
+	PostProcess PostProcessConfig `json:"post_process"`
+	// HTML controls the html written into the markdown.
+	HTML HTMLConfig `json:"html"`
 }
 
 func NewConfig(appId, appSecret string) *Config {
 	return &Config{
 		Feishu: FeishuConfig{
-			AppId:     appId,
-			AppSecret: appSecret,
+			AppId:      appId,
+			AppSecret:  appSecret,
+			RateLimit:  defaultRateLimit,
+			MaxRetries: defaultMaxRetries,
 		},
 		Output: OutputConfig{
-			ImageDir:        "static",
-			TitleAsFilename: false,
-			UseHTMLTags:     false,
-			SkipImgDownload: false,
+			ImageDir:         "static",
+			TitleAsFilename:  false,
+			FileNameTemplate: "{title}",
+			UseHTMLTags:      false,
+			SkipImgDownload:  false,
+			FileDir:          "files",
+			SkipFileDownload: false,
+			CodeFenceAttrs:   "",
+			CodeLineNumbers:  false,
+			Cover:            "",
+			CompatVersion:    "",
+			BareLinks:        "",
+			Timezone:         "UTC",
+			DateFormat:       DefaultDateFormat,
+			FrontMatter:      false,
+			ImageDimensions:  "",
+			PreserveColors:   false,
+			SheetFormat:      SheetFormatMarkdown,
+			TagsMinDocuments: 0,
+			Fsync:            utils.FsyncNever,
+			Newline:          utils.NewlineLF,
+		},
+		Cache: CacheConfig{
+			Dir:       "",
+			TTL:       "168h",
+			MaxSizeMB: 1024,
+		},
+		Sheet: SheetConfig{
+			FormulaMode: SheetFormulaValues,
 		},
+		Estimate: EstimateConfig{
+			BlockPagesPerDocument:  1,
+			ImagesPerDocument:      3,
+			AttachmentsPerDocument: 0.2,
+			RequestsPerSheet:       4,
+			CallLatency:            "300ms",
+		},
+	}
+}
+
+func (conf *FeishuConfig) Validate() error {
+	if conf.RateLimit < 0 {
+		return errors.Errorf("invalid feishu.rate_limit %v, expect a non-negative number", conf.RateLimit)
+	}
+	if conf.MaxRetries < 0 {
+		return errors.Errorf("invalid feishu.max_retries %d, expect a non-negative number", conf.MaxRetries)
+	}
+	return nil
+}
+
+func (conf *DownloadConfig) Validate() error {
+	if conf.Concurrency < 0 {
+		return errors.Errorf("invalid download.concurrency %d, expect a non-negative number", conf.Concurrency)
+	}
+	if conf.MaxDepth < 0 {
+		return errors.Errorf("invalid download.max_depth %d, expect a non-negative number", conf.MaxDepth)
+	}
+	if conf.QualityThreshold < 0 || conf.QualityThreshold > 100 {
+		return errors.Errorf("invalid download.quality_threshold %v, expect a percentage between 0 and 100", conf.QualityThreshold)
+	}
+	return nil
+}
+
+// ReviewThreshold is QualityThreshold or DefaultQualityThreshold when it is
+// not set.
+func (conf *DownloadConfig) ReviewThreshold() float64 {
+	if conf.QualityThreshold == 0 {
+		return DefaultQualityThreshold
+	}
+	return conf.QualityThreshold
+}
+
+// TraversalMaxDepth is MaxDepth or DefaultMaxDepth when it is not set.
+func (conf *DownloadConfig) TraversalMaxDepth() int {
+	if conf.MaxDepth == 0 {
+		return DefaultMaxDepth
+	}
+	return conf.MaxDepth
+}
+
+func (conf *SheetConfig) Validate() error {
+	switch conf.FormulaMode {
+	case "", SheetFormulaValues, SheetFormulaFormulas, SheetFormulaBoth:
+	default:
+		return errors.Errorf("invalid sheet.formula_mode %q, expect \"values\", \"formulas\" or \"both\"", conf.FormulaMode)
+	}
+	return nil
+}
+
+// ClientOptions returns the client options reading the formulas of
+// spreadsheets when the formula mode needs them.
+func (conf *SheetConfig) ClientOptions() []ClientOption {
+	needsFormulas := conf.FormulaMode == SheetFormulaFormulas || conf.FormulaMode == SheetFormulaBoth
+	return []ClientOption{WithSheetFormulas(needsFormulas)}
+}
+
+// ClientOptions returns the client options for the rate limit and retries.
+func (conf *FeishuConfig) ClientOptions() []ClientOption {
+	return []ClientOption{
+		WithRateLimit(conf.RateLimit),
+		WithRetry(conf.MaxRetries, defaultRetryBaseDelay),
 	}
 }
 
+func (conf *OutputConfig) Validate() error {
+	if _, err := NewCodeFenceAttrsTemplate(conf.CodeFenceAttrs); err != nil {
+		return err
+	}
+	if _, err := NewFrontMatterTemplate(conf.FrontMatterTemplate); err != nil {
+		return err
+	}
+	if _, err := NewGalleryTemplate(conf.GalleryTemplate); err != nil {
+		return err
+	}
+	if conf.GalleryMinImages < 0 {
+		return errors.Errorf("invalid output.gallery_min_images %d, expect a non-negative number", conf.GalleryMinImages)
+	}
+	if _, err := conf.Location(); err != nil {
+		return err
+	}
+	if _, _, err := conf.ResolveCompatVersion(); err != nil {
+		return err
+	}
+	switch conf.BareLinks {
+	case "", "plain", "autolink":
+	default:
+		return errors.Errorf("invalid output.bare_links %q, expect \"plain\" or \"autolink\"", conf.BareLinks)
+	}
+	switch conf.ImageDimensions {
+	case "", "html", "attrs":
+	default:
+		return errors.Errorf("invalid output.image_dimensions %q, expect \"html\" or \"attrs\"", conf.ImageDimensions)
+	}
+	switch conf.Dialect {
+	case "", DialectGFM, DialectCommonMark:
+	default:
+		return errors.Errorf("invalid output.dialect %q, expect \"gfm\" or \"commonmark\"", conf.Dialect)
+	}
+	if conf.FileNodeMaxMB < 0 {
+		return errors.Errorf("invalid output.file_node_max_mb %d, expect a non-negative number", conf.FileNodeMaxMB)
+	}
+	switch conf.SheetFormat {
+	case "", SheetFormatMarkdown, SheetFormatCSV:
+	default:
+		return errors.Errorf("invalid output.sheet_format %q, expect \"markdown\" or \"csv\"", conf.SheetFormat)
+	}
+	if conf.TagsMinDocuments < 0 {
+		return errors.Errorf("invalid output.tags_min_documents %d, expect a non-negative number", conf.TagsMinDocuments)
+	}
+	if err := validateFileNameTemplate(conf.FileNameTemplate); err != nil {
+		return err
+	}
+	switch conf.Fsync {
+	case "", utils.FsyncAlways, utils.FsyncBatch, utils.FsyncNever:
+	default:
+		return errors.Errorf("invalid output.fsync %q, expect \"always\", \"batch\" or \"never\"", conf.Fsync)
+	}
+	switch conf.Newline {
+	case "", utils.NewlineLF, utils.NewlineCRLF:
+	default:
+		return errors.Errorf("invalid output.newline %q, expect \"lf\" or \"crlf\"", conf.Newline)
+	}
+	switch conf.Cover {
+	case "", "image", "front_matter":
+	default:
+		return errors.Errorf("invalid output.cover %q, expect \"\", \"image\" or \"front_matter\"", conf.Cover)
+	}
+	if conf.IncludeIcons {
+		return errors.New("output.include_icons is not supported, the docx open API does not return the icon of a document")
+	}
+	if err := conf.PostProcess.Validate(); err != nil {
+		return err
+	}
+	if err := conf.HTML.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// NormalizeText applies the newline and byte order mark policy to a
+// generated text file right before it is written.
+func (conf *OutputConfig) NormalizeText(data []byte) []byte {
+	return utils.NormalizeText(data, conf.Newline, conf.BOM)
+}
+
 func GetConfigFilePath() (string, error) {
 	configPath, err := os.UserConfigDir()
 	if err != nil {
@@ -73,3 +439,23 @@ func (conf *Config) WriteConfig2File(configPath string) error {
 	err = os.WriteFile(configPath, file, 0o644)
 	return err
 }
+
+// AllowFileNode reports whether an uploaded file with this name passes
+// FileNodeExtensions, compared without the dot and case.
+func (conf *OutputConfig) AllowFileNode(name string) bool {
+	if len(conf.FileNodeExtensions) == 0 {
+		return true
+	}
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	for _, allowed := range conf.FileNodeExtensions {
+		if strings.EqualFold(strings.TrimPrefix(allowed, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// FileNodeMaxBytes is FileNodeMaxMB in bytes.
+func (conf *OutputConfig) FileNodeMaxBytes() int64 {
+	return conf.FileNodeMaxMB << 20
+}
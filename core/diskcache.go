@@ -0,0 +1,285 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// DiskCache keeps document blocks and media on disk so that runs exporting
+// the same documents, possibly by different users of the host, share them.
+// Blocks are keyed by document token and revision, media by file token.
+type DiskCache struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+	mu      sync.Mutex
+}
+
+type CacheStats struct {
+	Dir          string `json:"dir"`
+	DocxEntries  int    `json:"docx_entries"`
+	MediaEntries int    `json:"media_entries"`
+	Size         int64  `json:"size"`
+}
+
+// Open returns the configured cache, or nil when no cache dir is set.
+func (conf CacheConfig) Open() (*DiskCache, error) {
+	if conf.Dir == "" {
+		return nil, nil
+	}
+	var ttl time.Duration
+	if conf.TTL != "" {
+		d, err := time.ParseDuration(conf.TTL)
+		if err != nil || d < 0 {
+			return nil, errors.Errorf("invalid cache.ttl %q, expect a duration like \"168h\"", conf.TTL)
+		}
+		ttl = d
+	}
+	if conf.MaxSizeMB < 0 {
+		return nil, errors.Errorf("invalid cache.max_size_mb %d", conf.MaxSizeMB)
+	}
+	for _, sub := range []string{"docx", "media"} {
+		if err := os.MkdirAll(filepath.Join(conf.Dir, sub), 0o775); err != nil {
+			return nil, err
+		}
+	}
+	return &DiskCache{dir: conf.Dir, ttl: ttl, maxSize: conf.MaxSizeMB << 20}, nil
+}
+
+func (c *DiskCache) Dir() string {
+	return c.dir
+}
+
+// get returns the content of a fresh entry and marks it as recently used.
+func (c *DiskCache) get(path string) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+		os.Remove(path)
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, true
+}
+
+func (c *DiskCache) put(path string, data []byte) error {
+	if err := utils.WriteFileAtomic(path, data, 0o664); err != nil {
+		return err
+	}
+	return c.evict()
+}
+
+type cacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *DiskCache) entries() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	for _, sub := range []string{"docx", "media"} {
+		err := filepath.WalkDir(filepath.Join(c.dir, sub), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			entries = append(entries, cacheEntry{path, info.Size(), info.ModTime()})
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// evict removes the least recently used entries until the cache fits into
+// the configured size.
+func (c *DiskCache) evict() error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, e := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.Remove(e.path); err == nil || os.IsNotExist(err) {
+			total -= e.size
+		}
+	}
+	return nil
+}
+
+func (c *DiskCache) Stats() (CacheStats, error) {
+	stats := CacheStats{Dir: c.dir}
+	entries, err := c.entries()
+	if err != nil {
+		return stats, err
+	}
+	for _, e := range entries {
+		if filepath.Base(filepath.Dir(e.path)) == "docx" {
+			stats.DocxEntries++
+		} else {
+			stats.MediaEntries++
+		}
+		stats.Size += e.size
+	}
+	return stats, nil
+}
+
+func (c *DiskCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sub := range []string{"docx", "media"} {
+		dir := filepath.Join(c.dir, sub)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0o775); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DiskCache) docxPath(docToken string, revision int64) string {
+	return filepath.Join(c.dir, "docx", fmt.Sprintf("%s@%d.json", docToken, revision))
+}
+
+func (c *DiskCache) mediaPath(token, ext string) string {
+	return filepath.Join(c.dir, "media", token+ext)
+}
+
+// getMedia returns the cached media of the token and its file extension.
+func (c *DiskCache) getMedia(token string) ([]byte, string, bool) {
+	matches, _ := filepath.Glob(filepath.Join(c.dir, "media", token+"*"))
+	for _, m := range matches {
+		ext := strings.TrimPrefix(filepath.Base(m), token)
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			continue
+		}
+		if data, ok := c.get(m); ok {
+			return data, ext, true
+		}
+	}
+	return nil, "", false
+}
+
+type diskCachedAPI struct {
+	API
+	cache *DiskCache
+}
+
+type cachedDocx struct {
+	Document *lark.DocxDocument `json:"document"`
+	Blocks   []*lark.DocxBlock  `json:"blocks"`
+}
+
+// NewDiskCachedAPI returns an API serving document blocks and media from the
+// disk cache. Every document lookup first asks api for the current revision,
+// so a cached copy is only used while the document is unchanged.
+func NewDiskCachedAPI(api API, cache *DiskCache) API {
+	return &diskCachedAPI{API: api, cache: cache}
+}
+
+func (a *diskCachedAPI) GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error) {
+	meta, err := a.API.GetDocxDocument(ctx, docToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if data, ok := a.cache.get(a.cache.docxPath(docToken, meta.RevisionID)); ok {
+		cached := cachedDocx{}
+		if err := json.Unmarshal(data, &cached); err == nil && cached.Document != nil &&
+			cached.Document.RevisionID == meta.RevisionID {
+			return cached.Document, cached.Blocks, nil
+		}
+	}
+
+	docx, blocks, err := a.API.GetDocxContent(ctx, docToken)
+	if err != nil {
+		return docx, blocks, err
+	}
+	// older revisions of the document are never served again
+	stale, _ := filepath.Glob(filepath.Join(a.cache.dir, "docx", docToken+"@*.json"))
+	for _, path := range stale {
+		os.Remove(path)
+	}
+	if data, err := json.Marshal(cachedDocx{docx, blocks}); err == nil {
+		if err := a.cache.put(a.cache.docxPath(docToken, docx.RevisionID), data); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to cache %s: %v\n", docToken, err)
+		}
+	}
+	return docx, blocks, nil
+}
+
+func (a *diskCachedAPI) DownloadImage(ctx context.Context, imgToken, outDir string) (string, error) {
+	if data, ext, ok := a.cache.getMedia(imgToken); ok {
+		filename := fmt.Sprintf("%s/%s%s", outDir, imgToken, ext)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			return imgToken, err
+		}
+		if err := utils.WriteFileAtomic(filename, data, 0o644); err != nil {
+			return imgToken, err
+		}
+		return filename, nil
+	}
+	filename, err := a.API.DownloadImage(ctx, imgToken, outDir)
+	if err != nil {
+		return filename, err
+	}
+	if data, err := os.ReadFile(filename); err == nil {
+		a.putMedia(imgToken, filepath.Ext(filename), data)
+	}
+	return filename, nil
+}
+
+func (a *diskCachedAPI) DownloadImageRaw(ctx context.Context, imgToken, imgDir string) (string, []byte, error) {
+	if data, ext, ok := a.cache.getMedia(imgToken); ok {
+		return fmt.Sprintf("%s/%s%s", imgDir, imgToken, ext), data, nil
+	}
+	filename, data, err := a.API.DownloadImageRaw(ctx, imgToken, imgDir)
+	if err != nil {
+		return filename, data, err
+	}
+	a.putMedia(imgToken, filepath.Ext(filename), data)
+	return filename, data, nil
+}
+
+func (a *diskCachedAPI) putMedia(token, ext string, data []byte) {
+	if err := a.cache.put(a.cache.mediaPath(token, ext), data); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache %s: %v\n", token, err)
+	}
+}
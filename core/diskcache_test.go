@@ -0,0 +1,140 @@
+package core_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+// revisionStubAPI 返回可变修订号的文档，并统计内容和图片的请求次数
+type revisionStubAPI struct {
+	core.API
+	revision     int64
+	contentCalls int
+	mediaCalls   int
+}
+
+func (s *revisionStubAPI) GetDocxDocument(ctx context.Context, docToken string) (*lark.DocxDocument, error) {
+	return &lark.DocxDocument{DocumentID: docToken, RevisionID: s.revision}, nil
+}
+
+func (s *revisionStubAPI) GetDocxContent(ctx context.Context, docToken string) (*lark.DocxDocument, []*lark.DocxBlock, error) {
+	s.contentCalls++
+	return &lark.DocxDocument{DocumentID: docToken, RevisionID: s.revision, Title: "Title"},
+		[]*lark.DocxBlock{{BlockID: docToken, BlockType: lark.DocxBlockTypePage}}, nil
+}
+
+func (s *revisionStubAPI) DownloadImage(ctx context.Context, imgToken, outDir string) (string, error) {
+	s.mediaCalls++
+	filename := filepath.Join(outDir, imgToken+".png")
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return imgToken, err
+	}
+	return filename, os.WriteFile(filename, []byte("png data of "+imgToken), 0o644)
+}
+
+func openTestCache(t *testing.T, conf core.CacheConfig) *core.DiskCache {
+	conf.Dir = t.TempDir()
+	cache, err := conf.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestDiskCacheRevision(t *testing.T) {
+	stub := &revisionStubAPI{revision: 1}
+	api := core.NewDiskCachedAPI(stub, openTestCache(t, core.CacheConfig{}))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		docx, blocks, err := api.GetDocxContent(ctx, "doxcn1")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), docx.RevisionID)
+		assert.Len(t, blocks, 1)
+	}
+	assert.Equal(t, 1, stub.contentCalls)
+
+	// 修订号变化后不能返回缓存的旧内容
+	stub.revision = 2
+	docx, _, err := api.GetDocxContent(ctx, "doxcn1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), docx.RevisionID)
+	assert.Equal(t, 2, stub.contentCalls)
+}
+
+func TestDiskCacheMedia(t *testing.T) {
+	stub := &revisionStubAPI{}
+	cache := openTestCache(t, core.CacheConfig{})
+	api := core.NewDiskCachedAPI(stub, cache)
+	ctx := context.Background()
+
+	for _, outDir := range []string{t.TempDir(), t.TempDir()} {
+		filename, err := api.DownloadImage(ctx, "boxcn1", outDir)
+		assert.NoError(t, err)
+		assert.Equal(t, outDir+"/boxcn1.png", filename)
+		data, err := os.ReadFile(filename)
+		assert.NoError(t, err)
+		assert.Equal(t, "png data of boxcn1", string(data))
+	}
+	assert.Equal(t, 1, stub.mediaCalls)
+
+	stats, err := cache.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.MediaEntries)
+	assert.NoError(t, cache.Clear())
+	stats, _ = cache.Stats()
+	assert.Equal(t, 0, stats.MediaEntries)
+}
+
+func TestDiskCacheExpiry(t *testing.T) {
+	stub := &revisionStubAPI{revision: 1}
+	cache := openTestCache(t, core.CacheConfig{TTL: "1h"})
+	api := core.NewDiskCachedAPI(stub, cache)
+	ctx := context.Background()
+
+	_, _, err := api.GetDocxContent(ctx, "doxcn1")
+	assert.NoError(t, err)
+	old := time.Now().Add(-2 * time.Hour)
+	path := filepath.Join(cache.Dir(), "docx", "doxcn1@1.json")
+	assert.NoError(t, os.Chtimes(path, old, old))
+
+	_, _, err = api.GetDocxContent(ctx, "doxcn1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stub.contentCalls)
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	stub := &revisionStubAPI{}
+	cache := openTestCache(t, core.CacheConfig{MaxSizeMB: 1})
+	api := core.NewDiskCachedAPI(stub, cache)
+
+	big := make([]byte, 600<<10)
+	for i, token := range []string{"boxcnOld", "boxcnNew"} {
+		path := filepath.Join(cache.Dir(), "media", token+".png")
+		assert.NoError(t, os.WriteFile(path, big, 0o644))
+		mtime := time.Now().Add(time.Duration(i-10) * time.Minute)
+		assert.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	// 写入新条目时淘汰最久未使用的条目
+	_, err := api.DownloadImage(context.Background(), "boxcn1", t.TempDir())
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(cache.Dir(), "media", "boxcnOld.png"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(cache.Dir(), "media", "boxcnNew.png"))
+	assert.NoError(t, err)
+}
+
+func TestCacheConfigOpen(t *testing.T) {
+	cache, err := core.CacheConfig{}.Open()
+	assert.NoError(t, err)
+	assert.Nil(t, cache)
+	_, err = core.CacheConfig{Dir: t.TempDir(), TTL: "a week"}.Open()
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	DialectGFM        = "gfm"
+	DialectCommonMark = "commonmark"
+)
+
+// entityRegexp matches the character references a renderer would decode.
+var entityRegexp = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});`)
+
+// textEscaper escapes the literal characters of plain text runs that would
+// otherwise be read as markdown syntax. Only the characters significant in
+// their position are escaped, so ordinary text such as snake_case or
+// "a * b" is kept as is. Code spans, code blocks and html table cells are
+// never passed through it.
+type textEscaper struct {
+	dialect string
+}
+
+func isASCIIPunct(r rune) bool {
+	return r < unicode.MaxASCII && unicode.IsPunct(r) || strings.ContainsRune("$+<=>^`|~", r)
+}
+
+func isSpaceOrEdge(r rune) bool {
+	return r == 0 || unicode.IsSpace(r)
+}
+
+// isSpaceBetween reports whether r is surrounded by whitespace within the
+// run, such as the "*" of "a * b", which can not open or close emphasis.
+func isSpaceBetween(prev, next rune) bool {
+	return prev != 0 && unicode.IsSpace(prev) && next != 0 && unicode.IsSpace(next)
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// escape escapes text, lineStart tells whether it starts a line of the
+// generated markdown, where block markers such as "#" or "1." take effect.
+func (e *textEscaper) escape(text string, lineStart bool) string {
+	runes := []rune(text)
+	at := func(i int) rune {
+		if i < 0 || i >= len(runes) {
+			return 0
+		}
+		return runes[i]
+	}
+	marked := -1
+	buf := new(strings.Builder)
+	for i, r := range runes {
+		if (i == 0 && lineStart) || at(i-1) == '\n' {
+			if n := e.blockMarker(runes[i:]); n >= 0 {
+				marked = i + n
+			}
+		}
+		if i == marked || e.inlineSignificant(r, at(i-1), at(i+1), runes[i:]) {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// blockMarker returns the offset of the character to escape when line
+// starts with a block marker, -1 otherwise.
+func (e *textEscaper) blockMarker(line []rune) int {
+	end := len(line)
+	for i, r := range line {
+		if r == '\n' {
+			end = i
+			break
+		}
+	}
+	line = line[:end]
+	if len(line) == 0 {
+		return -1
+	}
+	after := func(i int) rune {
+		if i >= len(line) {
+			return 0
+		}
+		return line[i]
+	}
+	onlyOf := func(c rune) bool {
+		for _, r := range line {
+			if r != c && r != ' ' && r != '\t' {
+				return false
+			}
+		}
+		return true
+	}
+	switch first := line[0]; first {
+	case '#':
+		n := 0
+		for n < len(line) && line[n] == '#' {
+			n++
+		}
+		if n <= 6 && isSpaceOrEdge(after(n)) {
+			return 0
+		}
+	case '>':
+		return 0
+	case '-', '+':
+		if isSpaceOrEdge(after(1)) || onlyOf(first) {
+			return 0
+		}
+	case '=':
+		if onlyOf('=') {
+			return 0
+		}
+	case '~':
+		// gfm escapes every tilde inline, commonmark only fences
+		if e.dialect == DialectCommonMark && after(1) == '~' && after(2) == '~' {
+			return 0
+		}
+	default:
+		n := 0
+		for n < len(line) && n < 10 && line[n] >= '0' && line[n] <= '9' {
+			n++
+		}
+		if n > 0 && n < 10 && (after(n) == '.' || after(n) == ')') && isSpaceOrEdge(after(n+1)) {
+			return n
+		}
+	}
+	return -1
+}
+
+// inlineSignificant reports whether r would start or end inline syntax
+// between prev and next.
+func (e *textEscaper) inlineSignificant(r, prev, next rune, rest []rune) bool {
+	switch r {
+	case '\\':
+		return next == 0 || isASCIIPunct(next)
+	case '`', '[', ']':
+		return true
+	case '*':
+		return !isSpaceBetween(prev, next)
+	case '_':
+		// intraword underscores never form emphasis
+		return !isSpaceBetween(prev, next) && !(isWordChar(prev) && isWordChar(next))
+	case '~':
+		// strikethrough is a gfm extension
+		return e.dialect == DialectGFM && !isSpaceBetween(prev, next)
+	case '|':
+		return e.dialect == DialectGFM
+	case '<':
+		return unicode.IsLetter(next) || next == '/' || next == '!' || next == '?'
+	case '&':
+		return entityRegexp.MatchString(string(rest))
+	}
+	return false
+}
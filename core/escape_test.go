@@ -0,0 +1,58 @@
+package core_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEscapeText(t *testing.T) {
+	doc, blocks := loadTestdocx(t, "testescape")
+	tests := []struct {
+		dialect string
+		golden  string
+	}{
+		{core.DialectGFM, "testescape.gfm.md"},
+		{core.DialectCommonMark, "testescape.commonmark.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			config := core.NewConfig("", "").Output
+			config.EscapeText = true
+			config.Dialect = tt.dialect
+			assert.NoError(t, config.Validate())
+			md := core.NewParser(config).ParseDocxContent(doc, blocks)
+
+			goldenPath := path.Join(utils.RootDir(), "testdata", tt.golden)
+			if *updateGolden {
+				assert.NoError(t, os.WriteFile(goldenPath, []byte(md), 0o644))
+			}
+			expected, err := os.ReadFile(goldenPath)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), md)
+		})
+	}
+}
+
+func TestParseEscapeTextDisabled(t *testing.T) {
+	doc, blocks := loadTestdocx(t, "testescape")
+	md := core.NewParser(core.NewConfig("", "").Output).ParseDocxContent(doc, blocks)
+	assert.Contains(t, md, "# not a heading")
+	assert.NotContains(t, md, `\#`)
+}
+
+func TestEscapeTextDialect(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	assert.Equal(t, core.DialectGFM, config.ResolveDialect())
+	config.Dialect = core.DialectCommonMark
+	assert.Equal(t, core.DialectCommonMark, config.ResolveDialect())
+	config.Dialect = "markdown"
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "output.dialect"))
+}
@@ -0,0 +1,11 @@
+package core
+
+import "github.com/88250/lute"
+
+// SetLuteFormat replaces the lute call of FormatMarkdown, returning the
+// function restoring it.
+func SetLuteFormat(format func(engine *lute.Lute, markdown string) string) func() {
+	saved := luteFormat
+	luteFormat = format
+	return func() { luteFormat = saved }
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// CodeFenceAttrsPresets maps the preset names accepted by
+// output.code_fence_attrs to their templates. Any other non-empty value is
+// used as a template directly. The hugo preset only emits the highlight
+// options of Hugo and Chroma, which have no counterpart for wrapping.
+var CodeFenceAttrsPresets = map[string]string{
+	"hugo": "{{if .LineNumbers}}{linenos=true}{{end}}",
+}
+
+// CodeFenceAttrsData is the data available to the code_fence_attrs template.
+type CodeFenceAttrsData struct {
+	Language string
+	Wrap     bool
+	// LineNumbers is output.code_line_numbers
+	LineNumbers bool
+}
+
+func NewCodeFenceAttrsTemplate(spec string) (*template.Template, error) {
+	if spec == "" || spec == "plain" {
+		return nil, nil
+	}
+	if preset, ok := CodeFenceAttrsPresets[spec]; ok {
+		spec = preset
+	}
+	tmpl, err := template.New("code_fence_attrs").Parse(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid output.code_fence_attrs template")
+	}
+	// execution errors such as unknown fields would otherwise drop the
+	// attributes of every code block silently
+	sample := CodeFenceAttrsData{Language: "go", Wrap: true, LineNumbers: true}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, errors.Wrap(err, "invalid output.code_fence_attrs template")
+	}
+	return tmpl, nil
+}
+
+func escapeFenceAttrBraces(s string) string {
+	s = strings.ReplaceAll(s, "{", `\{`)
+	return strings.ReplaceAll(s, "}", `\}`)
+}
+
+// codeFenceAttrs renders the attributes of a code block and returns the
+// placeholder to put on the fence line. The placeholder is swapped back by
+// RestoreCodeFenceAttrs once lute has formatted the document, as lute would
+// otherwise unescape the attribute string.
+func (p *Parser) codeFenceAttrs(style *lark.DocxTextStyle) string {
+	if p.fenceAttrsTmpl == nil || style == nil {
+		return ""
+	}
+	data := CodeFenceAttrsData{
+		Language:    escapeFenceAttrBraces(DocxCodeLang2MdStr[style.Language]),
+		Wrap:        style.Wrap,
+		LineNumbers: p.codeLineNumbers,
+	}
+	buf := new(strings.Builder)
+	if err := p.fenceAttrsTmpl.Execute(buf, data); err != nil {
+		return ""
+	}
+	attrs := strings.TrimSpace(buf.String())
+	if attrs == "" {
+		return ""
+	}
+	placeholder := fmt.Sprintf("feishu2mdfence%dattrs", len(p.fenceAttrs))
+	p.fenceAttrs[placeholder] = attrs
+	return " " + placeholder
+}
+
+func (p *Parser) RestoreCodeFenceAttrs(markdown string) string {
+	for placeholder, attrs := range p.fenceAttrs {
+		markdown = strings.Replace(markdown, placeholder, attrs, 1)
+	}
+	return markdown
+}
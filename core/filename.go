@@ -0,0 +1,45 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/pkg/errors"
+)
+
+const defaultFileNameTemplate = "{title}"
+
+var fileNamePlaceholderRegexp = regexp.MustCompile(`\{[^{}]*\}`)
+
+func validateFileNameTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	placeholders := fileNamePlaceholderRegexp.FindAllString(template, -1)
+	if len(placeholders) == 0 {
+		return errors.Errorf("invalid output.file_name_template %q, expect {title} or {token} in it", template)
+	}
+	for _, p := range placeholders {
+		if p != "{title}" && p != "{token}" {
+			return errors.Errorf("invalid output.file_name_template %q, unknown placeholder %s, expect {title} or {token}", template, p)
+		}
+	}
+	return nil
+}
+
+// FileName expands FileNameTemplate into the name of a document file without
+// extension, e.g. "{title}_{token}". It falls back to the token when the title
+// leaves the name empty.
+func (conf *OutputConfig) FileName(title, token string) string {
+	template := conf.FileNameTemplate
+	if template == "" {
+		template = defaultFileNameTemplate
+	}
+	name := strings.NewReplacer("{title}", title, "{token}", token).Replace(template)
+	name = utils.SanitizeFileName(name)
+	if strings.TrimSpace(name) == "" {
+		return token
+	}
+	return name
+}
@@ -0,0 +1,35 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputFileName(t *testing.T) {
+	tests := []struct {
+		template string
+		title    string
+		want     string
+	}{
+		{"", "a/b: c", "a_b_ c"},
+		{"{title}", "设计文档", "设计文档"},
+		{"{token}", "设计文档", "doxcnToken"},
+		{"{title}_{token}", "设计文档", "设计文档_doxcnToken"},
+		{"docs/{title}", "x", "docs_x"},
+		{"{title}", " ", "doxcnToken"},
+	}
+	for _, tt := range tests {
+		conf := core.NewConfig("", "").Output
+		conf.FileNameTemplate = tt.template
+		assert.NoError(t, conf.Validate())
+		assert.Equal(t, tt.want, conf.FileName(tt.title, "doxcnToken"), tt.template)
+	}
+
+	for _, template := range []string{"static", "{title}_{date}"} {
+		conf := core.NewConfig("", "").Output
+		conf.FileNameTemplate = template
+		assert.Error(t, conf.Validate(), template)
+	}
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FrontMatterField is one key of a YAML front matter block, kept in order.
+type FrontMatterField struct {
+	Key   string
+	Value interface{}
+}
+
+// RenderFrontMatter renders the fields as a YAML front matter block. Values
+// are encoded as JSON scalars, which YAML reads back unchanged, so titles
+// containing quotes or colons need no further escaping. It must be prepended
+// after lute formatting, which would otherwise reflow the block.
+func RenderFrontMatter(fields []FrontMatterField) string {
+	sb := new(strings.Builder)
+	sb.WriteString("---\n")
+	for _, f := range fields {
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(f.Value); err != nil {
+			continue
+		}
+		sb.WriteString(f.Key)
+		sb.WriteString(": ")
+		sb.WriteString(strings.TrimSuffix(buf.String(), "\n"))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("---\n\n")
+	return sb.String()
+}
+
+// DocumentMeta is the metadata of an exported document, available to
+// output.front_matter_template.
+type DocumentMeta struct {
+	Title        string
+	URL          string
+	Token        string
+	Revision     int64
+	DownloadedAt time.Time // in the timezone of output.timezone
+	Lang         string    // output.html.lang
+	Cover        string    // link of the cover image with output.cover "front_matter"
+}
+
+// frontMatterFuncs are the functions of output.front_matter_template, yaml
+// quotes a value the same way as the default front matter.
+var frontMatterFuncs = template.FuncMap{
+	"yaml": func(v interface{}) string {
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return `""`
+		}
+		return strings.TrimSuffix(buf.String(), "\n")
+	},
+}
+
+// NewFrontMatterTemplate parses output.front_matter_template, an empty spec
+// returns nil for the default fields.
+func NewFrontMatterTemplate(spec string) (*template.Template, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("front_matter_template").Funcs(frontMatterFuncs).Parse(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid output.front_matter_template template")
+	}
+	return tmpl, nil
+}
+
+// DocumentFrontMatter renders the front matter block of a document. The
+// template, when set, renders the lines between the "---" delimiters.
+func (conf *OutputConfig) DocumentFrontMatter(meta DocumentMeta) (string, error) {
+	tmpl, err := NewFrontMatterTemplate(conf.FrontMatterTemplate)
+	if err != nil {
+		return "", err
+	}
+	if meta.Lang == "" {
+		meta.Lang = conf.HTML.Lang
+	}
+	if tmpl == nil {
+		fields := []FrontMatterField{
+			{Key: "title", Value: meta.Title},
+			{Key: "source", Value: meta.URL},
+			{Key: "token", Value: meta.Token},
+			{Key: "revision", Value: meta.Revision},
+			{Key: "downloaded_at", Value: conf.FormatTime(meta.DownloadedAt)},
+		}
+		if meta.Lang != "" {
+			fields = append(fields, FrontMatterField{Key: "lang", Value: meta.Lang})
+		}
+		if meta.Cover != "" {
+			fields = append(fields, FrontMatterField{Key: "cover", Value: meta.Cover})
+		}
+		return RenderFrontMatter(fields), nil
+	}
+	buf := new(strings.Builder)
+	if err := tmpl.Execute(buf, meta); err != nil {
+		return "", errors.Wrap(err, "failed to render output.front_matter_template")
+	}
+	body := strings.TrimRight(buf.String(), "\n")
+	return "---\n" + body + "\n---\n\n", nil
+}
+
+// FormatDocument formats the parsed markdown by the compat version. With
+// output.front_matter the title header is replaced by the front matter,
+// which is returned apart from the body and has to be prepended after
+// restoring the code fence attributes. The front matter is empty otherwise.
+// When lute fails the error is a *FormatError and the body is the
+// unformatted markdown, still usable as a fallback.
+func (conf *OutputConfig) FormatDocument(meta DocumentMeta, markdown string) (frontMatter, body string, err error) {
+	_, behavior, err := conf.ResolveCompatVersion()
+	if err != nil {
+		return "", "", err
+	}
+	if !conf.FrontMatter {
+		body, err = behavior.FormatDocument(meta.Title, meta.URL, markdown)
+		return "", body, err
+	}
+	if frontMatter, err = conf.DocumentFrontMatter(meta); err != nil {
+		return "", "", err
+	}
+	body, err = FormatMarkdown(behavior.NewEngine(), markdown)
+	return frontMatter, body, err
+}
@@ -0,0 +1,94 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderFrontMatter(t *testing.T) {
+	got := core.RenderFrontMatter([]core.FrontMatterField{
+		{Key: "title", Value: `Q&A: "quoted" <title>`},
+		{Key: "source", Value: "https://domain.feishu.cn/wiki/settings/123"},
+		{Key: "node_count", Value: 12},
+	})
+	want := "---\n" +
+		`title: "Q&A: \"quoted\" <title>"` + "\n" +
+		`source: "https://domain.feishu.cn/wiki/settings/123"` + "\n" +
+		"node_count: 12\n" +
+		"---\n\n"
+	assert.Equal(t, want, got)
+}
+
+func TestDocumentFrontMatter(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	config.Timezone = "Asia/Shanghai"
+	meta := core.DocumentMeta{
+		Title:        `Release: "v2" notes`,
+		URL:          "https://domain.feishu.cn/docx/doxcnABC",
+		Token:        "doxcnABC",
+		Revision:     42,
+		DownloadedAt: time.Date(2024, 5, 1, 2, 3, 4, 0, time.UTC),
+	}
+	got, err := config.DocumentFrontMatter(meta)
+	assert.NoError(t, err)
+	assert.Equal(t, "---\n"+
+		`title: "Release: \"v2\" notes"`+"\n"+
+		`source: "https://domain.feishu.cn/docx/doxcnABC"`+"\n"+
+		`token: "doxcnABC"`+"\n"+
+		"revision: 42\n"+
+		`downloaded_at: "2024-05-01 10:03:04"`+"\n"+
+		"---\n\n", got)
+
+	// the cover is linked only when output.cover is "front_matter"
+	meta.Cover = "./static/imgCover.png"
+	got, err = config.DocumentFrontMatter(meta)
+	assert.NoError(t, err)
+	assert.Contains(t, got, `downloaded_at: "2024-05-01 10:03:04"`+"\n"+`cover: "./static/imgCover.png"`+"\n---")
+
+	config.FrontMatterTemplate = "title: {{yaml .Title}}\ndate: {{.DownloadedAt.Format \"2006-01-02\"}}\n"
+	assert.NoError(t, config.Validate())
+	got, err = config.DocumentFrontMatter(meta)
+	assert.NoError(t, err)
+	assert.Equal(t, "---\ntitle: \"Release: \\\"v2\\\" notes\"\ndate: 2024-05-01\n---\n\n", got)
+
+	config.FrontMatterTemplate = "{{.Title"
+	assert.Error(t, config.Validate())
+}
+
+func TestValidateCover(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	for _, cover := range []string{"", "image", "front_matter"} {
+		config.Cover = cover
+		assert.NoError(t, config.Validate())
+	}
+	config.Cover = "banner"
+	assert.Error(t, config.Validate())
+
+	// icons are not available from the open API
+	config.Cover = ""
+	config.IncludeIcons = true
+	err := config.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "include_icons")
+	}
+}
+
+func TestFormatDocumentFrontMatter(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	meta := core.DocumentMeta{Title: "Doc", URL: "https://domain.feishu.cn/docx/doxcnABC", Token: "doxcnABC"}
+
+	frontMatter, body, err := config.FormatDocument(meta, "text\n")
+	assert.NoError(t, err)
+	assert.Empty(t, frontMatter)
+	assert.Contains(t, body, "原文档链接")
+
+	config.FrontMatter = true
+	frontMatter, body, err = config.FormatDocument(meta, "text\n")
+	assert.NoError(t, err)
+	assert.Contains(t, frontMatter, `title: "Doc"`)
+	assert.NotContains(t, body, "原文档链接")
+	assert.NotContains(t, body, "# Doc")
+}
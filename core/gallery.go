@@ -0,0 +1,174 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+)
+
+// GalleryTemplatePresets maps the preset names accepted by
+// output.gallery_template to their templates. Any other non-empty value is
+// used as a template directly.
+var GalleryTemplatePresets = map[string]string{
+	"hugo": `{{"{{<"}} gallery {{">}}"}}
+{{range .Images}}{{"{{<"}} figure src={{printf "%q" .Src}}{{with .Alt}} alt={{printf "%q" .}}{{end}}{{if .Caption}} caption={{printf "%q" .Caption}}{{end}} {{">}}"}}
+{{end}}{{"{{<"}} /gallery {{">}}"}}`,
+	"html": `<div class="gallery" style="display: flex; flex-wrap: wrap; gap: 8px;">
+{{range .Images}}<figure style="flex: 1 1 200px; margin: 0;"><img src="{{html .Src}}" alt="{{html (or .Alt .Caption)}}">{{if .Caption}}<figcaption>{{html .Caption}}</figcaption>{{end}}</figure>
+{{end}}</div>`,
+}
+
+// DefaultGalleryMinImages is the length of the shortest image run rendered
+// as a gallery when output.gallery_min_images is not set.
+const DefaultGalleryMinImages = 3
+
+// GalleryImage is an image of a gallery. Src is the local link once the
+// image is downloaded, the token otherwise. Alt is only set with
+// output.html.accessibility, see ImageAltText.
+type GalleryImage struct {
+	Src     string
+	Token   string
+	Caption string
+	Alt     string
+	Width   int64
+	Height  int64
+}
+
+// GalleryData is the data available to the gallery_template template.
+type GalleryData struct {
+	Images []GalleryImage
+}
+
+func NewGalleryTemplate(spec string) (*template.Template, error) {
+	if spec == "" || spec == "plain" {
+		return nil, nil
+	}
+	if preset, ok := GalleryTemplatePresets[spec]; ok {
+		spec = preset
+	}
+	tmpl, err := template.New("gallery_template").Parse(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid output.gallery_template template")
+	}
+	return tmpl, nil
+}
+
+// galleryImages returns the images of a block that can join a gallery: an
+// image, or a grid ("分栏") whose columns each hold only images, or a single
+// image with text under it as its caption. Other blocks return nil.
+func (p *Parser) galleryImages(b *lark.DocxBlock) []GalleryImage {
+	if b == nil {
+		return nil
+	}
+	if b.BlockType == lark.DocxBlockTypeImage && b.Image != nil {
+		return []GalleryImage{{Token: b.Image.Token, Width: b.Image.Width, Height: b.Image.Height}}
+	}
+	if b.BlockType != lark.DocxBlockTypeGrid {
+		return nil
+	}
+	var images []GalleryImage
+	for _, columnId := range b.Children {
+		column := p.blockMap[columnId]
+		if column == nil {
+			return nil
+		}
+		var columnImages []GalleryImage
+		var captions []string
+		for _, childId := range column.Children {
+			child := p.blockMap[childId]
+			switch {
+			case child == nil:
+				return nil
+			case child.BlockType == lark.DocxBlockTypeImage && child.Image != nil:
+				columnImages = append(columnImages, GalleryImage{Token: child.Image.Token,
+					Width: child.Image.Width, Height: child.Image.Height})
+			case child.BlockType == lark.DocxBlockTypeText:
+				if caption := strings.TrimSpace(p.plainInline(child.Text)); caption != "" {
+					captions = append(captions, caption)
+				}
+			default:
+				return nil
+			}
+		}
+		if len(captions) > 0 {
+			if len(columnImages) != 1 {
+				return nil
+			}
+			columnImages[0].Caption = strings.Join(captions, " ")
+		}
+		images = append(images, columnImages...)
+	}
+	return images
+}
+
+// parseGalleryRun renders the children starting at start as a gallery when
+// they begin with a long enough run of images, returning the placeholder
+// and the number of blocks it covers, or 0 when there is no gallery. The
+// placeholder is swapped for the rendered template by RestoreGalleries once
+// the image links are known and lute has formatted the document.
+func (p *Parser) parseGalleryRun(children []string, start int) (string, int) {
+	if p.galleryTmpl == nil {
+		return "", 0
+	}
+	var images []GalleryImage
+	end := start
+	for ; end < len(children); end++ {
+		blockImages := p.galleryImages(p.blockMap[children[end]])
+		if len(blockImages) == 0 {
+			break
+		}
+		images = append(images, blockImages...)
+	}
+	if len(images) < p.galleryMinImages {
+		return "", 0
+	}
+	for _, img := range images {
+		if img.Width <= 0 || img.Height <= 0 {
+			p.unsizedImgs[img.Token] = true
+		}
+		if p.accessible && img.Caption == "" {
+			p.altlessImages++
+		}
+		p.ImgTokens = append(p.ImgTokens, img.Token)
+	}
+	// a grid of images rendered as a gallery keeps its layout
+	p.quality.Supported += end - start
+	placeholder := fmt.Sprintf("feishu2mdgallery%dimages", len(p.galleries))
+	p.galleries = append(p.galleries, images)
+	return placeholder + "\n", end - start
+}
+
+// RestoreGalleries renders the galleries in place of their placeholders,
+// with the local links and probed dimensions passed to ResolveImage.
+func (p *Parser) RestoreGalleries(markdown string) string {
+	for i, images := range p.galleries {
+		data := GalleryData{Images: make([]GalleryImage, len(images))}
+		for j, img := range images {
+			img.Src = img.Token
+			if p.accessible {
+				img.Alt = ImageAltText(img.Caption)
+			}
+			if resolved, ok := p.resolvedImgs[img.Token]; ok {
+				img.Src = resolved.Src
+				if img.Width <= 0 || img.Height <= 0 {
+					img.Width, img.Height = resolved.Width, resolved.Height
+				}
+			}
+			data.Images[j] = img
+		}
+		buf := new(strings.Builder)
+		if err := p.galleryTmpl.Execute(buf, data); err != nil {
+			// a template failing on the data falls back to the plain images
+			buf.Reset()
+			for _, img := range data.Images {
+				buf.WriteString(p.RenderImage(img.Src, img.Width, img.Height) + "\n\n")
+			}
+		}
+		placeholder := fmt.Sprintf("feishu2mdgallery%dimages", i)
+		markdown = strings.Replace(markdown, placeholder, strings.TrimSpace(buf.String()), 1)
+	}
+	return markdown
+}
@@ -0,0 +1,76 @@
+package core_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/88250/lute"
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// renderGallery parses the gallery fixture the way the download does:
+// resolving the images, formatting with lute and restoring the galleries.
+func renderGallery(t *testing.T, config core.OutputConfig) string {
+	t.Helper()
+	engine := lute.New(func(l *lute.Lute) {
+		l.RenderOptions.AutoSpace = true
+	})
+	doc, blocks := loadTestdocx(t, "testgallery")
+	parser := core.NewParser(config)
+	md := parser.ParseDocxContent(doc, blocks)
+	assert.Len(t, parser.ImgTokens, 10)
+	for _, token := range parser.ImgTokens {
+		md = parser.ResolveImage(md, token, "static/"+token+".png", 0, 0)
+	}
+	return parser.RestoreGalleries(engine.FormatStr("md", md))
+}
+
+func TestParseGalleries(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	config.GalleryTemplate = "html"
+	assert.NoError(t, config.Validate())
+	md := renderGallery(t, config)
+
+	goldenPath := path.Join(utils.RootDir(), "testdata", "testgallery.html.md")
+	if *updateGolden {
+		assert.NoError(t, os.WriteFile(goldenPath, []byte(md), 0o644))
+	}
+	expected, err := os.ReadFile(goldenPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), md)
+
+	// the run of five and the grid followed by an image form the galleries,
+	// the two images between them are too few and kept as is
+	assert.Equal(t, 2, strings.Count(md, `<div class="gallery"`))
+	assert.Contains(t, md, "![](static/boxcnGalleryI6.png)")
+	assert.Contains(t, md, "<figcaption>After &#34;v2&#34;</figcaption>")
+	assert.NotContains(t, md, "feishu2mdgallery")
+}
+
+func TestParseGalleryTemplates(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	md := renderGallery(t, config)
+	assert.Equal(t, 10, strings.Count(md, "![](static/"))
+
+	config.GalleryTemplate = "hugo"
+	md = renderGallery(t, config)
+	assert.Equal(t, 2, strings.Count(md, "{{< gallery >}}"))
+	assert.Contains(t, md, `{{< figure src="static/boxcnGalleryI8.png" caption="Before" >}}`)
+
+	config.GalleryTemplate = `{{len .Images}} images`
+	config.GalleryMinImages = 2
+	md = renderGallery(t, config)
+	assert.Contains(t, md, "5 images")
+	assert.Contains(t, md, "2 images")
+	assert.Contains(t, md, "3 images")
+
+	config.GalleryTemplate = "{{range .Images}"
+	assert.Error(t, config.Validate())
+	config.GalleryTemplate = "html"
+	config.GalleryMinImages = -1
+	assert.Error(t, config.Validate())
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewHTTPClient builds the http client shared by the lark client and the
+// media downloads. The CA bundle is loaded here once so that a broken bundle
+// is reported at startup rather than on the first request.
+func NewHTTPClient(config HTTPConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{}
+
+	if config.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(config.CABundle)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read http.ca_bundle")
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no valid PEM certificate found in http.ca_bundle %s", config.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.InsecureSkipVerify {
+		fmt.Fprintln(os.Stderr, "WARNING: http.insecure_skip_verify is enabled, "+
+			"TLS certificates will NOT be verified. Prefer http.ca_bundle instead.")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{
+		Transport: transport,
+		Timeout:   60 * time.Second,
+	}, nil
+}
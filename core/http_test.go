@@ -0,0 +1,117 @@
+package core_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCAServer starts a TLS server whose certificate is signed by a
+// freshly generated CA and returns the server with the CA in PEM format.
+func newTestCAServer(t *testing.T) (*httptest.Server, []byte) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "feishu2md test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	assert.NoError(t, err)
+
+	srvKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	srvTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	srvDER, err := x509.CreateCertificate(rand.Reader, srvTmpl, caCert, &srvKey.PublicKey, caKey)
+	assert.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{srvDER},
+			PrivateKey:  srvKey,
+		}},
+	}
+	server.StartTLS()
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	return server, caPEM
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	server, caPEM := newTestCAServer(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(caPath, caPEM, 0o644))
+	badPath := filepath.Join(dir, "bad.pem")
+	assert.NoError(t, os.WriteFile(badPath, []byte("not a certificate"), 0o644))
+
+	t.Run("system store rejects unknown CA", func(t *testing.T) {
+		client, err := core.NewHTTPClient(core.HTTPConfig{})
+		assert.NoError(t, err)
+		_, err = client.Get(server.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("custom CA bundle is trusted", func(t *testing.T) {
+		client, err := core.NewHTTPClient(core.HTTPConfig{CABundle: caPath})
+		assert.NoError(t, err)
+		resp, err := client.Get(server.URL)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	})
+
+	t.Run("insecure skip verify", func(t *testing.T) {
+		client, err := core.NewHTTPClient(core.HTTPConfig{InsecureSkipVerify: true})
+		assert.NoError(t, err)
+		resp, err := client.Get(server.URL)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+		}
+	})
+
+	t.Run("missing bundle fails at startup", func(t *testing.T) {
+		_, err := core.NewHTTPClient(core.HTTPConfig{CABundle: filepath.Join(dir, "missing.pem")})
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid bundle fails at startup", func(t *testing.T) {
+		_, err := core.NewHTTPClient(core.HTTPConfig{CABundle: badPath})
+		assert.Error(t, err)
+	})
+}
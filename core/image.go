@@ -0,0 +1,40 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenderImage renders an image according to output.image_dimensions. Images
+// without known dimensions fall back to the plain markdown syntax.
+func (p *Parser) RenderImage(src string, width, height int64) string {
+	if width <= 0 || height <= 0 {
+		return fmt.Sprintf("![%s](%s)", p.imageAlt, src)
+	}
+	switch p.imageDimensions {
+	case "html":
+		return fmt.Sprintf(`<img src="%s" width="%d" height="%d" alt="%s">`, src, width, height, p.imageAlt)
+	case "attrs":
+		return fmt.Sprintf("![%s](%s){width=%d height=%d}", p.imageAlt, src, width, height)
+	}
+	return fmt.Sprintf("![%s](%s)", p.imageAlt, src)
+}
+
+// NeedsImageSize reports whether the document did not provide the
+// dimensions of the image, so they should be probed from the downloaded file.
+func (p *Parser) NeedsImageSize(token string) bool {
+	return p.imageDimensions != "" && p.unsizedImgs[token]
+}
+
+// ResolveImage replaces the image token with its local link, adding the
+// probed dimensions to images that had none in the document. Images of a
+// gallery are kept for RestoreGalleries.
+func (p *Parser) ResolveImage(markdown, token, link string, width, height int64) string {
+	p.resolvedImgs[token] = GalleryImage{Src: link, Token: token, Width: width, Height: height}
+	if p.NeedsImageSize(token) && width > 0 && height > 0 &&
+		strings.Contains(markdown, p.RenderImage(token, 0, 0)) {
+		return strings.Replace(markdown,
+			p.RenderImage(token, 0, 0), p.RenderImage(link, width, height), 1)
+	}
+	return strings.Replace(markdown, token, link, 1)
+}
@@ -0,0 +1,289 @@
+package core
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// The markups of InlineDiff, DiffOptions.Style.
+const (
+	DiffStyleHTML   = "html"   // <ins> and <del> tags
+	DiffStyleCritic = "critic" // CriticMarkup {++ ++} and {-- --}
+)
+
+// DiffOptions configures InlineDiff.
+type DiffOptions struct {
+	Style string
+	// ImageKey identifies the image of a link target, images of different
+	// keys are flagged as replaced. nil uses ImageFileKey.
+	ImageKey func(src string) string
+}
+
+// DiffStats counts the changes marked by InlineDiff, in words.
+type DiffStats struct {
+	Insertions     int `json:"insertions"`
+	Deletions      int `json:"deletions"`
+	ReplacedImages int `json:"replaced_images"`
+}
+
+func (s DiffStats) Changed() bool {
+	return s.Insertions > 0 || s.Deletions > 0 || s.ReplacedImages > 0
+}
+
+var markdownImage = regexp.MustCompile(`!\[[^\]]*\]\(<?([^)\s>]*)>?[^)]*\)`)
+
+// ImageFileKey returns the file name of the image without its extension,
+// which is the image token for the images named by token and the token
+// itself for images not downloaded.
+func ImageFileKey(src string) string {
+	name := path.Base(src)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// StripFrontMatter removes a leading YAML front matter from the markdown.
+func StripFrontMatter(markdown string) string {
+	if !strings.HasPrefix(markdown, "---\n") {
+		return markdown
+	}
+	end := strings.Index(markdown[4:], "\n---\n")
+	if end < 0 {
+		return markdown
+	}
+	return strings.TrimLeft(markdown[4+end+5:], "\n")
+}
+
+type diffToken struct {
+	sep   string // the whitespace before the token
+	text  string
+	image bool
+	key   string // what is compared, the word or the key of the image
+}
+
+// tokenizeMarkdown splits the markdown into words and images. Whitespace
+// only separates the words, so reflowed lines compare equal. Every CJK
+// character is a word of its own as the text has no spaces between words.
+func tokenizeMarkdown(markdown string, imageKey func(string) string) (tokens []diffToken, tail string) {
+	sep := new(strings.Builder)
+	word := new(strings.Builder)
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, diffToken{sep: sep.String(), text: word.String(), key: word.String()})
+			sep.Reset()
+			word.Reset()
+		}
+	}
+	splitWords := func(s string) {
+		for _, r := range s {
+			switch {
+			case unicode.IsSpace(r):
+				flush()
+				sep.WriteRune(r)
+			case isCJK(r):
+				flush()
+				tokens = append(tokens, diffToken{sep: sep.String(), text: string(r), key: string(r)})
+				sep.Reset()
+			default:
+				word.WriteRune(r)
+			}
+		}
+	}
+	last := 0
+	for _, m := range markdownImage.FindAllStringSubmatchIndex(markdown, -1) {
+		// an image glued to a word stays a token of its own
+		splitWords(markdown[last:m[0]])
+		flush()
+		tokens = append(tokens, diffToken{sep: sep.String(), text: markdown[m[0]:m[1]], image: true,
+			key: "\x00" + imageKey(markdown[m[2]:m[3]])})
+		sep.Reset()
+		last = m[1]
+	}
+	splitWords(markdown[last:])
+	flush()
+	return tokens, sep.String()
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+type diffOp struct {
+	kind byte // '=', '-' or '+'
+	a, b int  // indexes of the token in the old and new sequence
+}
+
+// diffTokens returns a shortest edit script turning a into b by the Myers
+// algorithm. Only the diagonals reached by each step are kept for the
+// backtracking, the memory grows with the square of the changes.
+func diffTokens(a, b []diffToken) []diffOp {
+	n, m := len(a), len(b)
+	total := n + m
+	off := total + 1
+	v := make([]int, 2*total+3)
+	var snaps [][]int
+	steps := -1
+	for d := 0; d <= total && steps < 0; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x].key == b[y].key {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				steps = d
+				break
+			}
+		}
+		snaps = append(snaps, append([]int(nil), v[off-d:off+d+1]...))
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := steps; d > 0; d-- {
+		prev := snaps[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		var pk int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := at(pk)
+		py := px - pk
+		for x > px && y > py {
+			x--
+			y--
+			ops = append(ops, diffOp{'=', x, y})
+		}
+		if x == px {
+			ops = append(ops, diffOp{'+', x, py})
+		} else {
+			ops = append(ops, diffOp{'-', px, y})
+		}
+		x, y = px, py
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{'=', x, y})
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// InlineDiff compares two rendered markdown documents word by word and
+// returns the new one with the insertions and deletions marked in the
+// style of opts. The layout follows the new document, an image whose key
+// changed is marked as replaced and unchanged images keep the link of the
+// old document.
+func InlineDiff(oldMarkdown, newMarkdown string, opts DiffOptions) (string, DiffStats) {
+	imageKey := opts.ImageKey
+	if imageKey == nil {
+		imageKey = ImageFileKey
+	}
+	a, _ := tokenizeMarkdown(oldMarkdown, imageKey)
+	b, tail := tokenizeMarkdown(newMarkdown, imageKey)
+	ops := diffTokens(a, b)
+
+	buf := new(strings.Builder)
+	var stats DiffStats
+	var dels, ins []diffToken
+	flushHunk := func() {
+		if len(dels) == 0 && len(ins) == 0 {
+			return
+		}
+		if len(dels) == len(ins) && allImages(dels) && allImages(ins) {
+			for i := range dels {
+				buf.WriteString(dels[i].sep)
+				buf.WriteString(replacedImage(opts.Style, dels[i].text, ins[i].text))
+			}
+			stats.ReplacedImages += len(dels)
+		} else {
+			writeChange(buf, opts.Style, '-', dels)
+			writeChange(buf, opts.Style, '+', ins)
+			stats.Deletions += len(dels)
+			stats.Insertions += len(ins)
+		}
+		dels, ins = nil, nil
+	}
+	for _, op := range ops {
+		switch op.kind {
+		case '-':
+			dels = append(dels, a[op.a])
+		case '+':
+			ins = append(ins, b[op.b])
+		default:
+			flushHunk()
+			buf.WriteString(b[op.b].sep)
+			if b[op.b].image {
+				buf.WriteString(a[op.a].text)
+			} else {
+				buf.WriteString(b[op.b].text)
+			}
+		}
+	}
+	flushHunk()
+	buf.WriteString(tail)
+	return buf.String(), stats
+}
+
+func allImages(tokens []diffToken) bool {
+	for _, t := range tokens {
+		if !t.image {
+			return false
+		}
+	}
+	return true
+}
+
+func diffMarks(style string, kind byte) (openMark, closeMark string) {
+	switch {
+	case style == DiffStyleCritic && kind == '-':
+		return "{--", "--}"
+	case style == DiffStyleCritic:
+		return "{++", "++}"
+	case kind == '-':
+		return "<del>", "</del>"
+	}
+	return "<ins>", "</ins>"
+}
+
+// writeChange writes the inserted or deleted words, closing the markup at
+// line breaks which inline markup can not span.
+func writeChange(buf *strings.Builder, style string, kind byte, tokens []diffToken) {
+	openMark, closeMark := diffMarks(style, kind)
+	for i, t := range tokens {
+		if i == 0 || strings.Contains(t.sep, "\n") {
+			if i > 0 {
+				buf.WriteString(closeMark)
+			}
+			buf.WriteString(t.sep)
+			buf.WriteString(openMark)
+		} else {
+			buf.WriteString(t.sep)
+		}
+		buf.WriteString(t.text)
+	}
+	if len(tokens) > 0 {
+		buf.WriteString(closeMark)
+	}
+}
+
+func replacedImage(style, from, to string) string {
+	if style == DiffStyleCritic {
+		return "{~~" + from + "~>" + to + "~~}"
+	}
+	return `<del class="image-replaced">` + from + `</del><ins class="image-replaced">` + to + `</ins>`
+}
@@ -0,0 +1,87 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInlineDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		old   string
+		new   string
+		style string
+		want  string
+		stats core.DiffStats
+	}{
+		{
+			name: "reflowed lines are unchanged",
+			old:  "# Title\n\nThe quick brown\nfox jumps.\n",
+			new:  "# Title\n\nThe quick\nbrown fox jumps.\n",
+			want: "# Title\n\nThe quick\nbrown fox jumps.\n",
+		},
+		{
+			name:  "words",
+			old:   "The quick brown fox jumps.\n",
+			new:   "The slow brown fox jumps high.\n",
+			want:  "The <del>quick</del> <ins>slow</ins> brown fox <del>jumps.</del> <ins>jumps high.</ins>\n",
+			stats: core.DiffStats{Insertions: 3, Deletions: 2},
+		},
+		{
+			name:  "critic markup",
+			old:   "The quick brown fox.\n",
+			new:   "The brown fox.\n\nA new paragraph.\n",
+			style: core.DiffStyleCritic,
+			want:  "The {--quick--} brown fox.\n\n{++A new paragraph.++}\n",
+			stats: core.DiffStats{Insertions: 3, Deletions: 1},
+		},
+		{
+			name:  "cjk characters",
+			old:   "今天天气很好。\n",
+			new:   "今天天气不好。\n",
+			want:  "今天天气<del>很</del><ins>不</ins>好。\n",
+			stats: core.DiffStats{Insertions: 1, Deletions: 1},
+		},
+		{
+			name:  "images",
+			old:   "Before\n\n![](static/imgA.png)\n\n![](static/imgB.png)\n",
+			new:   "Before\n\n![](imgA)\n\n![](imgC)\n",
+			want:  "Before\n\n![](static/imgA.png)\n\n<del class=\"image-replaced\">![](static/imgB.png)</del><ins class=\"image-replaced\">![](imgC)</ins>\n",
+			stats: core.DiffStats{ReplacedImages: 1},
+		},
+		{
+			name:  "lines are marked separately",
+			old:   "Keep\n",
+			new:   "Keep\n\n- one\n- two\n",
+			want:  "Keep\n\n<ins>- one</ins>\n<ins>- two</ins>\n",
+			stats: core.DiffStats{Insertions: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stats := core.InlineDiff(tt.old, tt.new, core.DiffOptions{Style: tt.style})
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.stats, stats)
+			assert.Equal(t, tt.stats.Insertions+tt.stats.Deletions+tt.stats.ReplacedImages > 0, stats.Changed())
+		})
+	}
+}
+
+func TestInlineDiffLongDocument(t *testing.T) {
+	words := make([]string, 20000)
+	for i := range words {
+		words[i] = "word"
+	}
+	old := strings.Join(words, " ")
+	words[10000] = "changed"
+	_, stats := core.InlineDiff(old, strings.Join(words, " "), core.DiffOptions{})
+	assert.Equal(t, core.DiffStats{Insertions: 1, Deletions: 1}, stats)
+}
+
+func TestStripFrontMatter(t *testing.T) {
+	assert.Equal(t, "# Title\n", core.StripFrontMatter("---\ntitle: Title\n---\n\n# Title\n"))
+	assert.Equal(t, "# Title\n---\n", core.StripFrontMatter("# Title\n---\n"))
+}
@@ -0,0 +1,84 @@
+package core_test
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadListSequences reads the sequences of the ordered blocks of a fixture,
+// which the lark sdk drops when decoding the blocks.
+func loadListSequences(t *testing.T, name string) map[string]string {
+	data, err := os.ReadFile(path.Join(utils.RootDir(), "testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := struct {
+		Blocks []struct {
+			BlockID string `json:"block_id"`
+			Ordered *struct {
+				Style struct {
+					Sequence string `json:"sequence"`
+				} `json:"style"`
+			} `json:"ordered"`
+		} `json:"blocks"`
+	}{}
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatal(err)
+	}
+	sequences := make(map[string]string)
+	for _, block := range fixture.Blocks {
+		if block.Ordered != nil && block.Ordered.Style.Sequence != "" {
+			sequences[block.BlockID] = block.Ordered.Style.Sequence
+		}
+	}
+	return sequences
+}
+
+func TestParseListStartFromBlock(t *testing.T) {
+	doc, blocks := loadTestdocx(t, "testlists")
+	config := core.NewConfig("", "").Output
+	config.ListStartFromBlock = true
+	parser := core.NewParser(config)
+	parser.SetListSequences(loadListSequences(t, "testlists"))
+	md := parser.ParseDocxContent(doc, blocks)
+
+	// the start number survives formatting, nested lists still number from 1
+	_, md, err := config.FormatDocument(core.DocumentMeta{
+		Title: doc.Title,
+		URL:   "https://domain.feishu.cn/docx/" + doc.DocumentID,
+	}, md)
+	assert.NoError(t, err)
+
+	goldenPath := path.Join(utils.RootDir(), "testdata", "testlists.md")
+	if *updateGolden {
+		assert.NoError(t, os.WriteFile(goldenPath, []byte(md), 0o644))
+	}
+	expected, err := os.ReadFile(goldenPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), md)
+}
+
+func TestParseListStartFromBlockDisabled(t *testing.T) {
+	doc, blocks := loadTestdocx(t, "testlists")
+	sequences := loadListSequences(t, "testlists")
+
+	// the sequences are ignored unless output.list_start_from_block is set
+	parser := core.NewParser(core.NewConfig("", "").Output)
+	parser.SetListSequences(sequences)
+	md := parser.ParseDocxContent(doc, blocks)
+	assert.Contains(t, md, "1. item thirty-seven")
+	assert.NotContains(t, md, "37.")
+
+	// documents without the sequences are numbered from 1 as before
+	config := core.NewConfig("", "").Output
+	config.ListStartFromBlock = true
+	md = core.NewParser(config).ParseDocxContent(doc, blocks)
+	assert.Contains(t, md, "1. item thirty-seven")
+	assert.Contains(t, md, "3. item thirty-nine")
+}
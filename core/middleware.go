@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chyroc/lark"
+	"golang.org/x/time/rate"
+)
+
+// Middleware runs around every call of an API. method is the name of the
+// API method and next performs the call.
+type Middleware func(ctx context.Context, method string, next func(ctx context.Context) error) error
+
+type middlewareAPI struct {
+	api API
+	mw  Middleware
+}
+
+// WithMiddleware returns an API that passes every call of api through mw.
+func WithMiddleware(api API, mw Middleware) API {
+	return &middlewareAPI{api: api, mw: mw}
+}
+
+// RateLimit returns a middleware allowing n calls per interval.
+func RateLimit(n int, interval time.Duration) Middleware {
+	limiter := rate.NewLimiter(rate.Every(interval/time.Duration(n)), n)
+	return func(ctx context.Context, method string, next func(ctx context.Context) error) error {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		return next(ctx)
+	}
+}
+
+// MethodMetrics are the collected numbers of one API method.
+type MethodMetrics struct {
+	Method   string        `json:"method"`
+	Calls    int           `json:"calls"`
+	Errors   int           `json:"errors"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Metrics counts calls, errors and time spent per API method.
+type Metrics struct {
+	mu      sync.Mutex
+	methods map[string]*MethodMetrics
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{methods: make(map[string]*MethodMetrics)}
+}
+
+func (m *Metrics) Middleware() Middleware {
+	return func(ctx context.Context, method string, next func(ctx context.Context) error) error {
+		start := time.Now()
+		err := next(ctx)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		mm, ok := m.methods[method]
+		if !ok {
+			mm = &MethodMetrics{Method: method}
+			m.methods[method] = mm
+		}
+		mm.Calls++
+		mm.Duration += time.Since(start)
+		if err != nil {
+			mm.Errors++
+		}
+		return err
+	}
+}
+
+// Snapshot returns the metrics sorted by method name.
+func (m *Metrics) Snapshot() []MethodMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]MethodMetrics, 0, len(m.methods))
+	for _, mm := range m.methods {
+		result = append(result, *mm)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Method < result[j].Method })
+	return result
+}
+
+func (a *middlewareAPI) GetDocxDocument(ctx context.Context, docToken string) (docx *lark.DocxDocument, err error) {
+	err = a.mw(ctx, "GetDocxDocument", func(ctx context.Context) error {
+		docx, err = a.api.GetDocxDocument(ctx, docToken)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetDocxContent(ctx context.Context, docToken string) (docx *lark.DocxDocument, blocks []*lark.DocxBlock, err error) {
+	err = a.mw(ctx, "GetDocxContent", func(ctx context.Context) error {
+		docx, blocks, err = a.api.GetDocxContent(ctx, docToken)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetDocxCover(ctx context.Context, docToken string) (cover string, err error) {
+	err = a.mw(ctx, "GetDocxCover", func(ctx context.Context) error {
+		cover, err = a.api.GetDocxCover(ctx, docToken)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetDocxListSequences(ctx context.Context, documentID string) (sequences map[string]string, err error) {
+	err = a.mw(ctx, "GetDocxListSequences", func(ctx context.Context) error {
+		sequences, err = a.api.GetDocxListSequences(ctx, documentID)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetDocxBoards(ctx context.Context, documentID string) (boards map[string]Board, err error) {
+	err = a.mw(ctx, "GetDocxBoards", func(ctx context.Context) error {
+		boards, err = a.api.GetDocxBoards(ctx, documentID)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetWikiNodeInfo(ctx context.Context, token string) (node *lark.GetWikiNodeRespNode, err error) {
+	err = a.mw(ctx, "GetWikiNodeInfo", func(ctx context.Context) error {
+		node, err = a.api.GetWikiNodeInfo(ctx, token)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetWikiNodeByObj(ctx context.Context, objToken, objType string) (node *lark.GetWikiNodeRespNode, err error) {
+	err = a.mw(ctx, "GetWikiNodeByObj", func(ctx context.Context) error {
+		node, err = a.api.GetWikiNodeByObj(ctx, objToken, objType)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetWikiName(ctx context.Context, spaceID string) (name string, err error) {
+	err = a.mw(ctx, "GetWikiName", func(ctx context.Context) error {
+		name, err = a.api.GetWikiName(ctx, spaceID)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetWikiNodeList(ctx context.Context, spaceID string, parentNodeToken *string) (nodes []*WikiNode, err error) {
+	err = a.mw(ctx, "GetWikiNodeList", func(ctx context.Context) error {
+		nodes, err = a.api.GetWikiNodeList(ctx, spaceID, parentNodeToken)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetWikiSpace(ctx context.Context, spaceID string) (space *lark.GetWikiSpaceRespSpace, err error) {
+	err = a.mw(ctx, "GetWikiSpace", func(ctx context.Context) error {
+		space, err = a.api.GetWikiSpace(ctx, spaceID)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetWikiSpaceList(ctx context.Context) (spaces []*lark.GetWikiSpaceListRespItem, err error) {
+	err = a.mw(ctx, "GetWikiSpaceList", func(ctx context.Context) error {
+		spaces, err = a.api.GetWikiSpaceList(ctx)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetWikiSpaceMembers(ctx context.Context, spaceID string) (members []WikiSpaceMember, err error) {
+	err = a.mw(ctx, "GetWikiSpaceMembers", func(ctx context.Context) error {
+		members, err = a.api.GetWikiSpaceMembers(ctx, spaceID)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetDriveFolderFileList(ctx context.Context, pageToken *string, folderToken *string) (files []*lark.GetDriveFileListRespFile, err error) {
+	err = a.mw(ctx, "GetDriveFolderFileList", func(ctx context.Context) error {
+		files, err = a.api.GetDriveFolderFileList(ctx, pageToken, folderToken)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetDriveFolderName(ctx context.Context, folderToken string) (name string, err error) {
+	err = a.mw(ctx, "GetDriveFolderName", func(ctx context.Context) error {
+		name, err = a.api.GetDriveFolderName(ctx, folderToken)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetDocCollaborators(ctx context.Context, token, objType string) (members []*lark.GetDriveMemberPermissionListRespMember, err error) {
+	err = a.mw(ctx, "GetDocCollaborators", func(ctx context.Context) error {
+		members, err = a.api.GetDocCollaborators(ctx, token, objType)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetDocPublicPermission(ctx context.Context, token, objType string) (perm *lark.GetDrivePublicPermissionRespPermissionPublic, err error) {
+	err = a.mw(ctx, "GetDocPublicPermission", func(ctx context.Context) error {
+		perm, err = a.api.GetDocPublicPermission(ctx, token, objType)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) DownloadBoardImage(ctx context.Context, boardToken, dir string) (path string, err error) {
+	err = a.mw(ctx, "DownloadBoardImage", func(ctx context.Context) error {
+		path, err = a.api.DownloadBoardImage(ctx, boardToken, dir)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) DownloadAttachment(ctx context.Context, fileToken, dir string, namer AttachmentNamer) (path string, err error) {
+	err = a.mw(ctx, "DownloadAttachment", func(ctx context.Context) error {
+		path, err = a.api.DownloadAttachment(ctx, fileToken, dir, namer)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) DownloadDriveFile(ctx context.Context, fileToken, path string, maxBytes int64) (size int64, err error) {
+	err = a.mw(ctx, "DownloadDriveFile", func(ctx context.Context) error {
+		size, err = a.api.DownloadDriveFile(ctx, fileToken, path, maxBytes)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) DownloadImage(ctx context.Context, imgToken, outDir string) (filename string, err error) {
+	err = a.mw(ctx, "DownloadImage", func(ctx context.Context) error {
+		filename, err = a.api.DownloadImage(ctx, imgToken, outDir)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) DownloadImageRaw(ctx context.Context, imgToken, imgDir string) (filename string, data []byte, err error) {
+	err = a.mw(ctx, "DownloadImageRaw", func(ctx context.Context) error {
+		filename, data, err = a.api.DownloadImageRaw(ctx, imgToken, imgDir)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetSheetContent(ctx context.Context, sheetToken string) (sheet *Spreadsheet, err error) {
+	err = a.mw(ctx, "GetSheetContent", func(ctx context.Context) error {
+		sheet, err = a.api.GetSheetContent(ctx, sheetToken)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetBitableRecords(ctx context.Context, appToken string) (sheet *Spreadsheet, err error) {
+	err = a.mw(ctx, "GetBitableRecords", func(ctx context.Context) error {
+		sheet, err = a.api.GetBitableRecords(ctx, appToken)
+		return err
+	})
+	return
+}
+
+func (a *middlewareAPI) GetUserName(ctx context.Context, openID string) (name string, err error) {
+	err = a.mw(ctx, "GetUserName", func(ctx context.Context) error {
+		name, err = a.api.GetUserName(ctx, openID)
+		return err
+	})
+	return
+}
@@ -0,0 +1,77 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubAPI 只实现测试用到的方法，其余方法调用时会panic
+type stubAPI struct {
+	core.API
+	nodeCalls int
+}
+
+func (s *stubAPI) GetWikiNodeInfo(ctx context.Context, token string) (*lark.GetWikiNodeRespNode, error) {
+	s.nodeCalls++
+	if token == "missing" {
+		return nil, errors.New("not found")
+	}
+	return &lark.GetWikiNodeRespNode{NodeToken: token, ObjToken: "obj_" + token}, nil
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	metrics := core.NewMetrics()
+	api := core.WithMiddleware(&stubAPI{}, metrics.Middleware())
+
+	node, err := api.GetWikiNodeInfo(context.Background(), "wikcn1")
+	assert.NoError(t, err)
+	assert.Equal(t, "obj_wikcn1", node.ObjToken)
+	_, err = api.GetWikiNodeInfo(context.Background(), "missing")
+	assert.Error(t, err)
+
+	snapshot := metrics.Snapshot()
+	if assert.Len(t, snapshot, 1) {
+		assert.Equal(t, "GetWikiNodeInfo", snapshot[0].Method)
+		assert.Equal(t, 2, snapshot[0].Calls)
+		assert.Equal(t, 1, snapshot[0].Errors)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	api := core.WithMiddleware(&stubAPI{}, core.RateLimit(1, time.Hour))
+	ctx := context.Background()
+	_, err := api.GetWikiNodeInfo(ctx, "wikcn1")
+	assert.NoError(t, err)
+
+	// 令牌用完后，调用应等待直到上下文超时
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = api.GetWikiNodeInfo(ctx, "wikcn2")
+	assert.Error(t, err)
+}
+
+func TestCachedAPI(t *testing.T) {
+	stub := &stubAPI{}
+	api := core.NewCachedAPI(stub)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		node, err := api.GetWikiNodeInfo(ctx, "wikcn1")
+		assert.NoError(t, err)
+		assert.Equal(t, "obj_wikcn1", node.ObjToken)
+	}
+	assert.Equal(t, 1, stub.nodeCalls)
+
+	// 失败的查询不缓存
+	_, err := api.GetWikiNodeInfo(ctx, "missing")
+	assert.Error(t, err)
+	_, err = api.GetWikiNodeInfo(ctx, "missing")
+	assert.Error(t, err)
+	assert.Equal(t, 3, stub.nodeCalls)
+}
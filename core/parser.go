@@ -2,8 +2,11 @@ package core
 
 import (
 	"fmt"
+	"html"
 	"reflect"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/Wsine/feishu2md/utils"
 	"github.com/chyroc/lark"
@@ -11,19 +14,99 @@ import (
 )
 
 type Parser struct {
-	useHTMLTags bool
-	ImgTokens   []string
-	blockMap    map[string]*lark.DocxBlock
+	useHTMLTags     bool
+	ImgTokens       []string
+	FileTokens      []string // attachments of file blocks, in document order
+	Boards          []Board  // boards rendered as images, in document order
+	boards          map[string]Board
+	blockMap        map[string]*lark.DocxBlock
+	fenceAttrsTmpl  *template.Template
+	fenceAttrs      map[string]string
+	codeLineNumbers bool
+	bareLinks       string
+	inTable         bool
+	imageDimensions string
+	unsizedImgs     map[string]bool // images without dimensions in the document
+	preserveColors  bool
+	escaper         *textEscaper // nil leaves plain text as is
+	inCode          bool         // inside a code block, where nothing is escaped
+	lineStart       bool         // the next text run starts a line
+	documentID      string
+	headings        []tocHeading // computed once a table of contents is rendered
+	// runs of images rendered by the gallery template, nil keeps them as is
+	galleryTmpl      *template.Template
+	galleryMinImages int
+	galleries        [][]GalleryImage
+	resolvedImgs     map[string]GalleryImage // local links passed to ResolveImage
+	// the fixes of output.html.accessibility
+	accessible       bool
+	imageAlt         string
+	lastHeadingLevel int
+	altlessImages    int
+	emptyHeaders     int
+	// the first ordered list of the document numbered from listStart
+	listStartFromBlock bool
+	listSequences      map[string]string
+	listStartBlock     string
+	listStart          int
+	quality            ConversionQuality
+	// the plain text mode of TextParser, where blocks are rendered without
+	// markup and links keep their urls only with keepLinks
+	plainText bool
+	keepLinks bool
+	// Warnings lists the accessibility issues fixed or left in the document
+	Warnings []string
 }
 
 func NewParser(config OutputConfig) *Parser {
+	// an invalid template is rejected by OutputConfig.Validate beforehand
+	fenceAttrsTmpl, _ := NewCodeFenceAttrsTemplate(config.CodeFenceAttrs)
+	galleryTmpl, _ := NewGalleryTemplate(config.GalleryTemplate)
+	galleryMinImages := config.GalleryMinImages
+	if galleryMinImages <= 0 {
+		galleryMinImages = DefaultGalleryMinImages
+	}
+	var escaper *textEscaper
+	if config.EscapeText {
+		escaper = &textEscaper{dialect: config.ResolveDialect()}
+	}
+	var imageAlt string
+	if config.HTML.Accessibility {
+		imageAlt = DefaultImageAlt
+	}
 	return &Parser{
-		useHTMLTags: config.UseHTMLTags,
-		ImgTokens:   make([]string, 0),
-		blockMap:    make(map[string]*lark.DocxBlock),
+		useHTMLTags:     config.UseHTMLTags,
+		ImgTokens:       make([]string, 0),
+		FileTokens:      make([]string, 0),
+		blockMap:        make(map[string]*lark.DocxBlock),
+		fenceAttrsTmpl:  fenceAttrsTmpl,
+		fenceAttrs:      make(map[string]string),
+		codeLineNumbers: config.CodeLineNumbers,
+		bareLinks:       config.BareLinks,
+		imageDimensions: config.ImageDimensions,
+		unsizedImgs:     make(map[string]bool),
+		preserveColors:  config.PreserveColors,
+		escaper:         escaper,
+
+		galleryTmpl:      galleryTmpl,
+		galleryMinImages: galleryMinImages,
+		resolvedImgs:     make(map[string]GalleryImage),
+
+		accessible:       config.HTML.Accessibility,
+		imageAlt:         imageAlt,
+		lastHeadingLevel: 1,
+
+		listStartFromBlock: config.ListStartFromBlock,
 	}
 }
 
+// SetListSequences passes the sequences of the ordered list blocks, as
+// returned by GetDocxListSequences, which the lark sdk leaves out of the
+// blocks. They only apply with output.list_start_from_block.
+func (p *Parser) SetListSequences(sequences map[string]string) {
+	p.listSequences = sequences
+}
+
 // =============================================================
 // Parser utils
 // =============================================================
@@ -120,14 +203,20 @@ func (p *Parser) ParseDocxContent(doc *lark.DocxDocument, blocks []*lark.DocxBlo
 	for _, block := range blocks {
 		p.blockMap[block.BlockID] = block
 	}
+	p.documentID = doc.DocumentID
 
 	entryBlock := p.blockMap[doc.DocumentID]
-	return p.ParseDocxBlock(entryBlock, 0)
+	p.findListStart(entryBlock)
+	markdown := p.ParseDocxBlock(entryBlock, 0)
+	p.accessibilityWarnings()
+	return markdown
 }
 
 func (p *Parser) ParseDocxBlock(b *lark.DocxBlock, indentLevel int) string {
 	buf := new(strings.Builder)
-	buf.WriteString(strings.Repeat("\t", indentLevel))
+	if !p.plainText {
+		buf.WriteString(strings.Repeat("\t", indentLevel))
+	}
 	switch b.BlockType {
 	case lark.DocxBlockTypePage:
 		buf.WriteString(p.ParseDocxBlockPage(b))
@@ -158,49 +247,111 @@ func (p *Parser) ParseDocxBlock(b *lark.DocxBlock, indentLevel int) string {
 	case lark.DocxBlockTypeOrdered:
 		buf.WriteString(p.ParseDocxBlockOrdered(b, indentLevel))
 	case lark.DocxBlockTypeCode:
-		buf.WriteString("```" + DocxCodeLang2MdStr[b.Code.Style.Language] + "\n")
+		if p.plainText {
+			buf.WriteString(strings.TrimSpace(p.ParseDocxBlockText(b.Code)) + "\n")
+			break
+		}
+		buf.WriteString("```" + DocxCodeLang2MdStr[b.Code.Style.Language])
+		buf.WriteString(p.codeFenceAttrs(b.Code.Style) + "\n")
+		p.inCode = true
 		buf.WriteString(strings.TrimSpace(p.ParseDocxBlockText(b.Code)))
+		p.inCode = false
 		buf.WriteString("\n```\n")
 	case lark.DocxBlockTypeQuote:
-		buf.WriteString("> ")
+		if !p.plainText {
+			buf.WriteString("> ")
+		}
 		buf.WriteString(p.ParseDocxBlockText(b.Quote))
 	case lark.DocxBlockTypeEquation:
+		if p.plainText {
+			buf.WriteString(strings.TrimSpace(p.ParseDocxBlockText(b.Equation)) + "\n")
+			break
+		}
 		buf.WriteString("$$\n")
 		buf.WriteString(p.ParseDocxBlockText(b.Equation))
 		buf.WriteString("\n$$\n")
 	case lark.DocxBlockTypeTodo:
-		if b.Todo.Style.Done {
-			buf.WriteString("- [x] ")
+		if !p.plainText {
+			buf.WriteString("- ")
+		}
+		if b.Todo.Style != nil && b.Todo.Style.Done {
+			buf.WriteString("[x] ")
 		} else {
-			buf.WriteString("- [ ] ")
+			buf.WriteString("[ ] ")
 		}
 		buf.WriteString(p.ParseDocxBlockText(b.Todo))
+	// images, dividers and attachments carry no searchable text
 	case lark.DocxBlockTypeDivider:
-		buf.WriteString("---\n")
+		if !p.plainText {
+			buf.WriteString("---\n")
+		}
 	case lark.DocxBlockTypeImage:
-		buf.WriteString(p.ParseDocxBlockImage(b.Image))
+		if !p.plainText {
+			buf.WriteString(p.ParseDocxBlockImage(b.Image))
+		}
+	case lark.DocxBlockTypeView:
+		if !p.plainText {
+			buf.WriteString(p.ParseDocxBlockView(b))
+		}
+	case lark.DocxBlockTypeFile:
+		if !p.plainText {
+			buf.WriteString(p.ParseDocxBlockFile(b.File))
+		}
 	case lark.DocxBlockTypeTableCell:
 		buf.WriteString(p.ParseDocxBlockTableCell(b))
 	case lark.DocxBlockTypeTable:
+		if p.plainText {
+			buf.WriteString(p.plainTable(b.Table))
+			break
+		}
 		buf.WriteString(p.ParseDocxBlockTable(b.Table))
 	case lark.DocxBlockTypeQuoteContainer:
 		buf.WriteString(p.ParseDocxBlockQuoteContainer(b))
 	case lark.DocxBlockTypeGrid:
+		if p.plainText {
+			buf.WriteString(p.plainGrid(b))
+			break
+		}
 		buf.WriteString(p.ParseDocxBlockGrid(b, indentLevel))
+	case DocxBlockTypeTOC:
+		if !p.plainText {
+			buf.WriteString(p.ParseDocxBlockTOC())
+		}
+	case DocxBlockTypeBoard:
+		board, ok := p.boards[b.BlockID]
+		if !ok {
+			p.dropBlock(b)
+			return buf.String()
+		}
+		if !p.plainText {
+			buf.WriteString(p.ParseDocxBlockBoard(board))
+		}
 	default:
+		p.dropBlock(b)
+		return buf.String()
 	}
+	p.countBlock(b)
 	return buf.String()
 }
 
 func (p *Parser) ParseDocxBlockPage(b *lark.DocxBlock) string {
+	if p.plainText {
+		return p.plainLine(b.Page) + "\n" + p.plainChildren(b.Children)
+	}
 	buf := new(strings.Builder)
 
 	buf.WriteString("# ")
 	buf.WriteString(p.ParseDocxBlockText(b.Page))
 	buf.WriteString("\n")
 
-	for _, childId := range b.Children {
-		childBlock := p.blockMap[childId]
+	for i := 0; i < len(b.Children); i++ {
+		if gallery, n := p.parseGalleryRun(b.Children, i); n > 0 {
+			buf.WriteString(gallery)
+			buf.WriteString("\n")
+			i += n - 1
+			continue
+		}
+		childBlock := p.blockMap[b.Children[i]]
 		buf.WriteString(p.ParseDocxBlock(childBlock, 0))
 		buf.WriteString("\n")
 	}
@@ -209,17 +360,65 @@ func (p *Parser) ParseDocxBlockPage(b *lark.DocxBlock) string {
 }
 
 func (p *Parser) ParseDocxBlockText(b *lark.DocxBlockText) string {
+	if p.plainText {
+		return p.plainLine(b)
+	}
 	buf := new(strings.Builder)
 	numElem := len(b.Elements)
-	for _, e := range b.Elements {
+	p.lineStart = true
+	for i := 0; i < numElem; i++ {
+		e := b.Elements[i]
+		// Feishu splits a hyperlink with mixed styles into several runs,
+		// merge them back so that the anchor text stays within one link.
+		if url := textRunLinkURL(e); url != "" {
+			text := new(strings.Builder)
+			plain := new(strings.Builder)
+			for ; i < numElem && textRunLinkURL(b.Elements[i]) == url; i++ {
+				text.WriteString(p.renderTextRunStyle(b.Elements[i].TextRun))
+				plain.WriteString(b.Elements[i].TextRun.Content)
+			}
+			i--
+			buf.WriteString(p.renderLink(text.String(), plain.String(), url))
+			continue
+		}
 		inline := numElem > 1
 		buf.WriteString(p.ParseDocxTextElement(e, inline))
+		p.lineStart = false
 	}
 	buf.WriteString("\n")
 	return buf.String()
 }
 
+func textRunLinkURL(e *lark.DocxTextElement) string {
+	if e.TextRun == nil || e.TextRun.TextElementStyle == nil ||
+		e.TextRun.TextElementStyle.Link == nil {
+		return ""
+	}
+	return e.TextRun.TextElementStyle.Link.URL
+}
+
+// renderLink renders a hyperlink, keeping the anchor text whatever styles it
+// carries. Links inside tables are written as html since the table itself is
+// an html block where markdown is not parsed.
+func (p *Parser) renderLink(text, plain, rawURL string) string {
+	decoded := utils.UnescapeURL(rawURL)
+	url := utils.EscapeURLForMarkdown(decoded)
+	if text == "" {
+		text = url
+	}
+	if p.inTable {
+		return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), text)
+	}
+	if p.bareLinks == "autolink" && strings.TrimSpace(plain) == decoded {
+		return "<" + url + ">"
+	}
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
 func (p *Parser) ParseDocxBlockCallout(b *lark.DocxBlock) string {
+	if p.plainText {
+		return p.plainChildren(b.Children)
+	}
 	buf := new(strings.Builder)
 
 	buf.WriteString(">[!TIP] \n")
@@ -240,8 +439,7 @@ func (p *Parser) ParseDocxTextElement(e *lark.DocxTextElement, inline bool) stri
 		buf.WriteString(e.MentionUser.UserID)
 	}
 	if e.MentionDoc != nil {
-		buf.WriteString(
-			fmt.Sprintf("[%s](%s)", e.MentionDoc.Title, utils.UnescapeURL(e.MentionDoc.URL)))
+		buf.WriteString(p.renderLink(e.MentionDoc.Title, e.MentionDoc.Title, e.MentionDoc.URL))
 	}
 	if e.Equation != nil {
 		symbol := "$$"
@@ -254,11 +452,30 @@ func (p *Parser) ParseDocxTextElement(e *lark.DocxTextElement, inline bool) stri
 }
 
 func (p *Parser) ParseDocxTextElementTextRun(tr *lark.DocxTextElementTextRun) string {
+	text := p.renderTextRunStyle(tr)
+	if style := tr.TextElementStyle; style != nil && style.Link != nil {
+		return p.renderLink(text, tr.Content, style.Link.URL)
+	}
+	return text
+}
+
+// renderTextRunStyle renders the content of a text run with its inline
+// styles, links are left to the caller.
+func (p *Parser) renderTextRunStyle(tr *lark.DocxTextElementTextRun) string {
+	// markdown is not parsed inside the html table, so styles in cells are
+	// always written as html tags
+	useHTML := p.useHTMLTags || p.inTable
+	content := tr.Content
+	if p.inTable {
+		content = htmlTextEscaper.Replace(content)
+	}
+	lineStart := p.lineStart
+	p.lineStart = false
 	buf := new(strings.Builder)
 	postWrite := ""
 	if style := tr.TextElementStyle; style != nil {
 		if style.Bold {
-			if p.useHTMLTags {
+			if useHTML {
 				buf.WriteString("<strong>")
 				postWrite = "</strong>"
 			} else {
@@ -266,7 +483,7 @@ func (p *Parser) ParseDocxTextElementTextRun(tr *lark.DocxTextElementTextRun) st
 				postWrite = "**"
 			}
 		} else if style.Italic {
-			if p.useHTMLTags {
+			if useHTML {
 				buf.WriteString("<em>")
 				postWrite = "</em>"
 			} else {
@@ -274,7 +491,7 @@ func (p *Parser) ParseDocxTextElementTextRun(tr *lark.DocxTextElementTextRun) st
 				postWrite = "_"
 			}
 		} else if style.Strikethrough {
-			if p.useHTMLTags {
+			if useHTML {
 				buf.WriteString("<del>")
 				postWrite = "</del>"
 			} else {
@@ -285,26 +502,39 @@ func (p *Parser) ParseDocxTextElementTextRun(tr *lark.DocxTextElementTextRun) st
 			buf.WriteString("<u>")
 			postWrite = "</u>"
 		} else if style.InlineCode {
-			buf.WriteString("`")
-			postWrite = "`"
-		} else if link := style.Link; link != nil {
-			buf.WriteString("[")
-			postWrite = fmt.Sprintf("](%s)", utils.UnescapeURL(link.URL))
+			if p.inTable {
+				buf.WriteString("<code>")
+				postWrite = "</code>"
+			} else {
+				buf.WriteString("`")
+				postWrite = "`"
+			}
 		}
 	}
-	buf.WriteString(tr.Content)
+	// code spans, code blocks and html table cells keep their text literally
+	if p.escaper != nil && !p.inCode && !p.inTable && postWrite != "`" {
+		content = p.escaper.escape(content, lineStart && postWrite == "")
+	}
+	buf.WriteString(content)
 	buf.WriteString(postWrite)
-	return buf.String()
+	return p.renderTextRunColor(tr.TextElementStyle, buf.String())
 }
 
 func (p *Parser) ParseDocxBlockHeading(b *lark.DocxBlock, headingLevel int) string {
 	buf := new(strings.Builder)
 
-	buf.WriteString(strings.Repeat("#", headingLevel))
+	text := docxHeadingText(b, headingLevel)
+	if p.plainText {
+		return p.plainLine(text) + p.plainChildren(b.Children)
+	}
+	level := headingLevel
+	if p.accessible {
+		level = p.fixHeadingLevel(p.plainInline(text), headingLevel)
+	}
+	buf.WriteString(strings.Repeat("#", level))
 	buf.WriteString(" ")
 
-	headingText := reflect.ValueOf(b).Elem().FieldByName(fmt.Sprintf("Heading%d", headingLevel))
-	buf.WriteString(p.ParseDocxBlockText(headingText.Interface().(*lark.DocxBlockText)))
+	buf.WriteString(p.ParseDocxBlockText(text))
 
 	for _, childId := range b.Children {
 		childBlock := p.blockMap[childId]
@@ -314,14 +544,56 @@ func (p *Parser) ParseDocxBlockHeading(b *lark.DocxBlock, headingLevel int) stri
 	return buf.String()
 }
 
+func docxHeadingText(b *lark.DocxBlock, headingLevel int) *lark.DocxBlockText {
+	headingText := reflect.ValueOf(b).Elem().FieldByName(fmt.Sprintf("Heading%d", headingLevel))
+	return headingText.Interface().(*lark.DocxBlockText)
+}
+
 func (p *Parser) ParseDocxBlockImage(img *lark.DocxBlockImage) string {
 	buf := new(strings.Builder)
-	buf.WriteString(fmt.Sprintf("![](%s)", img.Token))
+	buf.WriteString(p.RenderImage(img.Token, img.Width, img.Height))
 	buf.WriteString("\n")
+	if img.Width <= 0 || img.Height <= 0 {
+		p.unsizedImgs[img.Token] = true
+	}
+	if p.accessible {
+		p.altlessImages++
+	}
 	p.ImgTokens = append(p.ImgTokens, img.Token)
 	return buf.String()
 }
 
+// ParseDocxBlockView renders the file blocks shown by the view block.
+func (p *Parser) ParseDocxBlockView(b *lark.DocxBlock) string {
+	buf := new(strings.Builder)
+	for _, childId := range b.Children {
+		if childBlock, ok := p.blockMap[childId]; ok {
+			buf.WriteString(p.ParseDocxBlock(childBlock, 0))
+		}
+	}
+	return buf.String()
+}
+
+// ParseDocxBlockFile renders the attachment as a link to its token, which is
+// replaced with the local file by ResolveFile once downloaded.
+func (p *Parser) ParseDocxBlockFile(file *lark.DocxBlockFile) string {
+	name := file.Name
+	if name == "" {
+		name = file.Token
+	}
+	name = strings.NewReplacer("[", "\\[", "]", "\\]").Replace(name)
+	p.FileTokens = append(p.FileTokens, file.Token)
+	return fmt.Sprintf("[%s](%s)\n", name, file.Token)
+}
+
+// ResolveFile replaces the attachment token with its local link.
+func (p *Parser) ResolveFile(markdown, token, link string) string {
+	if strings.ContainsAny(link, " ()<>") {
+		link = "<" + link + ">"
+	}
+	return strings.Replace(markdown, "]("+token+")", "]("+link+")", 1)
+}
+
 func (p *Parser) ParseDocxWhatever(body *lark.DocBody) string {
 	buf := new(strings.Builder)
 
@@ -345,13 +617,28 @@ func (p *Parser) ParseDocxBlockBullet(b *lark.DocxBlock, indentLevel int) string
 func (p *Parser) ParseDocxBlockOrdered(b *lark.DocxBlock, indentLevel int) string {
 	buf := new(strings.Builder)
 
-	// calculate order and indent level
-	parent := p.blockMap[b.ParentID]
+	order := orderedIndex(p.blockMap, b)
+	order += p.listStartOffset(b, order)
+	buf.WriteString(fmt.Sprintf("%d. ", order))
+	buf.WriteString(p.ParseDocxBlockText(b.Ordered))
+
+	for _, childId := range b.Children {
+		childBlock := p.blockMap[childId]
+		buf.WriteString(p.ParseDocxBlock(childBlock, indentLevel+1))
+	}
+
+	return buf.String()
+}
+
+// orderedIndex calculates the number of an ordered list item, counting the
+// ordered siblings right before it.
+func orderedIndex(blockMap map[string]*lark.DocxBlock, b *lark.DocxBlock) int {
+	parent := blockMap[b.ParentID]
 	order := 1
 	for idx, child := range parent.Children {
 		if child == b.BlockID {
 			for i := idx - 1; i >= 0; i-- {
-				if p.blockMap[parent.Children[i]].BlockType == lark.DocxBlockTypeOrdered {
+				if blockMap[parent.Children[i]].BlockType == lark.DocxBlockTypeOrdered {
 					order += 1
 				} else {
 					break
@@ -360,16 +647,45 @@ func (p *Parser) ParseDocxBlockOrdered(b *lark.DocxBlock, indentLevel int) strin
 			break
 		}
 	}
+	return order
+}
 
-	buf.WriteString(fmt.Sprintf("%d. ", order))
-	buf.WriteString(p.ParseDocxBlockText(b.Ordered))
-
-	for _, childId := range b.Children {
-		childBlock := p.blockMap[childId]
-		buf.WriteString(p.ParseDocxBlock(childBlock, indentLevel+1))
+// findListStart looks up the explicit start number of the first ordered
+// list at the top level of the document. Documents whose first item has no
+// sequence, or "auto", are numbered from 1 as usual.
+func (p *Parser) findListStart(page *lark.DocxBlock) {
+	if !p.listStartFromBlock || page == nil {
+		return
 	}
+	for _, child := range page.Children {
+		if block := p.blockMap[child]; block == nil || block.BlockType != lark.DocxBlockTypeOrdered {
+			continue
+		}
+		if start, err := strconv.Atoi(p.listSequences[child]); err == nil && start > 0 {
+			p.listStartBlock, p.listStart = child, start
+		}
+		return
+	}
+}
 
-	return buf.String()
+// listStartOffset returns how much the item numbered order is shifted, the
+// items following the first one of the document continue from its start
+// number while nested lists number locally.
+func (p *Parser) listStartOffset(b *lark.DocxBlock, order int) int {
+	start := p.blockMap[p.listStartBlock]
+	if start == nil || b.ParentID != start.ParentID {
+		return 0
+	}
+	siblings := p.blockMap[b.ParentID].Children
+	for idx, child := range siblings {
+		if child == b.BlockID {
+			if first := idx - order + 1; first >= 0 && siblings[first] == p.listStartBlock {
+				return p.listStart - 1
+			}
+			break
+		}
+	}
+	return 0
 }
 
 func (p *Parser) ParseDocxBlockTableCell(b *lark.DocxBlock) string {
@@ -402,6 +718,8 @@ func (p *Parser) ParseDocxBlockTable(t *lark.DocxBlockTable) string {
 
 	// 构建表格内容
 
+	p.inTable = true
+	defer func() { p.inTable = false }()
 	for i, blockId := range t.Cells {
 		block := p.blockMap[blockId]
 		cellContent := p.ParseDocxBlock(block, 0)
@@ -449,9 +767,10 @@ func (p *Parser) ParseDocxBlockTable(t *lark.DocxBlockTable) string {
 				if mergeInfo.ColSpan > 1 {
 					attributes += fmt.Sprintf(` colspan="%d"`, mergeInfo.ColSpan)
 				}
+				openTag, closeTag := p.tableCellTag(rowIndex, cellContent)
 				buf.WriteString(fmt.Sprintf(
-					`<td%s>%s</td>`,
-					attributes, cellContent,
+					`%s%s>%s%s`,
+					openTag, attributes, cellContent, closeTag,
 				))
 				// 标记合并范围内的所有单元格为已处理
 				for r := rowIndex; r < rowIndex+int(mergeInfo.RowSpan); r++ {
@@ -461,7 +780,8 @@ func (p *Parser) ParseDocxBlockTable(t *lark.DocxBlockTable) string {
 				}
 			} else {
 				// 普通单元格
-				buf.WriteString(fmt.Sprintf("<td>%s</td>", cellContent))
+				openTag, closeTag := p.tableCellTag(rowIndex, cellContent)
+				buf.WriteString(fmt.Sprintf("%s>%s%s", openTag, cellContent, closeTag))
 			}
 		}
 		buf.WriteString("</tr>\n")
@@ -472,6 +792,9 @@ func (p *Parser) ParseDocxBlockTable(t *lark.DocxBlockTable) string {
 }
 
 func (p *Parser) ParseDocxBlockQuoteContainer(b *lark.DocxBlock) string {
+	if p.plainText {
+		return p.plainChildren(b.Children)
+	}
 	buf := new(strings.Builder)
 
 	for _, child := range b.Children {
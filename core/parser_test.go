@@ -25,6 +25,7 @@ func TestParseDocxContent(t *testing.T) {
 		"testdocx.1",
 		"testdocx.2",
 		"testdocx.3",
+		"testlinks",
 	}
 	for _, td := range testdata {
 		t.Run(td, func(t *testing.T) {
@@ -52,3 +53,149 @@ func TestParseDocxContent(t *testing.T) {
 		})
 	}
 }
+
+func loadTestdocx(t *testing.T, name string) (*lark.DocxDocument, []*lark.DocxBlock) {
+	jsonFile, err := os.ReadFile(path.Join(utils.RootDir(), "testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := struct {
+		Document *lark.DocxDocument `json:"document"`
+		Blocks   []*lark.DocxBlock  `json:"blocks"`
+	}{}
+	if err := json.Unmarshal(jsonFile, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.Document, data.Blocks
+}
+
+func TestParseCodeFenceAttrs(t *testing.T) {
+	engine := lute.New(func(l *lute.Lute) {
+		l.RenderOptions.AutoSpace = true
+	})
+	tests := []struct {
+		name        string
+		attrs       string
+		lineNumbers bool
+		fence       string
+	}{
+		{"plain", "", true, "```bash\n"},
+		{"hugo preset", "hugo", false, "```bash\n"},
+		{"hugo preset with line numbers", "hugo", true, "```bash {linenos=true}\n"},
+		{"custom template", `{.{{.Language}} wrap={{.Wrap}}}`, false, "```bash {.bash wrap=true}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, blocks := loadTestdocx(t, "testdocx.1")
+			config := core.NewConfig("", "").Output
+			config.CodeFenceAttrs = tt.attrs
+			config.CodeLineNumbers = tt.lineNumbers
+			assert.NoError(t, config.Validate())
+
+			parser := core.NewParser(config)
+			md := engine.FormatStr("md", parser.ParseDocxContent(doc, blocks))
+			md = parser.RestoreCodeFenceAttrs(md)
+			assert.Contains(t, md, tt.fence)
+			assert.NotContains(t, md, "feishu2mdfence")
+		})
+	}
+
+	config := core.NewConfig("", "").Output
+	config.CodeFenceAttrs = "{{if .Wrap}"
+	assert.Error(t, config.Validate())
+	// templates failing to execute are rejected up front
+	config.CodeFenceAttrs = "{hl_lines={{.Highlight}}}"
+	assert.ErrorContains(t, config.Validate(), "invalid output.code_fence_attrs template")
+}
+
+func TestParseBareLinks(t *testing.T) {
+	doc, blocks := loadTestdocx(t, "testlinks")
+	config := core.NewConfig("", "").Output
+	config.BareLinks = "autolink"
+	assert.NoError(t, config.Validate())
+
+	md := core.NewParser(config).ParseDocxContent(doc, blocks)
+	assert.Contains(t, md, "Bare: <https://example.com/a?b=1&c=2>")
+	// anchor text different from the url is never turned into an autolink
+	assert.Contains(t, md, "[the **bold part**](https://example.com/docs)")
+}
+
+func TestParseImageDimensions(t *testing.T) {
+	doc := &lark.DocxDocument{DocumentID: "doxcn", Title: "Images"}
+	blocks := []*lark.DocxBlock{
+		{
+			BlockID: "doxcn", BlockType: lark.DocxBlockTypePage, Children: []string{"img1", "img2"},
+			Page: &lark.DocxBlockText{Elements: []*lark.DocxTextElement{
+				{TextRun: &lark.DocxTextElementTextRun{Content: "Images"}},
+			}},
+		},
+		{BlockID: "img1", BlockType: lark.DocxBlockTypeImage,
+			Image: &lark.DocxBlockImage{Token: "boxcnSized", Width: 800, Height: 600}},
+		{BlockID: "img2", BlockType: lark.DocxBlockTypeImage,
+			Image: &lark.DocxBlockImage{Token: "boxcnUnsized"}},
+	}
+
+	tests := []struct {
+		mode    string
+		sized   string
+		unsized string
+	}{
+		{"", "![](static/boxcnSized.png)", "![](static/boxcnUnsized.png)"},
+		{"html", `<img src="static/boxcnSized.png" width="800" height="600" alt="">`,
+			`<img src="static/boxcnUnsized.png" width="32" height="18" alt="">`},
+		{"attrs", "![](static/boxcnSized.png){width=800 height=600}",
+			"![](static/boxcnUnsized.png){width=32 height=18}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config := core.NewConfig("", "").Output
+			config.ImageDimensions = tt.mode
+			assert.NoError(t, config.Validate())
+
+			parser := core.NewParser(config)
+			md := parser.ParseDocxContent(doc, blocks)
+			assert.False(t, parser.NeedsImageSize("boxcnSized"))
+			assert.Equal(t, tt.mode != "", parser.NeedsImageSize("boxcnUnsized"))
+			// 文档中缺少尺寸的图片使用下载后探测到的尺寸
+			md = parser.ResolveImage(md, "boxcnSized", "static/boxcnSized.png", 0, 0)
+			md = parser.ResolveImage(md, "boxcnUnsized", "static/boxcnUnsized.png", 32, 18)
+			assert.Contains(t, md, tt.sized)
+			assert.Contains(t, md, tt.unsized)
+		})
+	}
+
+	config := core.NewConfig("", "").Output
+	config.ImageDimensions = "pixels"
+	assert.Error(t, config.Validate())
+}
+
+func TestParsePreserveColors(t *testing.T) {
+	doc, blocks := loadTestdocx(t, "testcolors")
+	engine := lute.New(func(l *lute.Lute) {
+		l.RenderOptions.AutoSpace = true
+	})
+	tests := []struct {
+		name   string
+		config func(*core.OutputConfig)
+		golden string
+	}{
+		{"plain", func(c *core.OutputConfig) {}, "testcolors.md"},
+		{"preserve_colors", func(c *core.OutputConfig) { c.PreserveColors = true }, "testcolors.preserve.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := core.NewConfig("", "").Output
+			tt.config(&config)
+			md := core.NewParser(config).ParseDocxContent(doc, blocks)
+			md = engine.FormatStr("md", md)
+
+			goldenPath := path.Join(utils.RootDir(), "testdata", tt.golden)
+			if *updateGolden {
+				assert.NoError(t, os.WriteFile(goldenPath, []byte(md), 0o644))
+			}
+			expected, err := os.ReadFile(goldenPath)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), md)
+		})
+	}
+}
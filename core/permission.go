@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+
+	"github.com/chyroc/lark"
+)
+
+type WikiSpaceMember struct {
+	MemberType string `json:"member_type"`
+	MemberID   string `json:"member_id"`
+	MemberRole string `json:"member_role"`
+}
+
+type listWikiSpaceMembersReq struct {
+	SpaceID   string  `path:"space_id" json:"-"`
+	PageToken *string `query:"page_token" json:"-"`
+}
+
+type listWikiSpaceMembersResp struct {
+	Code int64  `json:"code,omitempty"`
+	Msg  string `json:"msg,omitempty"`
+	Data struct {
+		Members   []WikiSpaceMember `json:"members"`
+		HasMore   bool              `json:"has_more"`
+		PageToken string            `json:"page_token"`
+	} `json:"data"`
+}
+
+func (c *Client) GetWikiSpace(ctx context.Context, spaceID string) (*lark.GetWikiSpaceRespSpace, error) {
+	var resp *lark.GetWikiSpaceResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		resp, response, err = c.larkClient.Drive.GetWikiSpace(ctx, &lark.GetWikiSpaceReq{
+			SpaceID: spaceID,
+		})
+		return response, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Space, nil
+}
+
+// GetWikiSpaceList lists the wiki spaces the app can access, which only
+// includes the spaces the app was added to as a member.
+func (c *Client) GetWikiSpaceList(ctx context.Context) ([]*lark.GetWikiSpaceListRespItem, error) {
+	var spaces []*lark.GetWikiSpaceListRespItem
+	var pageToken *string
+	for {
+		var resp *lark.GetWikiSpaceListResp
+		err := c.call(ctx, func() (response *lark.Response, err error) {
+			resp, response, err = c.larkClient.Drive.GetWikiSpaceList(ctx, &lark.GetWikiSpaceListReq{
+				PageToken: pageToken,
+			})
+			return response, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		spaces = append(spaces, resp.Items...)
+		if !resp.HasMore || resp.PageToken == "" {
+			break
+		}
+		pageToken = &resp.PageToken
+	}
+	return spaces, nil
+}
+
+// GetWikiSpaceMembers lists the members and roles of a wiki space. The lark
+// sdk only supports adding and deleting members, so the list API is
+// requested directly.
+func (c *Client) GetWikiSpaceMembers(ctx context.Context, spaceID string) ([]WikiSpaceMember, error) {
+	var members []WikiSpaceMember
+	var pageToken *string
+	for {
+		resp := new(listWikiSpaceMembersResp)
+		err := c.call(ctx, func() (*lark.Response, error) {
+			response, err := c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+				Scope:                 "Drive",
+				API:                   "GetWikiSpaceMemberList",
+				Method:                "GET",
+				URL:                   openBaseURL + "/open-apis/wiki/v2/spaces/:space_id/members",
+				Body:                  &listWikiSpaceMembersReq{SpaceID: spaceID, PageToken: pageToken},
+				NeedTenantAccessToken: true,
+			}, resp)
+			if err == nil {
+				err = codeError("GetWikiSpaceMemberList", resp.Code, resp.Msg)
+			}
+			return response, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, resp.Data.Members...)
+		if !resp.Data.HasMore {
+			break
+		}
+		pageToken = &resp.Data.PageToken
+	}
+	return members, nil
+}
+
+func (c *Client) GetDocCollaborators(ctx context.Context, token, objType string) ([]*lark.GetDriveMemberPermissionListRespMember, error) {
+	var resp *lark.GetDriveMemberPermissionListResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		resp, response, err = c.larkClient.Drive.GetDriveMemberPermissionList(ctx, &lark.GetDriveMemberPermissionListReq{
+			Token: token,
+			Type:  objType,
+		})
+		return response, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Members, nil
+}
+
+func (c *Client) GetDocPublicPermission(ctx context.Context, token, objType string) (*lark.GetDrivePublicPermissionRespPermissionPublic, error) {
+	var resp *lark.GetDrivePublicPermissionResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		resp, response, err = c.larkClient.Drive.GetDrivePublicPermission(ctx, &lark.GetDrivePublicPermissionReq{
+			Token: token,
+			Type:  objType,
+		})
+		return response, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.PermissionPublic, nil
+}
+
+// GetUserName resolves an open id to the user name, which requires one of
+// the contact scopes.
+func (c *Client) GetUserName(ctx context.Context, openID string) (string, error) {
+	idType := lark.IDTypeOpenID
+	var resp *lark.GetUserResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		resp, response, err = c.larkClient.Contact.GetUser(ctx, &lark.GetUserReq{
+			UserID:     openID,
+			UserIDType: &idType,
+		})
+		return response, err
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.User == nil {
+		return "", nil
+	}
+	return resp.User.Name, nil
+}
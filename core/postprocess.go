@@ -0,0 +1,66 @@
+package core
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	PostProcessWarn = "warn"
+	PostProcessFail = "fail"
+
+	defaultPostProcessTimeout = time.Minute
+)
+
+// PostProcessConfig runs external commands over the exported files, an
+// escape hatch for team specific tweaks that do not belong in the parser.
+// The commands are run directly, not through a shell.
+type PostProcessConfig struct {
+	// FileCommand runs once per written markdown file, with the path of the
+	// file appended as the last argument and the metadata of the document as
+	// json on stdin.
+	FileCommand []string `json:"file_command"`
+	// RunCommand runs once after the run, with the output directory appended
+	// as the last argument and the download report as json on stdin.
+	RunCommand []string `json:"run_command"`
+	// Timeout bounds every command, such as "30s". Empty uses one minute.
+	Timeout string `json:"timeout"`
+	// OnFailure is "warn" (the default) to log a failed command and go on,
+	// or "fail" to fail the document, or the run for the run command.
+	OnFailure string `json:"on_failure"`
+}
+
+// Enabled reports whether any command is configured.
+func (conf *PostProcessConfig) Enabled() bool {
+	return len(conf.FileCommand) > 0 || len(conf.RunCommand) > 0
+}
+
+// TimeoutDuration parses Timeout.
+func (conf *PostProcessConfig) TimeoutDuration() (time.Duration, error) {
+	if conf.Timeout == "" {
+		return defaultPostProcessTimeout, nil
+	}
+	d, err := time.ParseDuration(conf.Timeout)
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("invalid output.post_process.timeout %q, expect a duration like \"30s\"", conf.Timeout)
+	}
+	return d, nil
+}
+
+func (conf *PostProcessConfig) Validate() error {
+	if _, err := conf.TimeoutDuration(); err != nil {
+		return err
+	}
+	switch conf.OnFailure {
+	case "", PostProcessWarn, PostProcessFail:
+	default:
+		return errors.Errorf("invalid output.post_process.on_failure %q, expect \"warn\" or \"fail\"", conf.OnFailure)
+	}
+	for _, command := range [][]string{conf.FileCommand, conf.RunCommand} {
+		if len(command) > 0 && command[0] == "" {
+			return errors.New("invalid output.post_process, the command name is empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostProcessConfig(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	assert.False(t, config.PostProcess.Enabled())
+	timeout, err := config.PostProcess.TimeoutDuration()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, timeout)
+
+	config.PostProcess.FileCommand = []string{"sh", "-c", "true"}
+	assert.True(t, config.PostProcess.Enabled())
+	assert.NoError(t, config.Validate())
+
+	config.PostProcess.OnFailure = "ignore"
+	assert.Error(t, config.Validate())
+	config.PostProcess.OnFailure = core.PostProcessFail
+	config.PostProcess.Timeout = "soon"
+	assert.Error(t, config.Validate())
+	config.PostProcess.Timeout = ""
+	config.PostProcess.RunCommand = []string{""}
+	assert.Error(t, config.Validate())
+}
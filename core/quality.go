@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/chyroc/lark"
+)
+
+// ConversionQuality counts how faithfully the blocks of a document were
+// converted to markdown. Supported blocks are rendered as they are,
+// degraded ones with a fallback losing part of them, such as the layout of
+// a grid, and dropped ones are left out together with their children.
+type ConversionQuality struct {
+	Supported int `json:"supported"`
+	Degraded  int `json:"degraded"`
+	Dropped   int `json:"dropped"`
+	// Score is the percentage of the blocks converted, a degraded block
+	// counts as half. A document without blocks scores 100.
+	Score float64 `json:"score"`
+	// block types degraded or dropped and how many times, such as "sheet"
+	DegradedTypes map[string]int `json:"degraded_types,omitempty"`
+	DroppedTypes  map[string]int `json:"dropped_types,omitempty"`
+}
+
+// degradedBlockTypes are rendered with a fallback: a callout becomes a
+// plain tip quote without its emoji and colors, the columns of a grid are
+// written one after another.
+var degradedBlockTypes = map[lark.DocxBlockType]bool{
+	lark.DocxBlockTypeCallout: true,
+	lark.DocxBlockTypeGrid:    true,
+}
+
+// docxBlockTypeNames name the block types in the quality report after the
+// field holding their data in the API.
+var docxBlockTypeNames = map[lark.DocxBlockType]string{
+	lark.DocxBlockTypePage:           "page",
+	lark.DocxBlockTypeText:           "text",
+	lark.DocxBlockTypeHeading1:       "heading1",
+	lark.DocxBlockTypeHeading2:       "heading2",
+	lark.DocxBlockTypeHeading3:       "heading3",
+	lark.DocxBlockTypeHeading4:       "heading4",
+	lark.DocxBlockTypeHeading5:       "heading5",
+	lark.DocxBlockTypeHeading6:       "heading6",
+	lark.DocxBlockTypeHeading7:       "heading7",
+	lark.DocxBlockTypeHeading8:       "heading8",
+	lark.DocxBlockTypeHeading9:       "heading9",
+	lark.DocxBlockTypeBullet:         "bullet",
+	lark.DocxBlockTypeOrdered:        "ordered",
+	lark.DocxBlockTypeCode:           "code",
+	lark.DocxBlockTypeQuote:          "quote",
+	lark.DocxBlockTypeEquation:       "equation",
+	lark.DocxBlockTypeTodo:           "todo",
+	lark.DocxBlockTypeBitable:        "bitable",
+	lark.DocxBlockTypeCallout:        "callout",
+	lark.DocxBlockTypeChatCard:       "chat_card",
+	lark.DocxBlockTypeDiagram:        "diagram",
+	lark.DocxBlockTypeDivider:        "divider",
+	lark.DocxBlockTypeFile:           "file",
+	lark.DocxBlockTypeGrid:           "grid",
+	lark.DocxBlockTypeGridColumn:     "grid_column",
+	lark.DocxBlockTypeIframe:         "iframe",
+	lark.DocxBlockTypeImage:          "image",
+	lark.DocxBlockTypeISV:            "isv",
+	lark.DocxBlockTypeMindnote:       "mindnote",
+	lark.DocxBlockTypeSheet:          "sheet",
+	lark.DocxBlockTypeTable:          "table",
+	lark.DocxBlockTypeTableCell:      "table_cell",
+	lark.DocxBlockTypeView:           "view",
+	lark.DocxBlockTypeQuoteContainer: "quote_container",
+	lark.DocxBlockTypeUndefined:      "undefined",
+}
+
+func docxBlockTypeName(t lark.DocxBlockType) string {
+	if name, ok := docxBlockTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("block_type_%d", t)
+}
+
+// Quality returns the conversion quality of the parsed document.
+func (p *Parser) Quality() ConversionQuality {
+	q := p.quality
+	total := q.Supported + q.Degraded + q.Dropped
+	q.Score = 100
+	if total > 0 {
+		score := (float64(q.Supported) + float64(q.Degraded)/2) / float64(total) * 100
+		q.Score = math.Round(score*10) / 10
+	}
+	return q
+}
+
+// countBlock counts a block rendered by ParseDocxBlock, the page itself is
+// not counted.
+func (p *Parser) countBlock(b *lark.DocxBlock) {
+	switch {
+	case b.BlockType == lark.DocxBlockTypePage:
+	case degradedBlockTypes[b.BlockType]:
+		p.quality.Degraded++
+		countType(&p.quality.DegradedTypes, b.BlockType)
+	default:
+		p.quality.Supported++
+	}
+}
+
+// dropBlock counts a block left out of the markdown and its children.
+func (p *Parser) dropBlock(b *lark.DocxBlock) {
+	p.quality.Dropped++
+	countType(&p.quality.DroppedTypes, b.BlockType)
+	for _, child := range b.Children {
+		if block, ok := p.blockMap[child]; ok {
+			p.dropBlock(block)
+		}
+	}
+}
+
+func countType(types *map[string]int, t lark.DocxBlockType) {
+	if *types == nil {
+		*types = make(map[string]int)
+	}
+	(*types)[docxBlockTypeName(t)]++
+}
@@ -0,0 +1,61 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+	"github.com/stretchr/testify/assert"
+)
+
+func qualityText(content string) *lark.DocxBlockText {
+	return &lark.DocxBlockText{Elements: []*lark.DocxTextElement{
+		{TextRun: &lark.DocxTextElementTextRun{Content: content}},
+	}}
+}
+
+func TestParseQuality(t *testing.T) {
+	doc := &lark.DocxDocument{DocumentID: "doc", Title: "Quality"}
+	blocks := []*lark.DocxBlock{
+		{BlockID: "doc", BlockType: lark.DocxBlockTypePage, Page: qualityText("Quality"),
+			Children: []string{"p1", "c1", "s1", "d1"}},
+		{BlockID: "p1", ParentID: "doc", BlockType: lark.DocxBlockTypeText, Text: qualityText("plain")},
+		{BlockID: "c1", ParentID: "doc", BlockType: lark.DocxBlockTypeCallout, Callout: &lark.DocxBlockCallout{},
+			Children: []string{"c1p"}},
+		{BlockID: "c1p", ParentID: "c1", BlockType: lark.DocxBlockTypeText, Text: qualityText("inside the callout")},
+		{BlockID: "s1", ParentID: "doc", BlockType: lark.DocxBlockTypeSheet, Sheet: &lark.DocxBlockSheet{Token: "sht"}},
+		// an unsupported container is dropped together with its children
+		{BlockID: "d1", ParentID: "doc", BlockType: lark.DocxBlockTypeDiagram, Children: []string{"d1p"}},
+		{BlockID: "d1p", ParentID: "d1", BlockType: lark.DocxBlockTypeText, Text: qualityText("inside the diagram")},
+	}
+	parser := core.NewParser(core.NewConfig("", "").Output)
+	md := parser.ParseDocxContent(doc, blocks)
+	assert.NotContains(t, md, "inside the diagram")
+
+	quality := parser.Quality()
+	assert.Equal(t, 2, quality.Supported)
+	assert.Equal(t, 1, quality.Degraded)
+	assert.Equal(t, 3, quality.Dropped)
+	assert.Equal(t, 41.7, quality.Score)
+	assert.Equal(t, map[string]int{"callout": 1}, quality.DegradedTypes)
+	assert.Equal(t, map[string]int{"sheet": 1, "diagram": 1, "text": 1}, quality.DroppedTypes)
+}
+
+func TestParseQualityEmpty(t *testing.T) {
+	doc := &lark.DocxDocument{DocumentID: "doc", Title: "Empty"}
+	parser := core.NewParser(core.NewConfig("", "").Output)
+	parser.ParseDocxContent(doc, []*lark.DocxBlock{
+		{BlockID: "doc", BlockType: lark.DocxBlockTypePage, Page: qualityText("Empty")},
+	})
+	assert.Equal(t, core.ConversionQuality{Score: 100}, parser.Quality())
+}
+
+func TestQualityThreshold(t *testing.T) {
+	conf := core.DownloadConfig{}
+	assert.Equal(t, float64(core.DefaultQualityThreshold), conf.ReviewThreshold())
+	conf.QualityThreshold = 75
+	assert.NoError(t, conf.Validate())
+	assert.Equal(t, 75.0, conf.ReviewThreshold())
+	conf.QualityThreshold = 120
+	assert.Error(t, conf.Validate())
+}
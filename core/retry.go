@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chyroc/lark"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// frequencyLimitCode is returned by the OPEN API when the app exceeds the
+// request frequency limit.
+const frequencyLimitCode = 99991400
+
+const (
+	defaultRateLimit      = 4
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	maxRetryDelay         = 10 * time.Second
+)
+
+// RetryError wraps the last error of a request that was retried.
+type RetryError struct {
+	Retries int
+	Err     error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (retried %d times)", e.Err, e.Retries)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Retries returns how many times the request that failed with err was
+// retried.
+func Retries(err error) int {
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		return retryErr.Retries
+	}
+	return 0
+}
+
+// WithRateLimit limits the requests of the client to qps per second, 0
+// disables the limit.
+func WithRateLimit(qps float64) ClientOption {
+	return func(o *clientOptions) {
+		o.rateLimit = qps
+	}
+}
+
+// WithRetry retries the requests hitting the frequency limit up to
+// maxRetries times, with exponential backoff starting from baseDelay.
+func WithRetry(maxRetries int, baseDelay time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.maxRetries = maxRetries
+		o.retryBaseDelay = baseDelay
+	}
+}
+
+func newRateLimiter(qps float64) *rate.Limiter {
+	if qps <= 0 {
+		return nil
+	}
+	burst := int(qps)
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+func isRateLimited(response *lark.Response, err error) bool {
+	if err == nil {
+		return false
+	}
+	if response != nil && response.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if lark.GetErrorCode(err) == frequencyLimitCode {
+		return true
+	}
+	// errors of requests without a json body only carry the http status
+	return strings.Contains(err.Error(), "429 Too Many Requests")
+}
+
+// retryDelay is the exponential backoff with jitter for the given attempt.
+func (c *Client) retryDelay(attempt int) time.Duration {
+	delay := c.retryBaseDelay << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// call sends one request through the rate limiter and retries it while the
+// frequency limit is hit, giving up with the last error after maxRetries or
+// when ctx is done.
+func (c *Client) call(ctx context.Context, fn func() (*lark.Response, error)) error {
+	for attempt := 0; ; attempt++ {
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		response, err := fn()
+		if !isRateLimited(response, err) || attempt >= c.maxRetries {
+			if err != nil && attempt > 0 {
+				return &RetryError{Retries: attempt, Err: err}
+			}
+			return err
+		}
+		timer := time.NewTimer(c.retryDelay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &RetryError{Retries: attempt, Err: err}
+		case <-timer.C:
+		}
+	}
+}
+
+// codeError converts the error code of a raw request response.
+func codeError(api string, code int64, msg string) error {
+	if code == 0 {
+		return nil
+	}
+	return lark.NewError("Drive", api, code, msg)
+}
+
+// notFoundCodes are returned by the OPEN API for documents that were deleted
+// or never existed.
+var notFoundCodes = map[int64]bool{
+	1770002: true, // not found
+	1770003: true, // resource deleted
+}
+
+// IsNotFound reports whether err means the requested document does not
+// exist anymore, as opposed to failing for permissions or the network.
+func IsNotFound(err error) bool {
+	var larkErr *lark.Error
+	if errors.As(err, &larkErr) {
+		return notFoundCodes[larkErr.Code]
+	}
+	return false
+}
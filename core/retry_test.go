@@ -0,0 +1,144 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/chyroc/lark"
+)
+
+// flakyTransport answers the tenant token request and fails the first
+// failures requests to the other APIs with the frequency limit.
+type flakyTransport struct {
+	mu       sync.Mutex
+	failures int
+	empty    bool // fail with a bare 429 instead of the error code
+	body     string
+	calls    int
+}
+
+func respond(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.URL.Path, "tenant_access_token") {
+		return respond(http.StatusOK, `{"code":0,"tenant_access_token":"t","expire":7200}`), nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		if f.empty {
+			resp := respond(http.StatusTooManyRequests, "")
+			resp.Status = "429 Too Many Requests"
+			return resp, nil
+		}
+		return respond(http.StatusBadRequest, `{"code":99991400,"msg":"request trigger frequency limit"}`), nil
+	}
+	resp := respond(http.StatusOK, f.body)
+	if f.empty {
+		resp.Header.Set("Content-Type", "image/png")
+		resp.Header.Set("Content-Disposition", `attachment; filename="img.png"`)
+	}
+	return resp, nil
+}
+
+func newFlakyClient(transport *flakyTransport, maxRetries int) *core.Client {
+	return core.NewClient("id", "secret",
+		core.WithHTTPClient(&http.Client{Transport: transport}),
+		core.WithRateLimit(0),
+		core.WithRetry(maxRetries, time.Millisecond),
+	)
+}
+
+const wikiNodeBody = `{"code":0,"data":{"node":{"obj_token":"doxcn","obj_type":"docx","title":"t"}}}`
+
+func TestRetryFrequencyLimit(t *testing.T) {
+	transport := &flakyTransport{failures: 2, body: wikiNodeBody}
+	node, err := newFlakyClient(transport, 3).GetWikiNodeInfo(context.Background(), "wikcn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.ObjToken != "doxcn" {
+		t.Errorf("unexpected node %+v", node)
+	}
+	if transport.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", transport.calls)
+	}
+}
+
+func TestRetryImageDownload(t *testing.T) {
+	transport := &flakyTransport{failures: 1, empty: true, body: "png"}
+	dir := t.TempDir()
+	path, err := newFlakyClient(transport, 3).DownloadImage(context.Background(), "boxcn", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "png" || transport.calls != 2 {
+		t.Errorf("unexpected download %q after %d calls", data, transport.calls)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	transport := &flakyTransport{failures: 10, body: wikiNodeBody}
+	_, err := newFlakyClient(transport, 2).GetWikiNodeInfo(context.Background(), "wikcn")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if core.Retries(err) != 2 || transport.calls != 3 {
+		t.Errorf("expected 2 retries in 3 calls, got %d in %d: %v", core.Retries(err), transport.calls, err)
+	}
+	if !strings.Contains(err.Error(), "99991400") || !strings.Contains(err.Error(), "retried 2 times") {
+		t.Errorf("expected the last error with the retry count, got %v", err)
+	}
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	transport := &flakyTransport{failures: 10, body: wikiNodeBody}
+	client := core.NewClient("id", "secret",
+		core.WithHTTPClient(&http.Client{Transport: transport}),
+		core.WithRetry(5, time.Hour),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetWikiNodeInfo(ctx, "wikcn")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("the backoff ignored the canceled context")
+	}
+	if transport.calls != 1 {
+		t.Errorf("expected 1 call, got %d", transport.calls)
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	deleted := lark.NewError("Drive", "GetDocxDocument", 1770003, "resource deleted")
+	if !core.IsNotFound(deleted) || !core.IsNotFound(&core.RetryError{Retries: 1, Err: deleted}) {
+		t.Errorf("expected %v to be not found", deleted)
+	}
+	forbidden := lark.NewError("Drive", "GetDocxDocument", 1770032, "forbidden")
+	if core.IsNotFound(forbidden) || core.IsNotFound(errors.New("timeout")) {
+		t.Errorf("expected only deleted documents to be not found")
+	}
+}
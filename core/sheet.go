@@ -0,0 +1,510 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chyroc/lark"
+)
+
+const (
+	SheetFormatMarkdown = "markdown"
+	SheetFormatCSV      = "csv"
+)
+
+const (
+	SheetFormulaValues   = "values"
+	SheetFormulaFormulas = "formulas"
+	SheetFormulaBoth     = "both"
+)
+
+// sheetFormulaColumn is the title of the column appended by SheetFormulaBoth.
+const sheetFormulaColumn = "Formulas"
+
+// sheetRowsPerRequest keeps every value request of a large sheet well under
+// the size limit of the api.
+const sheetRowsPerRequest = 1000
+
+// Spreadsheet is the displayed content of a sheet or a bitable. Every tab of
+// a sheet, or table of a bitable, is a SheetTab.
+type Spreadsheet struct {
+	Title    string
+	Revision int64
+	Tabs     []*SheetTab
+}
+
+// SheetTab holds the cells of a tab as displayed, formulas are evaluated and
+// dates formatted. The first row of a bitable table is its field names.
+// Trailing empty rows and columns are dropped.
+type SheetTab struct {
+	Title string
+	Rows  [][]string
+	// Formulas holds the formula of every cell of Rows, empty for the cells
+	// without one. It is only read by a client created WithSheetFormulas.
+	Formulas [][]string
+}
+
+type getSheetValuesReq struct {
+	SpreadSheetToken     string `path:"spreadsheetToken" json:"-"`
+	Range                string `path:"range" json:"-"`
+	ValueRenderOption    string `query:"valueRenderOption" json:"-"`
+	DateTimeRenderOption string `query:"dateTimeRenderOption" json:"-"`
+}
+
+type getSheetValuesResp struct {
+	Code int64  `json:"code,omitempty"`
+	Msg  string `json:"msg,omitempty"`
+	Data struct {
+		Revision   int64 `json:"revision"`
+		ValueRange struct {
+			Values [][]interface{} `json:"values"`
+		} `json:"valueRange"`
+	} `json:"data"`
+}
+
+// GetSheetContent reads every tab of a spreadsheet. The values are requested
+// directly, as the sdk can not decode decimal and boolean cells. The cells
+// covered by a merged cell are left empty.
+func (c *Client) GetSheetContent(ctx context.Context, sheetToken string) (*Spreadsheet, error) {
+	var meta *lark.GetSpreadsheetResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		meta, response, err = c.larkClient.Drive.GetSpreadsheet(ctx, &lark.GetSpreadsheetReq{
+			SpreadSheetToken: sheetToken,
+		})
+		return response, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list *lark.GetSheetListResp
+	err = c.call(ctx, func() (response *lark.Response, err error) {
+		list, response, err = c.larkClient.Drive.GetSheetList(ctx, &lark.GetSheetListReq{
+			SpreadSheetToken: sheetToken,
+		})
+		return response, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := &Spreadsheet{Title: meta.Spreadsheet.Title}
+	for _, s := range list.Sheets {
+		// tabs embedding a bitable have no cell values
+		if s.ResourceType != "" && s.ResourceType != "sheet" {
+			continue
+		}
+		tab := &SheetTab{Title: s.Title}
+		if grid := s.GridProperties; grid != nil && grid.RowCount > 0 && grid.ColumnCount > 0 {
+			for start := int64(1); start <= grid.RowCount; start += sheetRowsPerRequest {
+				end := start + sheetRowsPerRequest - 1
+				if end > grid.RowCount {
+					end = grid.RowCount
+				}
+				rng := fmt.Sprintf("%s!A%d:%s%d", s.SheetID, start, columnName(grid.ColumnCount), end)
+				values, revision, err := c.getSheetValues(ctx, sheetToken, rng, "FormattedValue")
+				if err != nil {
+					return nil, err
+				}
+				sheet.Revision = revision
+				for _, row := range values {
+					cells := make([]string, len(row))
+					for i, v := range row {
+						cells[i] = cellText(v)
+					}
+					tab.Rows = append(tab.Rows, cells)
+				}
+				if !c.sheetFormulas {
+					continue
+				}
+				// the formula rendering returns the formula of the formula
+				// cells and the raw value of the others
+				formulas, _, err := c.getSheetValues(ctx, sheetToken, rng, "Formula")
+				if err != nil {
+					return nil, err
+				}
+				for _, row := range formulas {
+					cells := make([]string, len(row))
+					for i, v := range row {
+						if s, ok := v.(string); ok && strings.HasPrefix(s, "=") {
+							cells[i] = s
+						}
+					}
+					tab.Formulas = append(tab.Formulas, cells)
+				}
+			}
+		}
+		tab.Rows = trimCells(tab.Rows)
+		if tab.Formulas != nil {
+			tab.Formulas = cropCells(tab.Formulas, tab.Rows)
+		}
+		sheet.Tabs = append(sheet.Tabs, tab)
+	}
+	return sheet, nil
+}
+
+func (c *Client) getSheetValues(ctx context.Context, sheetToken, rng, render string) ([][]interface{}, int64, error) {
+	resp := new(getSheetValuesResp)
+	err := c.call(ctx, func() (*lark.Response, error) {
+		response, err := c.larkClient.RawRequest(ctx, &lark.RawRequestReq{
+			Scope:  "Drive",
+			API:    "GetSheetValue",
+			Method: "GET",
+			URL:    openBaseURL + "/open-apis/sheets/v2/spreadsheets/:spreadsheetToken/values/:range",
+			Body: &getSheetValuesReq{
+				SpreadSheetToken:     sheetToken,
+				Range:                rng,
+				ValueRenderOption:    render,
+				DateTimeRenderOption: "FormattedString",
+			},
+			NeedTenantAccessToken: true,
+		}, resp)
+		if err == nil {
+			err = codeError("GetSheetValue", resp.Code, resp.Msg)
+		}
+		return response, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Data.ValueRange.Values, resp.Data.Revision, nil
+}
+
+// bitableDateFields are the field types holding a unix time in milliseconds.
+var bitableDateFields = map[int64]bool{5: true, 1001: true, 1002: true}
+
+// GetBitableRecords reads every table of a bitable, one row per record with
+// the fields in the order of the table.
+func (c *Client) GetBitableRecords(ctx context.Context, appToken string) (*Spreadsheet, error) {
+	var meta *lark.GetBitableMetaResp
+	err := c.call(ctx, func() (response *lark.Response, err error) {
+		meta, response, err = c.larkClient.Bitable.GetBitableMeta(ctx, &lark.GetBitableMetaReq{
+			AppToken: appToken,
+		})
+		return response, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sheet := &Spreadsheet{Title: meta.App.Name, Revision: meta.App.Revision}
+
+	var pageToken *string
+	for {
+		var tables *lark.GetBitableTableListResp
+		err := c.call(ctx, func() (response *lark.Response, err error) {
+			tables, response, err = c.larkClient.Bitable.GetBitableTableList(ctx, &lark.GetBitableTableListReq{
+				AppToken:  appToken,
+				PageToken: pageToken,
+			})
+			return response, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables.Items {
+			tab, err := c.getBitableTable(ctx, appToken, table)
+			if err != nil {
+				return nil, err
+			}
+			sheet.Tabs = append(sheet.Tabs, tab)
+		}
+		if !tables.HasMore {
+			break
+		}
+		pageToken = &tables.PageToken
+	}
+	return sheet, nil
+}
+
+func (c *Client) getBitableTable(ctx context.Context, appToken string, table *lark.GetBitableTableListRespItem) (*SheetTab, error) {
+	var fields []*lark.GetBitableFieldListRespItem
+	var pageToken *string
+	for {
+		var resp *lark.GetBitableFieldListResp
+		err := c.call(ctx, func() (response *lark.Response, err error) {
+			resp, response, err = c.larkClient.Bitable.GetBitableFieldList(ctx, &lark.GetBitableFieldListReq{
+				AppToken:  appToken,
+				TableID:   table.TableID,
+				PageToken: pageToken,
+			})
+			return response, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, resp.Items...)
+		if !resp.HasMore {
+			break
+		}
+		pageToken = &resp.PageToken
+	}
+
+	header := make([]string, len(fields))
+	for i, field := range fields {
+		header[i] = field.FieldName
+	}
+	tab := &SheetTab{Title: table.Name, Rows: [][]string{header}}
+	pageSize := int64(500)
+	pageToken = nil
+	for {
+		var resp *lark.GetBitableRecordListResp
+		err := c.call(ctx, func() (response *lark.Response, err error) {
+			resp, response, err = c.larkClient.Bitable.GetBitableRecordList(ctx, &lark.GetBitableRecordListReq{
+				AppToken:  appToken,
+				TableID:   table.TableID,
+				PageToken: pageToken,
+				PageSize:  &pageSize,
+			})
+			return response, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range resp.Items {
+			row := make([]string, len(fields))
+			for i, field := range fields {
+				value := record.Fields[field.FieldName]
+				if ms, ok := value.(float64); ok && bitableDateFields[field.Type] {
+					row[i] = time.UnixMilli(int64(ms)).UTC().Format(DefaultDateFormat)
+				} else {
+					row[i] = cellText(value)
+				}
+			}
+			tab.Rows = append(tab.Rows, row)
+		}
+		if !resp.HasMore {
+			break
+		}
+		pageToken = &resp.PageToken
+	}
+	tab.Rows = trimCells(tab.Rows)
+	return tab, nil
+}
+
+// columnName returns the letters of the n-th column, 1 is "A" and 27 "AA".
+func columnName(n int64) string {
+	name := ""
+	for n > 0 {
+		n--
+		name = string(rune('A'+n%26)) + name
+		n /= 26
+	}
+	return name
+}
+
+// cellText returns the displayed text of a cell value of a sheet or a
+// bitable record.
+func cellText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		// segments of rich text are concatenated, other lists such as
+		// options and persons are joined
+		segments := true
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); !ok || m["type"] == nil {
+				segments = false
+			}
+			parts = append(parts, cellText(item))
+		}
+		if segments {
+			return strings.Join(parts, "")
+		}
+		return strings.Join(parts, ", ")
+	case map[string]interface{}:
+		// links, mentions, persons, attachments and locations
+		for _, key := range []string{"text", "name", "full_address", "link"} {
+			if s, ok := v[key].(string); ok && s != "" {
+				return s
+			}
+		}
+		// dropdowns of sheets and formulas or lookups of bitables
+		for _, key := range []string{"values", "value"} {
+			if value, ok := v[key]; ok {
+				return cellText(value)
+			}
+		}
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// trimCells drops the trailing empty rows and columns, which sheets report
+// up to the size of the grid.
+func trimCells(rows [][]string) [][]string {
+	width := 0
+	height := 0
+	for i, row := range rows {
+		for j, cell := range row {
+			if cell != "" {
+				height = i + 1
+				if j+1 > width {
+					width = j + 1
+				}
+			}
+		}
+	}
+	rows = rows[:height]
+	for i, row := range rows {
+		if len(row) > width {
+			rows[i] = row[:width]
+		}
+	}
+	return rows
+}
+
+// cropCells cuts cells to the shape of rows, dropping what trimCells
+// dropped from them.
+func cropCells(cells, rows [][]string) [][]string {
+	cropped := make([][]string, len(rows))
+	for i, row := range rows {
+		cropped[i] = make([]string, len(row))
+		if i < len(cells) {
+			copy(cropped[i], cells[i])
+		}
+	}
+	return cropped
+}
+
+func (tab *SheetTab) hasFormulas() bool {
+	for _, row := range tab.Formulas {
+		for _, formula := range row {
+			if formula != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formulaErrors are the error codes a formula cell displays.
+var formulaErrors = map[string]bool{
+	"#NULL!": true, "#DIV/0!": true, "#VALUE!": true, "#REF!": true, "#NAME?": true,
+	"#NUM!": true, "#N/A": true, "#ERROR!": true, "#SPILL!": true, "#CALC!": true,
+}
+
+// WithFormulaMode returns the sheet as rendered by a formula mode.
+// SheetFormulaFormulas replaces the value of every formula cell by its
+// formula, except for the cells showing an error code. SheetFormulaBoth keeps
+// the values and appends a column listing the formulas of the row, such as
+// "D2: =SUM(A2:C2)". Tabs without formulas are returned unchanged.
+func (sheet *Spreadsheet) WithFormulaMode(mode string) *Spreadsheet {
+	if mode != SheetFormulaFormulas && mode != SheetFormulaBoth {
+		return sheet
+	}
+	rendered := &Spreadsheet{Title: sheet.Title, Revision: sheet.Revision}
+	for _, tab := range sheet.Tabs {
+		if !tab.hasFormulas() {
+			rendered.Tabs = append(rendered.Tabs, tab)
+			continue
+		}
+		out := &SheetTab{Title: tab.Title, Formulas: tab.Formulas, Rows: make([][]string, len(tab.Rows))}
+		width := tab.width()
+		for i, row := range tab.Rows {
+			cells := append([]string(nil), row...)
+			var notes []string
+			for j, formula := range tab.Formulas[i] {
+				if formula == "" {
+					continue
+				}
+				if mode == SheetFormulaBoth {
+					notes = append(notes, fmt.Sprintf("%s%d: %s", columnName(int64(j+1)), i+1, formula))
+				} else if !formulaErrors[cells[j]] {
+					cells[j] = formula
+				}
+			}
+			if mode == SheetFormulaBoth {
+				for len(cells) < width {
+					cells = append(cells, "")
+				}
+				if i == 0 && len(notes) == 0 {
+					cells = append(cells, sheetFormulaColumn)
+				} else {
+					cells = append(cells, strings.Join(notes, "; "))
+				}
+			}
+			out.Rows[i] = cells
+		}
+		rendered.Tabs = append(rendered.Tabs, out)
+	}
+	return rendered
+}
+
+// width returns the number of columns of the widest row.
+func (tab *SheetTab) width() int {
+	width := 0
+	for _, row := range tab.Rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	return width
+}
+
+// cell returns the cell at row i and column j, empty when the row is shorter.
+func (tab *SheetTab) cell(i, j int) string {
+	if j < len(tab.Rows[i]) {
+		return tab.Rows[i][j]
+	}
+	return ""
+}
+
+var markdownCellEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+// RenderSheetMarkdown renders every tab as a section holding a markdown
+// table, whose header is the first row.
+func RenderSheetMarkdown(sheet *Spreadsheet) string {
+	buf := new(strings.Builder)
+	for _, tab := range sheet.Tabs {
+		buf.WriteString("## " + tab.Title + "\n\n")
+		width := tab.width()
+		if width == 0 {
+			buf.WriteString("*empty*\n\n")
+			continue
+		}
+		for i := range tab.Rows {
+			buf.WriteString("|")
+			for j := 0; j < width; j++ {
+				buf.WriteString(" " + markdownCellEscaper.Replace(tab.cell(i, j)) + " |")
+			}
+			buf.WriteString("\n")
+			if i == 0 {
+				buf.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+			}
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// CSV returns the tab as csv, every row padded to the same number of
+// columns.
+func (tab *SheetTab) CSV() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	width := tab.width()
+	for i := range tab.Rows {
+		record := make([]string, width)
+		for j := range record {
+			record[j] = tab.cell(i, j)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,164 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// sheetTransport answers the sheet and bitable apis with canned responses,
+// keyed by the request path.
+type sheetTransport struct {
+	responses map[string]string
+}
+
+func (s *sheetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.URL.Path, "tenant_access_token") {
+		return respond(http.StatusOK, `{"code":0,"tenant_access_token":"t","expire":7200}`), nil
+	}
+	// the value requests of a range differ only by the render option
+	body, ok := s.responses[req.URL.Path+"?valueRenderOption="+req.URL.Query().Get("valueRenderOption")]
+	if !ok {
+		body, ok = s.responses[req.URL.Path]
+	}
+	if !ok {
+		return respond(http.StatusNotFound, `{"code":404,"msg":"not found `+req.URL.Path+`"}`), nil
+	}
+	resp := respond(http.StatusOK, body)
+	resp.Header.Set("Content-Type", "application/json")
+	return resp, nil
+}
+
+func newSheetClient(responses map[string]string, opts ...core.ClientOption) *core.Client {
+	return core.NewClient("id", "secret", append([]core.ClientOption{
+		core.WithHTTPClient(&http.Client{Transport: &sheetTransport{responses: responses}}),
+		core.WithRateLimit(0),
+		core.WithRetry(0, time.Millisecond),
+	}, opts...)...)
+}
+
+func TestGetSheetContent(t *testing.T) {
+	client := newSheetClient(map[string]string{
+		"/open-apis/sheets/v3/spreadsheets/shtcn1": `{"code":0,"data":{"spreadsheet":{"title":"Budget"}}}`,
+		"/open-apis/sheets/v3/spreadsheets/shtcn1/sheets/query": `{"code":0,"data":{"sheets":[
+			{"sheet_id":"s1","title":"2024","resource_type":"sheet","grid_properties":{"row_count":4,"column_count":4}},
+			{"sheet_id":"s2","title":"Embedded","resource_type":"bitable"}]}}`,
+		"/open-apis/sheets/v2/spreadsheets/shtcn1/values/s1!A1:D4": `{"code":0,"data":{"revision":7,"valueRange":{"values":[
+			["Item","Cost","Paid",null],
+			[[{"type":"text","text":"rich "},{"type":"text","text":"text"}],1.5,true,null],
+			[{"type":"url","text":"site","link":"https://example.com"},-2,false,null],
+			[null,null,null,null]]}}}`,
+	})
+	sheet, err := client.GetSheetContent(context.Background(), "shtcn1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Budget", sheet.Title)
+	assert.Equal(t, int64(7), sheet.Revision)
+	if assert.Len(t, sheet.Tabs, 1) {
+		// the empty last row and column are dropped
+		assert.Equal(t, [][]string{
+			{"Item", "Cost", "Paid"},
+			{"rich text", "1.5", "true"},
+			{"site", "-2", "false"},
+		}, sheet.Tabs[0].Rows)
+	}
+}
+
+func TestGetBitableRecords(t *testing.T) {
+	client := newSheetClient(map[string]string{
+		"/open-apis/bitable/v1/apps/bascn1":                    `{"code":0,"data":{"app":{"name":"Tasks","revision":3}}}`,
+		"/open-apis/bitable/v1/apps/bascn1/tables":             `{"code":0,"data":{"items":[{"table_id":"tbl1","name":"Open"}]}}`,
+		"/open-apis/bitable/v1/apps/bascn1/tables/tbl1/fields": `{"code":0,"data":{"items":[{"field_name":"Name","type":1},{"field_name":"Tags","type":4},{"field_name":"Due","type":5},{"field_name":"Owner","type":11}]}}`,
+		"/open-apis/bitable/v1/apps/bascn1/tables/tbl1/records": `{"code":0,"data":{"items":[
+			{"fields":{"Name":"Write","Tags":["a","b"],"Due":1700000000000,"Owner":[{"name":"Ann"},{"name":"Bob"}]}},
+			{"fields":{"Name":[{"type":"text","text":"Re"},{"type":"text","text":"view"}]}}]}}`,
+	})
+	sheet, err := client.GetBitableRecords(context.Background(), "bascn1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Tasks", sheet.Title)
+	if assert.Len(t, sheet.Tabs, 1) {
+		assert.Equal(t, "Open", sheet.Tabs[0].Title)
+		assert.Equal(t, [][]string{
+			{"Name", "Tags", "Due", "Owner"},
+			{"Write", "a, b", "2023-11-14 22:13:20", "Ann, Bob"},
+			{"Review", "", "", ""},
+		}, sheet.Tabs[0].Rows)
+	}
+}
+
+func TestRenderSheet(t *testing.T) {
+	sheet := &core.Spreadsheet{Title: "Budget", Tabs: []*core.SheetTab{
+		{Title: "2024", Rows: [][]string{{"Item", "Note"}, {"a|b", "line1\nline2"}, {"c"}}},
+		{Title: "Empty"},
+	}}
+	assert.Equal(t, "## 2024\n\n"+
+		"| Item | Note |\n| --- | --- |\n| a\\|b | line1<br>line2 |\n| c |  |\n\n"+
+		"## Empty\n\n*empty*\n\n", core.RenderSheetMarkdown(sheet))
+
+	data, err := sheet.Tabs[0].CSV()
+	assert.NoError(t, err)
+	assert.Equal(t, "Item,Note\na|b,\"line1\nline2\"\nc,\n", string(data))
+}
+
+func TestSheetFormulaModes(t *testing.T) {
+	data, err := os.ReadFile(path.Join(utils.RootDir(), "testdata", "testsheet.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var fixture map[string]json.RawMessage
+	if !assert.NoError(t, json.Unmarshal(data, &fixture)) {
+		return
+	}
+	responses := make(map[string]string, len(fixture))
+	for key, body := range fixture {
+		responses[key] = string(body)
+	}
+	sheet, err := newSheetClient(responses, core.WithSheetFormulas(true)).GetSheetContent(context.Background(), "shtcnF")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, mode := range []string{core.SheetFormulaValues, core.SheetFormulaFormulas, core.SheetFormulaBoth} {
+		md := core.RenderSheetMarkdown(sheet.WithFormulaMode(mode))
+		goldenPath := path.Join(utils.RootDir(), "testdata", "testsheet."+mode+".md")
+		if *updateGolden {
+			assert.NoError(t, os.WriteFile(goldenPath, []byte(md), 0o644))
+		}
+		expected, err := os.ReadFile(goldenPath)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), md, mode)
+	}
+
+	// the formulas are only read when asked for
+	sheet, err = newSheetClient(responses).GetSheetContent(context.Background(), "shtcnF")
+	if assert.NoError(t, err) {
+		assert.Nil(t, sheet.Tabs[0].Formulas)
+	}
+}
+
+func TestSheetFormatConfig(t *testing.T) {
+	config := core.NewConfig("", "").Output
+	assert.Equal(t, core.SheetFormatMarkdown, config.SheetFormat)
+	config.SheetFormat = "xlsx"
+	assert.Error(t, config.Validate())
+}
+
+func TestSheetFormulaConfig(t *testing.T) {
+	config := core.NewConfig("", "").Sheet
+	assert.Equal(t, core.SheetFormulaValues, config.FormulaMode)
+	assert.NoError(t, config.Validate())
+	config.FormulaMode = "expressions"
+	assert.Error(t, config.Validate())
+}
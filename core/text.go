@@ -0,0 +1,179 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/chyroc/lark"
+)
+
+// TextParser renders a docx document as plain text in reading order, meant
+// for search indexing. It runs the block traversal of Parser in plain text
+// mode so that the text and markdown outputs stay consistent: headings
+// become lines, lists keep their markers without nesting, tables become tab
+// separated rows, images are dropped and links are reduced to their anchor
+// text unless keepLinks.
+type TextParser struct {
+	parser *Parser
+}
+
+func NewTextParser(keepLinks bool) *TextParser {
+	parser := NewParser(OutputConfig{})
+	parser.plainText = true
+	parser.keepLinks = keepLinks
+	return &TextParser{parser: parser}
+}
+
+var blankLinesRegexp = regexp.MustCompile(`\n{3,}`)
+
+func (t *TextParser) index(blocks []*lark.DocxBlock) {
+	for _, block := range blocks {
+		t.parser.blockMap[block.BlockID] = block
+	}
+}
+
+func (t *TextParser) ParseDocxContent(doc *lark.DocxDocument, blocks []*lark.DocxBlock) string {
+	t.index(blocks)
+
+	entryBlock := t.parser.blockMap[doc.DocumentID]
+	if entryBlock == nil {
+		return ""
+	}
+	text := t.parser.ParseDocxBlock(entryBlock, 0)
+	text = blankLinesRegexp.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text) + "\n"
+}
+
+func isListBlock(b *lark.DocxBlock) bool {
+	if b == nil {
+		return false
+	}
+	switch b.BlockType {
+	case lark.DocxBlockTypeBullet, lark.DocxBlockTypeOrdered, lark.DocxBlockTypeTodo:
+		return true
+	}
+	return false
+}
+
+// plainChildren separates the children by blank lines, except between the
+// items of the same list.
+func (p *Parser) plainChildren(children []string) string {
+	buf := new(strings.Builder)
+	// blocks without text such as dividers still end the list before them
+	var prev *lark.DocxBlock
+	for _, childId := range children {
+		child := p.blockMap[childId]
+		if child == nil {
+			continue
+		}
+		text := p.ParseDocxBlock(child, 0)
+		if text != "" {
+			if buf.Len() > 0 && !(isListBlock(prev) && isListBlock(child)) {
+				buf.WriteString("\n")
+			}
+			buf.WriteString(text)
+		}
+		prev = child
+	}
+	return buf.String()
+}
+
+// plainGrid puts the columns of a grid one after another.
+func (p *Parser) plainGrid(b *lark.DocxBlock) string {
+	buf := new(strings.Builder)
+	for _, columnId := range b.Children {
+		if column := p.blockMap[columnId]; column != nil {
+			buf.WriteString(p.plainChildren(column.Children))
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String()
+}
+
+func (p *Parser) plainTable(t *lark.DocxBlockTable) string {
+	if t.Property == nil || t.Property.ColumnSize <= 0 {
+		return ""
+	}
+	cellReplacer := strings.NewReplacer("\t", " ", "\n", " ")
+	buf := new(strings.Builder)
+	for i, cellId := range t.Cells {
+		if i > 0 {
+			if int64(i)%t.Property.ColumnSize == 0 {
+				buf.WriteString("\n")
+			} else {
+				buf.WriteString("\t")
+			}
+		}
+		cell := p.blockMap[cellId]
+		if cell == nil {
+			continue
+		}
+		parts := make([]string, 0, len(cell.Children))
+		for _, childId := range cell.Children {
+			if child := p.blockMap[childId]; child != nil {
+				if text := strings.TrimSpace(p.ParseDocxBlock(child, 0)); text != "" {
+					parts = append(parts, cellReplacer.Replace(text))
+				}
+			}
+		}
+		buf.WriteString(strings.Join(parts, " "))
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// headingLevel relies on the heading block types being consecutive.
+func headingLevel(t lark.DocxBlockType) int {
+	return int(t-lark.DocxBlockTypeHeading1) + 1
+}
+
+// plainLine renders a text block as one line of plain text.
+func (p *Parser) plainLine(b *lark.DocxBlockText) string {
+	return strings.TrimRight(p.plainInline(b), " \n") + "\n"
+}
+
+// plainInline renders the elements of a text block without any markup, the
+// links keep their urls only in the text mode with keepLinks.
+func (p *Parser) plainInline(b *lark.DocxBlockText) string {
+	if b == nil {
+		return ""
+	}
+	buf := new(strings.Builder)
+	numElem := len(b.Elements)
+	for i := 0; i < numElem; i++ {
+		e := b.Elements[i]
+		// merge the runs of one hyperlink like ParseDocxBlockText
+		if url := textRunLinkURL(e); url != "" {
+			text := new(strings.Builder)
+			for ; i < numElem && textRunLinkURL(b.Elements[i]) == url; i++ {
+				text.WriteString(b.Elements[i].TextRun.Content)
+			}
+			i--
+			buf.WriteString(p.plainLink(text.String(), url))
+			continue
+		}
+		switch {
+		case e.TextRun != nil:
+			buf.WriteString(e.TextRun.Content)
+		case e.MentionUser != nil:
+			buf.WriteString(e.MentionUser.UserID)
+		case e.MentionDoc != nil:
+			buf.WriteString(p.plainLink(e.MentionDoc.Title, e.MentionDoc.URL))
+		case e.Equation != nil:
+			buf.WriteString(strings.TrimSuffix(e.Equation.Content, "\n"))
+		}
+	}
+	return buf.String()
+}
+
+func (p *Parser) plainLink(text, rawURL string) string {
+	url := utils.UnescapeURL(rawURL)
+	if !p.keepLinks {
+		return text
+	}
+	if text == "" || strings.TrimSpace(text) == url {
+		return url
+	}
+	return text + " (" + url + ")"
+}
@@ -0,0 +1,38 @@
+package core_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDocxText(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepLinks bool
+		golden    string
+	}{
+		{"testdocx.1", false, "testdocx.1.txt"},
+		{"testdocx.3", false, "testdocx.3.txt"},
+		{"testlinks", false, "testlinks.txt"},
+		{"testlinks", true, "testlinks.links.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			doc, blocks := loadTestdocx(t, tt.name)
+			text := core.NewTextParser(tt.keepLinks).ParseDocxContent(doc, blocks)
+
+			goldenPath := path.Join(utils.RootDir(), "testdata", tt.golden)
+			if *updateGolden {
+				assert.NoError(t, os.WriteFile(goldenPath, []byte(text), 0o644))
+			}
+			expected, err := os.ReadFile(goldenPath)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), text)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"time"
+	_ "time/tzdata"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultDateFormat = "2006-01-02 15:04:05"
+
+// Location returns the timezone generated content is rendered in, UTC unless
+// output.timezone is set, so that exports do not depend on the machine.
+func (conf *OutputConfig) Location() (*time.Location, error) {
+	if conf.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(conf.Timezone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid output.timezone %q", conf.Timezone)
+	}
+	return loc, nil
+}
+
+// InLocation converts t to the output timezone, falling back to UTC when the
+// timezone is invalid (which Validate reports beforehand).
+func (conf *OutputConfig) InLocation(t time.Time) time.Time {
+	loc, err := conf.Location()
+	if err != nil {
+		loc = time.UTC
+	}
+	return t.In(loc)
+}
+
+func (conf *OutputConfig) Now() time.Time {
+	return conf.InLocation(time.Now())
+}
+
+// FormatTime renders t with output.date_format in the output timezone.
+func (conf *OutputConfig) FormatTime(t time.Time) string {
+	layout := conf.DateFormat
+	if layout == "" {
+		layout = DefaultDateFormat
+	}
+	return conf.InLocation(t).Format(layout)
+}
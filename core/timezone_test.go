@@ -0,0 +1,68 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		format   string
+		input    time.Time
+		want     string
+	}{
+		{
+			name:  "defaults to utc",
+			input: time.Date(2024, 3, 10, 6, 59, 59, 0, time.FixedZone("CST", 8*3600)),
+			want:  "2024-03-09 22:59:59",
+		},
+		{
+			name:     "before spring forward",
+			timezone: "America/New_York",
+			input:    time.Date(2024, 3, 10, 6, 59, 59, 0, time.UTC),
+			want:     "2024-03-10 01:59:59",
+		},
+		{
+			name:     "after spring forward",
+			timezone: "America/New_York",
+			input:    time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC),
+			want:     "2024-03-10 03:00:00",
+		},
+		{
+			name:     "ambiguous hour after fall back",
+			timezone: "Europe/Berlin",
+			format:   "2006-01-02 15:04 MST",
+			input:    time.Date(2024, 10, 27, 1, 30, 0, 0, time.UTC),
+			want:     "2024-10-27 02:30 CET",
+		},
+		{
+			name:     "ambiguous hour before fall back",
+			timezone: "Europe/Berlin",
+			format:   "2006-01-02 15:04 MST",
+			input:    time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC),
+			want:     "2024-10-27 02:30 CEST",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := core.NewConfig("", "").Output
+			if tt.timezone != "" {
+				config.Timezone = tt.timezone
+			}
+			if tt.format != "" {
+				config.DateFormat = tt.format
+			}
+			assert.NoError(t, config.Validate())
+			assert.Equal(t, tt.want, config.FormatTime(tt.input))
+		})
+	}
+
+	config := core.NewConfig("", "").Output
+	config.Timezone = "Mars/Olympus_Mons"
+	assert.Error(t, config.Validate())
+}
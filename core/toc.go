@@ -0,0 +1,102 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/chyroc/lark"
+)
+
+// DocxBlockTypeTOC is the native table of contents block ("目录"), which the
+// sdk does not declare. Its depth is not part of the block data returned by
+// the api, so every heading of the document is listed.
+const DocxBlockTypeTOC lark.DocxBlockType = 53
+
+type tocHeading struct {
+	level  int
+	text   string
+	anchor string
+}
+
+// HeadingAnchor returns the anchor GitHub and most markdown renderers give a
+// heading: lowercased, punctuation removed and spaces turned into hyphens.
+// Letters of any script are kept.
+func HeadingAnchor(text string) string {
+	buf := new(strings.Builder)
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsNumber(r), r == '-', r == '_':
+			buf.WriteRune(r)
+		case r == ' ':
+			buf.WriteRune('-')
+		}
+	}
+	return buf.String()
+}
+
+// tocHeadings lists the headings of the document in reading order. Repeated
+// anchors get a "-1", "-2" suffix like the renderers do.
+func (p *Parser) tocHeadings() []tocHeading {
+	if p.headings != nil {
+		return p.headings
+	}
+	p.headings = make([]tocHeading, 0)
+	seen := make(map[string]int)
+	var walk func(b *lark.DocxBlock)
+	walk = func(b *lark.DocxBlock) {
+		if b == nil {
+			return
+		}
+		// the title is rendered as the first heading and takes its anchor
+		if b.BlockType == lark.DocxBlockTypePage {
+			seen[HeadingAnchor(p.plainInline(b.Page))] = 0
+		}
+		if b.BlockType >= lark.DocxBlockTypeHeading1 && b.BlockType <= lark.DocxBlockTypeHeading9 {
+			level := headingLevel(b.BlockType)
+			title := strings.TrimSpace(p.plainInline(docxHeadingText(b, level)))
+			anchor := HeadingAnchor(title)
+			if n, ok := seen[anchor]; ok {
+				seen[anchor] = n + 1
+				anchor += "-" + strconv.Itoa(n+1)
+			} else {
+				seen[anchor] = 0
+			}
+			p.headings = append(p.headings, tocHeading{level: level, text: title, anchor: anchor})
+		}
+		for _, childId := range b.Children {
+			walk(p.blockMap[childId])
+		}
+	}
+	walk(p.blockMap[p.documentID])
+	return p.headings
+}
+
+// ParseDocxBlockTOC renders the native table of contents block as a nested
+// list linking to the headings of the document, at the position of the block.
+func (p *Parser) ParseDocxBlockTOC() string {
+	headings := p.tocHeadings()
+	if len(headings) == 0 {
+		return ""
+	}
+	minLevel := headings[0].level
+	for _, h := range headings {
+		if h.level < minLevel {
+			minLevel = h.level
+		}
+	}
+	escaper := strings.NewReplacer("[", "\\[", "]", "\\]")
+	buf := new(strings.Builder)
+	prev := -1
+	for _, h := range headings {
+		// a skipped level nests only one deeper, more would be a code block
+		indent := h.level - minLevel
+		if indent > prev+1 {
+			indent = prev + 1
+		}
+		prev = indent
+		buf.WriteString(strings.Repeat("\t", indent))
+		buf.WriteString("- [" + escaper.Replace(h.text) + "](#" + h.anchor + ")\n")
+	}
+	return buf.String()
+}
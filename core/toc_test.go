@@ -0,0 +1,37 @@
+package core_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Wsine/feishu2md/core"
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDocxBlockTOC(t *testing.T) {
+	doc, blocks := loadTestdocx(t, "testtoc")
+	md := core.NewParser(core.NewConfig("", "").Output).ParseDocxContent(doc, blocks)
+
+	goldenPath := path.Join(utils.RootDir(), "testdata", "testtoc.md")
+	if *updateGolden {
+		assert.NoError(t, os.WriteFile(goldenPath, []byte(md), 0o644))
+	}
+	expected, err := os.ReadFile(goldenPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), md)
+}
+
+func TestHeadingAnchor(t *testing.T) {
+	tests := map[string]string{
+		"Overview":           "overview",
+		"Setup & Install":    "setup--install",
+		"Advanced [beta]":    "advanced-beta",
+		"常见问题":               "常见问题",
+		" snake_case title ": "snake_case-title",
+	}
+	for text, anchor := range tests {
+		assert.Equal(t, anchor, core.HeadingAnchor(text), text)
+	}
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "os"
+
+// NewSyncerWithFsync replaces the fsync of the syncer, to count the calls or
+// emulate a slow network filesystem.
+func NewSyncerWithFsync(policy string, fsync func(*os.File) error) *Syncer {
+	s, err := NewSyncer(policy)
+	if err != nil {
+		panic(err)
+	}
+	if s != nil {
+		s.fsync = fsync
+	}
+	return s
+}
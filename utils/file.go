@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	LinkHard    = "hardlink"
+	LinkReflink = "reflink"
+)
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// into place. Readers never observe a partial file, and an existing hard link
+// at path is replaced instead of being written through.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return WriteReaderAtomic(path, bytes.NewReader(data), perm)
+}
+
+// WriteReaderAtomic is WriteFileAtomic for streamed content.
+func WriteReaderAtomic(path string, r io.Reader, perm os.FileMode) error {
+	return writeReaderAtomic(path, r, perm, nil)
+}
+
+// writeReaderAtomic flushes the temporary file with fsync before renaming it
+// into place unless fsync is nil.
+func writeReaderAtomic(path string, r io.Reader, perm os.FileMode, fsync func(*os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".feishu2md-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if fsync != nil {
+		if err := fsync(tmp); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func fileHash(path string) ([]byte, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, 0, err
+	}
+	return h.Sum(nil), n, nil
+}
+
+// SameContent reports whether the file at path holds exactly data.
+func SameContent(path string, data []byte) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != int64(len(data)) {
+		return false
+	}
+	sum, _, err := fileHash(path)
+	if err != nil {
+		return false
+	}
+	want := sha256.Sum256(data)
+	return bytes.Equal(sum, want[:])
+}
+
+// SameFiles reports whether the two regular files have identical content.
+func SameFiles(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil || !ia.Mode().IsRegular() {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil || !ib.Mode().IsRegular() || ia.Size() != ib.Size() {
+		return false
+	}
+	if os.SameFile(ia, ib) {
+		return true
+	}
+	sa, _, err := fileHash(a)
+	if err != nil {
+		return false
+	}
+	sb, _, err := fileHash(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(sa, sb)
+}
+
+// LinkFile replaces dest with a hard link to src, or a reflink when hard links
+// are not possible. It returns the method used; on error dest is untouched.
+func LinkFile(src, dest string) (string, error) {
+	tmp := dest + ".feishu2md-link"
+	os.Remove(tmp)
+	method := LinkHard
+	if err := os.Link(src, tmp); err != nil {
+		if rerr := reflink(src, tmp); rerr != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		method = LinkReflink
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return method, nil
+}
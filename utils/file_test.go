@@ -0,0 +1,85 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wsine/feishu2md/utils"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	ref := filepath.Join(dir, "ref.md")
+	dest := filepath.Join(dir, "dest.md")
+	if err := os.WriteFile(ref, []byte("shared"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(ref, dest); err != nil {
+		t.Skip("hard links are not supported:", err)
+	}
+
+	// 覆盖硬链接时不能修改被链接的文件
+	if err := utils.WriteFileAtomic(dest, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(ref); string(data) != "shared" {
+		t.Errorf("reference file was modified: %q", data)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "changed" {
+		t.Errorf("dest = %q, want %q", data, "changed")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("temporary files were left behind: %v", entries)
+	}
+}
+
+func TestSameContent(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	c := filepath.Join(dir, "c")
+	os.WriteFile(a, []byte("hello"), 0o644)
+	os.WriteFile(b, []byte("hello"), 0o644)
+	os.WriteFile(c, []byte("world"), 0o644)
+
+	if !utils.SameContent(a, []byte("hello")) {
+		t.Error("SameContent(a, hello) = false")
+	}
+	if utils.SameContent(a, []byte("hello!")) {
+		t.Error("SameContent(a, hello!) = true")
+	}
+	if utils.SameContent(filepath.Join(dir, "missing"), nil) {
+		t.Error("SameContent(missing) = true")
+	}
+	if !utils.SameFiles(a, b) {
+		t.Error("SameFiles(a, b) = false")
+	}
+	if utils.SameFiles(a, c) {
+		t.Error("SameFiles(a, c) = true")
+	}
+}
+
+func TestLinkFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.png")
+	dest := filepath.Join(dir, "dest.png")
+	os.WriteFile(src, []byte("image"), 0o644)
+	os.WriteFile(dest, []byte("image"), 0o644)
+
+	method, err := utils.LinkFile(src, dest)
+	if err != nil {
+		t.Skip("linking is not supported:", err)
+	}
+	if method != utils.LinkHard && method != utils.LinkReflink {
+		t.Errorf("unexpected link method %q", method)
+	}
+	si, _ := os.Stat(src)
+	di, _ := os.Stat(dest)
+	if method == utils.LinkHard && !os.SameFile(si, di) {
+		t.Error("dest is not a hard link of src")
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "image" {
+		t.Errorf("dest = %q", data)
+	}
+}
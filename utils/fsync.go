@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FsyncAlways flushes every file and its directory before the write returns.
+	FsyncAlways = "always"
+	// FsyncBatch leaves written files to the page cache and flushes them
+	// together per directory, once fsyncBatchSize files are pending or on Flush.
+	FsyncBatch = "batch"
+	// FsyncNever leaves flushing to the operating system.
+	FsyncNever = "never"
+)
+
+// fsyncBatchSize bounds the unflushed files of one directory under the batch
+// policy, so a crash loses at most this many files per directory.
+const fsyncBatchSize = 64
+
+// fsyncParallelism is how many files of a directory are flushed at once,
+// overlapping the round trips of a network filesystem.
+const fsyncParallelism = 8
+
+// Syncer writes files atomically and flushes them to stable storage according
+// to its policy. A nil Syncer never flushes, like WriteFileAtomic.
+type Syncer struct {
+	policy  string
+	fsync   func(*os.File) error
+	mu      sync.Mutex
+	pending map[string][]string // directory -> files written since its last flush
+}
+
+// NewSyncer returns nil for the never policy.
+func NewSyncer(policy string) (*Syncer, error) {
+	switch policy {
+	case "", FsyncNever:
+		return nil, nil
+	case FsyncAlways, FsyncBatch:
+		return &Syncer{policy: policy, fsync: (*os.File).Sync, pending: make(map[string][]string)}, nil
+	}
+	return nil, errors.Errorf("invalid fsync policy %q, expect %q, %q or %q",
+		policy, FsyncAlways, FsyncBatch, FsyncNever)
+}
+
+func (s *Syncer) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return s.WriteReader(path, bytes.NewReader(data), perm)
+}
+
+func (s *Syncer) WriteReader(path string, r io.Reader, perm os.FileMode) error {
+	if s == nil {
+		return WriteReaderAtomic(path, r, perm)
+	}
+	if s.policy == FsyncAlways {
+		if err := writeReaderAtomic(path, r, perm, s.fsync); err != nil {
+			return err
+		}
+		return s.syncDir(filepath.Dir(path))
+	}
+	if err := WriteReaderAtomic(path, r, perm); err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	s.mu.Lock()
+	s.pending[dir] = append(s.pending[dir], path)
+	var files []string
+	if len(s.pending[dir]) >= fsyncBatchSize {
+		files = s.pending[dir]
+		delete(s.pending, dir)
+	}
+	s.mu.Unlock()
+	if files == nil {
+		return nil
+	}
+	return s.flushDir(dir, files)
+}
+
+// Flush flushes every file pending under the batch policy.
+func (s *Syncer) Flush() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[string][]string)
+	s.mu.Unlock()
+	dirs := make([]string, 0, len(pending))
+	for dir := range pending {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := s.flushDir(dir, pending[dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushDir flushes each file once, even if it was rewritten, then the
+// directory holding their names. Files removed since are skipped.
+func (s *Syncer) flushDir(dir string, files []string) error {
+	seen := make(map[string]bool, len(files))
+	paths := make(chan string)
+	errs := make(chan error, fsyncParallelism)
+	var wg sync.WaitGroup
+	for i := 0; i < fsyncParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var failed error
+			for path := range paths {
+				if err := s.syncPath(path); err != nil && !os.IsNotExist(err) && failed == nil {
+					failed = err
+				}
+			}
+			errs <- failed
+		}()
+	}
+	for _, path := range files {
+		if !seen[path] {
+			seen[path] = true
+			paths <- path
+		}
+	}
+	close(paths)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return s.syncDir(dir)
+}
+
+func (s *Syncer) syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.fsync(f)
+}
+
+// syncDir persists the renames in dir. Windows can not flush a directory.
+func (s *Syncer) syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	if err := s.syncPath(dir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// WriteFileDurable is WriteFileAtomic flushed under the always policy, for
+// the files a later run relies on whatever the configured policy is.
+func WriteFileDurable(path string, data []byte, perm os.FileMode) error {
+	s, _ := NewSyncer(FsyncAlways)
+	return s.WriteFile(path, data, perm)
+}
@@ -0,0 +1,139 @@
+package utils_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Wsine/feishu2md/utils"
+)
+
+// countingFsync counts the flushed files and directories.
+type countingFsync struct {
+	files, dirs int32
+}
+
+func (c *countingFsync) fsync(f *os.File) error {
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		atomic.AddInt32(&c.dirs, 1)
+	} else {
+		atomic.AddInt32(&c.files, 1)
+	}
+	return nil
+}
+
+func TestNewSyncer(t *testing.T) {
+	for _, policy := range []string{"", utils.FsyncNever} {
+		if s, err := utils.NewSyncer(policy); s != nil || err != nil {
+			t.Errorf("expected a nil syncer for %q, got %v, %v", policy, s, err)
+		}
+	}
+	if _, err := utils.NewSyncer("sometimes"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestSyncerPolicies(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directories are not flushed on windows")
+	}
+	tests := []struct {
+		policy                string
+		files, dirs           int32 // after the writes
+		flushFiles, flushDirs int32 // after Flush
+	}{
+		// 每次写入都刷盘文件和所在目录
+		{utils.FsyncAlways, 4, 4, 4, 4},
+		// 写入时不刷盘，Flush 时每个文件和目录只刷一次
+		{utils.FsyncBatch, 0, 0, 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			dir := t.TempDir()
+			sub := filepath.Join(dir, "sub")
+			if err := os.Mkdir(sub, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			counter := &countingFsync{}
+			s := utils.NewSyncerWithFsync(tt.policy, counter.fsync)
+			for _, path := range []string{
+				filepath.Join(dir, "a.md"),
+				filepath.Join(dir, "b.md"),
+				filepath.Join(dir, "a.md"),
+				filepath.Join(sub, "c.png"),
+			} {
+				if err := s.WriteFile(path, []byte(path), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if counter.files != tt.files || counter.dirs != tt.dirs {
+				t.Errorf("expected %d files and %d dirs flushed on write, got %d and %d",
+					tt.files, tt.dirs, counter.files, counter.dirs)
+			}
+			if err := s.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if counter.files != tt.flushFiles || counter.dirs != tt.flushDirs {
+				t.Errorf("expected %d files and %d dirs flushed in total, got %d and %d",
+					tt.flushFiles, tt.flushDirs, counter.files, counter.dirs)
+			}
+			if data, _ := os.ReadFile(filepath.Join(sub, "c.png")); string(data) != filepath.Join(sub, "c.png") {
+				t.Errorf("unexpected content %q", data)
+			}
+		})
+	}
+}
+
+func TestSyncerBatchSkipsRemovedFiles(t *testing.T) {
+	dir := t.TempDir()
+	s := utils.NewSyncerWithFsync(utils.FsyncBatch, (*os.File).Sync)
+	path := filepath.Join(dir, "gone.md")
+	if err := s.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Errorf("expected removed files to be skipped, got %v", err)
+	}
+}
+
+// BenchmarkSyncerSlowFilesystem exports 4 directories of 32 small files onto
+// a filesystem whose fsync takes a network round trip.
+func BenchmarkSyncerSlowFilesystem(b *testing.B) {
+	slowFsync := func(*os.File) error {
+		time.Sleep(500 * time.Microsecond)
+		return nil
+	}
+	data := make([]byte, 4<<10)
+	for _, policy := range []string{utils.FsyncAlways, utils.FsyncBatch, utils.FsyncNever} {
+		b.Run(policy, func(b *testing.B) {
+			root := b.TempDir()
+			for d := 0; d < 4; d++ {
+				if err := os.Mkdir(filepath.Join(root, fmt.Sprint(d)), 0o755); err != nil {
+					b.Fatal(err)
+				}
+			}
+			s := utils.NewSyncerWithFsync(policy, slowFsync)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for d := 0; d < 4; d++ {
+					for f := 0; f < 32; f++ {
+						path := filepath.Join(root, fmt.Sprint(d), fmt.Sprintf("%d.md", f))
+						if err := s.WriteFile(path, data, 0o644); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+				if err := s.Flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+)
+
+// ImageSize decodes the dimensions of a png, jpeg or gif image without
+// decoding the pixels.
+func ImageSize(r io.Reader) (int64, int64, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(cfg.Width), int64(cfg.Height), nil
+}
+
+// ImageFileSize is ImageSize for the image file at path.
+func ImageFileSize(path string) (int64, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return ImageSize(f)
+}
@@ -0,0 +1,28 @@
+package utils_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/Wsine/feishu2md/utils"
+)
+
+func TestImageSize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 32, 18))); err != nil {
+		t.Fatal(err)
+	}
+	width, height, err := utils.ImageSize(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != 32 || height != 18 {
+		t.Errorf("ImageSize = %dx%d, want 32x18", width, height)
+	}
+
+	if _, _, err := utils.ImageSize(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Error("expected an error for invalid image data")
+	}
+}
@@ -0,0 +1,46 @@
+package utils
+
+import "bytes"
+
+// Newline policies of the generated text files.
+const (
+	NewlineLF   = "lf"
+	NewlineCRLF = "crlf"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// NormalizeText rewrites every line ending of data, whether "\r\n", "\r" or
+// "\n", to the newline policy and removes a leading byte order mark, adding
+// one back when bom is set. Normalizing twice gives the same bytes.
+func NormalizeText(data []byte, newline string, bom bool) []byte {
+	data = TrimBOM(data)
+	out := make([]byte, 0, len(data)+len(utf8BOM)+bytes.Count(data, []byte("\n")))
+	if bom {
+		out = append(out, utf8BOM...)
+	}
+	eol := []byte("\n")
+	if newline == NewlineCRLF {
+		eol = []byte("\r\n")
+	}
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '\r':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				i++
+			}
+			out = append(out, eol...)
+		case '\n':
+			out = append(out, eol...)
+		default:
+			out = append(out, data[i])
+		}
+	}
+	return out
+}
+
+// TrimBOM removes a leading UTF-8 byte order mark, which encoding/json
+// rejects.
+func TrimBOM(data []byte) []byte {
+	return bytes.TrimPrefix(data, utf8BOM)
+}
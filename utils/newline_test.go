@@ -0,0 +1,31 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/Wsine/feishu2md/utils"
+)
+
+func TestNormalizeText(t *testing.T) {
+	input := "\xEF\xBB\xBF# Title\r\n\r\nmixed\rendings\n"
+	tests := []struct {
+		newline string
+		bom     bool
+		want    string
+	}{
+		{utils.NewlineLF, false, "# Title\n\nmixed\nendings\n"},
+		{utils.NewlineCRLF, false, "# Title\r\n\r\nmixed\r\nendings\r\n"},
+		{utils.NewlineLF, true, "\xEF\xBB\xBF# Title\n\nmixed\nendings\n"},
+		{utils.NewlineCRLF, true, "\xEF\xBB\xBF# Title\r\n\r\nmixed\r\nendings\r\n"},
+	}
+	for _, tt := range tests {
+		got := utils.NormalizeText([]byte(input), tt.newline, tt.bom)
+		if string(got) != tt.want {
+			t.Errorf("NormalizeText(%s, bom=%v) = %q, want %q", tt.newline, tt.bom, got, tt.want)
+		}
+		// 重复处理结果不变
+		if again := utils.NormalizeText(got, tt.newline, tt.bom); string(again) != tt.want {
+			t.Errorf("NormalizeText is not idempotent for %s, bom=%v: %q", tt.newline, tt.bom, again)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+type patchHunk struct {
+	oldStart int
+	oldLines []string // context and removed lines
+	newLines []string // context and added lines
+	oldLeft  int      // lines of the old and new side still expected
+	newLeft  int
+}
+
+// ApplyPatch applies a unified diff of a single file, as written by diff -u
+// or git diff, to text with "\n" line endings. A hunk whose context moved is
+// looked up around its recorded line; a hunk whose context is gone makes
+// the patch fail and nothing is applied.
+func ApplyPatch(text, patch string) (string, error) {
+	hunks, err := parsePatch(patch)
+	if err != nil {
+		return "", err
+	}
+	trailingNewline := strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+
+	var out []string
+	pos := 0
+	offset := 0
+	for i, hunk := range hunks {
+		at := findHunk(lines, hunk.oldLines, hunk.oldStart-1+offset, pos)
+		if at < 0 {
+			return "", errors.Errorf("hunk #%d at line %d does not apply", i+1, hunk.oldStart)
+		}
+		offset = at - (hunk.oldStart - 1)
+		out = append(out, lines[pos:at]...)
+		out = append(out, hunk.newLines...)
+		pos = at + len(hunk.oldLines)
+	}
+	out = append(out, lines[pos:]...)
+
+	result := strings.Join(out, "\n")
+	if trailingNewline && len(out) > 0 {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// findHunk returns the line where want starts, nearest to the expected line
+// and not before min, or -1.
+func findHunk(lines, want []string, expected, min int) int {
+	matches := func(at int) bool {
+		if at < min || at+len(want) > len(lines) {
+			return false
+		}
+		for i, line := range want {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+	if expected < min {
+		expected = min
+	}
+	for delta := 0; expected-delta >= min || expected+delta <= len(lines); delta++ {
+		if matches(expected - delta) {
+			return expected - delta
+		}
+		if matches(expected + delta) {
+			return expected + delta
+		}
+	}
+	return -1
+}
+
+func parsePatch(patch string) ([]*patchHunk, error) {
+	var hunks []*patchHunk
+	var hunk *patchHunk
+	files := 0
+	for _, line := range strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n") {
+		if hunk != nil && hunk.open() {
+			switch {
+			case strings.HasPrefix(line, " ") || line == "":
+				hunk.add(strings.TrimPrefix(line, " "), true, true)
+			case strings.HasPrefix(line, "-"):
+				hunk.add(line[1:], true, false)
+			case strings.HasPrefix(line, "+"):
+				hunk.add(line[1:], false, true)
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+			default:
+				return nil, errors.Errorf("invalid patch line %q", line)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "--- ") {
+			if files++; files > 1 {
+				return nil, errors.New("the patch changes more than one file")
+			}
+			continue
+		}
+		if m := hunkHeader.FindStringSubmatch(line); m != nil {
+			hunk = &patchHunk{oldStart: atoi(m[1], 0), oldLeft: atoi(m[2], 1), newLeft: atoi(m[4], 1)}
+			if hunk.oldStart == 0 {
+				// a hunk adding to an empty file starts at line 0
+				hunk.oldStart = 1
+			}
+			hunks = append(hunks, hunk)
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, errors.New("the patch has no hunks")
+	}
+	if hunk.open() {
+		return nil, errors.Errorf("hunk #%d of the patch is truncated", len(hunks))
+	}
+	return hunks, nil
+}
+
+func atoi(s string, empty int) int {
+	if s == "" {
+		return empty
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// open reports whether the hunk expects more lines. The counts of the hunk
+// header tell where it ends, an empty context line looks the same as the
+// blank line after the patch.
+func (h *patchHunk) open() bool {
+	return h.oldLeft > 0 || h.newLeft > 0
+}
+
+func (h *patchHunk) add(line string, old, new bool) {
+	if old {
+		h.oldLines = append(h.oldLines, line)
+		h.oldLeft--
+	}
+	if new {
+		h.newLines = append(h.newLines, line)
+		h.newLeft--
+	}
+}
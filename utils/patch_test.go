@@ -0,0 +1,60 @@
+package utils_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Wsine/feishu2md/utils"
+)
+
+const patchOriginal = "# Title\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\nfooter\n"
+
+const tablePatch = `--- a/Title.md
++++ b/Title.md
+@@ -3,3 +3,3 @@
+ | a | b |
+ |---|---|
+-| 1 | 2 |
++| 1 | 3 |
+@@ -6,2 +6,3 @@
+ 
+ footer
++fixed by hand
+`
+
+func TestApplyPatch(t *testing.T) {
+	got, err := utils.ApplyPatch(patchOriginal, tablePatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Title\n\n| a | b |\n|---|---|\n| 1 | 3 |\n\nfooter\nfixed by hand\n"
+	if got != want {
+		t.Errorf("ApplyPatch() = %q, want %q", got, want)
+	}
+
+	// 上方插入了内容，按上下文找到移动后的位置
+	moved := "# Title\n\nnew paragraph\n\n" + strings.TrimPrefix(patchOriginal, "# Title\n\n")
+	got, err = utils.ApplyPatch(moved, tablePatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "| 1 | 3 |") || !strings.HasSuffix(got, "footer\nfixed by hand\n") {
+		t.Errorf("expected the moved hunks to apply, got %q", got)
+	}
+}
+
+func TestApplyPatchFails(t *testing.T) {
+	changed := strings.Replace(patchOriginal, "| 1 | 2 |", "| 1 | 5 |", 1)
+	if _, err := utils.ApplyPatch(changed, tablePatch); err == nil || !strings.Contains(err.Error(), "hunk #1") {
+		t.Errorf("expected hunk #1 to fail, got %v", err)
+	}
+	for _, patch := range []string{
+		"not a patch\n",
+		tablePatch + "--- a/Other.md\n+++ b/Other.md\n@@ -1 +1 @@\n-x\n+y\n",
+		"@@ -1,3 +1,3 @@\n # Title\n",
+	} {
+		if _, err := utils.ApplyPatch(patchOriginal, patch); err == nil {
+			t.Errorf("expected an error for %q", patch)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxPathBytes is the default limit on the byte length of the
+// generated paths. Windows counts MAX_PATH in UTF-16 units of the absolute
+// path, so a lower value leaves room for the working directory.
+func DefaultMaxPathBytes() int {
+	if runtime.GOOS == "windows" {
+		return 200
+	}
+	return 240
+}
+
+// TruncateName shortens a file or folder name to at most maxBytes, cutting on
+// a rune boundary and appending "~" with the tail of token so that names
+// sharing a long prefix stay unique. Names within the limit are unchanged.
+func TruncateName(name string, maxBytes int, token string) string {
+	if len(name) <= maxBytes {
+		return name
+	}
+	if len(token) > 6 {
+		token = token[len(token)-6:]
+	}
+	suffix := "~" + token
+	if maxBytes <= len(suffix) {
+		return suffix[len(suffix)-maxBytes:]
+	}
+	prefix := name
+	for len(prefix)+len(suffix) > maxBytes {
+		_, size := utf8.DecodeLastRuneInString(prefix)
+		prefix = prefix[:len(prefix)-size]
+	}
+	// Windows does not allow names ending with a space or a dot
+	prefix = strings.TrimRight(prefix, " .")
+	return prefix + suffix
+}
@@ -0,0 +1,23 @@
+package utils_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Wsine/feishu2md/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateName(t *testing.T) {
+	assert.Equal(t, "short", utils.TruncateName("short", 10, "wikcnABCDEF"))
+	assert.Equal(t, "abcd~ABCDEF", utils.TruncateName("abcdefghijkl", 11, "wikcnABCDEF"))
+	// 不截断半个汉字，并去掉末尾的空格
+	assert.Equal(t, "飞书~ABCDEF", utils.TruncateName("飞书文档 导出", 14, "wikcnABCDEF"))
+	assert.Equal(t, "飞书~ABCDEF", utils.TruncateName("飞书 文档导出", 15, "wikcnABCDEF"))
+
+	title := strings.Repeat("知", 60)
+	a := utils.TruncateName(title, 40, "nodeAAAAAA")
+	b := utils.TruncateName(title, 40, "nodeBBBBBB")
+	assert.LessOrEqual(t, len(a), 40)
+	assert.NotEqual(t, a, b)
+}
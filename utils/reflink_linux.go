@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink clones src into a new file dst sharing the same extents, which is
+// supported by copy-on-write filesystems such as btrfs and xfs.
+func reflink(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
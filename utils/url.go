@@ -14,8 +14,27 @@ func UnescapeURL(rawURL string) string {
 	return rawURL
 }
 
+// EscapeURLForMarkdown percent-encodes the characters that would break the
+// link destination of a markdown link, such as parentheses, spaces and
+// non-ascii characters. Existing escapes are kept as is.
+func EscapeURLForMarkdown(rawURL string) string {
+	const hex = "0123456789ABCDEF"
+	buf := make([]byte, 0, len(rawURL))
+	for i := 0; i < len(rawURL); i++ {
+		c := rawURL[i]
+		switch {
+		case c >= 0x80, c <= 0x20, c == 0x7f,
+			c == '(', c == ')', c == '<', c == '>', c == '"', c == '`', c == '\\':
+			buf = append(buf, '%', hex[c>>4], hex[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
+
 func ValidateDocumentURL(url string) (string, string, error) {
-	reg := regexp.MustCompile("^https://[\\w-.]+/(docs|docx|wiki)/([a-zA-Z0-9]+)")
+	reg := regexp.MustCompile("^https://[\\w-.]+/(docs|docx|wiki|sheets|base)/([a-zA-Z0-9]+)")
 	matchResult := reg.FindStringSubmatch(url)
 	if matchResult == nil || len(matchResult) != 3 {
 		return "", "", errors.Errorf("Invalid feishu/larksuite document URL pattern")
@@ -61,6 +61,16 @@ func TestValidateDownloadURL(t *testing.T) {
 			url:   "https://sample.f.mioffice.cn/docx/doccnByZP6puODElAYySJkPIfUb",
 			noErr: true,
 		},
+		{
+			name:  "validate sheet url success",
+			url:   "https://sample.feishu.cn/sheets/shtcnByZP6puODElAYySJkPIfUb",
+			noErr: true,
+		},
+		{
+			name:  "validate bitable url success",
+			url:   "https://sample.feishu.cn/base/bascnByZP6puODElAYySJkPIfUb",
+			noErr: true,
+		},
 		{
 			name:  "validate arbitrary url failed",
 			url:   "https://google.com",
@@ -121,3 +131,39 @@ func TestValidWikiURL(t *testing.T) {
 		})
 	}
 }
+
+func TestEscapeURLForMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		rawURL string
+		want   string
+	}{
+		{
+			name:   "plain url is kept",
+			rawURL: "https://example.com/a?b=1&c=2#frag",
+			want:   "https://example.com/a?b=1&c=2#frag",
+		},
+		{
+			name:   "parentheses are escaped",
+			rawURL: "https://en.wikipedia.org/wiki/Go_(programming_language)",
+			want:   "https://en.wikipedia.org/wiki/Go_%28programming_language%29",
+		},
+		{
+			name:   "cjk and spaces are escaped",
+			rawURL: "https://www.feishu.cn/搜索 页面",
+			want:   "https://www.feishu.cn/%E6%90%9C%E7%B4%A2%20%E9%A1%B5%E9%9D%A2",
+		},
+		{
+			name:   "existing escapes are kept",
+			rawURL: "https://example.com/%E6%90%9C",
+			want:   "https://example.com/%E6%90%9C",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EscapeURLForMarkdown(tt.rawURL); got != tt.want {
+				t.Errorf("URL = %v\nGot = %v\nExpected = %v", tt.rawURL, got, tt.want)
+			}
+		})
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"strings"
 
 	"github.com/88250/lute"
 	"github.com/Wsine/feishu2md/core"
@@ -59,13 +58,30 @@ func downloadHandler(c *gin.Context) {
 		return
 	}
 
-	docx, blocks, err := client.GetDocxContent(ctx, docToken)
-	if err != nil {
-		c.String(http.StatusInternalServerError, "Internal error: client.GetDocxContent")
-		log.Panicf("error: %s", err)
-		return
+	switch docType {
+	case "sheets", "sheet", "base", "bitable":
+		// spreadsheets and bitables are rendered as markdown tables
+		var sheet *core.Spreadsheet
+		if docType == "base" || docType == "bitable" {
+			sheet, err = client.GetBitableRecords(ctx, docToken)
+		} else {
+			sheet, err = client.GetSheetContent(ctx, docToken)
+		}
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Internal error: client.GetSheetContent")
+			log.Panicf("error: %s", err)
+			return
+		}
+		markdown = core.RenderSheetMarkdown(sheet)
+	default:
+		docx, blocks, err := client.GetDocxContent(ctx, docToken)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Internal error: client.GetDocxContent")
+			log.Panicf("error: %s", err)
+			return
+		}
+		markdown = parser.ParseDocxContent(docx, blocks)
 	}
-	markdown = parser.ParseDocxContent(docx, blocks)
 
 	zipBuffer := new(bytes.Buffer)
 	writer := zip.NewWriter(zipBuffer)
@@ -76,7 +92,11 @@ func downloadHandler(c *gin.Context) {
 			log.Panicf("error: %s", err)
 			return
 		}
-		markdown = strings.Replace(markdown, imgToken, localLink, 1)
+		var width, height int64
+		if parser.NeedsImageSize(imgToken) {
+			width, height, _ = utils.ImageSize(bytes.NewReader(rawImage))
+		}
+		markdown = parser.ResolveImage(markdown, imgToken, localLink, width, height)
 		f, err := writer.Create(localLink)
 		if err != nil {
 			c.String(http.StatusInternalServerError, "Internal error: zipWriter.Create")
@@ -94,7 +114,12 @@ func downloadHandler(c *gin.Context) {
 	engine := lute.New(func(l *lute.Lute) {
 		l.RenderOptions.AutoSpace = true
 	})
-	result := engine.FormatStr("md", markdown)
+	result, err := core.FormatMarkdown(engine, markdown)
+	if err != nil {
+		// 格式化失败时返回未格式化的内容
+		log.Printf("warning: %s: %v", docToken, err)
+	}
+	result = parser.RestoreCodeFenceAttrs(result)
 
 	// Set response
 	if len(parser.ImgTokens) > 0 {